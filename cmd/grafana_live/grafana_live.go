@@ -10,8 +10,10 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/AarC10/GSW-V2/lib/db"
+	"github.com/AarC10/GSW-V2/lib/ipc"
 	"github.com/gorilla/websocket"
 
 	"github.com/AarC10/GSW-V2/lib/tlm"
@@ -23,9 +25,10 @@ import (
 var shmDir = flag.String("shm", "/dev/shm", "directory to use for shared memory")
 var configFilepath = flag.String("c", "grafana_live", "name of config file")
 
-// streamTelemetryPacket streams telemetry packet data to Grafana Live as it is received on the channel.
-func streamTelemetryPacket(packet tlm.TelemetryPacket, config *viper.Viper, authToken string, websocketConn *websocket.Conn) {
-	reader, err := proc.NewIpcShmReaderForPacket(packet, *shmDir)
+// streamTelemetryPacket streams the engineering values of a packet sent by a vehicle to Grafana Live as gsw_service publishes them.
+// If the GSW service restarts, streaming resumes with the packet's definition from its new telemetry config.
+func streamTelemetryPacket(packet tlm.TelemetryPacket, vehicle string, config *viper.Viper, authToken string, websocketConn *websocket.Conn) {
+	reader, err := proc.NewValueReader(packet, vehicle, ipc.ReadLatest, *shmDir)
 	if err != nil {
 		fmt.Printf("Error creating reader: %v\n", err)
 		return
@@ -35,24 +38,37 @@ func streamTelemetryPacket(packet tlm.TelemetryPacket, config *viper.Viper, auth
 	// read config values
 	grafanaChannelPath := config.GetString("channel_path")
 
-	// set up MeasurementGroup
-	measurements := make([]db.Measurement, len(packet.Measurements))
-	measurementGroup := db.MeasurementGroup{DatabaseName: grafanaChannelPath, Measurements: measurements}
-	for i, measurementName := range packet.Measurements {
-		measurements[i].Name = measurementName
+	var measurementGroup db.MeasurementGroup
+	setup := func(packet tlm.TelemetryPacket) {
+		measurements := make([]db.Measurement, len(packet.Measurements))
+		measurementGroup = db.MeasurementGroup{DatabaseName: grafanaChannelPath, Measurements: measurements}
+		if vehicle != "" {
+			measurementGroup.Tags = []db.Tag{{Key: proc.VehicleTag, Value: vehicle}}
+		}
+		for i, measurementName := range packet.Measurements {
+			measurements[i].Name = measurementName
+		}
 	}
+	setup(packet)
+
+	reader.SetStateHandler(func(state proc.ReaderState, packet tlm.TelemetryPacket) {
+		if state == proc.ReaderWriterDown {
+			fmt.Println("GSW service is down, waiting for it to restart to stream packet " + packet.Name + ".")
+			return
+		}
+		fmt.Println("GSW service restarted, resuming streaming for packet " + packet.Name + ".")
+		setup(packet)
+	})
 
 	// stream data over WebSocket
 	if websocketConn != nil {
 		for {
-			p, err := reader.Read(context.TODO())
+			message, err := reader.Read(context.TODO())
 			if err != nil {
 				fmt.Printf("Error reading packet: %v\n", err)
 				continue
 			}
-			packetData := p.Data()
-
-			proc.UpdateMeasurementGroup(packet, measurementGroup, packetData)
+			updateMeasurementGroup(&measurementGroup, message)
 			query := []byte(db.CreateQuery(measurementGroup))
 			err = websocketConn.WriteMessage(websocket.BinaryMessage, query)
 			if err != nil {
@@ -71,14 +87,12 @@ func streamTelemetryPacket(packet tlm.TelemetryPacket, config *viper.Viper, auth
 	if config.GetBool("use_http") {
 		liveAddr := config.GetString("http_addr")
 		for {
-			p, err := reader.Read(context.TODO())
+			message, err := reader.Read(context.TODO())
 			if err != nil {
 				fmt.Printf("Error reading packet: %v\n", err)
 				continue
 			}
-			packetData := p.Data()
-
-			proc.UpdateMeasurementGroup(packet, measurementGroup, packetData)
+			updateMeasurementGroup(&measurementGroup, message)
 			query := db.CreateQuery(measurementGroup)
 			if err := sendQuery(query, liveAddr, authToken); err != nil {
 				fmt.Printf("Error streaming data: %v\n", err)
@@ -90,6 +104,16 @@ func streamTelemetryPacket(packet tlm.TelemetryPacket, config *viper.Viper, auth
 	}
 }
 
+// updateMeasurementGroup sets the measurements of a group to the engineering values read.
+func updateMeasurementGroup(measurementGroup *db.MeasurementGroup, message *proc.ValueMessage) {
+	measurementGroup.Timestamp = time.Now().UnixNano()
+	for i := range measurementGroup.Measurements {
+		if i < len(message.Values) {
+			measurementGroup.Measurements[i].Value = message.Values[i].String()
+		}
+	}
+}
+
 // sendQuery sends the query string containing telemetry data to Grafana Live over HTTP.
 func sendQuery(query string, liveAddr string, authToken string) error {
 	// Convert the query string to bytes
@@ -180,6 +204,7 @@ func setupWebSocket(config *viper.Viper, authToken string) (*websocket.Conn, err
 }
 
 func main() {
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with gsw_service: shm or socket")
 	flag.Parse()
 	err := godotenv.Load()
 	if err != nil {
@@ -206,7 +231,9 @@ func main() {
 
 	for _, packet := range proc.GswConfig.TelemetryPackets {
 		fmt.Println("Starting streaming for packet " + packet.Name)
-		go streamTelemetryPacket(packet, liveConfig, authToken, websocketConn)
+		for _, vehicle := range proc.ShmVehicles() {
+			go streamTelemetryPacket(packet, vehicle, liveConfig, authToken, websocketConn)
+		}
 	}
 
 	// Catch interrupt signals
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
@@ -11,6 +13,7 @@ import (
 	"sync"
 	"syscall"
 
+	"github.com/AarC10/GSW-V2/lib/archive"
 	"github.com/AarC10/GSW-V2/lib/db"
 	"github.com/AarC10/GSW-V2/lib/logger"
 	"github.com/AarC10/GSW-V2/lib/tlm"
@@ -30,9 +33,15 @@ type resolvedDBConfig struct {
 var (
 	shmDir         = flag.String("shm", "/dev/shm", "directory to use for shared memory")
 	configFilepath = flag.String("c", "gsw_service", "name of config file")
-	doPprof        = flag.Int("p", 0, "Port to run pprof server on. Leave empty or set to 0 to disable pprof server")
+	doPprof        = flag.Int("p", 0, "Port to run the pprof and /metrics server on. Leave empty or set to 0 to disable the server")
 )
 
+// dbQueueSize is how many received packets of each telemetry packet can wait for the database writer before being dropped.
+const dbQueueSize = 256
+
+// archiveQueueSize is how many received datagrams can wait for the archive writer before being dropped.
+const archiveQueueSize = 4096
+
 // printTelemetryPackets prints the telemetry packets and their measurements it found in the configuration.
 func printTelemetryPackets() {
 	fmt.Println("Telemetry Packets:")
@@ -55,57 +64,69 @@ func printTelemetryPackets() {
 }
 
 // telemetryConfigInitialize reads the telemetry config file and writes
-// it into shared memory. Returns the cleanup function.
-func telemetryConfigInitialize(config *viper.Viper) (func(), error) {
+// it into shared memory. Returns the cleanup function and the SHA-256 of the file.
+func telemetryConfigInitialize(config *viper.Viper) (func(), string, error) {
 	if !config.IsSet("telemetry_config") {
 		err := errors.New("telemetry config filepath is not set in GSW config")
 		logger.Error(fmt.Sprint(err))
-		return nil, err
+		return nil, "", err
 	}
 	data, err := os.ReadFile(config.GetString("telemetry_config"))
 	if err != nil {
 		logger.Error("Error reading YAML file: ", zap.Error(err))
-		return nil, err
+		return nil, "", err
 	}
 	_, err = proc.ParseConfigBytes(data)
 	if err != nil {
 		logger.Error("Error parsing YAML:", zap.Error(err))
-		return nil, err
+		return nil, "", err
 	}
 
 	cleanup, err := proc.WriteTelemetryConfigToShm(*shmDir, data)
 	if err != nil {
 		logger.Error("Error writing telemetry config to shared memory: ", zap.Error(err))
-		return nil, err
+		return nil, "", err
 	}
 
 	printTelemetryPackets()
-	return cleanup, nil
+	hash := sha256.Sum256(data)
+	return cleanup, hex.EncodeToString(hash[:]), nil
 }
 
-// decomInitialize starts decommutation goroutines for each telemetry packet
-func decomInitialize(ctx context.Context, wg *sync.WaitGroup) map[int]chan []byte {
-	channelMap := make(map[int]chan []byte)
+// decomInitialize starts decommutation goroutines for each telemetry packet, or each port shared by CCSDS packets.
+// Returns the output channel of each packet, keyed by packet name.
+func decomInitialize(ctx context.Context, wg *sync.WaitGroup) map[string]chan proc.ReceivedPacket {
+	channelMap := make(map[string]chan proc.ReceivedPacket)
 
-	for _, packet := range proc.GswConfig.TelemetryPackets {
-		finalOutputChannel := make(chan []byte)
-		channelMap[packet.Port] = finalOutputChannel
+	for _, group := range proc.ReceiverGroups() {
+		channels := make([]chan proc.ReceivedPacket, len(group))
+		for i, packet := range group {
+			channels[i] = make(chan proc.ReceivedPacket, dbQueueSize)
+			channelMap[packet.Name] = channels[i]
+		}
 
 		wg.Add(1)
-		go func(packet tlm.TelemetryPacket, ch chan []byte) {
+		go func(group []tlm.TelemetryPacket, channels []chan proc.ReceivedPacket) {
 			defer wg.Done()
-			err := proc.TelemetryPacketWriter(ctx, packet, finalOutputChannel, *shmDir)
+			var err error
+			if group[0].CCSDS != nil {
+				err = proc.CCSDSPacketWriter(ctx, group, channels, *shmDir)
+			} else {
+				err = proc.TelemetryPacketWriter(ctx, group[0], channels[0], *shmDir)
+			}
 			if err != nil && !errors.Is(err, context.Canceled) {
 				logger.Error("error initializing packet writer", zap.Error(err))
 			}
-			close(ch)
-		}(packet, finalOutputChannel)
+			for _, ch := range channels {
+				close(ch)
+			}
+		}(group, channels)
 	}
 
 	return channelMap
 }
 
-func dbInitialize(ctx context.Context, channelMap map[int]chan []byte, cfg resolvedDBConfig, wg *sync.WaitGroup) error {
+func dbInitialize(ctx context.Context, channelMap map[string]chan proc.ReceivedPacket, cfg resolvedDBConfig, wg *sync.WaitGroup) error {
 	var handler db.Handler
 
 	if cfg.v2 != nil {
@@ -131,10 +152,10 @@ func dbInitialize(ctx context.Context, channelMap map[int]chan []byte, cfg resol
 
 	for _, packet := range proc.GswConfig.TelemetryPackets {
 		wg.Add(1)
-		go func(packet tlm.TelemetryPacket, ch chan []byte) {
+		go func(packet tlm.TelemetryPacket, ch chan proc.ReceivedPacket) {
 			defer wg.Done()
 			proc.DatabaseWriter(ctx, handler, packet, ch)
-		}(packet, channelMap[packet.Port])
+		}(packet, channelMap[packet.Name])
 	}
 	return nil
 }
@@ -200,9 +221,11 @@ func readConfig() (*viper.Viper, int) {
 	return config, *doPprof
 }
 
+// initProfiling starts the HTTP server for pprof and the Prometheus metrics at /metrics.
 func initProfiling(pprofPort int) {
+	http.HandleFunc("/metrics", proc.ServeMetrics)
 	go func() {
-		logger.Info(fmt.Sprintf("Running pprof server at localhost:%d", pprofPort))
+		logger.Info(fmt.Sprintf("Running pprof and metrics server at localhost:%d", pprofPort))
 		err := http.ListenAndServe(fmt.Sprintf("localhost:%d", pprofPort), nil)
 		if err != nil {
 			logger.Error("Error starting pprof server: ", zap.Error(err))
@@ -210,7 +233,93 @@ func initProfiling(pprofPort int) {
 	}()
 }
 
+// archiveInitialize starts archiving every received datagram to the directory in the archive config section.
+func archiveInitialize(ctx context.Context, config *viper.Viper, wg *sync.WaitGroup) error {
+	writer, err := archive.NewWriter(archive.Config{
+		Dir:             config.GetString("archive.dir"),
+		SegmentSize:     config.GetInt64("archive.segment_size"),
+		SegmentDuration: config.GetDuration("archive.segment_duration"),
+		MaxSize:         config.GetInt64("archive.max_size"),
+	})
+	if err != nil {
+		return err
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		proc.ArchiveWriter(ctx, writer, make(chan archive.Record, archiveQueueSize))
+	}()
+	return nil
+}
+
+// forwardInitialize starts forwarding validated packets to the destinations in the forwarding config section.
+// Destinations can be changed through the status API while the service runs.
+func forwardInitialize(ctx context.Context, config *viper.Viper, wg *sync.WaitGroup) *proc.Forwarder {
+	forwarder := proc.NewForwarder()
+	var destinations []proc.ForwardDestination
+	if err := config.UnmarshalKey("forwarding", &destinations); err != nil {
+		logger.Warn("Forwarding configuration is invalid, packets will not be forwarded until destinations are added", zap.Error(err))
+	}
+	for _, destination := range destinations {
+		if err := forwarder.Set(destination); err != nil {
+			logger.Warn("Invalid forwarding destination", zap.Error(err))
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		proc.ForwardPackets(ctx, forwarder)
+	}()
+	return forwarder
+}
+
+// statusInitialize serves the health and status API on addr until the context is canceled.
+func statusInitialize(ctx context.Context, addr string, info proc.StatusInfo, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := proc.NewStatusServer(info).Run(ctx, addr)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("error running status API", zap.Error(err))
+		}
+	}()
+}
+
+// logIngestStats logs the ingest counters of each packet, the deliveries of each station when merging,
+// the counters of each forwarding destination, and how many datagrams each source had rejected by the source allowlists.
+func logIngestStats(forwarder *proc.Forwarder) {
+	for packet, stats := range proc.IngestStats() {
+		logger.Info("Ingest stats", zap.String("packet", packet), zap.Uint64("received", stats.Received),
+			zap.Uint64("wrongSize", stats.WrongSize), zap.Uint64("kernelDrops", stats.KernelDrops), zap.Uint64("shmErrors", stats.ShmErrors),
+			zap.Uint64("sequenceLost", stats.SequenceLost), zap.Uint64("unroutable", stats.Unroutable), zap.Uint64("archiveDrops", stats.ArchiveDrops),
+			zap.Uint64("duplicates", stats.Duplicates), zap.Uint64("authFailed", stats.AuthFailed))
+	}
+
+	for packet, stations := range proc.MergedStationStats() {
+		for _, station := range stations {
+			logger.Info("Station stats", zap.String("packet", packet), zap.String("station", station.Station), zap.Uint64("delivered", station.Delivered),
+				zap.Uint64("first", station.First), zap.Uint64("exclusive", station.Exclusive))
+		}
+	}
+
+	if forwarder != nil {
+		for _, destination := range forwarder.Destinations() {
+			logger.Info("Forwarding stats", zap.String("destination", destination.Name), zap.Uint64("sent", destination.Sent),
+				zap.Uint64("dropped", destination.Dropped), zap.Uint64("sendErrors", destination.SendErrors))
+		}
+	}
+
+	for packet, sources := range proc.RejectedDatagrams() {
+		for source, count := range sources {
+			logger.Warn("Rejected datagrams from source", zap.String("packet", packet), zap.String("source", source), zap.Uint64("count", count))
+		}
+	}
+}
+
 func main() {
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with the tools reading them: shm or socket")
 	flag.Parse()
 	logger.InitLogger()
 
@@ -220,7 +329,7 @@ func main() {
 		initProfiling(profilingPort)
 	}
 
-	telemetryConfigCleanup, err := telemetryConfigInitialize(config)
+	telemetryConfigCleanup, configHash, err := telemetryConfigInitialize(config)
 	if err != nil {
 		logger.Fatal("Exiting GSW...")
 		return
@@ -241,23 +350,43 @@ func main() {
 
 	var wg sync.WaitGroup
 
+	// Start archiving before the decom writers so no datagram is missed
+	if config.IsSet("archive.dir") {
+		if err := archiveInitialize(ctx, config, &wg); err != nil {
+			logger.Warn("Archive initialization failed, received datagrams will not be archived", zap.Error(err))
+		}
+	}
+
+	// Start forwarding before the decom writers so the first packets are forwarded
+	forwarder := forwardInitialize(ctx, config, &wg)
+
 	// Start decom writers
 	channelMap := decomInitialize(ctx, &wg)
 
+	statusInfo := proc.StatusInfo{ConfigHash: configHash, Forwarder: forwarder, ForwardingToken: config.GetString("forwarding_token")}
 	resolvedDB, err := resolveDBConfig(config)
 	if err != nil {
 		logger.Warn("Database configuration is invalid; telemetry packets will not be published to the database", zap.Error(err))
 	} else if resolvedDB.v1 != nil || resolvedDB.v2 != nil {
 		if err = dbInitialize(ctx, channelMap, resolvedDB, &wg); err != nil {
 			logger.Warn("DB initialization failed, telemetry packets will not be published to the database", zap.Error(err))
+		} else if resolvedDB.v2 != nil {
+			statusInfo.Database = "influxdb_v2"
+		} else {
+			statusInfo.Database = "influxdb_v1"
 		}
 	} else {
 		logger.Info("No database configuration found; telemetry packets will not be published to the database")
 	}
 
+	if config.IsSet("status_address") {
+		statusInitialize(ctx, config.GetString("status_address"), statusInfo, &wg)
+	}
+
 	// Wait for shutdown signal
 	<-ctx.Done()
 	logger.Info("Shutting down GSW...")
 	wg.Wait()
+	logIngestStats(forwarder)
 	logger.Info("GSW stopped")
 }
@@ -4,8 +4,10 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"net/http"
 	_ "net/http/pprof"
@@ -16,14 +18,15 @@ import (
 	"go.uber.org/zap"
 )
 
-type packetsMapFlagValue map[*tlm.TelemetryPacket]struct{}
+// packetsFlagValue is the set of packet names selected with -packet.
+type packetsFlagValue map[string]struct{}
 
 // String implementation for flag.Value.
 // Used for diagnostics.
-func (p *packetsMapFlagValue) String() string {
+func (p *packetsFlagValue) String() string {
 	output := make([]string, 0, len(*p))
-	for packet := range *p {
-		output = append(output, packet.Name)
+	for name := range *p {
+		output = append(output, name)
 	}
 
 	return strings.Join(output, ", ")
@@ -31,33 +34,27 @@ func (p *packetsMapFlagValue) String() string {
 
 // Set implementation for flag.Value.
 // Called for every flag to set the flag value.
-func (p *packetsMapFlagValue) Set(value string) error {
-	for _, packet := range proc.GswConfig.TelemetryPackets {
-		if packet.Name != value {
-			continue
-		}
-		(*p)[&packet] = struct{}{}
-		return nil
-	}
-	return fmt.Errorf("packet not declared in config (restart gsw_service?)")
+func (p *packetsFlagValue) Set(value string) error {
+	(*p)[value] = struct{}{}
+	return nil
 }
 
-// Packets gets a slice of packets from the packets map.
-// If no packets are defined, returns the entire config.
-func (p *packetsMapFlagValue) Packets() []*tlm.TelemetryPacket {
-	if len(*p) == 0 {
-		output := make([]*tlm.TelemetryPacket, len(proc.GswConfig.TelemetryPackets))
-		for i, packet := range proc.GswConfig.TelemetryPackets {
-			output[i] = &packet
-		}
-		return output
-	} else {
-		output := make([]*tlm.TelemetryPacket, 0, len(*p))
-		for packet := range *p {
+// Packets gets a slice of the selected packets from the config.
+// If no packets are selected, returns every packet in the config.
+func (p *packetsFlagValue) Packets() ([]*tlm.TelemetryPacket, error) {
+	output := make([]*tlm.TelemetryPacket, 0, len(proc.GswConfig.TelemetryPackets))
+	found := 0
+	for i := range proc.GswConfig.TelemetryPackets {
+		packet := &proc.GswConfig.TelemetryPackets[i]
+		if _, ok := (*p)[packet.Name]; ok || len(*p) == 0 {
 			output = append(output, packet)
+			found++
 		}
-		return output
 	}
+	if len(*p) != 0 && found != len(*p) {
+		return nil, fmt.Errorf("packet not declared in config (restart gsw_service?): %s", p.String())
+	}
+	return output, nil
 }
 
 func initProfiling(pprofPort int) {
@@ -71,18 +68,49 @@ func initProfiling(pprofPort int) {
 	}()
 }
 
-func main() {
-	configData, err := proc.ReadTelemetryConfigFromShm("/dev/shm")
-	if err != nil {
-		logger.Fatal("couldn't read config from shm", zap.Error(err))
+// ingest runs the gsw_service decom path in process for the given packets until the context is canceled.
+func ingest(ctx context.Context, packets []*tlm.TelemetryPacket, shmDir string, wg *sync.WaitGroup) {
+	for _, packet := range packets {
+		wg.Add(1)
+		go func(packet tlm.TelemetryPacket) {
+			defer wg.Done()
+			err := proc.TelemetryPacketWriter(ctx, packet, make(chan proc.ReceivedPacket), shmDir)
+			if err != nil && ctx.Err() == nil {
+				logger.Fatal("error running packet ingest", zap.Error(err))
+			}
+		}(*packet)
 	}
-	_, err = proc.ParseConfigBytes(configData)
-	if err != nil {
-		logger.Fatal("couldn't parse shm config", zap.Error(err))
+
+	// the reader and writer can only start once every packet's socket is listening
+	for _, packet := range packets {
+		for !udpPortListening(packet.Port) {
+			time.Sleep(10 * time.Millisecond)
+		}
 	}
+}
 
+// udpPortListening checks the kernel socket tables for a UDP socket bound to port.
+func udpPortListening(port int) bool {
+	local := fmt.Sprintf(":%04X", port)
+	for _, table := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		data, err := os.ReadFile(table)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) > 1 && strings.HasSuffix(fields[1], local) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func main() {
 	timeout := flag.Duration("duration", 0, "the test duration")
 	isReader := flag.Bool("reader", false, "run a gsw reader")
+	catchUp := flag.Bool("catch_up", false, "read every packet in shared memory in order instead of only the newest")
 	var readerOutputFormat outputFormatFlagValue
 	flag.Var(&readerOutputFormat, "output", "output format (options: json or a go template, defaults to pretty printing)")
 
@@ -90,15 +118,40 @@ func main() {
 	writerSleep := flag.Duration("writer_sleep", 0, "approximately how long the writer will sleep between packets")
 	serverAddress := flag.String("writer_host", "localhost", "the gsw host that the writer will attempt to write to")
 
+	isIngest := flag.Bool("ingest", false, "run the gsw ingest path in process instead of using a running gsw_service, to measure it end to end")
+	configPath := flag.String("c", "", "telemetry config file. Defaults to the config of the running gsw_service")
+	batchSize := flag.Int("batch_size", 0, "with -ingest, datagrams read per receive call (1 disables batching)")
+	receiveBuffer := flag.Int("receive_buffer", 0, "with -ingest, socket receive buffer size in bytes")
+	shmDir := flag.String("shm", "/dev/shm", "directory to use for shared memory")
+
 	profilePort := flag.Int("pprof", 0, "run pprof at a port")
 
-	packets := make(packetsMapFlagValue)
+	packets := make(packetsFlagValue)
 	flag.Var(&packets, "packet", "only this packet will be written or read")
 
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with gsw_service: shm or socket")
 	flag.Parse()
 
-	if !*isReader && !*isWriter {
-		logger.Fatal("use -reader and/or -writer to start the process as a reader or writer")
+	if !*isReader && !*isWriter && !*isIngest {
+		logger.Fatal("use -reader, -writer and/or -ingest to start the process as a reader, writer or ingest")
+	}
+	if *isIngest && *configPath == "" {
+		logger.Fatal("-ingest needs a telemetry config file (-c), since gsw_service would already be receiving the packets")
+	}
+
+	if _, err := proc.LoadConfig(*configPath, *shmDir); err != nil {
+		logger.Fatal("couldn't read telemetry config", zap.Error(err))
+	}
+	// flags take precedence over the ingest settings in the config
+	flagIngest := tlm.UDPConfig{BatchSize: *batchSize, ReceiveBuffer: *receiveBuffer}
+	if err := flagIngest.Validate(); err != nil {
+		logger.Fatal("invalid ingest flags", zap.Error(err))
+	}
+	proc.GswConfig.Ingest = proc.GswConfig.Ingest.Override(&flagIngest)
+
+	packetsSlice, err := packets.Packets()
+	if err != nil {
+		logger.Fatal("couldn't select packets", zap.Error(err))
 	}
 
 	if *profilePort != 0 {
@@ -111,15 +164,18 @@ func main() {
 	}
 	defer cancel()
 
-	packetsSlice := packets.Packets()
-
 	var wg sync.WaitGroup
+	if *isIngest {
+		logger.Info("running ingest", zap.Int("batchSize", proc.GswConfig.Ingest.BatchSize), zap.Int("receiveBuffer", proc.GswConfig.Ingest.ReceiveBuffer))
+		ingest(ctx, packetsSlice, *shmDir, &wg)
+	}
 	if *isReader {
 		logger.Info("running reader")
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			output := reader(ctx, packetsSlice)
+			output := reader(ctx, packetsSlice, *shmDir, *catchUp)
+			output.AddIngestStats(*isWriter, *isIngest)
 			outputString, err := readerOutputFormat.GenerateReaderOutput(*output)
 			if err != nil {
 				logger.Fatal("couldn't generate output", zap.Error(err))
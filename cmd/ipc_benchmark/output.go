@@ -7,13 +7,19 @@ import (
 	"strings"
 	"text/template"
 	"time"
+
+	"github.com/AarC10/GSW-V2/proc"
 )
 
 type ReaderOutput struct {
 	TotalPacketsLost     uint64
 	TotalPacketsReceived uint64
-	Runtime              time.Duration
-	Packets              []OutputPacket
+	// TotalPacketsSent is only set when the writer runs in the same process.
+	TotalPacketsSent uint64 `json:",omitempty"`
+	// TotalKernelDrops is only set when the ingest runs in the same process.
+	TotalKernelDrops uint64 `json:",omitempty"`
+	Runtime          time.Duration
+	Packets          []OutputPacket
 }
 
 type OutputPacket struct {
@@ -21,6 +27,26 @@ type OutputPacket struct {
 	Size     uint64
 	Lost     uint64
 	Received uint64
+	// Ingested and KernelDrops are only set when the ingest runs in the same process.
+	Ingested    uint64 `json:",omitempty"`
+	KernelDrops uint64 `json:",omitempty"`
+}
+
+// AddIngestStats adds the counters of the writer and ingest, when they ran in this process.
+func (o *ReaderOutput) AddIngestStats(writer bool, ingest bool) {
+	if writer {
+		o.TotalPacketsSent = totalPacketsSent.Load()
+	}
+	if !ingest {
+		return
+	}
+	stats := proc.IngestStats()
+	for i := range o.Packets {
+		packetStats := stats[o.Packets[i].Name]
+		o.Packets[i].Ingested = packetStats.Received
+		o.Packets[i].KernelDrops = packetStats.KernelDrops
+		o.TotalKernelDrops += packetStats.KernelDrops
+	}
 }
 
 type outputFormatType int
@@ -71,10 +97,20 @@ func (o *ReaderOutput) PrettyPrint() string {
 	sb.WriteString(fmt.Sprintf("Total runtime: %s\n", o.Runtime))
 	sb.WriteString(fmt.Sprintf("Total packets received: %d (%d/s)\n", o.TotalPacketsReceived, o.TotalPacketsReceived/uint64(o.Runtime.Seconds())))
 	sb.WriteString(fmt.Sprintf("Total packets lost: %d (%.3f%%)\n", o.TotalPacketsLost, (float64(o.TotalPacketsReceived)/float64(o.TotalPacketsLost+o.TotalPacketsReceived))*100))
+	if o.TotalPacketsSent != 0 {
+		sb.WriteString(fmt.Sprintf("Total packets sent: %d (%d/s)\n", o.TotalPacketsSent, o.TotalPacketsSent/uint64(o.Runtime.Seconds())))
+	}
+	if o.TotalKernelDrops != 0 {
+		sb.WriteString(fmt.Sprintf("Total kernel drops: %d\n", o.TotalKernelDrops))
+	}
 	for _, p := range o.Packets {
 		sb.WriteString(fmt.Sprintf("[%s] (%d B):\n", p.Name, p.Size))
 		sb.WriteString(fmt.Sprintf("\t[%s] Packets received: %d (%d/s)\n", p.Name, p.Received, p.Received/uint64(o.Runtime.Seconds())))
 		sb.WriteString(fmt.Sprintf("\t[%s] Packets lost: %d (%.3f%%)\n", p.Name, p.Lost, (float64(p.Received)/float64(p.Received+p.Lost))*100))
+		if p.Ingested != 0 || p.KernelDrops != 0 {
+			sb.WriteString(fmt.Sprintf("\t[%s] Packets ingested: %d\n", p.Name, p.Ingested))
+			sb.WriteString(fmt.Sprintf("\t[%s] Kernel drops: %d\n", p.Name, p.KernelDrops))
+		}
 	}
 	return sb.String()
 }
@@ -24,8 +24,16 @@ const (
 var totalPacketsReceived atomic.Uint64
 var totalPacketsLost atomic.Uint64
 
-func packetReader(ctx context.Context, packet tlm.TelemetryPacket) *OutputPacket {
-	reader, err := proc.NewIpcShmReaderForPacket(packet, "/dev/shm")
+// packetReader reads a packet until the context is canceled, counting lost packets from their sequence numbers.
+// With catchUp, every packet is read in order instead of only the newest.
+func packetReader(ctx context.Context, packet tlm.TelemetryPacket, shmDir string, catchUp bool) *OutputPacket {
+	var reader ipc.Reader
+	var err error
+	if catchUp {
+		reader, err = proc.NewIpcShmCatchUpReader(packet, "", shmDir)
+	} else {
+		reader, err = proc.NewIpcShmReaderForPacket(packet, shmDir)
+	}
 	if err != nil {
 		logger.Fatal("couldn't create reader for packet", zap.Error(err))
 	}
@@ -73,12 +81,15 @@ func packetReader(ctx context.Context, packet tlm.TelemetryPacket) *OutputPacket
 			break
 		}
 		p, err := reader.Read(ctx)
+		if ctx.Err() != nil {
+			break
+		}
 		if err != nil {
 			logger.Fatal("couldn't read packet", zap.Error(err))
 		}
-		shmPacket, ok := p.(*ipc.ShmReaderMessage)
+		shmPacket, ok := p.(ipc.SequencedMessage)
 		if !ok {
-			logger.Fatal("packet is not from shm IPC reader")
+			logger.Fatal("packet is not from an IPC ring reader")
 		}
 
 		data := shmPacket.Data()
@@ -120,7 +131,7 @@ func packetReader(ctx context.Context, packet tlm.TelemetryPacket) *OutputPacket
 	}
 }
 
-func reader(ctx context.Context, packets []*tlm.TelemetryPacket) *ReaderOutput {
+func reader(ctx context.Context, packets []*tlm.TelemetryPacket, shmDir string, catchUp bool) *ReaderOutput {
 	go func() {
 		var lastPacketsReceived uint64
 		for {
@@ -150,7 +161,7 @@ func reader(ctx context.Context, packets []*tlm.TelemetryPacket) *ReaderOutput {
 		wg.Add(1)
 		go func(packet *tlm.TelemetryPacket) {
 			defer wg.Done()
-			o := packetReader(ctx, *packet)
+			o := packetReader(ctx, *packet, shmDir, catchUp)
 			outputMu.Lock()
 			output.Packets = append(output.Packets, *o)
 			outputMu.Unlock()
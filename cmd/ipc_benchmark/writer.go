@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/AarC10/GSW-V2/lib/logger"
@@ -14,6 +15,8 @@ import (
 	"go.uber.org/zap"
 )
 
+var totalPacketsSent atomic.Uint64
+
 func createPacket(size int, seq uint64) []byte {
 	timestamp := time.Now().UnixNano()
 
@@ -58,6 +61,8 @@ func packetWriter(ctx context.Context, serverAddress string, port, size int, wri
 			_, err := conn.Write(packet)
 			if err != nil {
 				log.Error("error writing packet", zap.Error(err))
+			} else {
+				totalPacketsSent.Add(1)
 			}
 			sequence += 1
 		}
@@ -70,6 +75,8 @@ func packetWriter(ctx context.Context, serverAddress string, port, size int, wri
 			_, err := conn.Write(packet)
 			if err != nil {
 				log.Error("error writing packet", zap.Error(err))
+			} else {
+				totalPacketsSent.Add(1)
 			}
 			sequence += 1
 		}
@@ -8,69 +8,98 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/AarC10/GSW-V2/lib/ipc"
 	"github.com/AarC10/GSW-V2/lib/tlm"
-	"github.com/AarC10/GSW-V2/lib/util"
 	"github.com/AarC10/GSW-V2/proc"
 )
 
 var shmDir = flag.String("shm", "/dev/shm", "directory to use for shared memory")
+var vehicle = flag.String("vehicle", "", "vehicle to view packets from. Leave empty for packets not attributed to a vehicle")
+var list = flag.Bool("list", false, "list the shared memory segments or sockets and their writers instead of viewing packets")
 
-// buildString creates a string representation of the telemetry packet data
-// Format: MeasurementName: Value (Base-10) [(Base-16)]
-func buildString(packet tlm.TelemetryPacket, data []byte, startLine int) string {
+// buildString creates a string representation of the engineering values of a telemetry packet
+// Format: MeasurementName: Value [Quality]
+func buildString(packet tlm.TelemetryPacket, message *proc.ValueMessage, startLine int) string {
 	var sb strings.Builder
-	offset := 0
 
-	// Print the measurement name, base-10 value, and base-16 value. One for each line
-	// Format: MeasurementName: Value (Base-10) [(Base-16)]
+	// Print the measurement name and value, flagging values that aren't good. One for each line
 	sb.WriteString(fmt.Sprintf("\033[%d;0H", startLine))
-	for _, measurementName := range packet.Measurements {
-		measurement, ok := proc.GswConfig.Measurements[measurementName]
-		if !ok {
-			fmt.Printf("\t\tMeasurement '%s' not found\n", measurementName)
-			continue
+	for i, measurementName := range packet.Measurements {
+		if i >= len(message.Values) {
+			break
 		}
-
-		value, err := tlm.InterpretMeasurementValue(measurement, data[offset:offset+measurement.Size])
-		if err != nil {
-			continue
+		sb.WriteString(fmt.Sprintf("%s: %s", measurementName, message.Values[i]))
+		if !message.Quality[i].Good() {
+			sb.WriteString(fmt.Sprintf(" [%s]", message.Quality[i]))
 		}
-
-		sb.WriteString(fmt.Sprintf("%s: %v [%s]          \n", measurementName, value, util.Base16String(data[offset:offset+measurement.Size], 1)))
-		offset += measurement.Size
+		sb.WriteString("          \n")
 	}
 
 	return sb.String()
 }
 
-// printTelemetryPacket prints the telemetry packet data to the console
+// printTelemetryPacket prints the engineering values gsw_service decoded from a telemetry packet to the console
 // Written to the console at the specified start line and updated as new data is received
 func printTelemetryPacket(startLine int, packet tlm.TelemetryPacket) {
-	reader, err := proc.NewIpcShmReaderForPacket(packet, *shmDir)
+	reader, err := proc.NewValueReader(packet, *vehicle, ipc.ReadLatest, *shmDir)
 	if err != nil {
 		fmt.Printf("Error creating reader: %v\n", err)
 		return
 	}
 	defer reader.Cleanup()
 
-	fmt.Print(buildString(packet, make([]byte, proc.GetPacketSize(packet)), startLine))
+	reader.SetStateHandler(func(state proc.ReaderState, packet tlm.TelemetryPacket) {
+		if state == proc.ReaderWriterDown {
+			fmt.Printf("\033[%d;0HGSW service stopped writing %s, waiting for it to restart          \n", startLine, packet.Name)
+		}
+	})
+
+	empty := &proc.ValueMessage{
+		Values:  make([]tlm.Value, len(packet.Measurements)),
+		Quality: make([]tlm.Quality, len(packet.Measurements)),
+	}
+	fmt.Print(buildString(packet, empty, startLine))
 
 	for {
-		p, err := reader.Read(context.TODO())
+		message, err := reader.Read(context.TODO())
 		if err != nil {
 			fmt.Printf("Error reading packet: %v\n", err)
 			continue
 		}
-		data := p.Data()
 
-		fmt.Print(buildString(packet, data, startLine))
+		// the packet's measurements may have changed if gsw_service restarted with a new config
+		fmt.Print(buildString(reader.Packet(), message, startLine))
 	}
 }
 
+// printSegments prints the metadata of every shared memory segment, or every socket with the socket backend.
+func printSegments() {
+	infos, err := ipc.List(proc.IpcBackend, *shmDir)
+	if err != nil {
+		fmt.Printf("Error listing %s rings: %v\n", proc.IpcBackend, err)
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "IDENTIFIER\tNAME\tSIZE\tRING\tVERSION\tPID\tCREATED")
+	for _, info := range infos {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", info.Identifier, info.Name, info.MessageSize, info.RingSize,
+			info.Version, info.WriterPID, info.Created.Format(time.RFC3339))
+	}
+	writer.Flush()
+}
+
 func main() {
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with gsw_service: shm or socket")
 	flag.Parse()
 
+	if *list {
+		printSegments()
+		return
+	}
+
 	configData, err := proc.ReadTelemetryConfigFromShm(*shmDir)
 	if err != nil {
 		fmt.Println("*** Error accessing config file. Make sure the GSW service is running. ***")
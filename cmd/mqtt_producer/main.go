@@ -7,17 +7,15 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
-	"fmt"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 
+	"github.com/AarC10/GSW-V2/lib/client"
+	"github.com/AarC10/GSW-V2/lib/ipc"
 	"github.com/AarC10/GSW-V2/lib/logger"
-	"github.com/AarC10/GSW-V2/lib/tlm"
 	"github.com/AarC10/GSW-V2/proc"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"go.uber.org/zap"
@@ -30,15 +28,17 @@ var (
 )
 
 func main() {
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with gsw_service: shm or socket")
 	flag.Parse()
 
-	configData, err := proc.ReadTelemetryConfigFromShm(*shmDir)
+	// every packet is published, catching up after bursts while gsw_service still holds them
+	c, err := client.New(client.Options{
+		ShmDir:       *shmDir,
+		ReadMode:     ipc.ReadAll,
+		StateHandler: logState,
+	})
 	if err != nil {
-		logger.Fatal("error reading telemetry config from shm", zap.Error(err))
-	}
-	_, err = proc.ParseConfigBytes(configData)
-	if err != nil {
-		logger.Fatal("error parsing telemetry config from gsw", zap.Error(err))
+		logger.Fatal("error connecting to gsw", zap.Error(err))
 	}
 
 	opts := mqtt.NewClientOptions()
@@ -46,26 +46,12 @@ func main() {
 	opts.SetClientID("gsw-mqtt-app")
 	opts.SetCleanSession(true)
 
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
+	mqttClient := mqtt.NewClient(opts)
+	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
 		logger.Fatal("error connecting to mqtt and creating token", zap.Error(token.Error()))
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-
-	var wg sync.WaitGroup
-
-	for _, packet := range proc.GswConfig.TelemetryPackets {
-		wg.Add(1)
-		go func(packet tlm.TelemetryPacket) {
-			defer wg.Done()
-			err := packetWriter(ctx, packet, client)
-			if err != nil && !errors.Is(err, context.Canceled) {
-				logger.Error("error in writer", zap.Error(err))
-			}
-		}(packet)
-	}
-
 	go func() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -74,49 +60,45 @@ func main() {
 		cancel()
 	}()
 
-	wg.Wait()
-	client.Disconnect(250)
+	logger.Info("starting streaming")
+	err = c.Subscribe(ctx, nil, func(update client.Update) {
+		publishUpdate(mqttClient, update)
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Error("error subscribing to telemetry", zap.Error(err))
+	}
+	mqttClient.Disconnect(250)
 }
 
-func packetWriter(ctx context.Context, packet tlm.TelemetryPacket, client mqtt.Client) error {
-	pLog := logger.Log().With(zap.String("packet", packet.Name))
-	pLog.Info("starting streaming")
+// logState logs when gsw_service stops and resumes writing a packet.
+func logState(packet string, vehicle string, state proc.ReaderState) {
+	log := logger.Log().With(zap.String("packet", packet), zap.String("vehicle", vehicle))
+	if state == proc.ReaderWriterDown {
+		log.Warn("gsw_service is down, waiting for it to restart")
+		return
+	}
+	log.Info("gsw_service restarted, resuming streaming")
+}
 
-	reader, err := proc.NewIpcShmReaderForPacket(packet, *shmDir)
-	if err != nil {
-		return fmt.Errorf("couldn't create reader: %w", err)
+// publishUpdate publishes each measurement of a packet to its own topic.
+// Topics of packets sent by a vehicle include the vehicle name after the prefix.
+func publishUpdate(mqttClient mqtt.Client, update client.Update) {
+	if update.Overwritten > 0 {
+		logger.Warn("packets were overwritten by gsw_service before they could be published",
+			zap.String("packet", update.Packet), zap.String("vehicle", update.Vehicle), zap.Uint32("overwritten", update.Overwritten))
 	}
-	defer reader.Cleanup()
 
-	for {
-		p, err := reader.Read(ctx)
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		if err != nil {
-			pLog.Error("error reading packet", zap.Error(err))
+	prefix := *topicPrefix
+	if update.Vehicle != "" {
+		prefix += "/" + update.Vehicle
+	}
+	for _, measurement := range update.Measurements {
+		// NaN and Inf have no JSON representation
+		if !measurement.Quality.Good() {
 			continue
 		}
-		data := p.Data()
-		offset := 0
-		for _, name := range packet.Measurements {
-			meas, ok := proc.GswConfig.Measurements[name]
-			if !ok || offset+meas.Size > len(data) {
-				continue
-			}
-			val, err := tlm.InterpretMeasurementValue(meas, data[offset:offset+meas.Size])
-			if err != nil {
-				pLog.Error("error interpreting measurement", zap.Error(err))
-				continue
-			}
-			jsonStr, err := json.Marshal(val)
-			if err != nil {
-				pLog.Error("error marshaling measurement", zap.Error(err))
-				continue
-			}
-			// qos=0 delivery not guaranteed
-			client.Publish(fmt.Sprintf("%s/%s/%s", *topicPrefix, packet.Name, name), 0, false, jsonStr)
-			offset += meas.Size
-		}
+		topic := prefix + "/" + update.Packet + "/" + measurement.Name
+		// qos=0 delivery not guaranteed
+		mqttClient.Publish(topic, 0, false, measurement.Value.AppendFormat(nil, 'g', -1))
 	}
 }
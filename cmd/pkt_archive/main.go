@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/archive"
+	"github.com/AarC10/GSW-V2/lib/util"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// maxUDPPayload is the largest datagram that fits in an exported UDP packet.
+const maxUDPPayload = 65507
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "Reads the raw packet archive written by gsw_service.")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  list    list the archive segments and the times they cover")
+	fmt.Fprintln(os.Stderr, "  dump    print archived datagrams")
+	fmt.Fprintln(os.Stderr, "  export  write archived datagrams to a pcap file, for pkt_replay and pkt_decode")
+	fmt.Fprintf(os.Stderr, "Run %s <command> -h for the flags of a command.\n", os.Args[0])
+}
+
+// filterFlags are the flags selecting archived records.
+type filterFlags struct {
+	dir     *string
+	start   *string
+	end     *string
+	ports   *string
+	sources *string
+}
+
+func addFilterFlags(flags *flag.FlagSet) filterFlags {
+	return filterFlags{
+		dir:     flags.String("dir", "archive", "archive directory"),
+		start:   flags.String("start", "", "only datagrams received at or after this RFC 3339 time"),
+		end:     flags.String("end", "", "only datagrams received before this RFC 3339 time"),
+		ports:   flags.String("port", "", "only datagrams for these comma separated ports"),
+		sources: flags.String("source", "", "only datagrams from these comma separated addresses or subnets"),
+	}
+}
+
+// filter parses the filter flags.
+func (f filterFlags) filter() (archive.Filter, error) {
+	var filter archive.Filter
+	var err error
+	if *f.start != "" {
+		if filter.Start, err = time.Parse(time.RFC3339Nano, *f.start); err != nil {
+			return filter, fmt.Errorf("invalid -start: %w", err)
+		}
+	}
+	if *f.end != "" {
+		if filter.End, err = time.Parse(time.RFC3339Nano, *f.end); err != nil {
+			return filter, fmt.Errorf("invalid -end: %w", err)
+		}
+	}
+	for _, text := range splitList(*f.ports) {
+		port, err := strconv.ParseUint(text, 10, 16)
+		if err != nil {
+			return filter, fmt.Errorf("invalid -port %q", text)
+		}
+		filter.Ports = append(filter.Ports, uint16(port))
+	}
+	for _, text := range splitList(*f.sources) {
+		prefix, err := netip.ParsePrefix(text)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(text)
+			if addrErr != nil {
+				return filter, fmt.Errorf("invalid -source %q", text)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		filter.Sources = append(filter.Sources, prefix)
+	}
+	return filter, nil
+}
+
+// splitList splits a comma separated flag value, ignoring empty entries.
+func splitList(text string) []string {
+	var items []string
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func list(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	dir := flags.String("dir", "archive", "archive directory")
+	flags.Parse(args)
+
+	segments, err := archive.Segments(*dir)
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(out, "SEGMENT\tSTART\tEND\tRECORDS\tSIZE")
+	var records int
+	var size int64
+	for _, segment := range segments {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%d\t%d\n", segment.Path, formatTime(segment.Start), formatTime(segment.End), segment.Records, segment.Size)
+		records += segment.Records
+		size += segment.Size
+	}
+	fmt.Fprintf(out, "%d segments\t\t\t%d\t%d\n", len(segments), records, size)
+	return out.Flush()
+}
+
+// formatTime formats a receive time, or - if there is none.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func dump(args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	filterFlags := addFilterFlags(flags)
+	flags.Parse(args)
+	filter, err := filterFlags.filter()
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	return archive.Read(*filterFlags.dir, filter, func(record archive.Record) error {
+		source := "-"
+		if record.Source.IsValid() {
+			source = record.Source.String()
+		}
+		_, err := fmt.Fprintf(out, "%s port %d from %s (%d bytes): %s\n", formatTime(record.Time), record.Port, source, len(record.Data), util.Base16String(record.Data, 1))
+		return err
+	})
+}
+
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	filterFlags := addFilterFlags(flags)
+	output := flags.String("o", "archive.pcap", "pcap file to write")
+	flags.Parse(args)
+	filter, err := filterFlags.filter()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buffered := bufio.NewWriterSize(file, 128*1024)
+	writer := pcapgo.NewWriterNanos(buffered)
+	if err := writer.WriteFileHeader(65535, layers.LinkTypeRaw); err != nil {
+		return fmt.Errorf("writing pcap file header: %w", err)
+	}
+
+	var exported, skipped int
+	buffer := gopacket.NewSerializeBuffer()
+	err = archive.Read(*filterFlags.dir, filter, func(record archive.Record) error {
+		if len(record.Data) > maxUDPPayload {
+			skipped++
+			return nil
+		}
+		if err := serializeDatagram(buffer, record); err != nil {
+			return err
+		}
+		info := gopacket.CaptureInfo{Timestamp: record.Time, CaptureLength: len(buffer.Bytes()), Length: len(buffer.Bytes())}
+		if err := writer.WritePacket(info, buffer.Bytes()); err != nil {
+			return fmt.Errorf("writing %s: %w", *output, err)
+		}
+		exported++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("writing %s: %w", *output, err)
+	}
+
+	fmt.Printf("Exported %d datagrams to %s\n", exported, *output)
+	if skipped > 0 {
+		fmt.Printf("Skipped %d frames too large for a UDP datagram\n", skipped)
+	}
+	return nil
+}
+
+// serializeDatagram encodes a record as an IP packet holding a UDP datagram sent to its port.
+// Records without a source, such as serial frames, are given the unspecified IPv4 address.
+func serializeDatagram(buffer gopacket.SerializeBuffer, record archive.Record) error {
+	source := record.Source
+	if !source.IsValid() {
+		source = netip.IPv4Unspecified()
+	}
+	udp := &layers.UDP{DstPort: layers.UDPPort(record.Port)}
+	var ip gopacket.NetworkLayer
+	if source.Is4() {
+		ip = &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: source.AsSlice(), DstIP: net.IPv4zero}
+	} else {
+		ip = &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: source.AsSlice(), DstIP: net.IPv6unspecified}
+	}
+	if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+		return err
+	}
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	return gopacket.SerializeLayers(buffer, options, ip.(gopacket.SerializableLayer), udp, gopacket.Payload(record.Data))
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(os.Args[2:])
+	case "dump":
+		err = dump(os.Args[2:])
+	case "export":
+		err = export(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
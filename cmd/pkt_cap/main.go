@@ -1,58 +1,133 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"flag"
 	"fmt"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	capturelib "github.com/AarC10/GSW-V2/lib/capture"
 	"github.com/AarC10/GSW-V2/lib/logger"
+	"github.com/AarC10/GSW-V2/lib/tlm"
 	"github.com/AarC10/GSW-V2/proc"
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
-	"github.com/google/gopacket/pcapgo"
 	"go.uber.org/zap"
 )
 
-var shmDir = flag.String("shm", "/dev/shm", "directory to use for shared memory")
+var (
+	shmDir    = flag.String("shm", "/dev/shm", "directory to use for shared memory")
+	device    = flag.String("i", "any", "interface to capture on")
+	outputDir = flag.String("o", "captures", "directory to write captures to")
+	packets   = flag.String("packets", "", "only capture these comma separated packets from the telemetry config")
+	format    = flag.String("format", "pcap", "capture file format, pcap or pcapng (which records the telemetry config name)")
+	maxSize   = flag.Int64("size", 0, "megabytes before starting a new file, or 0 to never rotate by size")
+	duration  = flag.Duration("duration", 0, "time before starting a new file, or 0 to never rotate by time")
+	maxFiles  = flag.Int("files", 0, "only keep the last N files, deleting older ones, or 0 to keep every file")
+	statsRate = flag.Duration("stats", 10*time.Second, "interval between capture summaries, or 0 to only log one when stopping")
+)
+
+// selectPackets returns the configured packets named in the -packets flag, or every packet if it's empty.
+func selectPackets() ([]tlm.TelemetryPacket, error) {
+	if *packets == "" {
+		return proc.GswConfig.TelemetryPackets, nil
+	}
+
+	var selected []tlm.TelemetryPacket
+	for _, name := range strings.Split(*packets, ",") {
+		name = strings.TrimSpace(name)
+		index := slices.IndexFunc(proc.GswConfig.TelemetryPackets, func(packet tlm.TelemetryPacket) bool {
+			return packet.Name == name
+		})
+		if index < 0 {
+			return nil, fmt.Errorf("no packet named %q in the telemetry config", name)
+		}
+		selected = append(selected, proc.GswConfig.TelemetryPackets[index])
+	}
+	return selected, nil
+}
 
-func getFilter() (string, error) {
-	if len(proc.GswConfig.TelemetryPackets) == 0 {
+// portNames maps each captured port to the names of its packets, as several CCSDS packets can share a port.
+func portNames(selected []tlm.TelemetryPacket) map[uint16][]string {
+	names := make(map[uint16][]string)
+	for _, packet := range selected {
+		port := uint16(packet.Port)
+		names[port] = append(names[port], packet.Name)
+	}
+	return names
+}
+
+func getFilter(ports map[uint16][]string) (string, error) {
+	if len(ports) == 0 {
 		return "", fmt.Errorf("no telemetry packets configured")
 	}
 
-	ports := make([]string, 0, len(proc.GswConfig.TelemetryPackets))
-	for _, packet := range proc.GswConfig.TelemetryPackets {
-		ports = append(ports, fmt.Sprintf("udp port %d", packet.Port))
+	filters := make([]string, 0, len(ports))
+	for _, port := range slices.Sorted(maps.Keys(ports)) {
+		filters = append(filters, fmt.Sprintf("udp port %d", port))
 	}
 
-	return strings.Join(ports, " or "), nil
+	return strings.Join(filters, " or "), nil
+}
+
+// captureSummary counts the captured packets sent to each port.
+type captureSummary struct {
+	ports       map[uint16][]string
+	counts      map[uint16]uint64
+	written     uint64
+	kernelDrops int // Packets dropped by the kernel, as of the last summary
+}
+
+// add counts a captured packet by its UDP destination port.
+func (s *captureSummary) add(packet gopacket.Packet) {
+	s.written++
+	if udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		s.counts[uint16(udp.DstPort)]++
+	}
 }
 
-func createOutputFile() (*os.File, error) {
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	if err := os.MkdirAll("captures", 0755); err != nil {
-		return nil, fmt.Errorf("creating captures directory: %w", err)
+// updateDrops reads the packets dropped by the kernel from an open handle.
+func (s *captureSummary) updateDrops(handle *pcap.Handle) {
+	if stats, err := handle.Stats(); err == nil {
+		s.kernelDrops = stats.PacketsDropped + stats.PacketsIfDropped
 	}
+}
 
-	filename := fmt.Sprintf("captures/%s_%s.pcap", proc.GswConfig.Name, timestamp)
-	return os.Create(filename)
+// log logs the packets captured for each port and the packets dropped by the kernel.
+func (s *captureSummary) log(file string) {
+	fields := []zap.Field{zap.Uint64("written", s.written), zap.Int("kernelDrops", s.kernelDrops), zap.String("file", file)}
+	for _, port := range slices.Sorted(maps.Keys(s.ports)) {
+		key := fmt.Sprintf("%d (%s)", port, strings.Join(s.ports[port], ", "))
+		fields = append(fields, zap.Uint64(key, s.counts[port]))
+	}
+	logger.Info("capture summary", fields...)
 }
 
 func capture(ctx context.Context) error {
-	filter, err := getFilter()
+	selected, err := selectPackets()
+	if err != nil {
+		return err
+	}
+	ports := portNames(selected)
+	filter, err := getFilter(ports)
 	if err != nil {
 		return fmt.Errorf("building capture filter: %w", err)
 	}
+	fileFormat, err := capturelib.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
 
 	snaplen := uint32(65535)
-	handle, err := pcap.OpenLive("any", int32(snaplen), true, 100*time.Millisecond)
+	handle, err := pcap.OpenLive(*device, int32(snaplen), true, 100*time.Millisecond)
 	if err != nil {
 		return fmt.Errorf("opening pcap handle: %w", err)
 	}
@@ -62,31 +137,32 @@ func capture(ctx context.Context) error {
 		return fmt.Errorf("setting BPF filter: %w", err)
 	}
 
-	pcapFile, err := createOutputFile()
+	writer, err := capturelib.NewWriter(capturelib.WriterConfig{
+		Dir:         *outputDir,
+		Name:        proc.GswConfig.Name,
+		Format:      fileFormat,
+		LinkType:    handle.LinkType(),
+		SnapLen:     snaplen,
+		Interface:   *device,
+		Filter:      filter,
+		Comment:     fmt.Sprintf("telemetry config: %s", proc.GswConfig.Name),
+		MaxSize:     *maxSize * 1024 * 1024,
+		MaxDuration: *duration,
+		MaxFiles:    *maxFiles,
+	})
 	if err != nil {
 		return fmt.Errorf("creating output file: %w", err)
 	}
 	defer func() {
-		if err := pcapFile.Close(); err != nil {
-			logger.Error("failed closing pcap file", zap.Error(err))
+		if err := writer.Close(); err != nil {
+			logger.Error("failed closing capture file", zap.Error(err))
 		}
 	}()
 
-	bufferedFile := bufio.NewWriterSize(pcapFile, 128*1024)
-	defer func() {
-		if err := bufferedFile.Flush(); err != nil {
-			logger.Error("failed flushing buffered writer", zap.Error(err))
-		}
-	}()
-
-	pcapWriter := pcapgo.NewWriterNanos(bufferedFile)
-	if err := pcapWriter.WriteFileHeader(snaplen, handle.LinkType()); err != nil {
-		return fmt.Errorf("writing pcap file header: %w", err)
-	}
-
 	logger.Info("network capture started",
+		zap.String("interface", *device),
 		zap.String("filter", filter),
-		zap.String("file", pcapFile.Name()),
+		zap.String("file", writer.Path()),
 	)
 
 	go func() {
@@ -94,16 +170,37 @@ func capture(ctx context.Context) error {
 		handle.Close()
 	}()
 
+	summary := &captureSummary{ports: ports, counts: make(map[uint16]uint64)}
+	var ticks <-chan time.Time
+	if *statsRate > 0 {
+		ticker := time.NewTicker(*statsRate)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
 	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-	for packet := range packetSource.Packets() {
-		if err := pcapWriter.WritePacket(packet.Metadata().CaptureInfo, packet.Data()); err != nil {
-			logger.Error("failed writing packet", zap.Error(err))
+	packetChan := packetSource.Packets()
+	for {
+		select {
+		case packet, ok := <-packetChan:
+			if !ok {
+				// the handle is closed, so the drops from the last summary are logged
+				summary.log(writer.Path())
+				return ctx.Err()
+			}
+			if err := writer.WritePacket(packet.Metadata().CaptureInfo, packet.Data()); err != nil {
+				logger.Error("failed writing packet", zap.Error(err))
+				continue
+			}
+			summary.add(packet)
+		case <-ticks:
+			summary.updateDrops(handle)
+			summary.log(writer.Path())
 		}
 	}
-
-	return ctx.Err()
 }
 func main() {
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with gsw_service: shm or socket")
 	flag.Parse()
 	logger.InitLogger()
 
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/capture"
+	"github.com/AarC10/GSW-V2/proc"
+)
+
+var (
+	configFilepath = flag.String("c", "", "path to the telemetry config file the captures were recorded with")
+	outputDir      = flag.String("o", "decoded", "directory to write a CSV file per telemetry packet to")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -c <config.yaml> [flags] <capture.pcap> [capture.pcapng ...]\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Decodes the telemetry packets in pcap or pcapng captures into a CSV file per packet, with capture timestamps and engineering values.")
+	flag.PrintDefaults()
+}
+
+// csvFile is the output file of a telemetry packet.
+type csvFile struct {
+	file   *os.File
+	buffer *bufio.Writer
+	writer *csv.Writer
+	record []string
+}
+
+// csvWriter writes decoded packets to a CSV file per telemetry packet, creating the files as packets are decoded.
+type csvWriter struct {
+	dir      string
+	vehicles bool // Whether records have a vehicle column
+	files    map[string]*csvFile
+}
+
+func (w *csvWriter) write(decoded proc.DecodedPacket) error {
+	out, ok := w.files[decoded.Packet.Name]
+	if !ok {
+		var err error
+		out, err = w.create(decoded)
+		if err != nil {
+			return err
+		}
+		w.files[decoded.Packet.Name] = out
+	}
+
+	record := append(out.record[:0], decoded.Time.UTC().Format(time.RFC3339Nano))
+	if w.vehicles {
+		record = append(record, decoded.Vehicle)
+	}
+	for _, value := range decoded.Values {
+		record = append(record, value.String())
+	}
+	out.record = record
+	return out.writer.Write(record)
+}
+
+// create creates the output file of a packet and writes its header.
+func (w *csvWriter) create(decoded proc.DecodedPacket) (*csvFile, error) {
+	file, err := os.Create(filepath.Join(w.dir, decoded.Packet.Name+".csv"))
+	if err != nil {
+		return nil, fmt.Errorf("creating output file: %w", err)
+	}
+	buffer := bufio.NewWriterSize(file, 64*1024)
+	out := &csvFile{file: file, buffer: buffer, writer: csv.NewWriter(buffer)}
+
+	header := []string{"time"}
+	if w.vehicles {
+		header = append(header, "vehicle")
+	}
+	header = append(header, decoded.Packet.Measurements...)
+	if err := out.writer.Write(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("writing %s: %w", file.Name(), err)
+	}
+	return out, nil
+}
+
+// close flushes and closes every output file.
+func (w *csvWriter) close() error {
+	var errs []error
+	for _, out := range w.files {
+		out.writer.Flush()
+		if err := out.writer.Error(); err != nil {
+			errs = append(errs, fmt.Errorf("writing %s: %w", out.file.Name(), err))
+		}
+		if err := out.buffer.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("writing %s: %w", out.file.Name(), err))
+		}
+		if err := out.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// decodeFile decodes every datagram of a capture file, returning the number of packets skipped because they aren't complete UDP datagrams.
+func decodeFile(path string, decoder *proc.CaptureDecoder, out *csvWriter) (uint64, error) {
+	reader, err := capture.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	for {
+		datagram, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return reader.Skipped, nil
+		}
+		if err != nil {
+			return reader.Skipped, fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		decoded, ok := decoder.Decode(datagram)
+		if !ok {
+			continue
+		}
+		if err := out.write(decoded); err != nil {
+			return reader.Skipped, err
+		}
+	}
+}
+
+// printSummary prints how many datagrams were decoded and dropped for each packet and port.
+func printSummary(stats proc.CaptureStats, skipped uint64) {
+	fmt.Println("Packet                          Decoded  Wrong size")
+	for _, packet := range proc.GswConfig.TelemetryPackets {
+		fmt.Printf("%-30s %8d %11d\n", packet.Name, stats.Decoded[packet.Name], stats.WrongSize[packet.Name])
+	}
+
+	// CCSDS packets that can't be attributed to a packet are counted under their port
+	packets := make(map[string]bool, len(proc.GswConfig.TelemetryPackets))
+	for _, packet := range proc.GswConfig.TelemetryPackets {
+		packets[packet.Name] = true
+	}
+	ccsdsPorts := make(map[string]bool)
+	for name := range stats.WrongSize {
+		if !packets[name] {
+			ccsdsPorts[name] = true
+		}
+	}
+	for name := range stats.Unroutable {
+		ccsdsPorts[name] = true
+	}
+	for _, name := range slices.Sorted(maps.Keys(ccsdsPorts)) {
+		fmt.Printf("%s: %d invalid CCSDS packets, %d with an unknown APID or segmented user data\n", name, stats.WrongSize[name], stats.Unroutable[name])
+	}
+
+	for _, port := range slices.Sorted(maps.Keys(stats.UnknownPorts)) {
+		fmt.Printf("Unknown port %d: %d datagrams\n", port, stats.UnknownPorts[port])
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipped %d captured packets that aren't complete UDP datagrams\n", skipped)
+	}
+}
+
+func run(files []string) error {
+	if _, err := proc.ParseConfig(*configFilepath); err != nil {
+		return err
+	}
+	decoder, err := proc.NewCaptureDecoder()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	out := &csvWriter{dir: *outputDir, vehicles: len(proc.GswConfig.Vehicles) > 0, files: make(map[string]*csvFile)}
+
+	var skipped uint64
+	for _, file := range files {
+		fileSkipped, err := decodeFile(file, decoder, out)
+		skipped += fileSkipped
+		if err != nil {
+			out.close()
+			return err
+		}
+	}
+	if err := out.close(); err != nil {
+		return err
+	}
+
+	printSummary(decoder.Stats, skipped)
+	return nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if *configFilepath == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/capture"
+	"github.com/AarC10/GSW-V2/proc"
+)
+
+var (
+	shmDir         = flag.String("shm", "/dev/shm", "directory to use for shared memory")
+	configFilepath = flag.String("c", "", "path to a telemetry config file. Leave empty to read the config from a running gsw_service")
+	host           = flag.String("host", "localhost", "host to send the packets to")
+	speed          = flag.Float64("speed", 1, "playback speed multiplier. 0 sends packets as fast as possible")
+	loop           = flag.Bool("loop", false, "replay the captures until interrupted")
+	startFlag      = flag.String("start", "", "skip packets before this time, as an offset from the first packet (e.g. 90s) or an RFC 3339 time")
+	endFlag        = flag.String("end", "", "stop at packets after this time, as an offset from the first packet (e.g. 5m) or an RFC 3339 time")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <capture.pcap> [capture.pcapng ...]\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Replays the UDP datagrams sent to telemetry packet ports in pcap or pcapng captures, keeping their original timing.")
+	fmt.Fprintln(flag.CommandLine.Output(), "Captures are played one after another in the order given.")
+	flag.PrintDefaults()
+}
+
+// timeBound is a -start or -end flag, either an offset from the first packet or an absolute time.
+type timeBound struct {
+	offset   time.Duration
+	absolute time.Time
+	set      bool
+}
+
+func parseTimeBound(text string) (timeBound, error) {
+	if text == "" {
+		return timeBound{}, nil
+	}
+	if offset, err := time.ParseDuration(text); err == nil {
+		return timeBound{offset: offset, set: true}, nil
+	}
+	absolute, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return timeBound{}, fmt.Errorf("%q is neither a duration nor an RFC 3339 time", text)
+	}
+	return timeBound{absolute: absolute, set: true}, nil
+}
+
+// resolve returns the time of the bound for a capture starting at first.
+func (b timeBound) resolve(first time.Time) time.Time {
+	if !b.absolute.IsZero() {
+		return b.absolute
+	}
+	return first.Add(b.offset)
+}
+
+// replayer sends the datagrams of captures to the telemetry packet ports.
+type replayer struct {
+	conn       *net.UDPConn
+	host       netip.Addr
+	ports      map[uint16]bool
+	speed      float64
+	start, end timeBound
+
+	first time.Time // Time of the first datagram in the captures, which bounds are relative to
+}
+
+// pass is the progress of one replay of the captures.
+type pass struct {
+	wallStart    time.Time // When the first datagram was sent
+	captureStart time.Time // Capture time of the first datagram sent
+	sent         uint64
+	bytes        uint64
+	skipped      uint64 // Captured packets that aren't complete UDP datagrams
+	done         bool   // Whether the end bound was reached
+}
+
+// replayFile sends the datagrams of a capture file that fall within the bounds.
+func (r *replayer) replayFile(ctx context.Context, path string, p *pass) error {
+	reader, err := capture.Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	defer func() { p.skipped += reader.Skipped }()
+
+	for !p.done {
+		datagram, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if r.first.IsZero() {
+			r.first = datagram.Time
+		}
+		if !r.ports[datagram.Destination.Port()] {
+			continue
+		}
+		if r.start.set && datagram.Time.Before(r.start.resolve(r.first)) {
+			continue
+		}
+		if r.end.set && datagram.Time.After(r.end.resolve(r.first)) {
+			p.done = true
+			return nil
+		}
+
+		if p.sent == 0 {
+			p.wallStart = time.Now()
+			p.captureStart = datagram.Time
+		} else if err := r.wait(ctx, p, datagram.Time); err != nil {
+			return err
+		}
+
+		destination := netip.AddrPortFrom(r.host, datagram.Destination.Port())
+		if _, err := r.conn.WriteToUDPAddrPort(datagram.Payload, destination); err != nil {
+			return fmt.Errorf("sending to %s: %w", destination, err)
+		}
+		p.sent++
+		p.bytes += uint64(len(datagram.Payload))
+	}
+	return nil
+}
+
+// wait sleeps until a datagram captured at captured is due, scaled by the playback speed.
+func (r *replayer) wait(ctx context.Context, p *pass, captured time.Time) error {
+	if r.speed <= 0 {
+		return ctx.Err()
+	}
+	due := p.wallStart.Add(time.Duration(float64(captured.Sub(p.captureStart)) / r.speed))
+	delay := time.Until(due)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func run(ctx context.Context, files []string) error {
+	if _, err := proc.LoadConfig(*configFilepath, *shmDir); err != nil {
+		if *configFilepath == "" {
+			return fmt.Errorf("%w (use -c to give a config file)", err)
+		}
+		return err
+	}
+
+	start, err := parseTimeBound(*startFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -start: %w", err)
+	}
+	end, err := parseTimeBound(*endFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -end: %w", err)
+	}
+	if *speed < 0 {
+		return fmt.Errorf("invalid -speed %g, must not be negative", *speed)
+	}
+
+	hostAddr, err := net.ResolveIPAddr("ip", *host)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", *host, err)
+	}
+	addr, _ := netip.AddrFromSlice(hostAddr.IP)
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return fmt.Errorf("opening UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	r := &replayer{
+		conn:  conn,
+		host:  addr.Unmap(),
+		ports: make(map[uint16]bool, len(proc.GswConfig.TelemetryPackets)),
+		speed: *speed,
+		start: start,
+		end:   end,
+	}
+	for _, packet := range proc.GswConfig.TelemetryPackets {
+		r.ports[uint16(packet.Port)] = true
+	}
+
+	for i := 1; ; i++ {
+		var p pass
+		var err error
+		for _, file := range files {
+			if err = r.replayFile(ctx, file, &p); err != nil || p.done {
+				break
+			}
+		}
+		printPass(i, p)
+		if err != nil {
+			return err
+		}
+
+		if !*loop {
+			return nil
+		}
+		if p.sent == 0 {
+			return fmt.Errorf("no packets in the captures match the telemetry config and time window")
+		}
+	}
+}
+
+// printPass prints a summary of a replay of the captures.
+func printPass(i int, p pass) {
+	var elapsed time.Duration
+	if p.sent > 0 {
+		elapsed = time.Since(p.wallStart).Round(time.Millisecond)
+	}
+	fmt.Printf("Pass %d: sent %d packets (%d bytes) to %s in %s", i, p.sent, p.bytes, *host, elapsed)
+	if p.skipped > 0 {
+		fmt.Printf(", skipped %d captured packets that aren't complete UDP datagrams", p.skipped)
+	}
+	fmt.Println()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with gsw_service: shm or socket")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, flag.Args()); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
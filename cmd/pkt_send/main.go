@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/auth"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"github.com/AarC10/GSW-V2/lib/util"
+	"github.com/AarC10/GSW-V2/proc"
+)
+
+var (
+	shmDir         = flag.String("shm", "/dev/shm", "directory to use for shared memory")
+	configFilepath = flag.String("c", "", "path to a telemetry config file. Leave empty to read the config from a running gsw_service")
+	packetName     = flag.String("packet", "", "name of the telemetry packet to send")
+	host           = flag.String("host", "localhost", "host to send the packet to")
+	count          = flag.Int("n", 1, "number of times to send the packet")
+	interval       = flag.Duration("interval", time.Second, "time between packets when sending more than once")
+	authFlags      = auth.RegisterFlags(flag.CommandLine)
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -packet <name> [flags] [measurement=value ...]\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Encodes engineering values into a telemetry packet and sends it to the packet's port.")
+	fmt.Fprintln(flag.CommandLine.Output(), "Measurements that are not given are sent as zero.")
+	fmt.Fprintln(flag.CommandLine.Output(), "Packets are authenticated with the packet's auth settings unless -key-file or -key-env is given.")
+	flag.PrintDefaults()
+}
+
+// findPacket returns the telemetry packet with the given name.
+func findPacket(name string) (tlm.TelemetryPacket, error) {
+	for _, packet := range proc.GswConfig.TelemetryPackets {
+		if packet.Name == name {
+			return packet, nil
+		}
+	}
+	return tlm.TelemetryPacket{}, fmt.Errorf("packet %s not found in config %s", name, proc.GswConfig.Name)
+}
+
+// parseValues parses name=value arguments into engineering values.
+func parseValues(args []string) (map[string]tlm.Value, error) {
+	values := make(map[string]tlm.Value, len(args))
+	for _, arg := range args {
+		name, text, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("argument %q is not in the form name=value", arg)
+		}
+
+		measurement, ok := proc.GswConfig.Measurements[name]
+		if !ok {
+			return nil, fmt.Errorf("measurement %s not found", name)
+		}
+
+		value, err := tlm.ParseValue(measurement, text)
+		if err != nil {
+			return nil, fmt.Errorf("measurement %s: %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func run() error {
+	if _, err := proc.LoadConfig(*configFilepath, *shmDir); err != nil {
+		if *configFilepath == "" {
+			return fmt.Errorf("%w (use -c to give a config file)", err)
+		}
+		return err
+	}
+
+	packet, err := findPacket(*packetName)
+	if err != nil {
+		return err
+	}
+
+	values, err := parseValues(flag.Args())
+	if err != nil {
+		return err
+	}
+
+	encoder, err := tlm.NewEncoder(packet, proc.GswConfig.Measurements)
+	if err != nil {
+		return fmt.Errorf("creating encoder: %w", err)
+	}
+
+	data, err := encoder.Encode(values)
+	if err != nil {
+		return fmt.Errorf("encoding packet: %w", err)
+	}
+	// the key flags override the packet's auth settings
+	authenticator, err := authFlags.NewAuthenticator(packet.Auth)
+	if err != nil {
+		return fmt.Errorf("loading authentication key: %w", err)
+	}
+	if authenticator != nil {
+		data = authenticator.Append(nil, data)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(*host, fmt.Sprint(packet.Port)))
+	if err != nil {
+		return fmt.Errorf("resolving address: %w", err)
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	fmt.Printf("Sending %s (%d bytes) to %s: %s\n", packet.Name, len(data), addr, util.Base16String(data, 1))
+	for i := 0; i < *count; i++ {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+		if _, err := conn.Write(data); err != nil {
+			return fmt.Errorf("sending packet: %w", err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with gsw_service: shm or socket")
+	flag.Parse()
+
+	if *packetName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
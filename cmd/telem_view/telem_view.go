@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/AarC10/GSW-V2/lib/client"
 	"github.com/AarC10/GSW-V2/lib/logger"
 	"github.com/AarC10/GSW-V2/lib/tlm"
 	"github.com/AarC10/GSW-V2/lib/util"
@@ -27,6 +30,7 @@ var fpsLimit = flag.Int("fps", 0, "max UI frames per second (0 = unlimited)")
 
 var updateCounter atomic.Uint64
 var pendingUpdate atomic.Bool
+var downReaders atomic.Int32 // Readers waiting for gsw_service to restart
 
 // padValue will left justify any string into a field of width valueColWidth
 func padValue(s string) string {
@@ -34,14 +38,25 @@ func padValue(s string) string {
 }
 
 func main() {
+	flag.Var(&proc.IpcBackend, "ipc", "IPC backend to share packets with gsw_service: shm or socket")
 	flag.Parse()
-	configData, err := proc.ReadTelemetryConfigFromShm(*shmDir)
+	var updateTitle func() // Shows in the title whether gsw_service is down, set once the UI is laid out
+	// the unattributed ring is only worth viewing when no vehicles are configured
+	c, err := client.New(client.Options{
+		ShmDir:         *shmDir,
+		AttributedOnly: true,
+		StateHandler: func(packet string, vehicle string, state proc.ReaderState) {
+			if state == proc.ReaderWriterDown {
+				downReaders.Add(1)
+			} else {
+				downReaders.Add(-1)
+			}
+			updateTitle()
+		},
+	})
 	if err != nil {
 		logger.Fatal("couldn't read config from gsw", zap.Error(err))
 	}
-	if _, err = proc.ParseConfigBytes(configData); err != nil {
-		logger.Fatal("couldn't parse gsw config", zap.Error(err))
-	}
 
 	var hexOn atomic.Bool
 	var binOn atomic.Bool
@@ -54,6 +69,15 @@ func main() {
 
 	// top bar: left title, right update rate
 	topLeft := tview.NewTextView().SetDynamicColors(true).SetText("[::b]Telemetry Viewer")
+	updateTitle = func() {
+		title := "[::b]Telemetry Viewer"
+		if downReaders.Load() > 0 {
+			title += "  [red]GSW DOWN, waiting for restart"
+		}
+		app.QueueUpdateDraw(func() {
+			topLeft.SetText(title)
+		})
+	}
 	topRight := tview.NewTextView().SetDynamicColors(true).SetTextAlign(tview.AlignRight).SetText("0FPS")
 	topBar := tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(topLeft, 0, 1, false).
@@ -76,7 +100,7 @@ func main() {
 			SetAlign(tview.AlignCenter))
 
 	row := 1
-	for _, packet := range proc.GswConfig.TelemetryPackets {
+	for _, packet := range c.Packets() {
 		for _, name := range packet.Measurements {
 			// pad the initial “–” in the Value column
 			table.SetCell(row, 0, tview.NewTableCell(name))
@@ -90,6 +114,9 @@ func main() {
 		row++
 	}
 
+	vehicles := c.Vehicles()
+	var selected atomic.Int32
+
 	statusBar := tview.NewTextView().
 		SetDynamicColors(true).
 		SetTextAlign(tview.AlignCenter)
@@ -101,7 +128,11 @@ func main() {
 		if binOn.Load() {
 			b = "ON"
 		}
-		statusBar.SetText(fmt.Sprintf("(h) HEX %s  | (b) BINARY %s ", h, b))
+		status := fmt.Sprintf("(h) HEX %s  | (b) BINARY %s ", h, b)
+		if vehicle := vehicles[selected.Load()]; vehicle != "" {
+			status += fmt.Sprintf(" | (v) VEHICLE %s ", vehicle)
+		}
+		statusBar.SetText(status)
 	}
 	updateStatus()
 
@@ -139,92 +170,48 @@ func main() {
 		}
 	}()
 
-	// live telem readers
+	// live telem, from every packet and vehicle. Only the selected vehicle is shown,
+	// but the latest update from every vehicle is kept so switching vehicles is immediate.
+	views := make(map[string]*packetView, len(c.Packets()))
 	rowIndex := 1
-	for _, packet := range proc.GswConfig.TelemetryPackets {
-		go func(pkt tlm.TelemetryPacket, baseRow int) {
-			log := logger.Log().Named("packet_reader").With(zap.String("packet", pkt.Name))
-			reader, err := proc.NewIpcShmReaderForPacket(pkt, *shmDir)
-			if err != nil {
-				log.Error("error creating reader", zap.Error(err))
-				return
-			}
-			defer reader.Cleanup()
+	for _, packet := range c.Packets() {
+		view := &packetView{
+			app:          app,
+			table:        table,
+			rows:         make(map[string]int, len(packet.Measurements)),
+			measurements: c.Measurements(),
+			latest:       make([]atomic.Pointer[[]client.Measurement], len(vehicles)),
+		}
+		for i, name := range packet.Measurements {
+			view.rows[name] = rowIndex + i
+		}
+		views[packet.Name] = view
+		rowIndex += len(packet.Measurements) + 1
+	}
+	vehicleIndex := make(map[string]int, len(vehicles))
+	for v, vehicle := range vehicles {
+		vehicleIndex[vehicle] = v
+	}
 
-			for {
-				p, err := reader.Read(context.TODO())
-				if err != nil {
-					log.Error("error reading packet", zap.Error(err))
-					continue
-				}
-				data := p.Data()
-
-				offset := 0
-
-				// prep slices to collect all updates for this packet
-				measCount := len(pkt.Measurements)
-				valStrs := make([]string, measCount)
-				hexStrs := make([]string, measCount)
-				binStrs := make([]string, measCount)
-
-				// capture flags locally so we avoid closure/capture races
-				hexLocal := hexOn.Load()
-				binLocal := binOn.Load()
-
-				for i, name := range pkt.Measurements {
-					meas, ok := proc.GswConfig.Measurements[name]
-					if !ok || offset+meas.Size > len(data) {
-						valStrs[i] = padValue("–")
-						continue
-					}
-					val, err := tlm.InterpretMeasurementValue(meas, data[offset:offset+meas.Size])
-					if err != nil {
-						val = "err"
-					}
-
-					// format value
-					switch v := val.(type) {
-					case float32, float64:
-						val = fmt.Sprintf("%.8f", v)
-					}
-					valStr := fmt.Sprintf("%v", val)
-					valStrs[i] = padValue(valStr)
-
-					// HEX
-					if hexLocal {
-						hexStrs[i] = util.Base16String(data[offset:offset+meas.Size], 1)
-					}
-
-					// BIN
-					if binLocal {
-						var parts []string
-						for _, b := range data[offset : offset+meas.Size] {
-							s := fmt.Sprintf("%08b", b)
-							parts = append(parts, s[:4]+" "+s[4:])
-						}
-						binStrs[i] = strings.Join(parts, " ")
-					}
-
-					offset += meas.Size
-				}
+	// the rows of the table are laid out for the packets' measurements at startup,
+	// so measurements added when gsw_service restarts aren't shown
+	go func() {
+		err := c.Subscribe(context.Background(), nil, func(update client.Update) {
+			view := views[update.Packet]
+			v := vehicleIndex[update.Vehicle]
+			measurements := slices.Clone(update.Measurements)
+			view.latest[v].Store(&measurements)
 
-				// enqueue UI mutation for the entire measurement group (batch)
-				app.QueueUpdate(func() {
-					for i := 0; i < measCount; i++ {
-						table.GetCell(baseRow+i, 1).SetText(valStrs[i])
-						table.GetCell(baseRow+i, 2).SetText(hexStrs[i])
-						table.GetCell(baseRow+i, 3).SetText(binStrs[i])
-					}
-				})
-				// mark pending updates to draw
-				pendingUpdate.Store(true)
+			if int(selected.Load()) == v {
+				view.render(measurements, hexOn.Load(), binOn.Load())
 			}
-		}(packet, rowIndex)
-
-		rowIndex += len(packet.Measurements) + 1
-	}
+		})
+		if err != nil {
+			logger.Error("error subscribing to telemetry", zap.Error(err))
+		}
+	}()
 
-	// Capture 'h' and 'b' globally
+	// Capture 'h', 'b' and 'v' globally
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Rune() {
 		case 'h', 'H':
@@ -233,6 +220,20 @@ func main() {
 		case 'b', 'B':
 			binOn.Store(!binOn.Load())
 			updateStatus()
+		case 'v', 'V':
+			if len(vehicles) < 2 {
+				break
+			}
+			v := (int(selected.Load()) + 1) % len(vehicles)
+			selected.Store(int32(v))
+			updateStatus()
+			for _, view := range views {
+				if measurements := view.latest[v].Load(); measurements != nil {
+					view.render(*measurements, hexOn.Load(), binOn.Load())
+				} else {
+					view.clear()
+				}
+			}
 		}
 		return event
 	})
@@ -254,3 +255,106 @@ func main() {
 		panic(err)
 	}
 }
+
+// packetView renders the measurements of a packet into its rows of the table.
+type packetView struct {
+	app          *tview.Application
+	table        *tview.Table
+	rows         map[string]int                         // Table row of each measurement
+	measurements map[string]tlm.Measurement             // Definitions of the measurements, to show their raw bytes
+	latest       []atomic.Pointer[[]client.Measurement] // Latest measurements from each vehicle
+
+	mu     sync.Mutex // Guards valBuf and rawBuf, since packets from several vehicles can be rendered at once
+	valBuf []byte
+	rawBuf []byte
+}
+
+// render formats measurements and queues an update of their rows.
+func (v *packetView) render(measurements []client.Measurement, hexOn bool, binOn bool) {
+	rows := make([]int, 0, len(measurements))
+	valStrs := make([]string, 0, len(measurements))
+	hexStrs := make([]string, 0, len(measurements))
+	binStrs := make([]string, 0, len(measurements))
+
+	v.mu.Lock()
+	for _, measurement := range measurements {
+		row, ok := v.rows[measurement.Name]
+		if !ok {
+			continue
+		}
+		rows = append(rows, row)
+		if measurement.Quality&tlm.QualityInvalid != 0 {
+			valStrs = append(valStrs, padValue("err"))
+		} else {
+			v.valBuf = measurement.Value.AppendFormat(v.valBuf[:0], 'f', 8)
+			valStrs = append(valStrs, padValue(string(v.valBuf)))
+		}
+
+		var raw []byte
+		if hexOn || binOn {
+			raw = v.raw(measurement)
+		}
+
+		// HEX
+		var hexStr string
+		if hexOn {
+			hexStr = util.Base16String(raw, 1)
+		}
+		hexStrs = append(hexStrs, hexStr)
+
+		// BIN
+		var binStr string
+		if binOn {
+			var parts []string
+			for _, b := range raw {
+				s := fmt.Sprintf("%08b", b)
+				parts = append(parts, s[:4]+" "+s[4:])
+			}
+			binStr = strings.Join(parts, " ")
+		}
+		binStrs = append(binStrs, binStr)
+	}
+	v.mu.Unlock()
+
+	v.update(rows, valStrs, hexStrs, binStrs)
+}
+
+// raw returns the bytes a measurement was sent as, encoded again from its value since gsw_service only shares values.
+// It returns nil for values that can't be encoded. The bytes are only valid until the next call.
+func (v *packetView) raw(measurement client.Measurement) []byte {
+	definition, ok := v.measurements[measurement.Name]
+	if !ok || measurement.Quality&tlm.QualityInvalid != 0 {
+		return nil
+	}
+	v.rawBuf = slices.Grow(v.rawBuf[:0], definition.Size)[:definition.Size]
+	if err := tlm.EncodeMeasurement(definition, measurement.Value, v.rawBuf); err != nil {
+		return nil
+	}
+	return v.rawBuf
+}
+
+// clear queues an update resetting the packet's rows to placeholders.
+func (v *packetView) clear() {
+	rows := make([]int, 0, len(v.rows))
+	for _, row := range v.rows {
+		rows = append(rows, row)
+	}
+	valStrs := make([]string, len(rows))
+	for i := range valStrs {
+		valStrs[i] = padValue("–")
+	}
+	v.update(rows, valStrs, make([]string, len(rows)), make([]string, len(rows)))
+}
+
+// update enqueues a UI mutation for the packet's measurements (batch)
+func (v *packetView) update(rows []int, valStrs, hexStrs, binStrs []string) {
+	v.app.QueueUpdate(func() {
+		for i, row := range rows {
+			v.table.GetCell(row, 1).SetText(valStrs[i])
+			v.table.GetCell(row, 2).SetText(hexStrs[i])
+			v.table.GetCell(row, 3).SetText(binStrs[i])
+		}
+	})
+	// mark pending updates to draw
+	pendingUpdate.Store(true)
+}
@@ -4,12 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
+
+	"github.com/AarC10/GSW-V2/lib/auth"
 )
 
 // Prints usage info for the application.
@@ -39,8 +42,11 @@ func openConn(host string, port int) (*net.UDPConn, error) {
 	return conn, nil
 }
 
-// Sends the given packet over the given connection.
-func sendOverUDP(conn *net.UDPConn, packet []byte) error {
+// Sends the given packet over the given connection, appending its tag if the authenticator isn't nil.
+func sendOverUDP(conn *net.UDPConn, packet []byte, authenticator *auth.Authenticator) error {
+	if authenticator != nil {
+		packet = authenticator.Append(nil, packet)
+	}
 	_, err := conn.Write(packet)
 	if err != nil {
 		return err
@@ -202,7 +208,7 @@ func promptInput(scanner *bufio.Scanner, history [][]byte, isAsciiMode bool) ([]
 }
 
 // Loop prompting for input.
-func mainInputLoop(scanner *bufio.Scanner, conn *net.UDPConn) {
+func mainInputLoop(scanner *bufio.Scanner, conn *net.UDPConn, authenticator *auth.Authenticator) {
 	history := make([][]byte, 0, 20)
 	isAsciiMode := false
 	for {
@@ -240,13 +246,23 @@ func mainInputLoop(scanner *bufio.Scanner, conn *net.UDPConn) {
 		} else {
 			fmt.Printf("\tSending payload %# x\n", payload)
 		}
-		if err := sendOverUDP(conn, payload); err != nil {
+		if err := sendOverUDP(conn, payload, authenticator); err != nil {
 			fmt.Println("\tError sending payload:", err)
 		}
 	}
 }
 
 func main() {
+	authFlags := auth.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// payloads are only authenticated if a key was given
+	authenticator, err := authFlags.NewAuthenticator(nil)
+	if err != nil {
+		fmt.Println("Error loading authentication key:", err)
+		return
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 	// Read in host and port, then open connection
 	host, port, err := promptConnInfo(scanner)
@@ -260,6 +276,9 @@ func main() {
 		return
 	}
 	fmt.Print("Connection opened.\n\n")
+	if authenticator != nil {
+		fmt.Printf("Appending %d byte authentication tags to payloads.\n", authenticator.TagSize())
+	}
 	fmt.Println("** For usage info, type 'help'. **")
-	mainInputLoop(scanner, conn)
+	mainInputLoop(scanner, conn, authenticator)
 }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"net"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/AarC10/GSW-V2/lib/auth"
 	"golang.org/x/term"
 )
 
@@ -43,7 +45,7 @@ func (ps *periodicState) isPaused() bool {
 	return ps.paused
 }
 
-func runPeriodicSender(conn *net.UDPConn, interval time.Duration, state *periodicState) {
+func runPeriodicSender(conn *net.UDPConn, interval time.Duration, state *periodicState, authenticator *auth.Authenticator) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	for range ticker.C {
@@ -53,7 +55,7 @@ func runPeriodicSender(conn *net.UDPConn, interval time.Duration, state *periodi
 		copy(payload, state.payload)
 		state.mu.Unlock()
 		if !paused && len(payload) > 0 {
-			if _, err := conn.Write(payload); err != nil {
+			if err := sendOverUDP(conn, payload, authenticator); err != nil {
 				fmt.Printf("\r\n\tPeriodic send error: %v\r\n", err)
 			}
 		}
@@ -86,7 +88,11 @@ func openConn(host string, port int) (*net.UDPConn, error) {
 	return conn, nil
 }
 
-func sendOverUDP(conn *net.UDPConn, packet []byte) error {
+// sendOverUDP sends a packet, appending its tag if the authenticator isn't nil.
+func sendOverUDP(conn *net.UDPConn, packet []byte, authenticator *auth.Authenticator) error {
+	if authenticator != nil {
+		packet = authenticator.Append(nil, packet)
+	}
 	_, err := conn.Write(packet)
 	return err
 }
@@ -247,7 +253,7 @@ func readRawLine(prompt string) (lineResult, error) {
 	}
 }
 
-func mainInputLoop(conn *net.UDPConn, periodic *periodicState) {
+func mainInputLoop(conn *net.UDPConn, periodic *periodicState, authenticator *auth.Authenticator) {
 	history := make([][]byte, 0, 20)
 	isAsciiMode := false
 
@@ -265,7 +271,7 @@ func mainInputLoop(conn *net.UDPConn, periodic *periodicState) {
 		} else {
 			fmt.Printf("\tSending payload %# x\r\n", payload)
 		}
-		if err := sendOverUDP(conn, payload); err != nil {
+		if err := sendOverUDP(conn, payload, authenticator); err != nil {
 			fmt.Printf("\tError sending payload: %v\r\n", err)
 		}
 		if periodic != nil {
@@ -384,6 +390,16 @@ func mainInputLoop(conn *net.UDPConn, periodic *periodicState) {
 }
 
 func main() {
+	authFlags := auth.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// payloads are only authenticated if a key was given
+	authenticator, err := authFlags.NewAuthenticator(nil)
+	if err != nil {
+		fmt.Println("Error loading authentication key:", err)
+		return
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 
 	host, port, err := promptConnInfo(scanner)
@@ -404,14 +420,17 @@ func main() {
 		return
 	}
 	fmt.Print("Connection opened.\n\n")
+	if authenticator != nil {
+		fmt.Printf("Appending %d byte authentication tags to payloads.\n", authenticator.TagSize())
+	}
 	fmt.Println("** For usage info, type 'help'. **")
 
 	var periodic *periodicState
 	if interval > 0 {
 		periodic = &periodicState{}
-		go runPeriodicSender(conn, interval, periodic)
+		go runPeriodicSender(conn, interval, periodic, authenticator)
 		fmt.Printf("Periodic sending every %v. Press Ctrl+P to pause/unpause.\n\n", interval)
 	}
 
-	mainInputLoop(conn, periodic)
+	mainInputLoop(conn, periodic, authenticator)
 }
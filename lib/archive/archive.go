@@ -0,0 +1,151 @@
+// Package archive stores received datagrams in rotating segment files, each with an index of its records.
+//
+// A segment is a data file holding the records and an index file holding the time, port and offset of each record,
+// both starting with an 8 byte magic. Records are little endian:
+//
+//	offset  size  field
+//	0       4     CRC-32 (IEEE) of the rest of the record
+//	4       4     data length
+//	8       8     receive time, Unix nanoseconds
+//	16      2     port
+//	18      16    source address, IPv4 addresses mapped to IPv6
+//	34      1     source address family: 0 none, 4 IPv4, 6 IPv6
+//	35      1     reserved
+//	36            data
+//
+// Index entries are the receive time (8 bytes), record offset (8 bytes), port (2 bytes), 2 reserved bytes and data length (4 bytes).
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	recordHeaderSize = 36
+	indexEntrySize   = 24
+	magicSize        = 8
+
+	dataExtension  = ".archive"
+	indexExtension = ".index"
+
+	// segmentTimeFormat names segments by the receive time of their first record, so they sort by time
+	segmentTimeFormat = "20060102T150405.000000000Z"
+)
+
+var (
+	dataMagic  = [magicSize]byte{'G', 'S', 'W', 'A', 'R', 'C', 0, 1}
+	indexMagic = [magicSize]byte{'G', 'S', 'W', 'I', 'D', 'X', 0, 1}
+)
+
+// ErrCorrupt is returned when a record fails its checksum or an archive file has the wrong magic.
+var ErrCorrupt = errors.New("corrupt archive")
+
+// Record is an archived datagram.
+type Record struct {
+	Time   time.Time  // Time the datagram was received
+	Port   uint16     // Port of the telemetry packet the datagram was received for
+	Source netip.Addr // Address the datagram was sent from. Invalid for serial sources
+	Data   []byte     // Raw datagram
+}
+
+// appendRecord appends the encoding of a record to dst.
+func appendRecord(dst []byte, record Record) []byte {
+	start := len(dst)
+	dst = append(dst, make([]byte, recordHeaderSize)...)
+	header := dst[start:]
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(record.Data)))
+	binary.LittleEndian.PutUint64(header[8:16], uint64(record.Time.UnixNano()))
+	binary.LittleEndian.PutUint16(header[16:18], record.Port)
+	if record.Source.IsValid() {
+		address := record.Source.As16()
+		copy(header[18:34], address[:])
+		header[34] = 6
+		if record.Source.Is4() {
+			header[34] = 4
+		}
+	}
+	dst = append(dst, record.Data...)
+	binary.LittleEndian.PutUint32(dst[start:start+4], crc32.ChecksumIEEE(dst[start+4:]))
+	return dst
+}
+
+// decodeRecordHeader returns the data length declared by a record header.
+func decodeRecordHeader(header []byte) int {
+	return int(binary.LittleEndian.Uint32(header[4:8]))
+}
+
+// decodeRecord decodes a whole record. The record's data aliases encoded.
+func decodeRecord(encoded []byte) (Record, error) {
+	if crc32.ChecksumIEEE(encoded[4:]) != binary.LittleEndian.Uint32(encoded[0:4]) {
+		return Record{}, fmt.Errorf("%w: record checksum mismatch", ErrCorrupt)
+	}
+
+	record := Record{
+		Time: time.Unix(0, int64(binary.LittleEndian.Uint64(encoded[8:16]))),
+		Port: binary.LittleEndian.Uint16(encoded[16:18]),
+		Data: encoded[recordHeaderSize:],
+	}
+	switch encoded[34] {
+	case 4:
+		record.Source = netip.AddrFrom16([16]byte(encoded[18:34])).Unmap()
+	case 6:
+		record.Source = netip.AddrFrom16([16]byte(encoded[18:34]))
+	}
+	return record, nil
+}
+
+// indexEntry locates a record in its segment's data file.
+type indexEntry struct {
+	time   int64 // Unix nanoseconds
+	offset int64
+	port   uint16
+	length int // Data length
+}
+
+func (e indexEntry) end() int64 {
+	return e.offset + recordHeaderSize + int64(e.length)
+}
+
+func appendIndexEntry(dst []byte, entry indexEntry) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(entry.time))
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(entry.offset))
+	dst = binary.LittleEndian.AppendUint16(dst, entry.port)
+	dst = append(dst, 0, 0)
+	return binary.LittleEndian.AppendUint32(dst, uint32(entry.length))
+}
+
+func decodeIndexEntry(encoded []byte) indexEntry {
+	return indexEntry{
+		time:   int64(binary.LittleEndian.Uint64(encoded[0:8])),
+		offset: int64(binary.LittleEndian.Uint64(encoded[8:16])),
+		port:   binary.LittleEndian.Uint16(encoded[16:18]),
+		length: int(binary.LittleEndian.Uint32(encoded[20:24])),
+	}
+}
+
+// segmentName returns the name of a segment starting at t, without an extension.
+func segmentName(t time.Time) string {
+	return t.UTC().Format(segmentTimeFormat)
+}
+
+// segmentPaths returns the data and index paths of the segments in dir, oldest first.
+func segmentPaths(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+dataExtension))
+	if err != nil {
+		return nil, err
+	}
+	// Glob sorts its matches, and segment names sort by time
+	return paths, nil
+}
+
+// indexPath returns the index path of a segment's data file.
+func indexPath(dataPath string) string {
+	return strings.TrimSuffix(dataPath, dataExtension) + indexExtension
+}
@@ -0,0 +1,228 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testRecords returns records received a second apart on alternating ports.
+func testRecords(n int) []Record {
+	sources := []netip.Addr{netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("fd00::5"), {}}
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{
+			Time:   testStart.Add(time.Duration(i) * time.Second),
+			Port:   uint16(10000 + i%2),
+			Source: sources[i%len(sources)],
+			Data:   bytes.Repeat([]byte{byte(i)}, 10+i),
+		}
+	}
+	return records
+}
+
+// writeRecords writes records to a new archive and closes it.
+func writeRecords(t *testing.T, config Config, records []Record) {
+	t.Helper()
+	writer, err := NewWriter(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, record := range records {
+		if err := writer.Write(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// readRecords returns the records selected by a filter, copying their data.
+func readRecords(t *testing.T, dir string, filter Filter) []Record {
+	t.Helper()
+	var records []Record
+	err := Read(dir, filter, func(record Record) error {
+		record.Data = bytes.Clone(record.Data)
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return records
+}
+
+func compareRecords(t *testing.T, expected []Record, actual []Record) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d records, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if !actual[i].Time.Equal(expected[i].Time) || actual[i].Port != expected[i].Port ||
+			actual[i].Source != expected[i].Source || !bytes.Equal(actual[i].Data, expected[i].Data) {
+			t.Errorf("expected %+v, got %+v", expected[i], actual[i])
+		}
+	}
+}
+
+func TestReadFilter(t *testing.T) {
+	dir := t.TempDir()
+	records := testRecords(6)
+	writeRecords(t, Config{Dir: dir}, records)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []Record
+	}{
+		{"all", Filter{}, records},
+		{"time", Filter{Start: testStart.Add(2 * time.Second), End: testStart.Add(4 * time.Second)}, records[2:4]},
+		{"port", Filter{Ports: []uint16{10001}}, []Record{records[1], records[3], records[5]}},
+		{"source", Filter{Sources: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")}}, []Record{records[0], records[3]}},
+		{"nothing", Filter{Ports: []uint16{9999}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compareRecords(t, tt.expected, readRecords(t, dir, tt.filter))
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		segments int
+		first    int // Index of the first record still archived
+	}{
+		{"size", Config{SegmentSize: 150}, 4, 0},
+		{"duration", Config{SegmentDuration: 3 * time.Second}, 3, 0},
+		{"retention", Config{SegmentDuration: 3 * time.Second, MaxSize: 400}, 2, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Dir = t.TempDir()
+			records := testRecords(8)
+			writeRecords(t, tt.config, records)
+
+			segments, err := Segments(tt.config.Dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(segments) != tt.segments {
+				t.Fatalf("expected %d segments, got %d", tt.segments, len(segments))
+			}
+			if !segments[0].Start.Equal(records[tt.first].Time) || !segments[len(segments)-1].End.Equal(records[7].Time) {
+				t.Errorf("expected segments from %s to %s, got %+v", records[tt.first].Time, records[7].Time, segments)
+			}
+			compareRecords(t, records[tt.first:], readRecords(t, tt.config.Dir, Filter{}))
+		})
+	}
+}
+
+func TestRetentionAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	records := testRecords(5)
+	writeRecords(t, Config{Dir: dir}, records[:3])
+	// the segment left by the previous writer counts towards the size limit
+	writeRecords(t, Config{Dir: dir, SegmentSize: 1, MaxSize: 300}, records[3:])
+
+	compareRecords(t, records[3:], readRecords(t, dir, Filter{}))
+}
+
+func TestRecovery(t *testing.T) {
+	dir := t.TempDir()
+	records := testRecords(4)
+	writeRecords(t, Config{Dir: dir}, records)
+	segments, err := Segments(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := segments[0].Path
+
+	// an index that is missing its last entries and a partially written record, as left by a crash
+	index, err := os.ReadFile(indexPath(path))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(indexPath(path), index[:magicSize+indexEntrySize], 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	partial := appendRecord(nil, records[0])
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	file.Write(partial[:len(partial)-1])
+	file.Close()
+
+	segments, err = Segments(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if segments[0].Records != len(records) {
+		t.Errorf("expected %d records, got %d", len(records), segments[0].Records)
+	}
+	compareRecords(t, records, readRecords(t, dir, Filter{}))
+}
+
+func TestCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, Config{Dir: dir}, testRecords(2))
+	segments, err := Segments(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(segments[0].Path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data[magicSize+recordHeaderSize] ^= 0xFF
+	if err := os.WriteFile(segments[0].Path, data, 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = Read(dir, Filter{}, func(Record) error { return nil })
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestHeaderWriteError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+	dir := t.TempDir()
+	records := testRecords(2)
+	// the index of the first segment is linked to a device that is always full
+	path := filepath.Join(dir, segmentName(records[0].Time)+dataExtension)
+	if err := os.Symlink("/dev/full", indexPath(path)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writer, err := NewWriter(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.Write(records[0]); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	// the segment that couldn't be started is removed, and the next record starts a new one
+	if err := writer.Write(records[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	compareRecords(t, records[1:], readRecords(t, dir, Filter{}))
+}
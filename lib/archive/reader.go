@@ -0,0 +1,239 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+)
+
+// Segment summarizes a segment of an archive.
+type Segment struct {
+	Path    string    // Path of the segment's data file
+	Start   time.Time // Earliest receive time in the segment
+	End     time.Time // Latest receive time in the segment
+	Records int       // Number of records
+	Size    int64     // Size of the data file in bytes
+}
+
+// Filter selects archived records. Its zero value selects every record.
+type Filter struct {
+	Start   time.Time      // Only records received at or after this time, if set
+	End     time.Time      // Only records received before this time, if set
+	Ports   []uint16       // Only records for these ports, if any
+	Sources []netip.Prefix // Only records sent from these addresses, if any
+}
+
+// matchesEntry checks the fields of a filter that are in the index.
+func (f Filter) matchesEntry(entry indexEntry) bool {
+	if !f.Start.IsZero() && entry.time < f.Start.UnixNano() {
+		return false
+	}
+	if !f.End.IsZero() && entry.time >= f.End.UnixNano() {
+		return false
+	}
+	return len(f.Ports) == 0 || slices.Contains(f.Ports, entry.port)
+}
+
+// Match reports whether a record is selected by the filter.
+func (f Filter) Match(record Record) bool {
+	entry := indexEntry{time: record.Time.UnixNano(), port: record.Port}
+	if !f.matchesEntry(entry) {
+		return false
+	}
+	if len(f.Sources) == 0 {
+		return true
+	}
+	source := record.Source.Unmap()
+	for _, prefix := range f.Sources {
+		if prefix.Contains(source) {
+			return true
+		}
+	}
+	return false
+}
+
+// Segments returns a summary of each segment in an archive directory, oldest first.
+func Segments(dir string) ([]Segment, error) {
+	paths, err := segmentPaths(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]Segment, 0, len(paths))
+	for _, path := range paths {
+		entries, size, err := readSegmentIndex(path)
+		if err != nil {
+			return nil, err
+		}
+		segment := Segment{Path: path, Records: len(entries), Size: size}
+		for i, entry := range entries {
+			t := time.Unix(0, entry.time)
+			if i == 0 || t.Before(segment.Start) {
+				segment.Start = t
+			}
+			if i == 0 || t.After(segment.End) {
+				segment.End = t
+			}
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// Read calls fn with each record in an archive directory selected by filter, oldest segment first.
+// The record's data is only valid until fn returns. Read stops at the first error returned by fn.
+func Read(dir string, filter Filter, fn func(Record) error) error {
+	paths, err := segmentPaths(dir)
+	if err != nil {
+		return err
+	}
+
+	var buffer []byte
+	for _, path := range paths {
+		entries, _, err := readSegmentIndex(path)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(entries, filter.matchesEntry) {
+			continue
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !filter.matchesEntry(entry) {
+				continue
+			}
+			size := recordHeaderSize + entry.length
+			if cap(buffer) < size {
+				buffer = make([]byte, size)
+			}
+			buffer = buffer[:size]
+			if _, err := file.ReadAt(buffer, entry.offset); err != nil {
+				file.Close()
+				return fmt.Errorf("reading %s: %w", path, err)
+			}
+			record, err := decodeRecord(buffer)
+			if err != nil {
+				file.Close()
+				return fmt.Errorf("reading %s at %d: %w", path, entry.offset, err)
+			}
+			if !filter.Match(record) {
+				continue
+			}
+			if err := fn(record); err != nil {
+				file.Close()
+				return err
+			}
+		}
+		file.Close()
+	}
+	return nil
+}
+
+// readSegmentIndex returns the index entries of a segment and the size of its data file.
+// Records the index is missing, such as those written before a crash, are recovered from the data file,
+// and a partially written record at its end is ignored.
+func readSegmentIndex(path string) ([]indexEntry, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	size := info.Size()
+	if size < magicSize {
+		// a segment that was just started, before its magic was flushed
+		return nil, size, nil
+	}
+
+	var magic [magicSize]byte
+	if _, err := io.ReadFull(file, magic[:]); err != nil || magic != dataMagic {
+		return nil, size, fmt.Errorf("%w: %s is not an archive segment", ErrCorrupt, path)
+	}
+
+	entries, err := readIndexFile(indexPath(path))
+	if err != nil {
+		return nil, size, err
+	}
+	// the index can be flushed ahead of the data it refers to
+	for len(entries) > 0 && entries[len(entries)-1].end() > size {
+		entries = entries[:len(entries)-1]
+	}
+
+	offset := int64(magicSize)
+	if len(entries) > 0 {
+		offset = entries[len(entries)-1].end()
+	}
+	if offset < size {
+		recovered, err := scanRecords(file, offset, size)
+		if err != nil {
+			return nil, size, fmt.Errorf("recovering %s: %w", path, err)
+		}
+		entries = append(entries, recovered...)
+	}
+	return entries, size, nil
+}
+
+// readIndexFile reads the entries of an index file. A missing index has no entries.
+func readIndexFile(path string) ([]indexEntry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < magicSize || [magicSize]byte(data[:magicSize]) != indexMagic {
+		return nil, fmt.Errorf("%w: %s is not an archive index", ErrCorrupt, path)
+	}
+
+	data = data[magicSize:]
+	entries := make([]indexEntry, 0, len(data)/indexEntrySize)
+	for len(data) >= indexEntrySize {
+		entries = append(entries, decodeIndexEntry(data[:indexEntrySize]))
+		data = data[indexEntrySize:]
+	}
+	return entries, nil
+}
+
+// scanRecords reads the records of a data file of the given size from offset, stopping at its end or a partially written record.
+func scanRecords(file *os.File, offset int64, size int64) ([]indexEntry, error) {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+
+	var entries []indexEntry
+	var buffer []byte
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return entries, nil
+		}
+		length := decodeRecordHeader(header)
+		if offset+recordHeaderSize+int64(length) > size {
+			return entries, nil
+		}
+		buffer = append(append(buffer[:0], header...), make([]byte, length)...)
+		if _, err := io.ReadFull(reader, buffer[recordHeaderSize:]); err != nil {
+			return entries, nil
+		}
+		record, err := decodeRecord(buffer)
+		if err != nil {
+			return entries, nil
+		}
+		entries = append(entries, indexEntry{time: record.Time.UnixNano(), offset: offset, port: record.Port, length: length})
+		offset += int64(len(buffer))
+	}
+}
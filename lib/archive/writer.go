@@ -0,0 +1,217 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Default segment rotation limits
+const (
+	DefaultSegmentSize     = 64 << 20
+	DefaultSegmentDuration = time.Hour
+)
+
+// Config configures an archive Writer.
+type Config struct {
+	Dir             string        // Directory holding the segments
+	SegmentSize     int64         // Size in bytes after which a new segment is started, DefaultSegmentSize if 0
+	SegmentDuration time.Duration // Age after which a new segment is started, DefaultSegmentDuration if 0
+	MaxSize         int64         // Total size of the segments in bytes, beyond which the oldest are deleted. 0 keeps every segment
+}
+
+// closedSegment is a segment that is no longer written, for retention.
+type closedSegment struct {
+	path string
+	size int64 // Size of the data and index files
+}
+
+// Writer appends records to the newest segment of an archive, rotating segments by size and age.
+// It is not safe for concurrent use.
+type Writer struct {
+	config Config
+
+	data      *os.File
+	dataBuf   *bufio.Writer
+	index     *os.File
+	indexBuf  *bufio.Writer
+	size      int64     // Size of the open segment's data and index files
+	offset    int64     // Offset of the next record in the open data file
+	started   time.Time // Receive time of the first record in the open segment
+	segments  []closedSegment
+	totalSize int64 // Size of the closed segments
+	scratch   []byte
+}
+
+// NewWriter creates a Writer, creating the archive directory if needed.
+// Existing segments are kept and count towards MaxSize.
+func NewWriter(config Config) (*Writer, error) {
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DefaultSegmentSize
+	}
+	if config.SegmentDuration <= 0 {
+		config.SegmentDuration = DefaultSegmentDuration
+	}
+	if config.MaxSize < 0 {
+		return nil, fmt.Errorf("max size specified as %d, must not be negative", config.MaxSize)
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating archive directory: %w", err)
+	}
+
+	w := &Writer{config: config}
+	paths, err := segmentPaths(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		segment := closedSegment{path: path, size: fileSize(path) + fileSize(indexPath(path))}
+		w.segments = append(w.segments, segment)
+		w.totalSize += segment.size
+	}
+	return w, nil
+}
+
+// fileSize returns the size of a file, or 0 if it can't be read.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Write appends a record, starting a new segment first if the open one is full or too old.
+func (w *Writer) Write(record Record) error {
+	if w.data != nil && (w.size >= w.config.SegmentSize || record.Time.Sub(w.started) >= w.config.SegmentDuration) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	if w.data == nil {
+		if err := w.open(record.Time); err != nil {
+			return err
+		}
+	}
+
+	w.scratch = appendRecord(w.scratch[:0], record)
+	if _, err := w.dataBuf.Write(w.scratch); err != nil {
+		return fmt.Errorf("writing %s: %w", w.data.Name(), err)
+	}
+	entry := indexEntry{time: record.Time.UnixNano(), offset: w.offset, port: record.Port, length: len(record.Data)}
+	w.offset += int64(len(w.scratch))
+
+	w.scratch = appendIndexEntry(w.scratch[:0], entry)
+	if _, err := w.indexBuf.Write(w.scratch); err != nil {
+		return fmt.Errorf("writing %s: %w", w.index.Name(), err)
+	}
+	w.size += recordHeaderSize + int64(len(record.Data)) + indexEntrySize
+	return nil
+}
+
+// open starts a new segment named after the receive time of its first record.
+func (w *Writer) open(started time.Time) error {
+	var data *os.File
+	var path string
+	for {
+		path = filepath.Join(w.config.Dir, segmentName(started)+dataExtension)
+		var err error
+		data, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("creating archive segment: %w", err)
+		}
+		// keep names unique and ordered when a segment starts within the same nanosecond
+		started = started.Add(time.Nanosecond)
+	}
+	index, err := os.OpenFile(indexPath(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		data.Close()
+		os.Remove(path)
+		return fmt.Errorf("creating archive index: %w", err)
+	}
+
+	// the magic is written unbuffered, so a segment that can't be written is removed instead of left without a header
+	if _, err := data.Write(dataMagic[:]); err != nil {
+		removeSegment(data, index)
+		return fmt.Errorf("writing %s: %w", data.Name(), err)
+	}
+	if _, err := index.Write(indexMagic[:]); err != nil {
+		removeSegment(data, index)
+		return fmt.Errorf("writing %s: %w", index.Name(), err)
+	}
+
+	w.data, w.dataBuf = data, bufio.NewWriterSize(data, 64*1024)
+	w.index, w.indexBuf = index, bufio.NewWriterSize(index, 16*1024)
+	w.size, w.offset, w.started = 2*magicSize, magicSize, started
+	return nil
+}
+
+// removeSegment closes and deletes a segment that couldn't be started.
+func removeSegment(data *os.File, index *os.File) {
+	data.Close()
+	index.Close()
+	os.Remove(data.Name())
+	os.Remove(index.Name())
+}
+
+// rotate closes the open segment and deletes the oldest segments beyond MaxSize.
+func (w *Writer) rotate() error {
+	path, size := w.data.Name(), w.size
+	if err := w.closeSegment(); err != nil {
+		return err
+	}
+	w.segments = append(w.segments, closedSegment{path: path, size: size})
+	w.totalSize += size
+
+	if w.config.MaxSize == 0 {
+		return nil
+	}
+	for len(w.segments) > 0 && w.totalSize > w.config.MaxSize {
+		oldest := w.segments[0]
+		if err := os.Remove(oldest.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("deleting archive segment: %w", err)
+		}
+		if err := os.Remove(indexPath(oldest.path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("deleting archive index: %w", err)
+		}
+		w.segments = w.segments[1:]
+		w.totalSize -= oldest.size
+	}
+	return nil
+}
+
+// Flush writes buffered records to the open segment.
+func (w *Writer) Flush() error {
+	if w.data == nil {
+		return nil
+	}
+	if err := w.dataBuf.Flush(); err != nil {
+		return fmt.Errorf("writing %s: %w", w.data.Name(), err)
+	}
+	if err := w.indexBuf.Flush(); err != nil {
+		return fmt.Errorf("writing %s: %w", w.index.Name(), err)
+	}
+	return nil
+}
+
+// closeSegment flushes and closes the open segment.
+func (w *Writer) closeSegment() error {
+	err := w.Flush()
+	err = errors.Join(err, w.data.Close(), w.index.Close())
+	w.data, w.index = nil, nil
+	return err
+}
+
+// Close flushes and closes the open segment.
+func (w *Writer) Close() error {
+	if w.data == nil {
+		return nil
+	}
+	return w.closeSegment()
+}
@@ -0,0 +1,180 @@
+// Package auth authenticates packets with a truncated HMAC-SHA256 tag appended to their data.
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// DefaultTagSize is the tag size in bytes when Config.TagSize is not set.
+const DefaultTagSize = 16
+
+// MinTagSize is the smallest tag accepted, below which forging a tag by guessing becomes practical.
+const MinTagSize = 8
+
+// MinKeySize is the smallest key accepted in bytes.
+const MinKeySize = 16
+
+// ErrInvalidTag is returned when a packet's tag doesn't match its data.
+var ErrInvalidTag = errors.New("invalid authentication tag")
+
+// Config describes the key and tag used to authenticate a packet.
+// The key is hex encoded, read from a file or an environment variable so it stays out of the config.
+type Config struct {
+	KeyFile string `yaml:"key_file,omitempty"` // File holding the hex encoded key (e.g. /etc/gsw/downlink.key)
+	KeyEnv  string `yaml:"key_env,omitempty"`  // Environment variable holding the hex encoded key, instead of a file
+	TagSize int    `yaml:"tag_size,omitempty"` // Size of the truncated tag in bytes (8-32). Defaults to 16
+}
+
+// Validate checks the config without loading the key.
+func (c Config) Validate() error {
+	if (c.KeyFile == "") == (c.KeyEnv == "") {
+		return fmt.Errorf("exactly one of key_file and key_env must be set")
+	}
+	if size := c.TagSizeOrDefault(); size < MinTagSize || size > sha256.Size {
+		return fmt.Errorf("tag_size %d must be between %d and %d", size, MinTagSize, sha256.Size)
+	}
+	return nil
+}
+
+// TagSizeOrDefault returns the tag size, or DefaultTagSize if it isn't set.
+func (c Config) TagSizeOrDefault() int {
+	if c.TagSize == 0 {
+		return DefaultTagSize
+	}
+	return c.TagSize
+}
+
+// NewAuthenticator loads the key and creates an Authenticator.
+func (c Config) NewAuthenticator() (*Authenticator, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := LoadKey(c.KeyFile, c.KeyEnv)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(key, c.TagSizeOrDefault())
+}
+
+// FlagConfig holds the key flags of a tool sending authenticated packets, set by RegisterFlags.
+type FlagConfig struct {
+	KeyFile string
+	KeyEnv  string
+	TagSize int // 0 keeps the configured tag size
+}
+
+// RegisterFlags defines the -key-file, -key-env and -tag-size flags on a flag set,
+// returning the config they are parsed into.
+func RegisterFlags(flags *flag.FlagSet) *FlagConfig {
+	var config FlagConfig
+	flags.StringVar(&config.KeyFile, "key-file", "", "file holding the hex encoded HMAC key to append authentication tags with")
+	flags.StringVar(&config.KeyEnv, "key-env", "", "environment variable holding the hex encoded HMAC key, instead of -key-file")
+	flags.IntVar(&config.TagSize, "tag-size", 0, fmt.Sprintf("size of the appended authentication tag in bytes. Defaults to the configured tag size, or %d", DefaultTagSize))
+	return &config
+}
+
+// NewAuthenticator loads the key given by the flags and creates an Authenticator,
+// using the configured auth settings for a key or tag size the flags don't give.
+// Returns nil if neither the flags nor the configured settings give a key.
+func (f *FlagConfig) NewAuthenticator(configured *Config) (*Authenticator, error) {
+	var config Config
+	if configured != nil {
+		config = *configured
+	}
+	if f.KeyFile != "" || f.KeyEnv != "" {
+		config.KeyFile, config.KeyEnv = f.KeyFile, f.KeyEnv
+	} else if configured == nil {
+		return nil, nil
+	}
+	if f.TagSize != 0 {
+		config.TagSize = f.TagSize
+	}
+	return config.NewAuthenticator()
+}
+
+// LoadKey reads a hex encoded key from a file, or from an environment variable if file is empty.
+// Surrounding whitespace is ignored, so keys generated with `openssl rand -hex 32 > key` can be used as is.
+func LoadKey(file string, env string) ([]byte, error) {
+	var encoded []byte
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading key: %w", err)
+		}
+		encoded = data
+	} else {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return nil, fmt.Errorf("key environment variable %s is not set", env)
+		}
+		encoded = []byte(value)
+	}
+
+	encoded = bytes.TrimSpace(encoded)
+	key := make([]byte, hex.DecodedLen(len(encoded)))
+	if _, err := hex.Decode(key, encoded); err != nil {
+		return nil, fmt.Errorf("key is not hex encoded: %w", err)
+	}
+	if len(key) < MinKeySize {
+		return nil, fmt.Errorf("key has %d bytes, less than %d", len(key), MinKeySize)
+	}
+	return key, nil
+}
+
+// Authenticator appends and verifies truncated HMAC-SHA256 tags.
+// It is safe for concurrent use.
+type Authenticator struct {
+	key     []byte
+	tagSize int
+}
+
+// NewAuthenticator creates an Authenticator with a key and a tag size in bytes.
+func NewAuthenticator(key []byte, tagSize int) (*Authenticator, error) {
+	if len(key) < MinKeySize {
+		return nil, fmt.Errorf("key has %d bytes, less than %d", len(key), MinKeySize)
+	}
+	if tagSize < MinTagSize || tagSize > sha256.Size {
+		return nil, fmt.Errorf("tag size %d must be between %d and %d", tagSize, MinTagSize, sha256.Size)
+	}
+	return &Authenticator{key: bytes.Clone(key), tagSize: tagSize}, nil
+}
+
+// TagSize returns the size of the tag appended to packets in bytes.
+func (a *Authenticator) TagSize() int {
+	return a.tagSize
+}
+
+// tag computes the truncated tag of data, appending it to dst.
+func (a *Authenticator) tag(dst []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(data)
+	var sum [sha256.Size]byte
+	return append(dst, mac.Sum(sum[:0])[:a.tagSize]...)
+}
+
+// Append appends data and its tag to dst and returns the extended slice.
+func (a *Authenticator) Append(dst []byte, data []byte) []byte {
+	dst = append(dst, data...)
+	return a.tag(dst, data)
+}
+
+// Verify checks the tag at the end of a packet, returning the data without it.
+// The returned slice shares the packet's memory.
+func (a *Authenticator) Verify(packet []byte) ([]byte, error) {
+	if len(packet) < a.tagSize {
+		return nil, fmt.Errorf("%w: packet of %d bytes is shorter than the tag", ErrInvalidTag, len(packet))
+	}
+	data := packet[:len(packet)-a.tagSize]
+	var expected [sha256.Size]byte
+	if !hmac.Equal(a.tag(expected[:0], data), packet[len(data):]) {
+		return nil, ErrInvalidTag
+	}
+	return data, nil
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestAuthenticator(t *testing.T) {
+	key, _ := hex.DecodeString(testKey)
+	a, err := NewAuthenticator(key, DefaultTagSize)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data := []byte{1, 2, 3, 4}
+	packet := a.Append(nil, data)
+	if len(packet) != len(data)+DefaultTagSize {
+		t.Fatalf("expected %d bytes, got %d", len(data)+DefaultTagSize, len(packet))
+	}
+	// the tag is the first bytes of HMAC-SHA256(key, data)
+	expected, _ := hex.DecodeString("e3ba74ad607691672b924220aa54ba7c")
+	if !bytes.Equal(packet[len(data):], expected) {
+		t.Errorf("expected tag % X, got % X", expected, packet[len(data):])
+	}
+
+	verified, err := a.Verify(packet)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(verified, data) {
+		t.Errorf("expected % X, got % X", data, verified)
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{"flipped data", append([]byte{0}, packet[1:]...)},
+		{"flipped tag", append(bytes.Clone(packet[:len(packet)-1]), packet[len(packet)-1]^1)},
+		{"no tag", data},
+		{"short", packet[:3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.Verify(tt.packet); !errors.Is(err, ErrInvalidTag) {
+				t.Errorf("expected ErrInvalidTag, got %v", err)
+			}
+		})
+	}
+
+	other, err := NewAuthenticator(bytes.Repeat([]byte{0xAA}, MinKeySize), DefaultTagSize)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := other.Verify(packet); err == nil {
+		t.Errorf("expected an error verifying with another key, got nil")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"file", Config{KeyFile: "downlink.key"}, false},
+		{"env", Config{KeyEnv: "GSW_KEY", TagSize: 32}, false},
+		{"no key", Config{}, true},
+		{"both keys", Config{KeyFile: "downlink.key", KeyEnv: "GSW_KEY"}, true},
+		{"short tag", Config{KeyFile: "downlink.key", TagSize: 4}, true},
+		{"long tag", Config{KeyFile: "downlink.key", TagSize: 33}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return path
+	}
+	t.Setenv("GSW_TEST_KEY", testKey)
+	t.Setenv("GSW_TEST_SHORT_KEY", "0011")
+
+	tests := []struct {
+		name    string
+		file    string
+		env     string
+		wantErr bool
+	}{
+		{"file", write("key", testKey+"\n"), "", false},
+		{"env", "", "GSW_TEST_KEY", false},
+		{"missing file", filepath.Join(dir, "missing"), "", true},
+		{"unset env", "", "GSW_TEST_UNSET_KEY", true},
+		{"not hex", write("bad", "not a key"), "", true},
+		{"short", "", "GSW_TEST_SHORT_KEY", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := LoadKey(tt.file, tt.env)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if hex.EncodeToString(key) != testKey {
+				t.Errorf("expected %s, got %x", testKey, key)
+			}
+		})
+	}
+}
+
+func TestFlagConfig(t *testing.T) {
+	t.Setenv("GSW_TEST_KEY", testKey)
+	t.Setenv("GSW_TEST_OTHER_KEY", "aa"+testKey[2:])
+	configured := &Config{KeyEnv: "GSW_TEST_OTHER_KEY", TagSize: 12}
+
+	tests := []struct {
+		name       string
+		args       []string
+		configured *Config
+		tagSize    int // 0 if no authenticator is expected
+		wantErr    bool
+	}{
+		{"no key", nil, nil, 0, false},
+		{"flag key", []string{"-key-env", "GSW_TEST_KEY"}, nil, DefaultTagSize, false},
+		{"flag tag size", []string{"-key-env", "GSW_TEST_KEY", "-tag-size", "8"}, nil, 8, false},
+		{"configured", nil, configured, 12, false},
+		{"configured tag size", []string{"-tag-size", "32"}, configured, 32, false},
+		{"flag key over configured", []string{"-key-env", "GSW_TEST_KEY"}, configured, 12, false},
+		{"both keys", []string{"-key-env", "GSW_TEST_KEY", "-key-file", "key"}, nil, 0, true},
+		{"short tag", []string{"-key-env", "GSW_TEST_KEY", "-tag-size", "4"}, nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := flag.NewFlagSet(tt.name, flag.ContinueOnError)
+			config := RegisterFlags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			a, err := config.NewAuthenticator(tt.configured)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.tagSize == 0 {
+				if a != nil {
+					t.Errorf("expected no authenticator, got one")
+				}
+				return
+			}
+			if a == nil {
+				t.Fatalf("expected an authenticator, got nil")
+			}
+			if a.TagSize() != tt.tagSize {
+				t.Errorf("expected tag size %d, got %d", tt.tagSize, a.TagSize())
+			}
+		})
+	}
+
+	// the key given by the flags replaces the configured key
+	flags := flag.NewFlagSet("key", flag.ContinueOnError)
+	config := RegisterFlags(flags)
+	if err := flags.Parse([]string{"-key-env", "GSW_TEST_KEY"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a, err := config.NewAuthenticator(configured)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key, _ := hex.DecodeString(testKey)
+	expected, _ := NewAuthenticator(key, 12)
+	if !bytes.Equal(a.Append(nil, []byte{1}), expected.Append(nil, []byte{1})) {
+		t.Errorf("expected tags from the flag key")
+	}
+}
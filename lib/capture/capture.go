@@ -0,0 +1,145 @@
+// Package capture reads the UDP datagrams recorded in pcap and pcapng files, and writes the rotating captures of pkt_cap.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapngMagic starts the section header block at the start of every pcapng file.
+var pcapngMagic = []byte{0x0A, 0x0D, 0x0D, 0x0A}
+
+// Datagram is a UDP datagram read from a capture.
+type Datagram struct {
+	Time        time.Time      // Time the datagram was captured
+	Source      netip.AddrPort // Address and port the datagram was sent from
+	Destination netip.AddrPort // Address and port the datagram was sent to
+	Payload     []byte         // UDP payload
+}
+
+// packetSource is implemented by the pcap and pcapng readers.
+type packetSource interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+}
+
+// Reader reads the UDP datagrams of a capture, skipping every other packet.
+type Reader struct {
+	source   packetSource
+	linkType layers.LinkType // Link type of every packet, unless the source is pcapng
+	closer   io.Closer
+
+	Skipped uint64 // Packets that were skipped because they aren't complete UDP datagrams
+}
+
+// NewReader creates a Reader for a pcap or pcapng stream, detecting the format from its header.
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(pcapngMagic))
+	if err != nil {
+		return nil, fmt.Errorf("reading capture header: %w", err)
+	}
+
+	if bytes.Equal(magic, pcapngMagic) {
+		options := pcapgo.DefaultNgReaderOptions
+		options.WantMixedLinkType = true
+		ngReader, err := pcapgo.NewNgReader(buffered, options)
+		if err != nil {
+			return nil, fmt.Errorf("reading pcapng header: %w", err)
+		}
+		return &Reader{source: ngReader}, nil
+	}
+
+	pcapReader, err := pcapgo.NewReader(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("reading pcap header: %w", err)
+	}
+	return &Reader{source: pcapReader, linkType: pcapReader.LinkType()}, nil
+}
+
+// Open opens a pcap or pcapng file. The Reader must be closed when done.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	reader.closer = file
+	return reader, nil
+}
+
+// Close closes the file opened by Open.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Next returns the next UDP datagram in the capture, or io.EOF at its end.
+// Packets that aren't UDP, were truncated by the capture's snap length or are IP fragments are skipped and counted.
+func (r *Reader) Next() (Datagram, error) {
+	for {
+		data, info, err := r.source.ReadPacketData()
+		if err != nil {
+			return Datagram{}, err
+		}
+
+		linkType := r.linkType
+		if len(info.AncillaryData) > 0 {
+			linkType = info.AncillaryData[0].(layers.LinkType)
+		}
+		datagram, ok := decodeDatagram(data, linkType)
+		if !ok || info.CaptureLength < info.Length {
+			r.Skipped++
+			continue
+		}
+		datagram.Time = info.Timestamp
+		return datagram, nil
+	}
+}
+
+// decodeDatagram decodes the UDP datagram in a captured packet.
+func decodeDatagram(data []byte, linkType layers.LinkType) (Datagram, bool) {
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+
+	var source, destination netip.Addr
+	switch network := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		if network.Flags&layers.IPv4MoreFragments != 0 || network.FragOffset != 0 {
+			return Datagram{}, false
+		}
+		source, _ = netip.AddrFromSlice(network.SrcIP.To4())
+		destination, _ = netip.AddrFromSlice(network.DstIP.To4())
+	case *layers.IPv6:
+		if packet.Layer(layers.LayerTypeIPv6Fragment) != nil {
+			return Datagram{}, false
+		}
+		source, _ = netip.AddrFromSlice(network.SrcIP)
+		destination, _ = netip.AddrFromSlice(network.DstIP)
+	default:
+		return Datagram{}, false
+	}
+
+	udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if !ok || int(udp.Length) != 8+len(udp.Payload) {
+		return Datagram{}, false
+	}
+	return Datagram{
+		Source:      netip.AddrPortFrom(source, uint16(udp.SrcPort)),
+		Destination: netip.AddrPortFrom(destination, uint16(udp.DstPort)),
+		Payload:     udp.Payload,
+	}, true
+}
@@ -0,0 +1,188 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// serialize encodes layers into a packet, computing lengths and checksums.
+func serialize(t *testing.T, serializable ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, options, serializable...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// udpPacket encodes an IP packet holding a UDP datagram from source to destination.
+func udpPacket(t *testing.T, source netip.AddrPort, destination netip.AddrPort, payload []byte) []byte {
+	t.Helper()
+	udp := &layers.UDP{SrcPort: layers.UDPPort(source.Port()), DstPort: layers.UDPPort(destination.Port())}
+	if source.Addr().Is4() {
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: source.Addr().AsSlice(), DstIP: destination.Addr().AsSlice()}
+		udp.SetNetworkLayerForChecksum(ip)
+		return serialize(t, ip, udp, gopacket.Payload(payload))
+	}
+	ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: source.Addr().AsSlice(), DstIP: destination.Addr().AsSlice()}
+	udp.SetNetworkLayerForChecksum(ip)
+	return serialize(t, ip, udp, gopacket.Payload(payload))
+}
+
+// ethernetFrame wraps an IP packet in an Ethernet frame.
+func ethernetFrame(t *testing.T, ipPacket []byte, ethernetType layers.EthernetType) []byte {
+	t.Helper()
+	ethernet := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{6, 7, 8, 9, 10, 11},
+		EthernetType: ethernetType,
+	}
+	return serialize(t, ethernet, gopacket.Payload(ipPacket))
+}
+
+// sllFrame wraps an IPv4 packet in the Linux cooked capture header written when capturing on the "any" interface.
+func sllFrame(ipPacket []byte) []byte {
+	header := []byte{0, 0, 0, 1, 0, 6, 0, 1, 2, 3, 4, 5, 0, 0, 0x08, 0x00}
+	return append(header, ipPacket...)
+}
+
+type capturedPacket struct {
+	data   []byte
+	length int // Original length, if the packet was truncated
+}
+
+func TestReader(t *testing.T) {
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	source := netip.MustParseAddrPort("10.0.0.5:40000")
+	destination := netip.MustParseAddrPort("10.0.0.1:10000")
+	source6 := netip.MustParseAddrPort("[fd00::5]:40000")
+	destination6 := netip.MustParseAddrPort("[fd00::1]:10001")
+
+	ipv4 := udpPacket(t, source, destination, []byte{1, 2, 3})
+	fragment := udpPacket(t, source, destination, []byte{4, 5, 6})
+	fragment[6] |= 0x20 // more fragments
+	tcpIP := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: source.Addr().AsSlice(), DstIP: destination.Addr().AsSlice()}
+	tcpSegment := &layers.TCP{SrcPort: 1, DstPort: 2}
+	tcpSegment.SetNetworkLayerForChecksum(tcpIP)
+	tcp := serialize(t, tcpIP, tcpSegment)
+
+	tests := []struct {
+		name     string
+		linkType layers.LinkType
+		ng       bool
+		packets  []capturedPacket
+		expected []Datagram
+		skipped  uint64
+	}{
+		{
+			name:     "pcap ethernet",
+			linkType: layers.LinkTypeEthernet,
+			packets: []capturedPacket{
+				{data: ethernetFrame(t, ipv4, layers.EthernetTypeIPv4)},
+				{data: ethernetFrame(t, udpPacket(t, source6, destination6, []byte{7}), layers.EthernetTypeIPv6)},
+			},
+			expected: []Datagram{
+				{Source: source, Destination: destination, Payload: []byte{1, 2, 3}},
+				{Source: source6, Destination: destination6, Payload: []byte{7}},
+			},
+		},
+		{
+			name:     "pcap linux cooked",
+			linkType: layers.LinkTypeLinuxSLL,
+			packets:  []capturedPacket{{data: sllFrame(ipv4)}},
+			expected: []Datagram{{Source: source, Destination: destination, Payload: []byte{1, 2, 3}}},
+		},
+		{
+			name:     "pcapng",
+			linkType: layers.LinkTypeEthernet,
+			ng:       true,
+			packets:  []capturedPacket{{data: ethernetFrame(t, ipv4, layers.EthernetTypeIPv4)}},
+			expected: []Datagram{{Source: source, Destination: destination, Payload: []byte{1, 2, 3}}},
+		},
+		{
+			name:     "skipped packets",
+			linkType: layers.LinkTypeRaw,
+			packets: []capturedPacket{
+				{data: tcp},
+				{data: fragment},
+				{data: ipv4[:len(ipv4)-1], length: len(ipv4)},
+				{data: ipv4},
+			},
+			expected: []Datagram{{Source: source, Destination: destination, Payload: []byte{1, 2, 3}}},
+			skipped:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file bytes.Buffer
+			var write func(gopacket.CaptureInfo, []byte) error
+			flush := func() error { return nil }
+			if tt.ng {
+				writer, err := pcapgo.NewNgWriter(&file, tt.linkType)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				write = writer.WritePacket
+				flush = writer.Flush
+			} else {
+				writer := pcapgo.NewWriterNanos(&file)
+				if err := writer.WriteFileHeader(65535, tt.linkType); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				write = writer.WritePacket
+			}
+			for i, packet := range tt.packets {
+				length := max(packet.length, len(packet.data))
+				info := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * time.Millisecond), CaptureLength: len(packet.data), Length: length}
+				if err := write(info, packet.data); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if err := flush(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			reader, err := NewReader(&file)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i, expected := range tt.expected {
+				datagram, err := reader.Next()
+				if err != nil {
+					t.Fatalf("datagram %d: unexpected error: %v", i, err)
+				}
+				if datagram.Source != expected.Source || datagram.Destination != expected.Destination || !bytes.Equal(datagram.Payload, expected.Payload) {
+					t.Errorf("expected %+v, got %+v", expected, datagram)
+				}
+				if datagram.Time.IsZero() || datagram.Time.Before(start) {
+					t.Errorf("expected a capture time after %s, got %s", start, datagram.Time)
+				}
+			}
+			if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("expected io.EOF, got %v", err)
+			}
+			if reader.Skipped != tt.skipped {
+				t.Errorf("expected %d skipped, got %d", tt.skipped, reader.Skipped)
+			}
+		})
+	}
+}
+
+func TestReaderBadHeader(t *testing.T) {
+	for _, data := range [][]byte{nil, {1, 2, 3, 4, 5, 6, 7, 8}} {
+		if _, err := NewReader(bytes.NewReader(data)); err == nil {
+			t.Errorf("expected error for % X", data)
+		}
+	}
+}
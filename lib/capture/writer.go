@@ -0,0 +1,219 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// Format is the file format written by a Writer.
+type Format int
+
+const (
+	FormatPcap   Format = iota // pcap with nanosecond timestamps
+	FormatPcapng               // pcapng, which can hold a comment and the captured interface
+)
+
+// ParseFormat parses the name of a capture format, pcap or pcapng.
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "pcap":
+		return FormatPcap, nil
+	case "pcapng":
+		return FormatPcapng, nil
+	}
+	return 0, fmt.Errorf("unknown capture format %q", name)
+}
+
+// extension returns the file extension of a format.
+func (f Format) extension() string {
+	if f == FormatPcapng {
+		return ".pcapng"
+	}
+	return ".pcap"
+}
+
+// WriterConfig configures a Writer.
+type WriterConfig struct {
+	Dir         string          // Directory the files are written to, created if needed
+	Name        string          // Prefix of the file names, such as the telemetry config name
+	Format      Format          // File format
+	LinkType    layers.LinkType // Link type of the captured packets
+	SnapLen     uint32          // Snap length of the capture
+	Interface   string          // Captured interface, recorded in pcapng files
+	Filter      string          // BPF filter of the capture, recorded in pcapng files
+	Comment     string          // Comment in the section header of pcapng files
+	MaxSize     int64           // Bytes before starting a new file, or 0 to never rotate by size
+	MaxDuration time.Duration   // Time before starting a new file, or 0 to never rotate by time
+	MaxFiles    int             // Number of files kept, deleting the oldest, or 0 to keep every file
+}
+
+// rotates reports whether the config starts new files.
+func (c WriterConfig) rotates() bool {
+	return c.MaxSize > 0 || c.MaxDuration > 0
+}
+
+// packetWriter is implemented by the pcap and pcapng writers.
+type packetWriter interface {
+	WritePacket(info gopacket.CaptureInfo, data []byte) error
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	w.count += int64(n)
+	return n, err
+}
+
+// Writer writes captured packets to files, starting a new file when the current one is too large or too old.
+// Files are named <name>_<start time>.<format>, with a sequence number added when rotating.
+type Writer struct {
+	config   WriterConfig
+	start    string // Time the writer was created, used in file names
+	sequence int    // Number of files created
+	files    []string
+
+	file     *os.File
+	buffered *bufio.Writer
+	counter  *countingWriter
+	packets  packetWriter
+	ngWriter *pcapgo.NgWriter // Set when writing pcapng, which buffers its writes
+	first    time.Time        // Capture time of the first packet in the file
+}
+
+// NewWriter creates the directory and first file of a capture.
+func NewWriter(config WriterConfig) (*Writer, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating capture directory: %w", err)
+	}
+	w := &Writer{config: config, start: time.Now().Format("2006-01-02_15-04-05")}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Path returns the path of the file being written.
+func (w *Writer) Path() string {
+	return w.file.Name()
+}
+
+// open starts the next file and deletes the oldest files beyond the limit.
+func (w *Writer) open() error {
+	w.sequence++
+	name := fmt.Sprintf("%s_%s", w.config.Name, w.start)
+	if w.config.rotates() {
+		name = fmt.Sprintf("%s_%04d", name, w.sequence)
+	}
+	path := filepath.Join(w.config.Dir, name+w.config.Format.extension())
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.buffered = bufio.NewWriterSize(file, 128*1024)
+	w.counter = &countingWriter{writer: w.buffered}
+	w.first = time.Time{}
+	w.ngWriter = nil
+
+	if w.config.Format == FormatPcapng {
+		intf := pcapgo.NgInterface{
+			Name:                w.config.Interface,
+			Filter:              w.config.Filter,
+			OS:                  runtime.GOOS,
+			LinkType:            w.config.LinkType,
+			SnapLength:          w.config.SnapLen,
+			TimestampResolution: 9,
+		}
+		options := pcapgo.DefaultNgWriterOptions
+		options.SectionInfo.Application = "pkt_cap"
+		options.SectionInfo.Comment = w.config.Comment
+		w.ngWriter, err = pcapgo.NewNgWriterInterface(w.counter, intf, options)
+		w.packets = w.ngWriter
+	} else {
+		writer := pcapgo.NewWriterNanos(w.counter)
+		err = writer.WriteFileHeader(w.config.SnapLen, w.config.LinkType)
+		w.packets = writer
+	}
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("writing %s header: %w", path, err)
+	}
+
+	w.files = append(w.files, path)
+	if w.config.MaxFiles > 0 && len(w.files) > w.config.MaxFiles {
+		oldest := w.files[0]
+		w.files = w.files[1:]
+		if err := os.Remove(oldest); err != nil {
+			return fmt.Errorf("deleting old capture: %w", err)
+		}
+	}
+	return nil
+}
+
+// closeFile flushes and closes the file being written.
+func (w *Writer) closeFile() error {
+	var err error
+	if w.ngWriter != nil {
+		err = w.ngWriter.Flush()
+	}
+	if flushErr := w.buffered.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("closing %s: %w", w.file.Name(), err)
+	}
+	return nil
+}
+
+// full reports whether a packet captured at t should start a new file.
+func (w *Writer) full(t time.Time) bool {
+	if w.first.IsZero() {
+		return false
+	}
+	if w.config.MaxSize > 0 && w.counter.count >= w.config.MaxSize {
+		return true
+	}
+	return w.config.MaxDuration > 0 && t.Sub(w.first) >= w.config.MaxDuration
+}
+
+// WritePacket writes a captured packet, first starting a new file if the current one is full.
+func (w *Writer) WritePacket(info gopacket.CaptureInfo, data []byte) error {
+	if w.full(info.Timestamp) {
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if w.first.IsZero() {
+		w.first = info.Timestamp
+	}
+	if err := w.packets.WritePacket(info, data); err != nil {
+		return fmt.Errorf("writing packet to %s: %w", w.file.Name(), err)
+	}
+	return nil
+}
+
+// Close flushes and closes the file being written.
+func (w *Writer) Close() error {
+	return w.closeFile()
+}
@@ -0,0 +1,161 @@
+package capture
+
+import (
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// writePackets writes a packet a second for n seconds and closes the writer.
+func writePackets(t *testing.T, config WriterConfig, n int) {
+	t.Helper()
+	writer, err := NewWriter(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	source := netip.MustParseAddrPort("10.0.0.5:4000")
+	destination := netip.MustParseAddrPort("10.0.0.1:10000")
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		data := udpPacket(t, source, destination, make([]byte, 72))
+		info := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * time.Second), CaptureLength: len(data), Length: len(data)}
+		if err := writer.WritePacket(info, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// countDatagrams returns the number of datagrams in each capture file in a directory.
+func countDatagrams(t *testing.T, dir string) []int {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var counts []int
+	for _, path := range paths {
+		reader, err := Open(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		count := 0
+		for {
+			if _, err := reader.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			count++
+		}
+		reader.Close()
+		counts = append(counts, count)
+	}
+	return counts
+}
+
+func TestWriterRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   WriterConfig
+		expected []int // Datagrams in each file, oldest first
+	}{
+		{"none", WriterConfig{}, []int{10}},
+		{"size", WriterConfig{MaxSize: 400}, []int{4, 4, 2}},
+		{"duration", WriterConfig{MaxDuration: 3 * time.Second}, []int{3, 3, 3, 1}},
+		{"ring", WriterConfig{MaxDuration: 3 * time.Second, MaxFiles: 2}, []int{3, 1}},
+		{"pcapng", WriterConfig{Format: FormatPcapng, MaxDuration: 5 * time.Second}, []int{5, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Dir = t.TempDir()
+			tt.config.Name = "test"
+			tt.config.LinkType = layers.LinkTypeRaw
+			tt.config.SnapLen = 65535
+			writePackets(t, tt.config, 10)
+
+			counts := countDatagrams(t, tt.config.Dir)
+			if len(counts) != len(tt.expected) {
+				t.Fatalf("expected %d files, got %v", len(tt.expected), counts)
+			}
+			for i := range counts {
+				if counts[i] != tt.expected[i] {
+					t.Errorf("expected %v datagrams, got %v", tt.expected, counts)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestWriterPcapngComment(t *testing.T) {
+	config := WriterConfig{
+		Dir:       t.TempDir(),
+		Name:      "test",
+		Format:    FormatPcapng,
+		LinkType:  layers.LinkTypeRaw,
+		SnapLen:   65535,
+		Interface: "eth0",
+		Filter:    "udp port 10000",
+		Comment:   "telemetry config: backplane",
+	}
+	writePackets(t, config, 1)
+
+	paths, _ := filepath.Glob(filepath.Join(config.Dir, "*.pcapng"))
+	if len(paths) != 1 {
+		t.Fatalf("expected 1 pcapng file, got %v", paths)
+	}
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+	reader, err := pcapgo.NewNgReader(file, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if comment := reader.SectionInfo().Comment; comment != config.Comment {
+		t.Errorf("expected comment %q, got %q", config.Comment, comment)
+	}
+	intf, err := reader.Interface(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if intf.Name != config.Interface || intf.Filter != config.Filter {
+		t.Errorf("expected interface %s with filter %q, got %s with %q", config.Interface, config.Filter, intf.Name, intf.Filter)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Format
+		valid    bool
+	}{
+		{"pcap", FormatPcap, true},
+		{"pcapng", FormatPcapng, true},
+		{"csv", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := ParseFormat(tt.name)
+			if (err == nil) != tt.valid {
+				t.Fatalf("expected valid %v, got %v", tt.valid, err)
+			}
+			if format != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, format)
+			}
+		})
+	}
+}
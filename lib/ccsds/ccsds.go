@@ -0,0 +1,117 @@
+// Package ccsds parses CCSDS Space Packets (CCSDS 133.0-B) and their time codes (CCSDS 301.0-B).
+package ccsds
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// PrimaryHeaderSize is the size of the Space Packet primary header in bytes.
+const PrimaryHeaderSize = 6
+
+// MaxAPID is the largest application process identifier. APID 2047 is reserved for idle packets.
+const MaxAPID = 2046
+
+// IdleAPID identifies idle packets, which carry no data and are sent to keep a link busy.
+const IdleAPID = 2047
+
+// MaxDataSize is the largest packet data field a primary header can declare.
+const MaxDataSize = 65536
+
+// SequenceCountModulus is the number of distinct sequence counts; counts wrap around to 0 after 16383.
+const SequenceCountModulus = 1 << 14
+
+// Sequence flags of a primary header
+const (
+	SequenceContinuation = 0 // Continuation segment of user data
+	SequenceFirst        = 1 // First segment of user data
+	SequenceLast         = 2 // Last segment of user data
+	SequenceUnsegmented  = 3 // Unsegmented user data
+)
+
+// ErrInvalidHeader is returned when a primary header is malformed.
+var ErrInvalidHeader = errors.New("invalid CCSDS primary header")
+
+// PrimaryHeader is a decoded Space Packet primary header.
+type PrimaryHeader struct {
+	Version         uint8  // Packet version number, always 0
+	Telecommand     bool   // Packet type, set for telecommands and clear for telemetry
+	SecondaryHeader bool   // Whether the packet data field starts with a secondary header
+	APID            uint16 // Application process identifier
+	SequenceFlags   uint8  // Segmentation of the user data, see SequenceUnsegmented
+	SequenceCount   uint16 // Sequence count of the APID, modulo 16384
+	DataLength      uint16 // Size of the packet data field minus one
+}
+
+// ParsePrimaryHeader decodes the primary header at the start of data.
+func ParsePrimaryHeader(data []byte) (PrimaryHeader, error) {
+	if len(data) < PrimaryHeaderSize {
+		return PrimaryHeader{}, fmt.Errorf("%w: %d bytes, expected at least %d", ErrInvalidHeader, len(data), PrimaryHeaderSize)
+	}
+
+	id := binary.BigEndian.Uint16(data[0:2])
+	sequence := binary.BigEndian.Uint16(data[2:4])
+	header := PrimaryHeader{
+		Version:         uint8(id >> 13),
+		Telecommand:     id&(1<<12) != 0,
+		SecondaryHeader: id&(1<<11) != 0,
+		APID:            id & 0x7FF,
+		SequenceFlags:   uint8(sequence >> 14),
+		SequenceCount:   sequence & 0x3FFF,
+		DataLength:      binary.BigEndian.Uint16(data[4:6]),
+	}
+	if header.Version != 0 {
+		return PrimaryHeader{}, fmt.Errorf("%w: version %d, expected 0", ErrInvalidHeader, header.Version)
+	}
+	return header, nil
+}
+
+// DataSize returns the size of the packet data field declared by the header.
+func (h PrimaryHeader) DataSize() int {
+	return int(h.DataLength) + 1
+}
+
+// PacketSize returns the size of the whole packet declared by the header.
+func (h PrimaryHeader) PacketSize() int {
+	return PrimaryHeaderSize + h.DataSize()
+}
+
+// Append appends the encoded header to dst.
+func (h PrimaryHeader) Append(dst []byte) []byte {
+	id := uint16(h.Version&0x7)<<13 | h.APID&0x7FF
+	if h.Telecommand {
+		id |= 1 << 12
+	}
+	if h.SecondaryHeader {
+		id |= 1 << 11
+	}
+	dst = binary.BigEndian.AppendUint16(dst, id)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(h.SequenceFlags&0x3)<<14|h.SequenceCount&0x3FFF)
+	return binary.BigEndian.AppendUint16(dst, h.DataLength)
+}
+
+// SequenceTracker counts the packets lost from gaps in the sequence counts of an APID.
+// The zero value is ready to use.
+type SequenceTracker struct {
+	last    uint16
+	started bool
+}
+
+// Next records a received sequence count and returns how many packets were lost before it.
+// A repeated count is treated as a duplicate rather than a wrap around with every packet lost.
+func (t *SequenceTracker) Next(count uint16) uint16 {
+	count &= SequenceCountModulus - 1
+	if !t.started {
+		t.started = true
+		t.last = count
+		return 0
+	}
+
+	lost := (count - t.last - 1) & (SequenceCountModulus - 1)
+	if count == t.last {
+		lost = 0
+	}
+	t.last = count
+	return lost
+}
@@ -0,0 +1,169 @@
+package ccsds
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePrimaryHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected PrimaryHeader
+		err      bool
+	}{
+		{
+			name: "telemetry with secondary header",
+			data: []byte{0x08, 0x64, 0xC0, 0x2A, 0x00, 0x09},
+			expected: PrimaryHeader{
+				SecondaryHeader: true,
+				APID:            100,
+				SequenceFlags:   SequenceUnsegmented,
+				SequenceCount:   42,
+				DataLength:      9,
+			},
+		},
+		{
+			name: "telecommand first segment",
+			data: []byte{0x17, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF, 0xAA},
+			expected: PrimaryHeader{
+				Telecommand:   true,
+				APID:          IdleAPID,
+				SequenceFlags: SequenceFirst,
+				SequenceCount: 0x3FFF,
+				DataLength:    0xFFFF,
+			},
+		},
+		{name: "short", data: []byte{0x08, 0x64, 0xC0, 0x2A, 0x00}, err: true},
+		{name: "version 1", data: []byte{0x28, 0x64, 0xC0, 0x2A, 0x00, 0x09}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := ParsePrimaryHeader(tt.data)
+			if tt.err {
+				if !errors.Is(err, ErrInvalidHeader) {
+					t.Fatalf("expected ErrInvalidHeader, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if header != tt.expected {
+				t.Fatalf("expected %+v, got %+v", tt.expected, header)
+			}
+			if encoded := header.Append(nil); !bytes.Equal(encoded, tt.data[:PrimaryHeaderSize]) {
+				t.Errorf("expected encoding % X, got % X", tt.data[:PrimaryHeaderSize], encoded)
+			}
+		})
+	}
+}
+
+func TestPrimaryHeaderSizes(t *testing.T) {
+	header := PrimaryHeader{DataLength: 9}
+	if header.DataSize() != 10 {
+		t.Errorf("expected data size 10, got %d", header.DataSize())
+	}
+	if header.PacketSize() != 16 {
+		t.Errorf("expected packet size 16, got %d", header.PacketSize())
+	}
+	if (PrimaryHeader{DataLength: 0xFFFF}).DataSize() != MaxDataSize {
+		t.Errorf("expected max data size %d", MaxDataSize)
+	}
+}
+
+func TestSequenceTracker(t *testing.T) {
+	tests := []struct {
+		name     string
+		counts   []uint16
+		expected []uint16
+	}{
+		{name: "consecutive", counts: []uint16{5, 6, 7}, expected: []uint16{0, 0, 0}},
+		{name: "gap", counts: []uint16{5, 6, 10}, expected: []uint16{0, 0, 3}},
+		{name: "wrap around", counts: []uint16{16382, 16383, 0, 1}, expected: []uint16{0, 0, 0, 0}},
+		{name: "gap across wrap around", counts: []uint16{16381, 2}, expected: []uint16{0, 4}},
+		{name: "duplicate", counts: []uint16{5, 5, 6}, expected: []uint16{0, 0, 0}},
+		{name: "reset", counts: []uint16{100, 0}, expected: []uint16{0, 16283}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tracker SequenceTracker
+			for i, count := range tt.counts {
+				if lost := tracker.Next(count); lost != tt.expected[i] {
+					t.Errorf("count %d: expected %d lost, got %d", count, tt.expected[i], lost)
+				}
+			}
+		})
+	}
+}
+
+func TestCUCDecode(t *testing.T) {
+	unixEpoch := time.Unix(0, 0).UTC()
+	tests := []struct {
+		name     string
+		cuc      CUC
+		data     []byte
+		expected time.Time
+	}{
+		{
+			name:     "coarse only",
+			cuc:      CUC{CoarseSize: 4, Epoch: unixEpoch},
+			data:     []byte{0x00, 0x00, 0x01, 0x00},
+			expected: unixEpoch.Add(256 * time.Second),
+		},
+		{
+			name:     "half second",
+			cuc:      CUC{CoarseSize: 4, FineSize: 2, Epoch: unixEpoch},
+			data:     []byte{0x00, 0x00, 0x00, 0x0A, 0x80, 0x00},
+			expected: unixEpoch.Add(10*time.Second + 500*time.Millisecond),
+		},
+		{
+			name:     "TAI epoch",
+			cuc:      CUC{CoarseSize: 4, FineSize: 1, Epoch: TAIEpoch},
+			data:     []byte{0x00, 0x00, 0x00, 0x3C, 0x40, 0xFF},
+			expected: time.Date(1958, time.January, 1, 0, 1, 0, 250000000, time.UTC),
+		},
+		{
+			name:     "three byte fine",
+			cuc:      CUC{CoarseSize: 1, FineSize: 3, Epoch: unixEpoch},
+			data:     []byte{0x01, 0x00, 0x00, 0x01},
+			expected: unixEpoch.Add(time.Second + 60*time.Nanosecond),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cuc.Validate(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			decoded, err := tt.cuc.Decode(tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !decoded.Equal(tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, decoded)
+			}
+
+			encoded := tt.cuc.Append(nil, decoded)
+			if !bytes.Equal(encoded, tt.data[:tt.cuc.Size()]) {
+				t.Errorf("expected encoding % X, got % X", tt.data[:tt.cuc.Size()], encoded)
+			}
+		})
+	}
+}
+
+func TestCUCErrors(t *testing.T) {
+	for _, cuc := range []CUC{{CoarseSize: 0}, {CoarseSize: 5}, {CoarseSize: 4, FineSize: 4}, {CoarseSize: 1, FineSize: -1}} {
+		if err := cuc.Validate(); err == nil {
+			t.Errorf("expected error for %+v", cuc)
+		}
+	}
+
+	if _, err := (CUC{CoarseSize: 4, FineSize: 2}).Decode([]byte{0, 0, 0, 0, 0}); err == nil {
+		t.Errorf("expected error for a short time code")
+	}
+}
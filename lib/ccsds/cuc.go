@@ -0,0 +1,77 @@
+package ccsds
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// TAIEpoch is the CCSDS recommended epoch, 1958-01-01 TAI.
+// Leap seconds are not applied, so times decoded from it are ahead of UTC by the accumulated leap seconds.
+var TAIEpoch = time.Date(1958, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// CUC decodes CCSDS Unsegmented time Codes without a preamble field.
+// The time code is a big endian count of seconds since the epoch, followed by a binary fraction of a second.
+type CUC struct {
+	CoarseSize int       // Size of the seconds count in bytes (1-4)
+	FineSize   int       // Size of the fraction of a second in bytes (0-3)
+	Epoch      time.Time // Time at which the count starts, TAIEpoch for the CCSDS recommended epoch
+}
+
+// Validate checks that the time code sizes are supported.
+func (c CUC) Validate() error {
+	if c.CoarseSize < 1 || c.CoarseSize > 4 {
+		return fmt.Errorf("coarse size specified as %d, instead of 1-4", c.CoarseSize)
+	}
+	if c.FineSize < 0 || c.FineSize > 3 {
+		return fmt.Errorf("fine size specified as %d, instead of 0-3", c.FineSize)
+	}
+	return nil
+}
+
+// Size returns the size of the time code in bytes.
+func (c CUC) Size() int {
+	return c.CoarseSize + c.FineSize
+}
+
+// Decode decodes the time code at the start of data.
+func (c CUC) Decode(data []byte) (time.Time, error) {
+	if len(data) < c.Size() {
+		return time.Time{}, fmt.Errorf("time code is %d bytes, expected %d", len(data), c.Size())
+	}
+
+	var coarse uint64
+	for _, b := range data[:c.CoarseSize] {
+		coarse = coarse<<8 | uint64(b)
+	}
+	var fine uint64
+	for _, b := range data[c.CoarseSize:c.Size()] {
+		fine = fine<<8 | uint64(b)
+	}
+
+	// the fine count is in units of 2^-(8*FineSize) seconds
+	nanos := int64(math.Round(float64(fine) * float64(time.Second) / float64(uint64(1)<<(8*c.FineSize))))
+	return c.Epoch.Add(time.Duration(coarse) * time.Second).Add(time.Duration(nanos)), nil
+}
+
+// Append appends the time code of t to dst.
+// Times before the epoch or past the range of the coarse count are clamped.
+func (c CUC) Append(dst []byte, t time.Time) []byte {
+	since := t.Sub(c.Epoch)
+	if since < 0 {
+		since = 0
+	}
+	coarse := uint64(since / time.Second)
+	if maxCoarse := uint64(1)<<(8*c.CoarseSize) - 1; coarse > maxCoarse {
+		coarse = maxCoarse
+	}
+	fine := uint64(since%time.Second) << (8 * c.FineSize) / uint64(time.Second)
+
+	for i := c.CoarseSize - 1; i >= 0; i-- {
+		dst = append(dst, byte(coarse>>(8*i)))
+	}
+	for i := c.FineSize - 1; i >= 0; i-- {
+		dst = append(dst, byte(fine>>(8*i)))
+	}
+	return dst
+}
@@ -0,0 +1,269 @@
+// Package client subscribes to the telemetry published by a running gsw_service.
+//
+// It reads the telemetry config gsw_service shares and the engineering values gsw_service decoded
+// from the packets subscribed to, reattaching whenever gsw_service restarts.
+package client
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"github.com/AarC10/GSW-V2/proc"
+	"go.uber.org/zap"
+)
+
+// Options configures a Client.
+type Options struct {
+	ShmDir   string       // Directory gsw_service shares telemetry in. Defaults to /dev/shm
+	ReadMode ipc.ReadMode // ReadLatest (default) skips to the newest packet, ReadAll delivers every packet in order
+	// Vehicles are the vehicles whose packets are delivered. An empty vehicle stands for the packets
+	// that aren't attributed to a vehicle. Defaults to every vehicle and the unattributed packets.
+	Vehicles []string
+	// AttributedOnly skips the packets that aren't attributed to a vehicle when Vehicles defaults
+	// and vehicles are configured, since every packet then comes from a known vehicle.
+	AttributedOnly bool
+	// StateHandler is called when gsw_service stops writing a packet for a vehicle and when it resumes.
+	// It is called concurrently for different packets and vehicles. Optional.
+	StateHandler func(packet string, vehicle string, state proc.ReaderState)
+}
+
+// Measurement is the new value of a measurement.
+type Measurement struct {
+	Name    string
+	Value   tlm.Value   // Calibrated value
+	Quality tlm.Quality // Problems with the value, if any
+}
+
+// Update holds the new values of the measurements subscribed to in a packet sent by a vehicle.
+type Update struct {
+	Packet           string
+	Vehicle          string        // Empty for packets that aren't attributed to a vehicle
+	ReceiveTimestamp time.Time     // When gsw_service received the packet
+	Sequence         uint64        // Sequence number of the packet for the vehicle, counting from 1 each time gsw_service starts
+	Overwritten      uint32        // Packets overwritten before they could be read, in ReadAll mode
+	Measurements     []Measurement // Measurements subscribed to, in the order of the packet
+}
+
+// Client subscribes to the telemetry published by a running gsw_service.
+type Client struct {
+	log          *zap.Logger
+	options      Options
+	packets      []tlm.TelemetryPacket
+	measurements map[string]tlm.Measurement
+	vehicles     []string
+}
+
+// New creates a client, reading the telemetry config from the running gsw_service without changing proc.GswConfig.
+func New(options Options) (*Client, error) {
+	if options.ShmDir == "" {
+		options.ShmDir = "/dev/shm"
+	}
+	// the config is kept by the client, so clients don't replace the global config or each other's
+	config, err := proc.LoadSharedConfig(options.ShmDir)
+	if err != nil {
+		return nil, err
+	}
+
+	vehicles := options.Vehicles
+	if len(vehicles) == 0 {
+		vehicles = config.ShmVehicles()
+		if options.AttributedOnly && len(vehicles) > 1 {
+			vehicles = vehicles[1:]
+		}
+	}
+	return &Client{
+		log:          logger.Log().Named("client"),
+		options:      options,
+		packets:      slices.Clone(config.TelemetryPackets),
+		measurements: maps.Clone(config.Measurements),
+		vehicles:     vehicles,
+	}, nil
+}
+
+// Packets returns the telemetry packets in the config gsw_service was running with when the client was created.
+func (c *Client) Packets() []tlm.TelemetryPacket {
+	return c.packets
+}
+
+// Measurements returns the definitions of the measurements in the config gsw_service was running with
+// when the client was created, keyed by name.
+func (c *Client) Measurements() map[string]tlm.Measurement {
+	return c.measurements
+}
+
+// Vehicles returns the vehicles whose packets are delivered.
+func (c *Client) Vehicles() []string {
+	return c.vehicles
+}
+
+// Subscribe delivers updates of the packets and measurements named to handler until the context is done,
+// then returns the context's error. A packet name subscribes to all of its measurements,
+// and a measurement name to that measurement in every packet holding it. No names subscribes to every packet.
+// Packets that can't be decoded are skipped, since gsw_service doesn't publish their values.
+//
+// The handler is called concurrently for different packets and vehicles, and in order for each of them.
+// An update and its slices are only valid during the call. If gsw_service restarts, updates resume
+// once it is back, with the packet's definition from its new telemetry config.
+func (c *Client) Subscribe(ctx context.Context, names []string, handler func(Update)) error {
+	var packets []tlm.TelemetryPacket
+	matched := make(map[string]bool)
+	for _, packet := range c.packets {
+		if len(selectMeasurements(packet, names, matched)) > 0 {
+			packets = append(packets, packet)
+		}
+	}
+	for _, name := range names {
+		if !matched[name] {
+			return fmt.Errorf("no packet or measurement named %s", name)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, packet := range packets {
+		if _, err := tlm.NewDecoder(packet, c.measurements); err != nil {
+			c.log.Error("skipping packet that can't be decoded", zap.String("packet", packet.Name), zap.Error(err))
+			continue
+		}
+		for _, vehicle := range c.vehicles {
+			s, err := c.newSubscription(packet, vehicle, names, handler)
+			if err != nil {
+				cancel()
+				wg.Wait()
+				return err
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.run(ctx)
+			}()
+		}
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// selectMeasurements returns the indices of the measurements of a packet that names subscribe to,
+// recording the names that matched.
+func selectMeasurements(packet tlm.TelemetryPacket, names []string, matched map[string]bool) []int {
+	all := len(names) == 0 || slices.Contains(names, packet.Name)
+	if all && len(names) > 0 {
+		matched[packet.Name] = true
+	}
+	var selected []int
+	for i, measurement := range packet.Measurements {
+		if all || slices.Contains(names, measurement) {
+			selected = append(selected, i)
+			matched[measurement] = true
+		}
+	}
+	return selected
+}
+
+// Reads that fail for another reason than the context are retried with exponential backoff,
+// so a reader that keeps failing doesn't spin.
+const (
+	retryDelay    = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// valueReader reads the values of a packet, as proc.ValueReader does.
+type valueReader interface {
+	Read(ctx context.Context) (*proc.ValueMessage, error)
+	Cleanup()
+}
+
+// subscription reads the values of a packet sent by a vehicle and delivers its updates.
+type subscription struct {
+	log      *zap.Logger
+	reader   valueReader
+	names    []string
+	handler  func(Update)
+	selected []int // Indices of the measurements subscribed to
+	update   Update
+}
+
+// newSubscription creates the reader of the values of a packet sent by a vehicle.
+func (c *Client) newSubscription(packet tlm.TelemetryPacket, vehicle string, names []string, handler func(Update)) (*subscription, error) {
+	reader, err := proc.NewValueReader(packet, vehicle, c.options.ReadMode, c.options.ShmDir)
+	if err != nil {
+		return nil, fmt.Errorf("creating reader for packet %s: %w", packet.Name, err)
+	}
+	s := &subscription{
+		log:     c.log.With(zap.String("packet", packet.Name), zap.String("vehicle", vehicle)),
+		reader:  reader,
+		names:   names,
+		handler: handler,
+		update:  Update{Packet: packet.Name, Vehicle: vehicle},
+	}
+	s.setup(packet)
+
+	reader.SetStateHandler(func(state proc.ReaderState, packet tlm.TelemetryPacket) {
+		if state == proc.ReaderAttached {
+			s.setup(packet)
+		}
+		if c.options.StateHandler != nil {
+			c.options.StateHandler(packet.Name, vehicle, state)
+		}
+	})
+	return s, nil
+}
+
+// setup selects the measurements subscribed to in a packet's definition.
+func (s *subscription) setup(packet tlm.TelemetryPacket) {
+	s.selected = selectMeasurements(packet, s.names, make(map[string]bool))
+	s.update.Measurements = make([]Measurement, len(s.selected))
+	for i, index := range s.selected {
+		s.update.Measurements[i].Name = packet.Measurements[index]
+	}
+}
+
+// run delivers updates until the context is done.
+func (s *subscription) run(ctx context.Context) {
+	defer s.reader.Cleanup()
+	backoff := retryDelay
+	for {
+		message, err := s.reader.Read(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.log.Error("error reading packet values", zap.Error(err), zap.Duration("retry", backoff))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxRetryDelay)
+			continue
+		}
+		backoff = retryDelay
+		if len(s.selected) == 0 {
+			continue
+		}
+
+		s.update.ReceiveTimestamp = time.Unix(0, int64(message.ReceiveTimestamp))
+		s.update.Sequence = message.Sequence
+		s.update.Overwritten = message.Overwritten
+		for i, index := range s.selected {
+			measurement := &s.update.Measurements[i]
+			if index >= len(message.Values) {
+				// a record shorter than the packet's definition has no value for the measurement
+				measurement.Value = tlm.Value{}
+				measurement.Quality = tlm.QualityInvalid
+				continue
+			}
+			measurement.Value = message.Values[index]
+			measurement.Quality = message.Quality[index]
+		}
+		s.handler(s.update)
+	}
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"github.com/AarC10/GSW-V2/proc"
+)
+
+const testConfig = `
+name: client_test
+measurements:
+  Altitude:
+    name: Altitude
+    size: 4
+    type: int
+  Status:
+    name: Status
+    size: 2
+    type: int
+    unsigned: true
+  Voltage:
+    name: Voltage
+    size: 2
+    type: int
+    scaling: 0.5
+telemetry_packets:
+  - name: Flight
+    port: 10000
+    measurements:
+      - Altitude
+      - Status
+  - name: Power
+    port: 10001
+    measurements:
+      - Voltage
+      - Status
+`
+
+// startTestService shares the test config and creates the value rings of its packets, like gsw_service starting.
+func startTestService(t *testing.T) (dir string, flight ipc.Writer, power ipc.Writer) {
+	t.Helper()
+	t.Cleanup(proc.ResetConfig)
+	dir = t.TempDir()
+	cleanup, err := proc.WriteTelemetryConfigToShm(dir, []byte(testConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(cleanup)
+	if flight, err = ipc.NewShmWriter("values-10000", "Flight values", tlm.ValueRecordLen(2), dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(flight.Cleanup)
+	if power, err = ipc.NewShmWriter("values-10001", "Power values", tlm.ValueRecordLen(2), dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(power.Cleanup)
+	return dir, flight, power
+}
+
+// subscribe subscribes to names until the test ends, sending copies of the updates to the channel returned.
+func subscribe(t *testing.T, c *Client, names []string) <-chan Update {
+	t.Helper()
+	updates := make(chan Update, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Subscribe(ctx, names, func(update Update) {
+			update.Measurements = slices.Clone(update.Measurements)
+			updates <- update
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("subscription did not stop")
+		}
+	})
+	return updates
+}
+
+// valueRecord encodes the values of a packet, as gsw_service publishes them.
+func valueRecord(t *testing.T, values ...tlm.Value) []byte {
+	t.Helper()
+	record := make([]byte, tlm.ValueRecordLen(len(values)))
+	if err := tlm.EncodeValueRecord(record, values); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return record
+}
+
+// writeUntilUpdate writes data until an update is received, since the subscription may not be reading yet.
+func writeUntilUpdate(t *testing.T, writer ipc.Writer, data []byte, updates <-chan Update) Update {
+	t.Helper()
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(2 * time.Second)
+	for {
+		if err := writer.Write(data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		select {
+		case update := <-updates:
+			return update
+		case <-ticker.C:
+		case <-timeout:
+			t.Fatalf("expected an update, got none")
+		}
+	}
+}
+
+func TestSubscribePacket(t *testing.T) {
+	dir, flight, _ := startTestService(t)
+	c, err := New(Options{ShmDir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updates := subscribe(t, c, []string{"Flight"})
+
+	update := writeUntilUpdate(t, flight, valueRecord(t, tlm.IntValue(-2), tlm.UintValue(7)), updates)
+	if update.Packet != "Flight" || update.Vehicle != "" {
+		t.Errorf("expected packet Flight without a vehicle, got %s and %q", update.Packet, update.Vehicle)
+	}
+	if update.Sequence == 0 || update.ReceiveTimestamp.IsZero() {
+		t.Errorf("expected a sequence and receive timestamp, got %d and %v", update.Sequence, update.ReceiveTimestamp)
+	}
+	expected := []Measurement{
+		{Name: "Altitude", Value: tlm.IntValue(-2)},
+		{Name: "Status", Value: tlm.UintValue(7)},
+	}
+	if len(update.Measurements) != len(expected) {
+		t.Fatalf("expected %d measurements, got %d", len(expected), len(update.Measurements))
+	}
+	for i, measurement := range update.Measurements {
+		if measurement.Name != expected[i].Name || measurement.Value != expected[i].Value || !measurement.Quality.Good() {
+			t.Errorf("expected %+v, got %+v", expected[i], measurement)
+		}
+	}
+}
+
+func TestSubscribeMeasurement(t *testing.T) {
+	dir, flight, power := startTestService(t)
+	c, err := New(Options{ShmDir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updates := subscribe(t, c, []string{"Voltage", "Status"})
+
+	// Status is delivered from every packet holding it
+	update := writeUntilUpdate(t, power, valueRecord(t, tlm.FloatValue(2.5), tlm.UintValue(1)), updates)
+	if update.Packet != "Power" {
+		t.Fatalf("expected packet Power, got %s", update.Packet)
+	}
+	if len(update.Measurements) != 2 || update.Measurements[0].Value != tlm.FloatValue(2.5) || update.Measurements[1].Value != tlm.UintValue(1) {
+		t.Errorf("expected Voltage 2.5 and Status 1, got %+v", update.Measurements)
+	}
+
+	update = writeUntilUpdate(t, flight, valueRecord(t, tlm.IntValue(1), tlm.UintValue(2)), updates)
+	for update.Packet != "Flight" {
+		update = <-updates
+	}
+	if len(update.Measurements) != 1 || update.Measurements[0].Name != "Status" || update.Measurements[0].Value != tlm.UintValue(2) {
+		t.Errorf("expected Status 2, got %+v", update.Measurements)
+	}
+}
+
+func TestSubscribeUnknownName(t *testing.T) {
+	dir, _, _ := startTestService(t)
+	c, err := New(Options{ShmDir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Subscribe(context.Background(), []string{"Flight", "Pressure"}, func(Update) {}); err == nil {
+		t.Errorf("expected an error for an unknown name, got nil")
+	}
+}
+
+func TestNewKeepsConfig(t *testing.T) {
+	dir, _, _ := startTestService(t)
+	proc.GswConfig.Name = "tool"
+	c, err := New(Options{ShmDir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if proc.GswConfig.Name != "tool" || len(proc.GswConfig.TelemetryPackets) != 0 {
+		t.Errorf("expected the global config to be left alone, got %s with %d packets", proc.GswConfig.Name, len(proc.GswConfig.TelemetryPackets))
+	}
+	if len(c.Packets()) != 2 || c.Measurements()["Voltage"].ScalingFactor != 0.5 {
+		t.Errorf("expected the client to keep the shared config, got %d packets", len(c.Packets()))
+	}
+}
+
+func TestNewWithoutService(t *testing.T) {
+	if _, err := New(Options{ShmDir: t.TempDir()}); err == nil {
+		t.Errorf("expected an error without a running gsw_service, got nil")
+	}
+}
+
+// failingReader fails every read, counting them.
+type failingReader struct {
+	reads atomic.Int32
+}
+
+func (r *failingReader) Read(context.Context) (*proc.ValueMessage, error) {
+	r.reads.Add(1)
+	return nil, errors.New("ring is unreadable")
+}
+
+func (r *failingReader) Cleanup() {}
+
+func TestSubscriptionBackoff(t *testing.T) {
+	reader := &failingReader{}
+	s := &subscription{log: logger.Log(), reader: reader, handler: func(Update) {}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx)
+		close(done)
+	}()
+
+	// a failing reader is retried after a delay instead of immediately, and stops once canceled
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("subscription did not stop")
+	}
+	if reads := reader.reads.Load(); reads != 1 {
+		t.Errorf("expected 1 read before retrying, got %d", reads)
+	}
+}
@@ -16,13 +16,26 @@ type BatchHandler interface {
 	Flush() error
 }
 
+// WriteErrorCounter is implemented by handlers that write asynchronously, whose errors can't be returned by Insert
+type WriteErrorCounter interface {
+	// WriteErrors returns the number of asynchronous writes that failed.
+	WriteErrors() uint64
+}
+
 // MeasurementGroup is a group of measurements to be sent to the database
 type MeasurementGroup struct {
 	DatabaseName string        // Name of the database
 	Timestamp    int64         // Unix timestamp in nanoseconds
+	Tags         []Tag         // Tags identifying the series, such as the vehicle (optional)
 	Measurements []Measurement // List of measurements to be sent
 }
 
+// Tag is a key and value that identifies a series in the database
+type Tag struct {
+	Key   string // Name of the tag
+	Value string // Value of the tag
+}
+
 // Measurement is a single measurement to be sent to the database
 type Measurement struct {
 	Name  string // Name of the measurement
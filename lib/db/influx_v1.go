@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/AarC10/GSW-V2/lib/logger"
 	"go.uber.org/zap"
@@ -50,9 +51,16 @@ func (h *InfluxDBV1Handler) CreateQuery(measurements MeasurementGroup) string {
 	return CreateQuery(measurements)
 }
 
+// tagEscaper escapes the characters that are special in line protocol tag keys and values
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
 // CreateQuery generates InfluxDB query for measurement group
 func CreateQuery(measurements MeasurementGroup) string {
-	query := measurements.DatabaseName + " "
+	query := measurements.DatabaseName
+	for _, tag := range measurements.Tags {
+		query += "," + tagEscaper.Replace(tag.Key) + "=" + tagEscaper.Replace(tag.Value)
+	}
+	query += " "
 
 	for _, measurement := range measurements.Measurements {
 		query += fmt.Sprintf("%s=%s,", measurement.Name, measurement.Value)
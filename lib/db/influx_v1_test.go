@@ -0,0 +1,38 @@
+package db
+
+import "testing"
+
+func TestCreateQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		group MeasurementGroup
+		want  string
+	}{
+		{
+			name: "no tags",
+			group: MeasurementGroup{
+				DatabaseName: "gsw",
+				Timestamp:    100,
+				Measurements: []Measurement{{Name: "A", Value: "1"}, {Name: "B", Value: "2.5"}},
+			},
+			want: "gsw A=1,B=2.5 100\n",
+		},
+		{
+			name: "tags",
+			group: MeasurementGroup{
+				DatabaseName: "gsw",
+				Tags:         []Tag{{Key: "vehicle", Value: "alpha"}, {Key: "site", Value: "pad 1,=b"}},
+				Measurements: []Measurement{{Name: "A", Value: "1"}},
+			},
+			want: "gsw,vehicle=alpha,site=pad\\ 1\\,\\=b A=1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CreateQuery(tt.group); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/AarC10/GSW-V2/lib/logger"
@@ -20,6 +21,8 @@ type InfluxDBV2Handler struct {
 	org      string
 	bucket   string
 	cfg      InfluxDBV2Config
+
+	writeErrors atomic.Uint64 // Number of failed asynchronous writes
 }
 
 // InfluxDBV2Config holds the fields needed by the InfluxDB v2 client.
@@ -121,6 +124,7 @@ func (handler *InfluxDBV2Handler) InitializeWithConfig(cfg InfluxDBV2Config) err
 	// error reporter because that'll totally never happen
 	go func() {
 		for err := range handler.writeAPI.Errors() {
+			handler.writeErrors.Add(1)
 			logger.Error("InfluxDB V2 async write error", zap.Error(err))
 		}
 	}()
@@ -155,6 +159,10 @@ func (handler *InfluxDBV2Handler) Insert(measurements MeasurementGroup) error {
 	}
 	point.SetTime(timestamp)
 
+	for _, tag := range measurements.Tags {
+		point.AddTag(tag.Key, tag.Value)
+	}
+
 	for _, measurement := range measurements.Measurements {
 		if floatVal, err := strconv.ParseFloat(measurement.Value, 64); err == nil {
 			point.AddField(measurement.Name, floatVal)
@@ -205,6 +213,10 @@ func (handler *InfluxDBV2Handler) BlockingInsert(ctx context.Context, measuremen
 	}
 	point.SetTime(timestamp)
 
+	for _, tag := range measurements.Tags {
+		point.AddTag(tag.Key, tag.Value)
+	}
+
 	for _, measurement := range measurements.Measurements {
 		if floatVal, err := strconv.ParseFloat(measurement.Value, 64); err == nil {
 			point.AddField(measurement.Name, floatVal)
@@ -218,5 +230,11 @@ func (handler *InfluxDBV2Handler) BlockingInsert(ctx context.Context, measuremen
 	return blockingAPI.WritePoint(ctx, point)
 }
 
-// Ensure InfluxDBV2Handler satisfies BatchHandler at compile time.
+// WriteErrors returns the number of asynchronous writes that failed.
+func (handler *InfluxDBV2Handler) WriteErrors() uint64 {
+	return handler.writeErrors.Load()
+}
+
+// Ensure InfluxDBV2Handler satisfies BatchHandler and WriteErrorCounter at compile time.
 var _ BatchHandler = (*InfluxDBV2Handler)(nil)
+var _ WriteErrorCounter = (*InfluxDBV2Handler)(nil)
@@ -0,0 +1,45 @@
+package framing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/AarC10/GSW-V2/lib/ccsds"
+)
+
+// ccsdsReader reads CCSDS Space Packets, using the packet length in each primary header.
+// Frames include the primary header.
+type ccsdsReader struct {
+	reader *bufio.Reader
+	buffer []byte
+}
+
+func (c *ccsdsReader) ReadFrame() ([]byte, error) {
+	header := c.buffer[:ccsds.PrimaryHeaderSize]
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return nil, err
+	}
+
+	primary, err := ccsds.ParsePrimaryHeader(header)
+	if err != nil {
+		// the length can still be trusted to skip the packet, as only the version is checked
+		if _, err := c.reader.Discard(int(uint16(header[4])<<8|uint16(header[5])) + 1); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFrame, err)
+	}
+	if primary.PacketSize() > len(c.buffer) {
+		// skip the packet so the stream stays in sync
+		if _, err := c.reader.Discard(primary.DataSize()); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, primary.PacketSize())
+	}
+
+	frame := c.buffer[:primary.PacketSize()]
+	if _, err := io.ReadFull(c.reader, frame[ccsds.PrimaryHeaderSize:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return frame, nil
+}
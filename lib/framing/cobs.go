@@ -0,0 +1,90 @@
+package framing
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// EncodeCOBS encodes data with Consistent Overhead Byte Stuffing and appends the zero byte delimiter.
+func EncodeCOBS(data []byte) []byte {
+	encoded := make([]byte, 1, len(data)+len(data)/254+2)
+	codeIndex := 0
+	code := byte(1)
+
+	for _, b := range data {
+		if b != 0 {
+			encoded = append(encoded, b)
+			code++
+		}
+		if b == 0 || code == 0xFF {
+			encoded[codeIndex] = code
+			codeIndex = len(encoded)
+			encoded = append(encoded, 0)
+			code = 1
+		}
+	}
+	encoded[codeIndex] = code
+
+	return append(encoded, 0)
+}
+
+// cobsReader reads zero delimited COBS frames.
+type cobsReader struct {
+	reader  *bufio.Reader
+	maxSize int
+	encoded []byte
+	buffer  []byte
+}
+
+func (c *cobsReader) ReadFrame() ([]byte, error) {
+	for {
+		c.encoded = c.encoded[:0]
+		oversized := false
+
+		for {
+			b, err := c.reader.ReadByte()
+			if err != nil {
+				if len(c.encoded) > 0 || oversized {
+					return nil, unexpectedEOF(err)
+				}
+				return nil, err
+			}
+			if b == 0 {
+				break
+			}
+			// COBS adds one byte per 254 bytes of data, plus the first code byte
+			if len(c.encoded) > c.maxSize+c.maxSize/254+1 {
+				oversized = true
+				continue
+			}
+			c.encoded = append(c.encoded, b)
+		}
+
+		if oversized {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, c.maxSize)
+		}
+		// consecutive delimiters are used to resynchronize, so skip empty frames
+		if len(c.encoded) == 0 {
+			continue
+		}
+
+		return c.decode()
+	}
+}
+
+// decode decodes the COBS frame held in the encoded buffer.
+func (c *cobsReader) decode() ([]byte, error) {
+	c.buffer = c.buffer[:0]
+	for i := 0; i < len(c.encoded); {
+		code := int(c.encoded[i])
+		if i+code > len(c.encoded) {
+			return nil, fmt.Errorf("%w: COBS code %d overruns frame", ErrInvalidFrame, code)
+		}
+		c.buffer = append(c.buffer, c.encoded[i+1:i+code]...)
+		i += code
+		if code < 0xFF && i < len(c.encoded) {
+			c.buffer = append(c.buffer, 0)
+		}
+	}
+	return c.buffer, nil
+}
@@ -0,0 +1,251 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/AarC10/GSW-V2/lib/ccsds"
+)
+
+// Framing types supported by NewReader
+const (
+	TypeFixed     = "fixed"     // Every frame has the same size
+	TypeLength    = "length"    // Every frame starts with its length
+	TypeDelimiter = "delimiter" // Every frame ends with a delimiter
+	TypeCOBS      = "cobs"      // Every frame is COBS encoded and ends with a zero byte
+	TypeSLIP      = "slip"      // Every frame is SLIP encoded (RFC 1055)
+	TypeSync      = "sync"      // Every frame is a sync word followed by a fixed size payload
+	TypeCCSDS     = "ccsds"     // Every frame is a CCSDS Space Packet, delimited by its primary header
+)
+
+// DefaultMaxSize is the largest frame accepted when Config.MaxSize is not set.
+const DefaultMaxSize = 65535
+
+// ErrFrameTooLarge is returned when a frame exceeds the configured maximum size.
+// The oversized frame is skipped, so reading may continue with the next frame.
+var ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+
+// ErrInvalidFrame is returned when a frame can't be decoded.
+// The invalid frame is skipped, so reading may continue with the next frame.
+var ErrInvalidFrame = errors.New("invalid frame")
+
+// Config describes how frames are delimited in a byte stream.
+type Config struct {
+	Type                 string `yaml:"type"`                             // Framing type (fixed, length, delimiter, cobs, slip, sync, ccsds). Defaults to fixed
+	Size                 int    `yaml:"size,omitempty"`                   // Frame size for fixed and sync framing. Defaults to the packet size
+	LengthSize           int    `yaml:"length_size,omitempty"`            // Size of the length prefix in bytes (1, 2 or 4). Defaults to 2
+	LengthEndianness     string `yaml:"length_endianness,omitempty"`      // Endianness of the length prefix (big, little). Defaults to big
+	LengthIncludesHeader bool   `yaml:"length_includes_header,omitempty"` // Whether the length prefix counts its own bytes
+	Delimiter            string `yaml:"delimiter,omitempty"`              // Hex encoded delimiter for delimiter framing (e.g. 0D0A)
+	SyncWord             string `yaml:"sync_word,omitempty"`              // Hex encoded sync word for sync framing (e.g. 1ACFFC1D)
+	MaxSize              int    `yaml:"max_size,omitempty"`               // Largest frame accepted. Defaults to DefaultMaxSize
+}
+
+// Reader reads frames from a byte stream.
+type Reader interface {
+	// ReadFrame returns the next frame in the stream.
+	// The returned slice is only valid until the next call to ReadFrame.
+	ReadFrame() ([]byte, error)
+}
+
+// Validate checks that the configuration is usable, without needing a stream.
+func (c Config) Validate() error {
+	_, err := NewReader(c, bytes.NewReader(nil), 1)
+	return err
+}
+
+// NewReader creates a frame reader for r.
+// packetSize is the size used by fixed framing when Config.Size is not set.
+func NewReader(cfg Config, r io.Reader, packetSize int) (Reader, error) {
+	maxSize := cfg.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxSize < 0 {
+		return nil, fmt.Errorf("max_size must be positive")
+	}
+
+	buffered := bufio.NewReader(r)
+
+	switch cfg.Type {
+	case "", TypeFixed:
+		size := cfg.Size
+		if size == 0 {
+			size = packetSize
+		}
+		if size <= 0 || size > maxSize {
+			return nil, fmt.Errorf("fixed frame size %d must be between 1 and %d", size, maxSize)
+		}
+		return &fixedReader{reader: buffered, buffer: make([]byte, size)}, nil
+	case TypeSync:
+		syncWord, err := hex.DecodeString(cfg.SyncWord)
+		if err != nil {
+			return nil, fmt.Errorf("decoding sync word: %w", err)
+		}
+		if len(syncWord) == 0 {
+			return nil, fmt.Errorf("sync_word is required for sync framing")
+		}
+		size := cfg.Size
+		if size == 0 {
+			size = packetSize
+		}
+		if size <= 0 || size > maxSize {
+			return nil, fmt.Errorf("sync frame size %d must be between 1 and %d", size, maxSize)
+		}
+		return &syncReader{reader: buffered, syncWord: syncWord, buffer: make([]byte, size)}, nil
+	case TypeCCSDS:
+		if maxSize < ccsds.PrimaryHeaderSize {
+			return nil, fmt.Errorf("max_size %d is smaller than a CCSDS primary header", maxSize)
+		}
+		return &ccsdsReader{reader: buffered, buffer: make([]byte, min(maxSize, ccsds.PrimaryHeaderSize+ccsds.MaxDataSize))}, nil
+	case TypeCOBS:
+		return &cobsReader{reader: buffered, maxSize: maxSize}, nil
+	case TypeSLIP:
+		return &slipReader{reader: buffered, maxSize: maxSize}, nil
+	case TypeLength:
+		lengthSize := cfg.LengthSize
+		if lengthSize == 0 {
+			lengthSize = 2
+		}
+		if lengthSize != 1 && lengthSize != 2 && lengthSize != 4 {
+			return nil, fmt.Errorf("length_size %d must be 1, 2 or 4", lengthSize)
+		}
+
+		var order binary.ByteOrder = binary.BigEndian
+		switch cfg.LengthEndianness {
+		case "", "big":
+		case "little":
+			order = binary.LittleEndian
+		default:
+			return nil, fmt.Errorf("length_endianness specified as %s, instead of big or little", cfg.LengthEndianness)
+		}
+
+		return &lengthReader{
+			reader:         buffered,
+			header:         make([]byte, lengthSize),
+			order:          order,
+			includesHeader: cfg.LengthIncludesHeader,
+			buffer:         make([]byte, maxSize),
+		}, nil
+	case TypeDelimiter:
+		delimiter, err := hex.DecodeString(cfg.Delimiter)
+		if err != nil {
+			return nil, fmt.Errorf("decoding delimiter: %w", err)
+		}
+		if len(delimiter) == 0 {
+			return nil, fmt.Errorf("delimiter is required for delimiter framing")
+		}
+		return &delimiterReader{reader: buffered, delimiter: delimiter, maxSize: maxSize}, nil
+	default:
+		return nil, fmt.Errorf("unsupported framing type: %s", cfg.Type)
+	}
+}
+
+// fixedReader reads frames of a fixed size.
+type fixedReader struct {
+	reader *bufio.Reader
+	buffer []byte
+}
+
+func (f *fixedReader) ReadFrame() ([]byte, error) {
+	if _, err := io.ReadFull(f.reader, f.buffer); err != nil {
+		return nil, err
+	}
+	return f.buffer, nil
+}
+
+// lengthReader reads frames prefixed with their length.
+type lengthReader struct {
+	reader         *bufio.Reader
+	header         []byte
+	order          binary.ByteOrder
+	includesHeader bool
+	buffer         []byte
+}
+
+func (l *lengthReader) ReadFrame() ([]byte, error) {
+	if _, err := io.ReadFull(l.reader, l.header); err != nil {
+		return nil, err
+	}
+
+	var length int
+	switch len(l.header) {
+	case 1:
+		length = int(l.header[0])
+	case 2:
+		length = int(l.order.Uint16(l.header))
+	case 4:
+		length = int(l.order.Uint32(l.header))
+	}
+
+	if l.includesHeader {
+		length -= len(l.header)
+		if length < 0 {
+			return nil, fmt.Errorf("length prefix %d is smaller than the prefix itself", length+len(l.header))
+		}
+	}
+	if length > len(l.buffer) {
+		// skip the frame so the stream stays in sync
+		if _, err := l.reader.Discard(length); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, length)
+	}
+
+	frame := l.buffer[:length]
+	if _, err := io.ReadFull(l.reader, frame); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return frame, nil
+}
+
+// delimiterReader reads frames terminated by a delimiter.
+type delimiterReader struct {
+	reader    *bufio.Reader
+	delimiter []byte
+	maxSize   int
+	buffer    []byte
+}
+
+func (d *delimiterReader) ReadFrame() ([]byte, error) {
+	d.buffer = d.buffer[:0]
+	oversized := false
+
+	for {
+		b, err := d.reader.ReadByte()
+		if err != nil {
+			if len(d.buffer) > 0 || oversized {
+				return nil, unexpectedEOF(err)
+			}
+			return nil, err
+		}
+
+		d.buffer = append(d.buffer, b)
+		if bytes.HasSuffix(d.buffer, d.delimiter) {
+			if oversized {
+				return nil, fmt.Errorf("%w: more than %d bytes before delimiter", ErrFrameTooLarge, d.maxSize)
+			}
+			return d.buffer[:len(d.buffer)-len(d.delimiter)], nil
+		}
+
+		if len(d.buffer) >= d.maxSize+len(d.delimiter) {
+			// keep reading until the delimiter so the stream stays in sync,
+			// holding on to just enough bytes to recognize it
+			oversized = true
+			d.buffer = append(d.buffer[:0], d.buffer[len(d.buffer)-len(d.delimiter)+1:]...)
+		}
+	}
+}
+
+// unexpectedEOF converts an EOF in the middle of a frame into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,351 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// readAll reads frames until the stream ends, copying each frame.
+func readAll(t *testing.T, reader Reader) ([][]byte, error) {
+	t.Helper()
+	var frames [][]byte
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return frames, nil
+			}
+			return frames, err
+		}
+		frames = append(frames, append([]byte(nil), frame...))
+	}
+}
+
+func compareFrames(t *testing.T, expected, actual [][]byte) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %d frames, got %d: % X", len(expected), len(actual), actual)
+	}
+	for i := range expected {
+		if !bytes.Equal(expected[i], actual[i]) {
+			t.Errorf("frame %d: expected % X, got % X", i, expected[i], actual[i])
+		}
+	}
+}
+
+func TestReaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		packetSize int
+		stream     []byte
+		expected   [][]byte
+	}{
+		{
+			name:       "fixed default size",
+			cfg:        Config{},
+			packetSize: 2,
+			stream:     []byte{1, 2, 3, 4},
+			expected:   [][]byte{{1, 2}, {3, 4}},
+		},
+		{
+			name:       "fixed configured size",
+			cfg:        Config{Type: TypeFixed, Size: 3},
+			packetSize: 2,
+			stream:     []byte{1, 2, 3, 4, 5, 6},
+			expected:   [][]byte{{1, 2, 3}, {4, 5, 6}},
+		},
+		{
+			name:     "length big endian",
+			cfg:      Config{Type: TypeLength},
+			stream:   []byte{0, 2, 1, 2, 0, 0, 0, 1, 3},
+			expected: [][]byte{{1, 2}, {}, {3}},
+		},
+		{
+			name:     "length little endian including header",
+			cfg:      Config{Type: TypeLength, LengthSize: 4, LengthEndianness: "little", LengthIncludesHeader: true},
+			stream:   []byte{6, 0, 0, 0, 1, 2, 5, 0, 0, 0, 3},
+			expected: [][]byte{{1, 2}, {3}},
+		},
+		{
+			name:     "length single byte",
+			cfg:      Config{Type: TypeLength, LengthSize: 1},
+			stream:   []byte{1, 0xAA, 2, 0xBB, 0xCC},
+			expected: [][]byte{{0xAA}, {0xBB, 0xCC}},
+		},
+		{
+			name:     "delimiter",
+			cfg:      Config{Type: TypeDelimiter, Delimiter: "0D0A"},
+			stream:   []byte{1, 0x0D, 2, 0x0D, 0x0A, 0x0D, 0x0A, 3, 0x0A, 0x0D, 0x0A},
+			expected: [][]byte{{1, 0x0D, 2}, {}, {3, 0x0A}},
+		},
+		{
+			name:     "ccsds",
+			cfg:      Config{Type: TypeCCSDS},
+			stream:   []byte{0x08, 0x64, 0xC0, 0x00, 0x00, 0x01, 0xAA, 0xBB, 0x00, 0x65, 0xC0, 0x01, 0x00, 0x00, 0xCC},
+			expected: [][]byte{{0x08, 0x64, 0xC0, 0x00, 0x00, 0x01, 0xAA, 0xBB}, {0x00, 0x65, 0xC0, 0x01, 0x00, 0x00, 0xCC}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewReader(tt.cfg, bytes.NewReader(tt.stream), tt.packetSize)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			frames, err := readAll(t, reader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			compareFrames(t, tt.expected, frames)
+		})
+	}
+}
+
+func TestTruncatedFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		stream []byte
+	}{
+		{"fixed", Config{Size: 4}, []byte{1, 2, 3, 4, 5}},
+		{"length", Config{Type: TypeLength}, []byte{0, 1, 1, 0, 4, 1}},
+		{"delimiter", Config{Type: TypeDelimiter, Delimiter: "00"}, []byte{1, 0, 2}},
+		{"ccsds", Config{Type: TypeCCSDS}, []byte{0x08, 0x64, 0xC0, 0x00, 0x00, 0x00, 1, 0x08, 0x64, 0xC0, 0x01, 0x00, 0x02, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewReader(tt.cfg, bytes.NewReader(tt.stream), 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			frames, err := readAll(t, reader)
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("expected unexpected EOF, got %v", err)
+			}
+			if len(frames) != 1 {
+				t.Errorf("expected 1 frame before the truncated one, got %d", len(frames))
+			}
+		})
+	}
+}
+
+func TestOversizedFrameIsSkipped(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		stream []byte
+	}{
+		{"length", Config{Type: TypeLength, LengthSize: 1, MaxSize: 2}, []byte{3, 9, 9, 9, 2, 1, 2}},
+		{"delimiter", Config{Type: TypeDelimiter, Delimiter: "FFFE", MaxSize: 2}, []byte{9, 9, 9, 0xFF, 0xFE, 1, 2, 0xFF, 0xFE}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewReader(tt.cfg, bytes.NewReader(tt.stream), 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, err := reader.ReadFrame(); !errors.Is(err, ErrFrameTooLarge) {
+				t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+			}
+
+			frames, err := readAll(t, reader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			compareFrames(t, [][]byte{{1, 2}}, frames)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"default", Config{}, false},
+		{"length", Config{Type: TypeLength, LengthSize: 4}, false},
+		{"delimiter", Config{Type: TypeDelimiter, Delimiter: "0a"}, false},
+		{"unknown type", Config{Type: "carrier pigeon"}, true},
+		{"bad length size", Config{Type: TypeLength, LengthSize: 3}, true},
+		{"bad length endianness", Config{Type: TypeLength, LengthEndianness: "middle"}, true},
+		{"missing delimiter", Config{Type: TypeDelimiter}, true},
+		{"bad delimiter", Config{Type: TypeDelimiter, Delimiter: "xyz"}, true},
+		{"negative max size", Config{MaxSize: -1}, true},
+		{"fixed larger than max", Config{Size: 10, MaxSize: 5}, true},
+		{"cobs", Config{Type: TypeCOBS}, false},
+		{"slip", Config{Type: TypeSLIP}, false},
+		{"sync", Config{Type: TypeSync, SyncWord: "EB90", Size: 4}, false},
+		{"missing sync word", Config{Type: TypeSync}, true},
+		{"ccsds", Config{Type: TypeCCSDS}, false},
+		{"ccsds max smaller than header", Config{Type: TypeCCSDS, MaxSize: 5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCOBS(t *testing.T) {
+	long := bytes.Repeat([]byte{0xAA}, 300)
+	long[253] = 0
+	tests := []struct {
+		name    string
+		data    []byte
+		encoded []byte
+	}{
+		{"empty", []byte{}, []byte{0x01, 0x00}},
+		{"zero", []byte{0x00}, []byte{0x01, 0x01, 0x00}},
+		{"zeros", []byte{0x00, 0x00}, []byte{0x01, 0x01, 0x01, 0x00}},
+		{"mixed", []byte{0x11, 0x22, 0x00, 0x33}, []byte{0x03, 0x11, 0x22, 0x02, 0x33, 0x00}},
+		{"trailing zero", []byte{0x11, 0x00}, []byte{0x02, 0x11, 0x01, 0x00}},
+		{"long", long, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := EncodeCOBS(tt.data)
+			if tt.encoded != nil && !bytes.Equal(encoded, tt.encoded) {
+				t.Errorf("expected encoding % X, got % X", tt.encoded, encoded)
+			}
+			if bytes.IndexByte(encoded[:len(encoded)-1], 0) != -1 {
+				t.Errorf("encoding contains a zero byte before the delimiter: % X", encoded)
+			}
+
+			// leading delimiters resynchronize the stream and are skipped
+			stream := append([]byte{0, 0}, encoded...)
+			reader, err := NewReader(Config{Type: TypeCOBS}, bytes.NewReader(stream), 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			frames, err := readAll(t, reader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			compareFrames(t, [][]byte{tt.data}, frames)
+		})
+	}
+}
+
+func TestCOBSInvalidFrame(t *testing.T) {
+	stream := append([]byte{0x05, 0x11, 0x00}, EncodeCOBS([]byte{1, 2})...)
+	reader, err := NewReader(Config{Type: TypeCOBS}, bytes.NewReader(stream), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := reader.ReadFrame(); !errors.Is(err, ErrInvalidFrame) {
+		t.Fatalf("expected ErrInvalidFrame, got %v", err)
+	}
+	frames, err := readAll(t, reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	compareFrames(t, [][]byte{{1, 2}}, frames)
+}
+
+func TestCCSDSSkippedPackets(t *testing.T) {
+	next := []byte{0x08, 0x64, 0xC0, 0x01, 0x00, 0x00, 1}
+	tests := []struct {
+		name   string
+		cfg    Config
+		packet []byte
+		err    error
+	}{
+		{"invalid version", Config{Type: TypeCCSDS}, []byte{0x28, 0x64, 0xC0, 0x00, 0x00, 0x01, 9, 9}, ErrInvalidFrame},
+		{"oversized", Config{Type: TypeCCSDS, MaxSize: 8}, []byte{0x08, 0x64, 0xC0, 0x00, 0x00, 0x02, 9, 9, 9}, ErrFrameTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := append(append([]byte(nil), tt.packet...), next...)
+			reader, err := NewReader(tt.cfg, bytes.NewReader(stream), 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, err := reader.ReadFrame(); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			frames, err := readAll(t, reader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			compareFrames(t, [][]byte{next}, frames)
+		})
+	}
+}
+
+func TestSLIP(t *testing.T) {
+	data := []byte{0x01, 0xC0, 0x02, 0xDB, 0x03}
+	encoded := EncodeSLIP(data)
+	expected := []byte{0xC0, 0x01, 0xDB, 0xDC, 0x02, 0xDB, 0xDD, 0x03, 0xC0}
+	if !bytes.Equal(encoded, expected) {
+		t.Fatalf("expected encoding % X, got % X", expected, encoded)
+	}
+
+	stream := append(append([]byte{}, encoded...), EncodeSLIP([]byte{0x04})...)
+	stream = append(stream, 0xDB, 0x01, 0xC0) // invalid escape
+	stream = append(stream, EncodeSLIP([]byte{0x05})...)
+
+	reader, err := NewReader(Config{Type: TypeSLIP}, bytes.NewReader(stream), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var frames [][]byte
+	var invalid int
+	for {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, ErrInvalidFrame) {
+			invalid++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		frames = append(frames, append([]byte(nil), frame...))
+	}
+
+	if invalid != 1 {
+		t.Errorf("expected 1 invalid frame, got %d", invalid)
+	}
+	compareFrames(t, [][]byte{data, {0x04}, {0x05}}, frames)
+}
+
+func TestSync(t *testing.T) {
+	syncWord := []byte{0x1A, 0xCF, 0xFC, 0x1D}
+	stream := []byte{0x00, 0x1A, 0xCF} // noise and a partial sync word
+	stream = append(stream, syncWord...)
+	stream = append(stream, 1, 2, 3)
+	stream = append(stream, 0x1A, 0x1A) // repeated first byte before the sync word
+	stream = append(stream, syncWord[1:]...)
+	stream = append(stream, 4, 5, 6)
+
+	reader, err := NewReader(Config{Type: TypeSync, SyncWord: "1ACFFC1D"}, bytes.NewReader(stream), 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	frames, err := readAll(t, reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	compareFrames(t, [][]byte{{1, 2, 3}, {4, 5, 6}}, frames)
+}
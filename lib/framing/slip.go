@@ -0,0 +1,92 @@
+package framing
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// SLIP special bytes (RFC 1055)
+const (
+	slipEnd    = 0xC0
+	slipEsc    = 0xDB
+	slipEscEnd = 0xDC
+	slipEscEsc = 0xDD
+)
+
+// EncodeSLIP encodes data as a SLIP frame, with an END byte on both sides.
+func EncodeSLIP(data []byte) []byte {
+	encoded := make([]byte, 0, len(data)+2)
+	encoded = append(encoded, slipEnd)
+	for _, b := range data {
+		switch b {
+		case slipEnd:
+			encoded = append(encoded, slipEsc, slipEscEnd)
+		case slipEsc:
+			encoded = append(encoded, slipEsc, slipEscEsc)
+		default:
+			encoded = append(encoded, b)
+		}
+	}
+	return append(encoded, slipEnd)
+}
+
+// slipReader reads SLIP frames.
+type slipReader struct {
+	reader  *bufio.Reader
+	maxSize int
+	buffer  []byte
+}
+
+func (s *slipReader) ReadFrame() ([]byte, error) {
+	for {
+		s.buffer = s.buffer[:0]
+		escaped := false
+		invalid := false
+		oversized := false
+
+		for {
+			b, err := s.reader.ReadByte()
+			if err != nil {
+				if len(s.buffer) > 0 || escaped || invalid || oversized {
+					return nil, unexpectedEOF(err)
+				}
+				return nil, err
+			}
+			if b == slipEnd {
+				break
+			}
+
+			if escaped {
+				escaped = false
+				switch b {
+				case slipEscEnd:
+					b = slipEnd
+				case slipEscEsc:
+					b = slipEsc
+				default:
+					invalid = true
+				}
+			} else if b == slipEsc {
+				escaped = true
+				continue
+			}
+
+			if len(s.buffer) >= s.maxSize {
+				oversized = true
+				continue
+			}
+			s.buffer = append(s.buffer, b)
+		}
+
+		switch {
+		case oversized:
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, s.maxSize)
+		case invalid || escaped:
+			return nil, fmt.Errorf("%w: bad SLIP escape sequence", ErrInvalidFrame)
+		case len(s.buffer) == 0:
+			// END bytes are also sent before frames to flush line noise, so skip empty frames
+			continue
+		}
+		return s.buffer, nil
+	}
+}
@@ -0,0 +1,47 @@
+package framing
+
+import (
+	"bufio"
+	"io"
+)
+
+// syncReader reads fixed size frames that follow a sync word.
+// Bytes that are not part of a frame are skipped until the next sync word.
+type syncReader struct {
+	reader   *bufio.Reader
+	syncWord []byte
+	buffer   []byte
+}
+
+func (s *syncReader) ReadFrame() ([]byte, error) {
+	matched := 0
+	for matched < len(s.syncWord) {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			if matched > 0 {
+				return nil, unexpectedEOF(err)
+			}
+			return nil, err
+		}
+
+		if b == s.syncWord[matched] {
+			matched++
+			continue
+		}
+
+		// fall back to the longest prefix of the sync word that is still a match
+		window := append(append([]byte(nil), s.syncWord[:matched]...), b)
+		matched = 0
+		for start := 1; start < len(window); start++ {
+			if string(window[start:]) == string(s.syncWord[:len(window)-start]) {
+				matched = len(window) - start
+				break
+			}
+		}
+	}
+
+	if _, err := io.ReadFull(s.reader, s.buffer); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return s.buffer, nil
+}
@@ -1,6 +1,9 @@
 package ipc
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 // Writer is an interface for sending data across processes
 type Writer interface {
@@ -19,3 +22,101 @@ type Reader interface {
 	Read(ctx context.Context) (ReaderMessage, error)
 	Cleanup()
 }
+
+// RingReader reads the messages of a ring of recent messages kept by its writer.
+// Its messages are SequencedMessages.
+type RingReader interface {
+	Reader
+	// SetReadMode selects which messages Read returns. Readers start in ReadLatest mode.
+	SetReadMode(mode ReadMode)
+	// Rewind makes the reader read from the oldest message the ring holds in ReadAll mode,
+	// instead of the first one written after the reader was created. It must be called before reading.
+	Rewind()
+	// ReadRaw returns a copy of the newest message.
+	ReadRaw() ([]byte, error)
+	// CheckWriter returns an error wrapping ErrWriterGone if the writer is gone.
+	CheckWriter() error
+}
+
+// SequencedMessage is a message read by a RingReader.
+type SequencedMessage interface {
+	ReaderMessage
+	// ReceiveTimestamp returns the unix timestamp when the message was written (nanoseconds since epoch).
+	ReceiveTimestamp() uint64
+	// Sequence returns the message sequence number, counting the messages written from 1.
+	Sequence() uint64
+	// Overwritten returns how many messages written right before this one were overwritten
+	// before the reader could read them. It is always 0 in ReadLatest mode.
+	Overwritten() uint32
+}
+
+// Backend selects how messages are shared between processes.
+// It implements flag.Value, so it can be set with a flag.
+type Backend string
+
+const (
+	// BackendShm shares messages in shared memory rings, for processes sharing a shared memory directory such as /dev/shm.
+	BackendShm Backend = "shm"
+	// BackendSocket shares messages over Unix domain sockets, for processes sharing a directory
+	// but not shared memory, such as in separate containers.
+	BackendSocket Backend = "socket"
+)
+
+// String returns the name of the backend.
+func (b *Backend) String() string {
+	return string(*b)
+}
+
+// Set sets the backend from its name.
+func (b *Backend) Set(name string) error {
+	switch Backend(name) {
+	case BackendShm, BackendSocket:
+		*b = Backend(name)
+		return nil
+	}
+	return fmt.Errorf("unknown IPC backend %q, expected %s or %s", name, BackendShm, BackendSocket)
+}
+
+// NewWriter creates a writer for messages of packetSize bytes with the backend.
+// name describes what is written, such as the packet name.
+func NewWriter(backend Backend, identifier string, name string, packetSize int, dir string) (Writer, error) {
+	if backend == BackendSocket {
+		writer, err := NewSocketWriter(identifier, name, packetSize, dir)
+		if err != nil {
+			return nil, err
+		}
+		return writer, nil
+	}
+	writer, err := NewShmWriter(identifier, name, packetSize, dir)
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// NewReader creates a reader with the backend, which fails if the writer's messages aren't packetSize bytes.
+// A negative packetSize accepts messages of any size.
+func NewReader(backend Backend, identifier string, packetSize int, dir string) (RingReader, error) {
+	var reader RingReader
+	var err error
+	switch {
+	case backend == BackendSocket:
+		reader, err = NewSocketReader(identifier, packetSize, dir)
+	case packetSize < 0:
+		reader, err = CreateShmReader(identifier, dir)
+	default:
+		reader, err = NewShmHandler(identifier, packetSize, false, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// List returns the metadata of every ring shared with the backend in dir.
+func List(backend Backend, dir string) ([]ShmInfo, error) {
+	if backend == BackendSocket {
+		return ListSockets(dir)
+	}
+	return ListShm(dir)
+}
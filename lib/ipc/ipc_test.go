@@ -0,0 +1,282 @@
+package ipc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// newBackendRing creates a writer and a reader for 8 byte messages with a backend.
+func newBackendRing(t *testing.T, backend Backend) (Writer, RingReader) {
+	t.Helper()
+	dir := t.TempDir()
+	writer, err := NewWriter(backend, "test", "test", 8, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(writer.Cleanup)
+	reader, err := NewReader(backend, "test", 8, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(reader.Cleanup)
+	return writer, reader
+}
+
+// writeValues writes the values from start to end (excluded) as messages.
+func writeValues(t *testing.T, writer Writer, start uint64, end uint64) {
+	t.Helper()
+	for i := start; i < end; i++ {
+		if err := writer.Write(binary.BigEndian.AppendUint64(nil, i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// readValue reads a message, returning its value and how many messages were overwritten before it.
+func readValue(t *testing.T, reader RingReader) (uint64, uint32) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	message, err := reader.Read(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sequenced := message.(SequencedMessage)
+	return binary.BigEndian.Uint64(sequenced.Data()), sequenced.Overwritten()
+}
+
+// TestBackends checks that readers of every backend return the same messages.
+func TestBackends(t *testing.T) {
+	for _, backend := range []Backend{BackendShm, BackendSocket} {
+		t.Run(string(backend), func(t *testing.T) {
+			t.Run("read latest", func(t *testing.T) {
+				writer, reader := newBackendRing(t, backend)
+				writeValues(t, writer, 0, 3)
+				// sockets may not have delivered every message yet, but never return an older one
+				last := int64(-1)
+				for last != 2 {
+					value, overwritten := readValue(t, reader)
+					if int64(value) <= last || overwritten != 0 {
+						t.Fatalf("expected a value after %d with none overwritten, got %d with %d overwritten", last, value, overwritten)
+					}
+					last = int64(value)
+				}
+			})
+
+			t.Run("read latest slow reader", func(t *testing.T) {
+				writer, reader := newBackendRing(t, backend)
+				// a reader that falls behind skips to the newest message instead of catching up
+				for end := uint64(ringSize + 30); end < 4*ringSize; end += ringSize + 30 {
+					writeValues(t, writer, end-ringSize-30, end)
+					if value, _ := readValue(t, reader); value != end-1 {
+						t.Fatalf("expected %d, got %d", end-1, value)
+					}
+				}
+			})
+
+			t.Run("read all", func(t *testing.T) {
+				writer, reader := newBackendRing(t, backend)
+				reader.SetReadMode(ReadAll)
+				writeValues(t, writer, 0, 3)
+				for expected := uint64(0); expected < 3; expected++ {
+					if value, overwritten := readValue(t, reader); value != expected || overwritten != 0 {
+						t.Errorf("expected %d with none overwritten, got %d with %d overwritten", expected, value, overwritten)
+					}
+				}
+
+				// every message of a burst longer than the ring is either read or reported as overwritten, in order
+				const end = 3 + 2*ringSize
+				writeValues(t, writer, 3, end)
+				next, lost := uint64(3), uint64(0)
+				for next < end {
+					value, overwritten := readValue(t, reader)
+					if value != next+uint64(overwritten) {
+						t.Fatalf("expected %d after %d overwritten, got %d", next+uint64(overwritten), overwritten, value)
+					}
+					next = value + 1
+					lost += uint64(overwritten)
+				}
+				if lost < ringSize {
+					t.Errorf("expected at least %d overwritten, got %d", ringSize, lost)
+				}
+			})
+
+			t.Run("rewind", func(t *testing.T) {
+				dir := t.TempDir()
+				writer, err := NewWriter(backend, "test", "test", 8, dir)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer writer.Cleanup()
+				writeValues(t, writer, 0, 3)
+
+				reader, err := NewReader(backend, "test", -1, dir)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer reader.Cleanup()
+				reader.SetReadMode(ReadAll)
+				reader.Rewind()
+				for expected := uint64(0); expected < 3; expected++ {
+					if value, _ := readValue(t, reader); value != expected {
+						t.Errorf("expected %d, got %d", expected, value)
+					}
+				}
+			})
+
+			t.Run("read raw", func(t *testing.T) {
+				dir := t.TempDir()
+				writer, err := NewWriter(backend, "test", "test", 8, dir)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer writer.Cleanup()
+				writeValues(t, writer, 7, 8)
+
+				reader, err := NewReader(backend, "test", -1, dir)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer reader.Cleanup()
+				data, err := reader.ReadRaw()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if value := binary.BigEndian.Uint64(data); value != 7 {
+					t.Errorf("expected 7, got %d", value)
+				}
+			})
+
+			t.Run("read raw empty", func(t *testing.T) {
+				_, reader := newBackendRing(t, backend)
+				data, err := reader.ReadRaw()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(data) != 8 || binary.BigEndian.Uint64(data) != 0 {
+					t.Errorf("expected 8 zero bytes, got %v", data)
+				}
+			})
+
+			t.Run("writer gone", func(t *testing.T) {
+				writer, reader := newBackendRing(t, backend)
+				reader.SetReadMode(ReadAll)
+				writeValues(t, writer, 0, 2)
+				// the writer must have sent the messages before it is gone
+				if value, _ := readValue(t, reader); value != 0 {
+					t.Errorf("expected 0, got %d", value)
+				}
+				writer.Cleanup()
+
+				if value, _ := readValue(t, reader); value != 1 {
+					t.Errorf("expected 1, got %d", value)
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 2*shmWriterCheckInterval)
+				defer cancel()
+				if _, err := reader.Read(ctx); !errors.Is(err, ErrWriterGone) {
+					t.Errorf("expected ErrWriterGone, got %v", err)
+				}
+				if err := reader.CheckWriter(); !errors.Is(err, ErrWriterGone) {
+					t.Errorf("expected ErrWriterGone, got %v", err)
+				}
+			})
+
+			t.Run("waits", func(t *testing.T) {
+				_, reader := newBackendRing(t, backend)
+				if err := reader.CheckWriter(); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				if _, err := reader.Read(ctx); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("expected context.DeadlineExceeded, got %v", err)
+				}
+			})
+
+			t.Run("message size", func(t *testing.T) {
+				dir := t.TempDir()
+				writer, err := NewWriter(backend, "test", "test", 8, dir)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer writer.Cleanup()
+				if _, err := NewReader(backend, "test", 9, dir); err == nil {
+					t.Errorf("expected an error for another message size, got nil")
+				}
+				if _, err := NewReader(backend, "missing", 8, dir); err == nil {
+					t.Errorf("expected an error for a missing writer, got nil")
+				}
+			})
+		})
+	}
+}
+
+func TestSocketWriterReplaced(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewSocketWriter("test", "test", 8, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	replacement, err := NewSocketWriter("test", "test", 8, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(replacement.Cleanup)
+
+	// the old writer leaves the replacement's socket in place, so readers still reach it
+	writer.Cleanup()
+	reader, err := NewSocketReader("test", 8, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Cleanup()
+	writeValues(t, replacement, 5, 6)
+	if value, _ := readValue(t, reader); value != 5 {
+		t.Errorf("expected 5, got %d", value)
+	}
+
+	replacement.Cleanup()
+	if _, err := os.Stat(socketPath("test", dir)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the socket to be removed, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	for _, backend := range []Backend{BackendShm, BackendSocket} {
+		t.Run(string(backend), func(t *testing.T) {
+			dir := t.TempDir()
+			writer, err := NewWriter(backend, "test", "Test packet", 8, dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer writer.Cleanup()
+
+			infos, err := List(backend, dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(infos) != 1 {
+				t.Fatalf("expected 1 ring, got %+v", infos)
+			}
+			info := infos[0]
+			if info.Identifier != "test" || info.Name != "Test packet" || info.MessageSize != 8 || info.RingSize != ringSize ||
+				info.Version != ShmLayoutVersion || info.WriterPID != os.Getpid() || time.Since(info.Created) > time.Minute {
+				t.Errorf("unexpected info %+v", info)
+			}
+		})
+	}
+}
+
+func TestBackendFlag(t *testing.T) {
+	var backend Backend
+	if err := backend.Set("socket"); err != nil || backend != BackendSocket {
+		t.Errorf("expected socket, got %s (%v)", backend, err)
+	}
+	if err := backend.Set("pipe"); err == nil {
+		t.Errorf("expected an error for an unknown backend, got nil")
+	}
+}
@@ -1,11 +1,14 @@
 package ipc
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -15,103 +18,359 @@ import (
 	"go.uber.org/zap"
 )
 
+// shmFileHeader is the header at the start of a shared memory segment, describing its layout.
+// The futex word stays first, and magic is written last, once the rest of the header is valid.
+// The writer clears magic again when it closes the segment.
 type shmFileHeader struct {
-	futex uint32
+	futex       uint32 // Incremented by every write to wake readers, wrapping around
+	magic       uint32
+	sequence    uint64 // Sequence number of the newest message, 0 before the first write
+	version     uint32
+	ringSize    uint32
+	messageSize uint32 // Size of a slot in the ring, including its header and padding
+	packetSize  uint32 // Size of the messages written, without their header
+	writerPID   uint32
+	created     int64 // Unix time in nanoseconds the segment was created
+	heartbeat   int64 // Unix time in nanoseconds the writer was last known to be running
+	name        [shmNameSize]byte
 }
 
+// shmMessageHeader starts each slot of the ring.
+// lock is a seqlock: the writer makes it odd before changing the slot and even once done,
+// so a reader that sees it odd, or changed after copying the slot, knows its copy may be torn.
 type shmMessageHeader struct {
-	timestamp   uint64
-	targetFutex uint32
+	timestamp uint64
+	sequence  uint64 // Sequence number of the message in the slot
+	lock      uint32
 }
 
 // ShmHandler is a shared memory handler for inter-process communication
 type ShmHandler struct {
-	file            *os.File       // File descriptor for shared memory
-	data            []byte         // Pointer to shared memory data
-	header          *shmFileHeader // Pointer to header in shared memory
-	messageSize     int            // size of an individual message, including the header
-	size            int            // Size of shared memory
-	mode            handlerMode    // handler mode: reader or writer
-	readerLastFutex uint32         // Last futex word value
+	file          *os.File       // File descriptor for shared memory
+	data          []byte         // Pointer to shared memory data
+	header        *shmFileHeader // Pointer to header in shared memory
+	messageSize   int            // size of an individual message, including the header and padding
+	packetSize    int            // size of the data of a message
+	size          int            // Size of shared memory
+	mode          handlerMode    // handler mode: reader or writer
+	readMode      ReadMode       // Which messages a reader returns
+	readerLast    uint64         // Sequence number of the last message read
+	overwritten   uint64         // Messages overwritten before the reader could read them, in ReadAll mode
+	torn          uint64         // Copies of a slot discarded because the writer changed it while it was copied
+	info          ShmInfo        // Metadata from the segment's header
+	inode         uint64         // Inode of the segment's file, to detect it being replaced
+	stopHeartbeat chan struct{}  // Closed to stop the writer's heartbeat
+	heartbeatDone chan struct{}  // Closed once the writer's heartbeat stopped
 }
 
+// ReadMode selects which messages Read returns.
+type ReadMode int
+
+const (
+	// ReadLatest returns the newest message, skipping any written since the last one read.
+	ReadLatest ReadMode = iota
+	// ReadAll returns every message since the last one read, in order, as long as the ring still holds them.
+	// Messages overwritten before they could be read are reported by ShmReaderMessage.Overwritten.
+	ReadAll
+)
+
 type handlerMode int
 
 const (
 	handlerModeReader handlerMode = iota
 	handlerModeWriter
 	shmFilePrefix        = "gsw-service-"
+	shmMagic             = 0x47535752 // "GSWR"
+	shmNameSize          = 64
 	shmFileHeaderSize    = int(unsafe.Sizeof(shmFileHeader{}))
 	shmMessageHeaderSize = int(unsafe.Sizeof(shmMessageHeader{}))
 	ringSize             = 256
+
+	// shmHeartbeatInterval is how often writers update the heartbeat in the header.
+	shmHeartbeatInterval = time.Second
+	// shmWriterTimeout is how old the heartbeat can be before readers consider the writer gone.
+	shmWriterTimeout = 5 * shmHeartbeatInterval
+	// shmWriterCheckInterval is how often waiting readers check that the writer is still there.
+	shmWriterCheckInterval = 500 * time.Millisecond
 )
 
+// ShmLayoutVersion is the version of the shared memory layout written by this package.
+// Readers refuse segments with another version.
+const ShmLayoutVersion = 4
+
+// ErrShmNotReady is returned when a segment's header hasn't been written yet, or it isn't a GSW segment.
+// Readers can retry, since a writer may be creating it.
+var ErrShmNotReady = errors.New("shared memory segment is not initialized")
+
+// ErrWriterGone is returned by readers once every message was read and the writer closed the segment,
+// replaced it with a new one or stopped running, such as when gsw_service restarts.
+// Readers must be recreated to read the new segment.
+var ErrWriterGone = errors.New("shared memory writer is gone")
+
+// ShmInfo describes a shared memory segment, as recorded in its header by its writer.
+type ShmInfo struct {
+	Identifier  string    // Identifier of the segment, its file name without the gsw-service- prefix
+	Name        string    // Name of what is written to the segment, such as the packet name
+	Version     int       // Layout version
+	RingSize    int       // Number of messages the ring holds
+	MessageSize int       // Size of the messages written, without their header
+	WriterPID   int       // Process ID of the writer
+	Created     time.Time // Time the writer created the segment
+}
+
+// Info returns the metadata of the handler's segment.
+func (handler *ShmHandler) Info() ShmInfo {
+	return handler.info
+}
+
+// shmPath returns the path of the segment with an identifier.
+func shmPath(identifier string, shmDir string) string {
+	return filepath.Join(shmDir, shmFilePrefix+identifier)
+}
+
+// parseShmHeader validates a segment header and returns its metadata.
+func parseShmHeader(identifier string, data []byte) (ShmInfo, error) {
+	if len(data) < shmFileHeaderSize {
+		return ShmInfo{}, fmt.Errorf("%w: %s is smaller than its header", ErrShmNotReady, identifier)
+	}
+	header := (*shmFileHeader)(unsafe.Pointer(&data[0]))
+	if magic := atomic.LoadUint32(&header.magic); magic != shmMagic {
+		return ShmInfo{}, fmt.Errorf("%w: %s has magic %#x, expected %#x", ErrShmNotReady, identifier, magic, uint32(shmMagic))
+	}
+	if header.version != ShmLayoutVersion {
+		return ShmInfo{}, fmt.Errorf("%s has layout version %d, expected %d (are gsw_service and this program the same version?)",
+			identifier, header.version, ShmLayoutVersion)
+	}
+	if header.ringSize != ringSize {
+		return ShmInfo{}, fmt.Errorf("%s has a ring of %d messages, expected %d", identifier, header.ringSize, ringSize)
+	}
+	if int(header.messageSize) != shmSlotSize(int(header.packetSize)) {
+		return ShmInfo{}, fmt.Errorf("%s has invalid message size %d for %d byte packets", identifier, header.messageSize, header.packetSize)
+	}
+	if size := shmFileHeaderSize + int(header.messageSize)*ringSize; len(data) < size {
+		return ShmInfo{}, fmt.Errorf("%s is %d bytes, smaller than its %d byte ring", identifier, len(data), size)
+	}
+
+	name := header.name[:]
+	if end := bytes.IndexByte(name, 0); end >= 0 {
+		name = name[:end]
+	}
+	return ShmInfo{
+		Identifier:  identifier,
+		Name:        string(name),
+		Version:     int(header.version),
+		RingSize:    int(header.ringSize),
+		MessageSize: int(header.packetSize),
+		WriterPID:   int(header.writerPID),
+		Created:     time.Unix(0, header.created),
+	}, nil
+}
+
+// shmSlotSize returns the size of a ring slot holding packets of packetSize bytes.
+// Slots are padded to 8 bytes so the atomic fields of every slot's header are aligned.
+func shmSlotSize(packetSize int) int {
+	return (shmMessageHeaderSize + packetSize + 7) &^ 7
+}
+
+// ReadShmInfo returns the metadata of the segment with an identifier, without opening a reader.
+func ReadShmInfo(identifier string, shmDir string) (ShmInfo, error) {
+	data, err := os.ReadFile(shmPath(identifier, shmDir))
+	if err != nil {
+		return ShmInfo{}, fmt.Errorf("reading shm file: %w", err)
+	}
+	return parseShmHeader(identifier, data)
+}
+
+// ListShm returns the metadata of every segment in a directory, sorted by identifier.
+// Files that aren't valid segments are skipped.
+func ListShm(shmDir string) ([]ShmInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(shmDir, shmFilePrefix+"*"))
+	if err != nil {
+		return nil, fmt.Errorf("listing shm files: %w", err)
+	}
+	var infos []ShmInfo
+	for _, path := range paths {
+		info, err := ReadShmInfo(strings.TrimPrefix(filepath.Base(path), shmFilePrefix), shmDir)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
 // NewShmHandler creates a shared memory handler for inter-process communication
+// A writer names the segment after its identifier, and a reader fails if the segment's messages aren't telemetryPacketSize bytes.
 func NewShmHandler(identifier string, telemetryPacketSize int, isWriter bool, shmDir string) (*ShmHandler, error) {
-	messageSize := telemetryPacketSize + shmMessageHeaderSize
+	if isWriter {
+		return NewShmWriter(identifier, identifier, telemetryPacketSize, shmDir)
+	}
+	handler, err := openShmReader(identifier, shmDir)
+	if err != nil {
+		return nil, err
+	}
+	if handler.info.MessageSize != telemetryPacketSize {
+		handler.Cleanup()
+		return nil, fmt.Errorf("%s holds %d byte messages, expected %d (is gsw_service running with another telemetry config?)",
+			identifier, handler.info.MessageSize, telemetryPacketSize)
+	}
+	return handler, nil
+}
+
+// NewShmWriter creates a shared memory segment for messages of packetSize bytes and a handler writing to it.
+// name describes what is written, such as the packet name, and is recorded in the segment's header.
+func NewShmWriter(identifier string, name string, packetSize int, shmDir string) (*ShmHandler, error) {
+	messageSize := shmSlotSize(packetSize)
 	handler := &ShmHandler{
 		messageSize: messageSize,
+		packetSize:  packetSize,
 		size:        (messageSize * ringSize) + shmFileHeaderSize,
-		mode:        handlerModeReader,
+		mode:        handlerModeWriter,
 	}
 
-	filename := filepath.Join(shmDir, fmt.Sprintf("%s%s", shmFilePrefix, identifier))
+	// a segment left behind is replaced rather than truncated, since readers may still have it mapped
+	path := shmPath(identifier, shmDir)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove old file: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %v", err)
+	}
+	handler.file = file
+	if handler.inode, err = fileInode(file); err != nil {
+		handler.Cleanup()
+		return nil, err
+	}
 
-	if isWriter {
-		handler.mode = handlerModeWriter
-		file, err := os.Create(filename)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create file: %v", err)
-		}
+	err = file.Truncate(int64(handler.size))
+	if err != nil {
+		handler.Cleanup()
+		return nil, fmt.Errorf("failed to truncate file: %v", err)
+	}
 
-		err = file.Truncate(int64(handler.size))
-		if err != nil {
-			return nil, fmt.Errorf("failed to truncate file: %v", err)
-		}
-		handler.file = file
+	data, err := syscall.Mmap(int(file.Fd()), 0, handler.size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		handler.Cleanup()
+		return nil, fmt.Errorf("failed to memory map file: %v", err)
+	}
+	handler.data = data
 
-		data, err := syscall.Mmap(int(file.Fd()), 0, handler.size, syscall.PROT_WRITE, syscall.MAP_SHARED)
-		if err != nil {
-			return nil, fmt.Errorf("failed to memory map file: %v", err)
-		}
-		handler.data = data
-	} else {
-		file, err := os.OpenFile(filename, os.O_RDWR, 0666)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open file: %v", err)
-		}
+	handler.header = (*shmFileHeader)(unsafe.Pointer(&handler.data[0]))
+	handler.header.version = ShmLayoutVersion
+	handler.header.ringSize = ringSize
+	handler.header.messageSize = uint32(messageSize)
+	handler.header.packetSize = uint32(packetSize)
+	handler.header.writerPID = uint32(os.Getpid())
+	handler.header.created = time.Now().UnixNano()
+	handler.header.heartbeat = handler.header.created
+	copy(handler.header.name[:], name)
+	atomic.StoreUint32(&handler.header.magic, shmMagic)
+
+	handler.info, err = parseShmHeader(identifier, handler.data)
+	if err != nil {
+		handler.Cleanup()
+		return nil, err
+	}
 
-		handler.file = file
+	handler.stopHeartbeat = make(chan struct{})
+	handler.heartbeatDone = make(chan struct{})
+	go handler.heartbeat()
+	return handler, nil
+}
 
-		data, err := syscall.Mmap(int(file.Fd()), 0, handler.size, syscall.PROT_READ, syscall.MAP_SHARED)
-		if err != nil {
-			return nil, fmt.Errorf("failed to memory map file: %v", err)
+// heartbeat updates the heartbeat in the header until the writer is cleaned up,
+// so readers can tell a writer that stopped running from one with nothing to write.
+func (handler *ShmHandler) heartbeat() {
+	defer close(handler.heartbeatDone)
+	ticker := time.NewTicker(shmHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-handler.stopHeartbeat:
+			return
+		case now := <-ticker.C:
+			atomic.StoreInt64(&handler.header.heartbeat, now.UnixNano())
 		}
+	}
+}
+
+// fileInode returns the inode of an open file.
+func fileInode(file *os.File) (uint64, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %v", err)
+	}
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("failed to get inode of %s", file.Name())
+	}
+	return sys.Ino, nil
+}
 
-		handler.data = data
+// openShmReader opens a reader for an existing segment, taking its layout from the segment's header.
+func openShmReader(identifier string, shmDir string) (*ShmHandler, error) {
+	file, err := os.OpenFile(shmPath(identifier, shmDir), os.O_RDWR, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
 	}
+	handler := &ShmHandler{file: file, mode: handlerModeReader}
 
+	stat, err := file.Stat()
+	if err != nil {
+		handler.Cleanup()
+		return nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+	if stat.Size() < int64(shmFileHeaderSize) {
+		handler.Cleanup()
+		return nil, fmt.Errorf("%w: %s is smaller than its header", ErrShmNotReady, identifier)
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		handler.Cleanup()
+		return nil, fmt.Errorf("failed to memory map file: %v", err)
+	}
+	handler.data = data
+
+	handler.info, err = parseShmHeader(identifier, data)
+	if err != nil {
+		handler.Cleanup()
+		return nil, err
+	}
+	handler.packetSize = handler.info.MessageSize
+	handler.messageSize = shmSlotSize(handler.packetSize)
+	handler.size = shmFileHeaderSize + handler.messageSize*ringSize
 	handler.header = (*shmFileHeader)(unsafe.Pointer(&handler.data[0]))
-	handler.readerLastFutex = atomic.LoadUint32(&handler.header.futex)
+	handler.readerLast = atomic.LoadUint64(&handler.header.sequence)
+	if handler.inode, err = fileInode(file); err != nil {
+		handler.Cleanup()
+		return nil, err
+	}
 
 	return handler, nil
 }
 
 // CreateShmReader creates a shared memory reader for inter-process communication
+// The size of the messages is read from the segment's header.
 func CreateShmReader(identifier string, shmDir string) (*ShmHandler, error) {
-	fileinfo, err := os.Stat(filepath.Join(shmDir, fmt.Sprintf("%s%s", shmFilePrefix, identifier)))
-	if err != nil {
-		return nil, fmt.Errorf("error getting shm file info: %v", err)
-	}
-	filesize := int(fileinfo.Size()) // TODO: fix unsafe int64 conversion
-
-	// TODO(mia): guessing packet sizes here is a little suboptimal
-	packetSize := ((filesize - shmFileHeaderSize) / ringSize) - shmMessageHeaderSize
-	return NewShmHandler(identifier, packetSize, false, shmDir)
+	return openShmReader(identifier, shmDir)
 }
 
 // Cleanup cleans up the shared memory handler and removes the shared memory file
+// A writer marks the segment closed first, so its readers return ErrWriterGone.
 func (handler *ShmHandler) Cleanup() {
+	if handler.stopHeartbeat != nil {
+		close(handler.stopHeartbeat)
+		<-handler.heartbeatDone
+		handler.stopHeartbeat = nil
+	}
+	if handler.mode == handlerModeWriter && handler.header != nil {
+		atomic.StoreUint32(&handler.header.magic, 0)
+		atomic.AddUint32(&handler.header.futex, 1)
+		_ = futexWake(unsafe.Pointer(&handler.header.futex))
+		handler.header = nil
+	}
 	if handler.data != nil {
 		if err := syscall.Munmap(handler.data); err != nil {
 			logger.Error("failed to unmap memory", zap.Error(err))
@@ -123,7 +382,8 @@ func (handler *ShmHandler) Cleanup() {
 			logger.Error("failed to close file", zap.Error(err))
 		}
 
-		if handler.mode == handlerModeWriter {
+		// the file may already have been replaced by a new writer, which keeps it
+		if handler.mode == handlerModeWriter && !handler.replaced() {
 			if err := os.Remove(handler.file.Name()); err != nil {
 				logger.Error("failed to remove shm file", zap.Error(err))
 
@@ -141,35 +401,76 @@ func (handler *ShmHandler) Write(data []byte) error {
 	if handler.mode != handlerModeWriter {
 		return fmt.Errorf("handler is in reader mode")
 	}
-	if len(data) > (handler.messageSize - shmMessageHeaderSize) {
+	if len(data) > handler.packetSize {
 		return fmt.Errorf("data size exceeds allocated message size")
 	}
 
-	targetFutex := atomic.LoadUint32(&handler.header.futex) + 1
-	messagePosition := shmFileHeaderSize + int(targetFutex%ringSize)*handler.messageSize
+	sequence := atomic.LoadUint64(&handler.header.sequence) + 1
+	messagePosition := handler.slotPosition(sequence)
 
 	messageHeader := (*shmMessageHeader)(unsafe.Pointer(&handler.data[messagePosition]))
 
-	dataPosition := messagePosition + shmMessageHeaderSize
-	copy(handler.data[dataPosition:], data)
-
-	*messageHeader = shmMessageHeader{
-		timestamp:   uint64(time.Now().UnixNano()),
-		targetFutex: targetFutex,
-	}
+	// readers that see an odd lock, or a different one after copying the slot, retry
+	atomic.AddUint32(&messageHeader.lock, 1)
 
-	atomic.StoreUint32(&handler.header.futex, targetFutex)
+	dataPosition := messagePosition + shmMessageHeaderSize
+	copy(handler.data[dataPosition:dataPosition+handler.packetSize], data)
+	messageHeader.timestamp = uint64(time.Now().UnixNano())
+	messageHeader.sequence = sequence
+
+	atomic.AddUint32(&messageHeader.lock, 1)
+	atomic.StoreUint64(&handler.header.sequence, sequence)
+	// the futex only wakes readers, which compare sequence numbers, so it may wrap around
+	atomic.AddUint32(&handler.header.futex, 1)
 	if err := futexWake(unsafe.Pointer(&handler.header.futex)); err != nil {
 		return err
 	}
 	return nil
 }
 
+// slotPosition returns the offset of the ring slot of a message.
+func (handler *ShmHandler) slotPosition(sequence uint64) int {
+	return shmFileHeaderSize + int(sequence%ringSize)*handler.messageSize
+}
+
+// readSlot copies the message with a sequence number from its slot.
+// It returns false if the slot holds another message, or was being written while it was copied.
+func (handler *ShmHandler) readSlot(sequence uint64) (*ShmReaderMessage, bool) {
+	messagePosition := handler.slotPosition(sequence)
+	messageHeader := (*shmMessageHeader)(unsafe.Pointer(&handler.data[messagePosition]))
+
+	lock := atomic.LoadUint32(&messageHeader.lock)
+	if lock%2 != 0 {
+		return nil, false
+	}
+
+	message := &ShmReaderMessage{
+		timestamp: messageHeader.timestamp,
+		sequence:  sequence,
+		data:      make([]byte, handler.packetSize),
+	}
+	dataPosition := messagePosition + shmMessageHeaderSize
+	copy(message.data, handler.data[dataPosition:])
+	slotSequence := messageHeader.sequence
+
+	if atomic.LoadUint32(&messageHeader.lock) != lock {
+		handler.torn++
+		return nil, false
+	}
+	// HACK(mia): if the message header does not match the message we want
+	// to be reading, it is not the right message.
+	if slotSequence != sequence {
+		return nil, false
+	}
+	return message, true
+}
+
 // ShmReaderMessage is a message read by an ShmHandler
 type ShmReaderMessage struct {
-	timestamp uint64
-	futex     uint32
-	data      []byte
+	timestamp   uint64
+	sequence    uint64
+	overwritten uint32
+	data        []byte
 }
 
 // ReceiveTimestamp returns the unix timestamp when the message was received
@@ -178,10 +479,23 @@ func (m *ShmReaderMessage) ReceiveTimestamp() uint64 {
 	return m.timestamp
 }
 
-// ReceiveTimestamp returns the message futex value (an incrementing counter).
+// Sequence returns the message sequence number, counting the messages written to the segment from 1.
 // This could be used to estimate message loss.
+func (m *ShmReaderMessage) Sequence() uint64 {
+	return m.sequence
+}
+
+// Futex returns the low 32 bits of the message sequence number.
+//
+// Deprecated: the 32-bit value wraps around on long runs, use Sequence.
 func (m *ShmReaderMessage) Futex() uint32 {
-	return m.futex
+	return uint32(m.sequence)
+}
+
+// Overwritten returns how many messages written right before this one were overwritten
+// before the reader could read them. It is always 0 in ReadLatest mode, which skips messages on purpose.
+func (m *ShmReaderMessage) Overwritten() uint32 {
+	return m.overwritten
 }
 
 // Data returns the message data.
@@ -189,26 +503,85 @@ func (m *ShmReaderMessage) Data() []byte {
 	return m.data
 }
 
+// SetReadMode selects which messages Read returns. Readers start in ReadLatest mode.
+func (handler *ShmHandler) SetReadMode(mode ReadMode) {
+	handler.readMode = mode
+}
+
+// Rewind makes the reader read from the first message written to the segment in ReadAll mode,
+// or the oldest one the ring still holds, instead of the first one written after the reader was created.
+func (handler *ShmHandler) Rewind() {
+	handler.readerLast = 0
+}
+
+// Overwritten returns how many messages were overwritten before the reader could read them in ReadAll mode.
+func (handler *ShmHandler) Overwritten() uint64 {
+	return handler.overwritten
+}
+
+// Torn returns how many copies of a slot the reader discarded and retried because the writer changed the slot while it was copied.
+func (handler *ShmHandler) Torn() uint64 {
+	return handler.torn
+}
+
+// replaced returns whether the handler's file was removed or replaced by another one.
+func (handler *ShmHandler) replaced() bool {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(handler.file.Name(), &stat); err != nil {
+		return true
+	}
+	return stat.Ino != handler.inode
+}
+
+// CheckWriter returns an error wrapping ErrWriterGone if the writer closed the segment,
+// replaced it with a new one, or stopped updating its heartbeat.
+func (handler *ShmHandler) CheckWriter() error {
+	if handler.mode != handlerModeReader {
+		return fmt.Errorf("handler is in writer mode")
+	}
+	if atomic.LoadUint32(&handler.header.magic) != shmMagic {
+		return fmt.Errorf("%w: %s was closed", ErrWriterGone, handler.info.Identifier)
+	}
+	if handler.replaced() {
+		return fmt.Errorf("%w: %s was replaced", ErrWriterGone, handler.info.Identifier)
+	}
+	heartbeat := time.Unix(0, atomic.LoadInt64(&handler.header.heartbeat))
+	if since := time.Since(heartbeat); since > shmWriterTimeout {
+		return fmt.Errorf("%w: %s had no heartbeat for %s", ErrWriterGone, handler.info.Identifier, since.Round(time.Second))
+	}
+	return nil
+}
+
 // wait sleeps the thread until an update to SHM.
-// Only waits if the futex value is not outdated.
+// Only waits if no message was written since the last one read.
 func (handler *ShmHandler) wait(ctx context.Context) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
+	woken := make(chan struct{})
 	stopf := context.AfterFunc(ctx, func() {
 		// If the context is canceled, we wake all waiting futexes.
 		// Other readers should be able to handle this gracefully.
 		_ = futexWake(unsafe.Pointer(&handler.header.futex))
+		close(woken)
 	})
-	defer stopf()
+	defer func() {
+		// a wake already running must finish before the reader can be cleaned up and the memory unmapped
+		if !stopf() {
+			<-woken
+		}
+	}()
 
+	// the futex is loaded before the sequence number, so a write after the check changes it and futexWait returns
 	currentFutex := atomic.LoadUint32(&handler.header.futex)
-	if handler.readerLastFutex != currentFutex {
+	if atomic.LoadUint64(&handler.header.sequence) != handler.readerLast {
 		return nil
 	}
 
-	err := futexWait(unsafe.Pointer(&handler.header.futex), handler.readerLastFutex, nil)
+	// wake up now and then to check that the writer is still there
+	timeout := syscall.NsecToTimespec(int64(shmWriterCheckInterval))
+	err := futexWait(unsafe.Pointer(&handler.header.futex), currentFutex, &timeout)
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
@@ -216,11 +589,14 @@ func (handler *ShmHandler) wait(ctx context.Context) error {
 	return err
 }
 
-// Read the current message in shared memory.
+// Read the current message in shared memory, or the next one after the last one read in ReadAll mode.
 func (handler *ShmHandler) Read(ctx context.Context) (ReaderMessage, error) {
 	if handler.mode != handlerModeReader {
 		return nil, fmt.Errorf("handler is in writer mode")
 	}
+	if handler.readMode == ReadAll {
+		return handler.readNext(ctx)
+	}
 
 	for {
 		err := handler.wait(ctx)
@@ -228,36 +604,65 @@ func (handler *ShmHandler) Read(ctx context.Context) (ReaderMessage, error) {
 			return nil, fmt.Errorf("waiting for message: %w", err)
 		}
 
-		newMessageFutex := atomic.LoadUint32(&handler.header.futex)
+		newest := atomic.LoadUint64(&handler.header.sequence)
 
 		// NOTE(mia): This means that the thread woke superfluously.
 		// futex should compare the value before waiting again, so
 		// it shouldn't cause an erroneous wait.
-		if newMessageFutex <= handler.readerLastFutex {
+		if newest <= handler.readerLast {
+			if err := handler.CheckWriter(); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		messagePosition := shmFileHeaderSize + int(newMessageFutex%ringSize)*handler.messageSize
+		message, ok := handler.readSlot(newest)
+		if !ok {
+			continue
+		}
 
-		shmData := make([]byte, handler.messageSize)
-		copy(shmData, handler.data[messagePosition:])
+		handler.readerLast = newest
 
-		messageHeader := (*shmMessageHeader)(unsafe.Pointer(&shmData[0]))
-		message := ShmReaderMessage{
-			timestamp: messageHeader.timestamp,
-			futex:     newMessageFutex,
-			data:      shmData[shmMessageHeaderSize:],
+		return message, nil
+	}
+}
+
+// readNext reads the message after the last one read, skipping ahead to the oldest message
+// the ring still holds if the reader fell more than a ring behind.
+func (handler *ShmHandler) readNext(ctx context.Context) (ReaderMessage, error) {
+	for {
+		err := handler.wait(ctx)
+		if err != nil && !errors.Is(err, syscall.ETIMEDOUT) {
+			return nil, fmt.Errorf("waiting for message: %w", err)
 		}
 
-		// HACK(mia): if the message header does not match the message we want
-		// to be reading, it is not the right message.
-		if messageHeader.targetFutex != newMessageFutex {
+		newest := atomic.LoadUint64(&handler.header.sequence)
+		if newest <= handler.readerLast {
+			if err := handler.CheckWriter(); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		handler.readerLastFutex = newMessageFutex
+		// the slot after the newest message may be being overwritten by the next write,
+		// so the oldest message that can be read is ringSize-2 messages before the newest
+		next := handler.readerLast + 1
+		if behind := newest - next; behind > ringSize-2 {
+			next = newest - (ringSize - 2)
+		}
 
-		return &message, nil
+		// the writer lapped the reader while the message was copied, retry with the messages still in the ring
+		message, ok := handler.readSlot(next)
+		if !ok {
+			continue
+		}
+
+		overwritten := next - handler.readerLast - 1
+		message.overwritten = uint32(min(overwritten, math.MaxUint32))
+		handler.overwritten += overwritten
+		handler.readerLast = next
+
+		return message, nil
 	}
 }
 
@@ -267,12 +672,9 @@ func (handler *ShmHandler) ReadRaw() ([]byte, error) {
 		return nil, fmt.Errorf("handler is in writer mode")
 	}
 
-	messageFutex := atomic.LoadUint32(&handler.header.futex)
-
-	messagePosition := shmFileHeaderSize + int(messageFutex%ringSize)*handler.messageSize
-
-	shmData := make([]byte, handler.messageSize-shmMessageHeaderSize)
-	copy(shmData, handler.data[messagePosition+shmMessageHeaderSize:])
-
-	return shmData, nil
+	for {
+		if message, ok := handler.readSlot(atomic.LoadUint64(&handler.header.sequence)); ok {
+			return message.data, nil
+		}
+	}
 }
@@ -0,0 +1,433 @@
+package ipc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// newTestRing creates a writer and a reader for a ring of 8 byte messages.
+func newTestRing(t *testing.T) (*ShmHandler, *ShmHandler) {
+	t.Helper()
+	return newTestRingAt(t, 0)
+}
+
+// newTestRingAt creates a writer and a reader for a ring of 8 byte messages,
+// as if sequence messages had already been written, to simulate long runs.
+func newTestRingAt(t *testing.T, sequence uint64) (*ShmHandler, *ShmHandler) {
+	t.Helper()
+	dir := t.TempDir()
+	writer, err := NewShmHandler("test", 8, true, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(writer.Cleanup)
+	writer.header.sequence = sequence
+	writer.header.futex = uint32(sequence)
+	reader, err := NewShmHandler("test", 8, false, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(reader.Cleanup)
+	return writer, reader
+}
+
+// writeCounters writes the values from start to end (excluded) as messages.
+func writeCounters(t *testing.T, writer *ShmHandler, start uint64, end uint64) {
+	t.Helper()
+	for i := start; i < end; i++ {
+		if err := writer.Write(binary.BigEndian.AppendUint64(nil, i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// readMessage reads a message, failing the test if none is written within a second.
+func readMessage(t *testing.T, reader *ShmHandler) *ShmReaderMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	message, err := reader.Read(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return message.(*ShmReaderMessage)
+}
+
+// readCounter reads a message, returning its value and how many messages were overwritten before it.
+func readCounter(t *testing.T, reader *ShmHandler) (uint64, uint32) {
+	t.Helper()
+	message := readMessage(t, reader)
+	return binary.BigEndian.Uint64(message.Data()), message.Overwritten()
+}
+
+func TestReadLatest(t *testing.T) {
+	writer, reader := newTestRing(t)
+	writeCounters(t, writer, 0, 3)
+	if value, overwritten := readCounter(t, reader); value != 2 || overwritten != 0 {
+		t.Errorf("expected 2 with none overwritten, got %d with %d overwritten", value, overwritten)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	writer, reader := newTestRing(t)
+	reader.SetReadMode(ReadAll)
+
+	writeCounters(t, writer, 0, 3)
+	for expected := uint64(0); expected < 3; expected++ {
+		if value, overwritten := readCounter(t, reader); value != expected || overwritten != 0 {
+			t.Errorf("expected %d with none overwritten, got %d with %d overwritten", expected, value, overwritten)
+		}
+	}
+
+	// a reader more than a ring behind resumes at the oldest message still in the ring
+	const burst = ringSize + 10
+	writeCounters(t, writer, 3, 3+burst)
+	oldest := uint64(3 + burst - (ringSize - 1))
+	value, overwritten := readCounter(t, reader)
+	if value != oldest || uint64(overwritten) != oldest-3 {
+		t.Errorf("expected %d with %d overwritten, got %d with %d overwritten", oldest, oldest-3, value, overwritten)
+	}
+	for expected := oldest + 1; expected < 3+burst; expected++ {
+		if value, overwritten := readCounter(t, reader); value != expected || overwritten != 0 {
+			t.Fatalf("expected %d with none overwritten, got %d with %d overwritten", expected, value, overwritten)
+		}
+	}
+	if reader.Overwritten() != oldest-3 {
+		t.Errorf("expected %d overwritten in total, got %d", oldest-3, reader.Overwritten())
+	}
+
+	// with every message read, the reader waits for the next one
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := reader.Read(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestReadAllConcurrentWriter(t *testing.T) {
+	writer, reader := newTestRing(t)
+	reader.SetReadMode(ReadAll)
+
+	const count = 10 * ringSize
+	go func() {
+		for i := uint64(0); i < count; i++ {
+			_ = writer.Write(binary.BigEndian.AppendUint64(nil, i))
+			if i%64 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	// every message is either read or reported as overwritten, in order
+	next := uint64(0)
+	for next < count {
+		value, overwritten := readCounter(t, reader)
+		if value != next+uint64(overwritten) {
+			t.Fatalf("expected %d after %d overwritten, got %d", next+uint64(overwritten), overwritten, value)
+		}
+		next = value + 1
+	}
+}
+
+func TestSequenceWraparound(t *testing.T) {
+	tests := []struct {
+		name  string
+		start uint64
+	}{
+		{"first messages", 0},
+		{"futex wraps around", math.MaxUint32 - 3},
+		{"long run", 1 << 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer, latest := newTestRingAt(t, tt.start)
+			all, err := CreateShmReader("test", filepath.Dir(writer.file.Name()))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer all.Cleanup()
+			all.SetReadMode(ReadAll)
+
+			for i := uint64(0); i < ringSize; i++ {
+				writeCounters(t, writer, i, i+1)
+				message := readMessage(t, latest)
+				if value := binary.BigEndian.Uint64(message.Data()); value != i || message.Sequence() != tt.start+i+1 {
+					t.Fatalf("expected %d with sequence %d, got %d with sequence %d", i, tt.start+i+1, value, message.Sequence())
+				}
+				if message.Futex() != uint32(tt.start+i+1) {
+					t.Fatalf("expected futex %d, got %d", uint32(tt.start+i+1), message.Futex())
+				}
+			}
+
+			// the ReadAll reader fell behind by a whole ring, across the wraparound
+			oldest := uint64(1)
+			value, overwritten := readCounter(t, all)
+			if value != oldest || uint64(overwritten) != oldest {
+				t.Errorf("expected %d with %d overwritten, got %d with %d overwritten", oldest, oldest, value, overwritten)
+			}
+			for expected := oldest + 1; expected < ringSize; expected++ {
+				message := readMessage(t, all)
+				if value := binary.BigEndian.Uint64(message.Data()); value != expected || message.Sequence() != tt.start+expected+1 {
+					t.Fatalf("expected %d with sequence %d, got %d with sequence %d", expected, tt.start+expected+1, value, message.Sequence())
+				}
+			}
+
+			// with every message read, both readers wait for the next one
+			for _, reader := range []*ShmHandler{latest, all} {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				if _, err := reader.Read(ctx); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("expected context.DeadlineExceeded, got %v", err)
+				}
+				cancel()
+			}
+			writeCounters(t, writer, ringSize, ringSize+1)
+			if value, _ := readCounter(t, all); value != ringSize {
+				t.Errorf("expected %d, got %d", ringSize, value)
+			}
+		})
+	}
+}
+
+func TestWriterGone(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(t *testing.T, writer *ShmHandler)
+	}{
+		{"cleaned up", func(t *testing.T, writer *ShmHandler) { writer.Cleanup() }},
+		{"replaced", func(t *testing.T, writer *ShmHandler) {
+			dir := filepath.Dir(writer.file.Name())
+			replacement, err := NewShmHandler("test", 8, true, dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			t.Cleanup(replacement.Cleanup)
+
+			// the old writer leaves the replacement in place
+			writer.Cleanup()
+			reader, err := CreateShmReader("test", dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer reader.Cleanup()
+			if err := reader.CheckWriter(); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}},
+		{"no heartbeat", func(t *testing.T, writer *ShmHandler) {
+			atomic.StoreInt64(&writer.header.heartbeat, time.Now().Add(-2*shmWriterTimeout).UnixNano())
+			// the writer's heartbeat would revive it
+			close(writer.stopHeartbeat)
+			<-writer.heartbeatDone
+			writer.stopHeartbeat = nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer, reader := newTestRing(t)
+			reader.SetReadMode(ReadAll)
+			if err := reader.CheckWriter(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// messages written before the writer went away are still read
+			writeCounters(t, writer, 0, 2)
+			tt.stop(t, writer)
+			for expected := uint64(0); expected < 2; expected++ {
+				if value, _ := readCounter(t, reader); value != expected {
+					t.Errorf("expected %d, got %d", expected, value)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*shmWriterCheckInterval)
+			defer cancel()
+			if _, err := reader.Read(ctx); !errors.Is(err, ErrWriterGone) {
+				t.Errorf("expected ErrWriterGone, got %v", err)
+			}
+		})
+	}
+}
+
+func TestShmInfo(t *testing.T) {
+	dir := t.TempDir()
+	before := time.Now()
+	writer, err := NewShmWriter("10000-alpha", "Backplane", 12, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer writer.Cleanup()
+
+	info, err := ReadShmInfo("10000-alpha", dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := ShmInfo{
+		Identifier:  "10000-alpha",
+		Name:        "Backplane",
+		Version:     ShmLayoutVersion,
+		RingSize:    ringSize,
+		MessageSize: 12,
+		WriterPID:   os.Getpid(),
+		Created:     info.Created,
+	}
+	if info != expected {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+	if info.Created.Before(before) || info.Created.After(time.Now()) {
+		t.Errorf("expected creation time after %s, got %s", before, info.Created)
+	}
+
+	// readers take the message size from the header
+	reader, err := CreateShmReader("10000-alpha", dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Cleanup()
+	if reader.Info() != info {
+		t.Errorf("expected %+v, got %+v", info, reader.Info())
+	}
+
+	if _, err := NewShmHandler("10000-alpha", 13, false, dir); err == nil {
+		t.Errorf("expected an error for another message size, got nil")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, shmFilePrefix+"stale"), make([]byte, 4096), 0666); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	infos, err := ListShm(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(infos) != 1 || infos[0] != info {
+		t.Errorf("expected only %+v, got %+v", info, infos)
+	}
+}
+
+func TestShmHeaderValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(header *shmFileHeader)
+		notReady bool
+	}{
+		{"not written", func(header *shmFileHeader) { header.magic = 0 }, true},
+		{"version", func(header *shmFileHeader) { header.version = ShmLayoutVersion + 1 }, false},
+		{"ring size", func(header *shmFileHeader) { header.ringSize = ringSize / 2 }, false},
+		{"message size", func(header *shmFileHeader) { header.messageSize = 1 << 20 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writer, err := NewShmWriter("test", "test", 8, dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer writer.Cleanup()
+			tt.modify(writer.header)
+
+			_, err = CreateShmReader("test", dir)
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if errors.Is(err, ErrShmNotReady) != tt.notReady {
+				t.Errorf("expected ErrShmNotReady %v, got %v", tt.notReady, err)
+			}
+		})
+	}
+}
+
+func TestReadSkipsSlotBeingWritten(t *testing.T) {
+	writer, reader := newTestRing(t)
+	writeCounters(t, writer, 0, 1)
+
+	// a writer stopped part way through a slot leaves its lock odd
+	header := (*shmMessageHeader)(unsafe.Pointer(&writer.data[writer.slotPosition(1)]))
+	atomic.AddUint32(&header.lock, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := reader.Read(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestTornReads(t *testing.T) {
+	const packetSize = 64 * 1024
+	dir := t.TempDir()
+	writer, err := NewShmHandler("stress", packetSize, true, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer writer.Cleanup()
+
+	// readers are only torn if the writer runs while they copy a slot, even on a single CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	// every message repeats its counter, so a message mixing two writes holds different values
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		message := make([]byte, packetSize)
+		deadline := time.Now().Add(500 * time.Millisecond)
+		for i := uint64(1); time.Now().Before(deadline); i++ {
+			for position := 0; position < packetSize; position += 8 {
+				binary.BigEndian.PutUint64(message[position:], i)
+			}
+			_ = writer.Write(message)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, mode := range []ReadMode{ReadLatest, ReadAll, ReadLatest, ReadAll} {
+		reader, err := NewShmHandler("stress", packetSize, false, dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer reader.Cleanup()
+		reader.SetReadMode(mode)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := uint64(0)
+			for {
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				message, err := reader.Read(ctx)
+				cancel()
+				if err != nil {
+					select {
+					case <-done:
+						return
+					default:
+						continue
+					}
+				}
+				data := message.(*ShmReaderMessage).Data()
+				value := binary.BigEndian.Uint64(data)
+				for position := 8; position < len(data); position += 8 {
+					if other := binary.BigEndian.Uint64(data[position:]); other != value {
+						t.Errorf("expected %d at byte %d, got %d", value, position, other)
+						return
+					}
+				}
+				if value <= last {
+					t.Errorf("expected a message after %d, got %d", last, value)
+					return
+				}
+				last = value
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,593 @@
+package ipc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"go.uber.org/zap"
+)
+
+// Each connection to a socket writer starts with a hello from the writer, describing its messages.
+// The reader then sends requests of a kind and a sequence number, which the writer answers with messages.
+// Every message is sent as a SOCK_SEQPACKET packet of its timestamp and sequence number, then its data.
+const (
+	// magic, version, packet size, ring size (uint32s), the writer's newest sequence number, its creation time (uint64s),
+	// its PID (uint32), 4 reserved bytes, then the name of what it writes
+	socketHelloSize         = 40 + shmNameSize
+	socketMessageHeaderSize = 16 // timestamp and sequence number (uint64s)
+	socketRequestSize       = 9  // kind, then a sequence number (uint64)
+	socketHelloTimeout      = time.Second
+)
+
+// Kinds of requests sent by socket readers.
+const (
+	// socketRequestStream sends every message after the sequence number in order, for the rest of the connection.
+	socketRequestStream = iota
+	// socketRequestLatest sends the newest message once it is newer than the sequence number.
+	socketRequestLatest
+	// socketRequestRaw sends the newest message right away, or a message of zeros with sequence number 0 before the first write.
+	socketRequestRaw
+)
+
+// socketPath returns the path of the socket with an identifier.
+func socketPath(identifier string, dir string) string {
+	return shmPath(identifier, dir) + ".sock"
+}
+
+// ReadSocketInfo returns the metadata of the writer of the socket with an identifier, as ReadShmInfo does for segments.
+func ReadSocketInfo(identifier string, dir string) (ShmInfo, error) {
+	reader, err := NewSocketReader(identifier, -1, dir)
+	if err != nil {
+		return ShmInfo{}, err
+	}
+	defer reader.Cleanup()
+	return reader.Info(), nil
+}
+
+// ListSockets returns the metadata of the writer of every socket in dir, sorted by identifier.
+// Sockets that don't accept readers, such as those left behind, are skipped.
+func ListSockets(dir string) ([]ShmInfo, error) {
+	paths, err := filepath.Glob(socketPath("*", dir))
+	if err != nil {
+		return nil, fmt.Errorf("listing sockets: %w", err)
+	}
+	var infos []ShmInfo
+	for _, path := range paths {
+		identifier := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), shmFilePrefix), ".sock")
+		info, err := ReadSocketInfo(identifier, dir)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// SocketWriter sends messages to readers connected to a Unix domain socket.
+// Like the shared memory ring, it keeps the last messages in a ring. ReadAll readers are sent them from their own position,
+// skipping ahead to the oldest message the ring still holds if they fall more than a ring behind,
+// and ReadLatest readers are sent the newest message each time they ask for one.
+// A slow reader never blocks the writer.
+type SocketWriter struct {
+	log        *zap.Logger
+	listener   *net.UnixListener
+	path       string
+	inode      uint64 // Inode of the socket, to detect it being replaced
+	name       string
+	created    time.Time
+	packetSize int
+
+	mu       sync.Mutex
+	wake     *sync.Cond // Signaled when a message is written or the writer is cleaned up
+	ring     [ringSize][]byte
+	sequence uint64 // Sequence number of the newest message, 0 before the first write
+	closed   bool
+	conns    map[*net.UnixConn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewSocketWriter creates a Unix domain socket for messages of packetSize bytes and a writer sending to its readers.
+// name describes what is written, such as the packet name, and is sent to readers with the writer's metadata.
+// A socket left behind is replaced.
+func NewSocketWriter(identifier string, name string, packetSize int, dir string) (*SocketWriter, error) {
+	path := socketPath(identifier, dir)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove old socket: %v", err)
+	}
+	listener, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: path, Net: "unixpacket"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %v", err)
+	}
+	// the socket is only removed by Cleanup if a new writer hasn't replaced it
+	listener.SetUnlinkOnClose(false)
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		_ = listener.Close()
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("failed to stat socket: %v", err)
+	}
+
+	writer := &SocketWriter{
+		log:        logger.Log().Named("socket_writer").With(zap.String("socket", path)),
+		listener:   listener,
+		path:       path,
+		inode:      stat.Ino,
+		name:       name,
+		created:    time.Now(),
+		packetSize: packetSize,
+		conns:      make(map[*net.UnixConn]struct{}),
+	}
+	writer.wake = sync.NewCond(&writer.mu)
+	writer.wg.Add(1)
+	go writer.accept()
+	return writer, nil
+}
+
+// Write sends a message to the connected readers.
+func (writer *SocketWriter) Write(data []byte) error {
+	if len(data) > writer.packetSize {
+		return fmt.Errorf("data size exceeds allocated message size")
+	}
+	message := make([]byte, socketMessageHeaderSize+writer.packetSize)
+	copy(message[socketMessageHeaderSize:], data)
+	binary.LittleEndian.PutUint64(message, uint64(time.Now().UnixNano()))
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if writer.closed {
+		return fmt.Errorf("writer is cleaned up")
+	}
+	writer.sequence++
+	binary.LittleEndian.PutUint64(message[8:], writer.sequence)
+	writer.ring[writer.sequence%ringSize] = message
+	writer.wake.Broadcast()
+	return nil
+}
+
+// Cleanup disconnects the readers, which return ErrWriterGone, and removes the socket unless a new writer replaced it.
+func (writer *SocketWriter) Cleanup() {
+	writer.mu.Lock()
+	if writer.closed {
+		writer.mu.Unlock()
+		return
+	}
+	writer.closed = true
+	writer.wake.Broadcast()
+	for conn := range writer.conns {
+		// unblocks sends to readers that stopped reading
+		_ = conn.Close()
+	}
+	writer.mu.Unlock()
+
+	if err := writer.listener.Close(); err != nil {
+		writer.log.Error("failed to close socket", zap.Error(err))
+	}
+	writer.wg.Wait()
+
+	// the socket may already have been replaced by a new writer, which keeps it
+	if writer.replaced() {
+		return
+	}
+	if err := os.Remove(writer.path); err != nil {
+		writer.log.Error("failed to remove socket", zap.Error(err))
+		return
+	}
+	writer.log.Info("removed socket")
+}
+
+// replaced returns whether the socket was removed or replaced by a new writer.
+func (writer *SocketWriter) replaced() bool {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(writer.path, &stat); err != nil {
+		return true
+	}
+	return stat.Ino != writer.inode
+}
+
+// accept serves the readers connecting until the writer is cleaned up.
+func (writer *SocketWriter) accept() {
+	defer writer.wg.Done()
+	for {
+		conn, err := writer.listener.AcceptUnix()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				writer.log.Error("failed to accept reader", zap.Error(err))
+			}
+			return
+		}
+
+		writer.mu.Lock()
+		if writer.closed {
+			writer.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		writer.conns[conn] = struct{}{}
+		newest := writer.sequence
+		writer.mu.Unlock()
+
+		writer.wg.Add(1)
+		go func() {
+			defer writer.wg.Done()
+			if err := writer.serve(conn, newest); err != nil && !errors.Is(err, net.ErrClosed) {
+				writer.log.Debug("reader disconnected", zap.Error(err))
+			}
+			writer.mu.Lock()
+			delete(writer.conns, conn)
+			writer.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// serve answers the requests of a reader, which connected when newest was the newest message.
+func (writer *SocketWriter) serve(conn *net.UnixConn, newest uint64) error {
+	hello := make([]byte, socketHelloSize)
+	binary.LittleEndian.PutUint32(hello, shmMagic)
+	binary.LittleEndian.PutUint32(hello[4:], ShmLayoutVersion)
+	binary.LittleEndian.PutUint32(hello[8:], uint32(writer.packetSize))
+	binary.LittleEndian.PutUint32(hello[12:], ringSize)
+	binary.LittleEndian.PutUint64(hello[16:], newest)
+	binary.LittleEndian.PutUint64(hello[24:], uint64(writer.created.UnixNano()))
+	binary.LittleEndian.PutUint32(hello[32:], uint32(os.Getpid()))
+	copy(hello[40:], writer.name)
+	if _, err := conn.Write(hello); err != nil {
+		return fmt.Errorf("sending hello: %w", err)
+	}
+
+	request := make([]byte, socketRequestSize)
+	message := make([]byte, socketMessageHeaderSize+writer.packetSize)
+	for {
+		if n, err := conn.Read(request); err != nil || n != socketRequestSize {
+			return fmt.Errorf("reading request: %w", err)
+		}
+		last := binary.LittleEndian.Uint64(request[1:])
+		switch request[0] {
+		case socketRequestStream:
+			return writer.stream(conn, last, message)
+		case socketRequestLatest:
+			// a reader that stopped reading doesn't get a backlog of stale messages, since it is only sent one per request
+			writer.mu.Lock()
+			for last >= writer.sequence && !writer.closed {
+				writer.wake.Wait()
+			}
+			if writer.closed {
+				writer.mu.Unlock()
+				return nil
+			}
+			copy(message, writer.ring[writer.sequence%ringSize])
+			writer.mu.Unlock()
+		case socketRequestRaw:
+			writer.mu.Lock()
+			if writer.sequence == 0 {
+				clear(message)
+			} else {
+				copy(message, writer.ring[writer.sequence%ringSize])
+			}
+			writer.mu.Unlock()
+		default:
+			return fmt.Errorf("unknown request %d", request[0])
+		}
+		if _, err := conn.Write(message); err != nil {
+			return fmt.Errorf("sending message: %w", err)
+		}
+	}
+}
+
+// stream sends every message after last to a reader, in order, until the writer is cleaned up.
+func (writer *SocketWriter) stream(conn *net.UnixConn, last uint64, message []byte) error {
+	for {
+		writer.mu.Lock()
+		for last >= writer.sequence && !writer.closed {
+			writer.wake.Wait()
+		}
+		if writer.closed {
+			writer.mu.Unlock()
+			return nil
+		}
+		// the reader resumes at the oldest message the ring still holds if it fell more than a ring behind
+		next := last + 1
+		if writer.sequence-next >= ringSize {
+			next = writer.sequence - (ringSize - 1)
+		}
+		copy(message, writer.ring[next%ringSize])
+		writer.mu.Unlock()
+
+		if _, err := conn.Write(message); err != nil {
+			return fmt.Errorf("sending message: %w", err)
+		}
+		last = next
+	}
+}
+
+// SocketReader reads the messages sent by a SocketWriter.
+// It implements RingReader with the same semantics as a shared memory reader.
+type SocketReader struct {
+	conn        *net.UnixConn
+	identifier  string
+	packetSize  int
+	readMode    ReadMode
+	streaming   bool   // Whether the writer was asked to stream every message, in ReadAll mode
+	pending     int    // Requests sent in ReadLatest mode that weren't answered yet
+	readerLast  uint64 // Sequence number of the last message read
+	overwritten uint64 // Messages overwritten before the reader could read them, in ReadAll mode
+	gone        error  // Why the writer is gone, once the connection closed
+	info        ShmInfo
+	buf         []byte
+}
+
+// NewSocketReader connects to the socket with an identifier, and fails if its messages aren't packetSize bytes.
+// A negative packetSize accepts messages of any size.
+func NewSocketReader(identifier string, packetSize int, dir string) (*SocketReader, error) {
+	path := socketPath(identifier, dir)
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: path, Net: "unixpacket"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", path, err)
+	}
+	reader := &SocketReader{conn: conn, identifier: identifier}
+
+	hello := make([]byte, socketHelloSize)
+	_ = conn.SetReadDeadline(time.Now().Add(socketHelloTimeout))
+	n, err := conn.Read(hello)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		reader.Cleanup()
+		return nil, fmt.Errorf("%w: reading hello from %s: %v", ErrShmNotReady, identifier, err)
+	}
+	if magic := binary.LittleEndian.Uint32(hello); n != socketHelloSize || magic != shmMagic {
+		reader.Cleanup()
+		return nil, fmt.Errorf("%s sent an invalid hello", identifier)
+	}
+	if version := binary.LittleEndian.Uint32(hello[4:]); version != ShmLayoutVersion {
+		reader.Cleanup()
+		return nil, fmt.Errorf("%s has layout version %d, expected %d (are gsw_service and this program the same version?)",
+			identifier, version, ShmLayoutVersion)
+	}
+	reader.packetSize = int(binary.LittleEndian.Uint32(hello[8:]))
+	if packetSize >= 0 && reader.packetSize != packetSize {
+		reader.Cleanup()
+		return nil, fmt.Errorf("%s holds %d byte messages, expected %d (is gsw_service running with another telemetry config?)",
+			identifier, reader.packetSize, packetSize)
+	}
+	reader.readerLast = binary.LittleEndian.Uint64(hello[16:])
+	reader.buf = make([]byte, socketMessageHeaderSize+reader.packetSize)
+
+	name := hello[40:]
+	if end := bytes.IndexByte(name, 0); end >= 0 {
+		name = name[:end]
+	}
+	reader.info = ShmInfo{
+		Identifier:  identifier,
+		Name:        string(name),
+		Version:     ShmLayoutVersion,
+		RingSize:    int(binary.LittleEndian.Uint32(hello[12:])),
+		MessageSize: reader.packetSize,
+		WriterPID:   int(binary.LittleEndian.Uint32(hello[32:])),
+		Created:     time.Unix(0, int64(binary.LittleEndian.Uint64(hello[24:]))),
+	}
+	return reader, nil
+}
+
+// Info returns the metadata the writer sent when the reader connected.
+func (reader *SocketReader) Info() ShmInfo {
+	return reader.info
+}
+
+// SetReadMode selects which messages Read returns. Readers start in ReadLatest mode.
+// Unlike a shared memory reader, the mode can't change once the reader has read.
+func (reader *SocketReader) SetReadMode(mode ReadMode) {
+	reader.readMode = mode
+}
+
+// Rewind makes the reader read from the oldest message the writer's ring holds in ReadAll mode,
+// instead of the first one written after the reader connected. It must be called before reading.
+func (reader *SocketReader) Rewind() {
+	reader.readerLast = 0
+}
+
+// Overwritten returns how many messages were overwritten before the reader could read them in ReadAll mode.
+func (reader *SocketReader) Overwritten() uint64 {
+	return reader.overwritten
+}
+
+// Cleanup closes the connection.
+func (reader *SocketReader) Cleanup() {
+	if reader.conn != nil {
+		_ = reader.conn.Close()
+		reader.conn = nil
+	}
+}
+
+// Read the newest message sent, or the next one after the last one read in ReadAll mode.
+func (reader *SocketReader) Read(ctx context.Context) (ReaderMessage, error) {
+	if reader.readMode == ReadAll {
+		if !reader.streaming {
+			if err := reader.request(socketRequestStream, reader.readerLast); err != nil {
+				return nil, err
+			}
+			reader.streaming = true
+		}
+		message, err := reader.receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		message.overwritten = uint32(min(message.sequence-reader.readerLast-1, uint64(^uint32(0))))
+		reader.overwritten += message.sequence - reader.readerLast - 1
+		reader.readerLast = message.sequence
+		return message, nil
+	}
+
+	// requests are answered in order, so the answer to the last one holds the newest message,
+	// even if earlier reads gave up before theirs arrived
+	if err := reader.request(socketRequestLatest, reader.readerLast); err != nil {
+		return nil, err
+	}
+	reader.pending++
+	var message *socketMessage
+	for reader.pending > 0 {
+		var err error
+		if message, err = reader.receive(ctx); err != nil {
+			return nil, err
+		}
+		reader.pending--
+	}
+	reader.readerLast = message.sequence
+	return message, nil
+}
+
+// ReadRaw returns a copy of the newest message, or zeros if none was written yet, like a shared memory reader.
+// It must be called before reading.
+func (reader *SocketReader) ReadRaw() ([]byte, error) {
+	if reader.streaming || reader.pending > 0 {
+		return nil, fmt.Errorf("ReadRaw must be called before reading")
+	}
+	if err := reader.request(socketRequestRaw, 0); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), socketHelloTimeout)
+	defer cancel()
+	message, err := reader.receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return message.Data(), nil
+}
+
+// CheckWriter returns an error wrapping ErrWriterGone if the writer closed the connection.
+func (reader *SocketReader) CheckWriter() error {
+	if reader.gone != nil {
+		return reader.gone
+	}
+	rawConn, err := reader.conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("getting connection: %w", err)
+	}
+	var n int
+	var recvErr error
+	err = rawConn.Read(func(fd uintptr) bool {
+		n, _, recvErr = syscall.Recvfrom(int(fd), make([]byte, 1), syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("checking connection: %w", err)
+	}
+	if recvErr == nil && n == 0 {
+		return reader.writerGone()
+	}
+	if recvErr != nil && !errors.Is(recvErr, syscall.EAGAIN) {
+		return reader.writerGone()
+	}
+	return nil
+}
+
+// request sends a request to the writer.
+func (reader *SocketReader) request(kind byte, sequence uint64) error {
+	if reader.gone != nil {
+		return reader.gone
+	}
+	request := make([]byte, socketRequestSize)
+	request[0] = kind
+	binary.LittleEndian.PutUint64(request[1:], sequence)
+	if _, err := reader.conn.Write(request); err != nil {
+		return reader.writerGone()
+	}
+	return nil
+}
+
+// writerGone records and returns the error returned once the writer closed the connection.
+func (reader *SocketReader) writerGone() error {
+	if reader.gone == nil {
+		reader.gone = fmt.Errorf("%w: %s closed the connection", ErrWriterGone, reader.identifier)
+	}
+	return reader.gone
+}
+
+// receive waits for the next message until the context is done.
+func (reader *SocketReader) receive(ctx context.Context) (*socketMessage, error) {
+	if reader.gone != nil {
+		return nil, reader.gone
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	woken := make(chan struct{})
+	stopf := context.AfterFunc(ctx, func() {
+		// a deadline in the past interrupts the read
+		_ = reader.conn.SetReadDeadline(time.Unix(1, 0))
+		close(woken)
+	})
+	n, err := reader.conn.Read(reader.buf)
+	if !stopf() {
+		<-woken
+		_ = reader.conn.SetReadDeadline(time.Time{})
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil || n == 0 {
+		return nil, reader.writerGone()
+	}
+	return reader.parse(n)
+}
+
+// parse copies the message received in the buffer.
+func (reader *SocketReader) parse(n int) (*socketMessage, error) {
+	if n != len(reader.buf) {
+		return nil, fmt.Errorf("received a %d byte message from %s, expected %d", n, reader.identifier, len(reader.buf))
+	}
+	return &socketMessage{
+		timestamp: binary.LittleEndian.Uint64(reader.buf),
+		sequence:  binary.LittleEndian.Uint64(reader.buf[8:]),
+		data:      append([]byte(nil), reader.buf[socketMessageHeaderSize:]...),
+	}, nil
+}
+
+// socketMessage is a message read by a SocketReader.
+type socketMessage struct {
+	timestamp   uint64
+	sequence    uint64
+	overwritten uint32
+	data        []byte
+}
+
+// ReceiveTimestamp returns the unix timestamp when the message was written (nanoseconds since epoch).
+func (m *socketMessage) ReceiveTimestamp() uint64 {
+	return m.timestamp
+}
+
+// Sequence returns the message sequence number, counting the messages written from 1.
+func (m *socketMessage) Sequence() uint64 {
+	return m.sequence
+}
+
+// Overwritten returns how many messages written right before this one were overwritten
+// before the reader could read them. It is always 0 in ReadLatest mode.
+func (m *socketMessage) Overwritten() uint32 {
+	return m.overwritten
+}
+
+// Data returns the message data.
+func (m *socketMessage) Data() []byte {
+	return m.data
+}
+
+// ensure both backends implement the interfaces
+var (
+	_ RingReader       = (*ShmHandler)(nil)
+	_ RingReader       = (*SocketReader)(nil)
+	_ Writer           = (*SocketWriter)(nil)
+	_ SequencedMessage = (*ShmReaderMessage)(nil)
+	_ SequencedMessage = (*socketMessage)(nil)
+)
@@ -0,0 +1,44 @@
+package serial
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenPTY opens a pseudo-terminal pair and returns the controller side and the path of the device side.
+// The device path can be opened with Open like a real serial port, which makes serial sources testable without hardware.
+func OpenPTY() (*os.File, string, error) {
+	controller, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening /dev/ptmx: %w", err)
+	}
+
+	conn, err := controller.SyscallConn()
+	if err != nil {
+		_ = controller.Close()
+		return nil, "", err
+	}
+
+	var number int
+	var ptyErr error
+	err = conn.Control(func(fd uintptr) {
+		if ptyErr = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0); ptyErr != nil {
+			ptyErr = fmt.Errorf("unlocking pty: %w", ptyErr)
+			return
+		}
+		if number, ptyErr = unix.IoctlGetInt(int(fd), unix.TIOCGPTN); ptyErr != nil {
+			ptyErr = fmt.Errorf("getting pty number: %w", ptyErr)
+		}
+	})
+	if err == nil {
+		err = ptyErr
+	}
+	if err != nil {
+		_ = controller.Close()
+		return nil, "", err
+	}
+
+	return controller, fmt.Sprintf("/dev/pts/%d", number), nil
+}
@@ -0,0 +1,158 @@
+package serial
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Config holds the line settings of a serial port.
+type Config struct {
+	Baud     int    `yaml:"baud,omitempty"`      // Baud rate. Defaults to 115200
+	Parity   string `yaml:"parity,omitempty"`    // Parity (none, even, odd). Defaults to none
+	DataBits int    `yaml:"data_bits,omitempty"` // Data bits (5-8). Defaults to 8
+	StopBits int    `yaml:"stop_bits,omitempty"` // Stop bits (1, 2). Defaults to 1
+}
+
+// baudRates maps baud rates to termios speed constants
+var baudRates = map[int]uint32{
+	1200:    unix.B1200,
+	2400:    unix.B2400,
+	4800:    unix.B4800,
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	500000:  unix.B500000,
+	576000:  unix.B576000,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	1500000: unix.B1500000,
+	2000000: unix.B2000000,
+	3000000: unix.B3000000,
+	4000000: unix.B4000000,
+}
+
+// dataBitsFlags maps data bits to termios character size flags
+var dataBitsFlags = map[int]uint32{
+	5: unix.CS5,
+	6: unix.CS6,
+	7: unix.CS7,
+	8: unix.CS8,
+}
+
+// withDefaults returns the config with unset fields replaced by their defaults.
+func (c Config) withDefaults() Config {
+	if c.Baud == 0 {
+		c.Baud = 115200
+	}
+	if c.Parity == "" {
+		c.Parity = "none"
+	}
+	if c.DataBits == 0 {
+		c.DataBits = 8
+	}
+	if c.StopBits == 0 {
+		c.StopBits = 1
+	}
+	return c
+}
+
+// Validate checks that the line settings are supported.
+func (c Config) Validate() error {
+	c = c.withDefaults()
+	if _, ok := baudRates[c.Baud]; !ok {
+		return fmt.Errorf("unsupported baud rate: %d", c.Baud)
+	}
+	if _, ok := dataBitsFlags[c.DataBits]; !ok {
+		return fmt.Errorf("data_bits specified as %d, instead of 5-8", c.DataBits)
+	}
+	if c.StopBits != 1 && c.StopBits != 2 {
+		return fmt.Errorf("stop_bits specified as %d, instead of 1 or 2", c.StopBits)
+	}
+	switch c.Parity {
+	case "none", "even", "odd":
+	default:
+		return fmt.Errorf("parity specified as %s, instead of none, even or odd", c.Parity)
+	}
+	return nil
+}
+
+// Open opens a serial device in raw mode with the given line settings.
+// Closing the returned file unblocks pending reads.
+func Open(device string, cfg Config) (*os.File, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg = cfg.withDefaults()
+
+	// O_NONBLOCK lets the Go runtime poll the device, so reads can be interrupted by Close
+	file, err := os.OpenFile(device, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening serial device: %w", err)
+	}
+
+	if err := configure(file, cfg); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("configuring serial device %s: %w", device, err)
+	}
+
+	return file, nil
+}
+
+// configure applies raw mode and the line settings to an open serial device.
+func configure(file *os.File, cfg Config) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var configErr error
+	err = conn.Control(func(fd uintptr) {
+		termios, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+		if err != nil {
+			configErr = fmt.Errorf("getting termios: %w", err)
+			return
+		}
+
+		// raw mode, equivalent to cfmakeraw
+		termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF | unix.IXANY
+		termios.Oflag &^= unix.OPOST
+		termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		termios.Cflag &^= unix.CSIZE | unix.PARENB | unix.PARODD | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+		termios.Cflag |= unix.CREAD | unix.CLOCAL | dataBitsFlags[cfg.DataBits]
+
+		switch cfg.Parity {
+		case "even":
+			termios.Cflag |= unix.PARENB
+			termios.Iflag |= unix.INPCK
+		case "odd":
+			termios.Cflag |= unix.PARENB | unix.PARODD
+			termios.Iflag |= unix.INPCK
+		}
+		if cfg.StopBits == 2 {
+			termios.Cflag |= unix.CSTOPB
+		}
+
+		speed := baudRates[cfg.Baud]
+		termios.Cflag |= speed
+		termios.Ispeed = speed
+		termios.Ospeed = speed
+
+		// reads return as soon as any data is available
+		termios.Cc[unix.VMIN] = 1
+		termios.Cc[unix.VTIME] = 0
+
+		if err := unix.IoctlSetTermios(int(fd), unix.TCSETS, termios); err != nil {
+			configErr = fmt.Errorf("setting termios: %w", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return configErr
+}
@@ -0,0 +1,83 @@
+package serial
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"defaults", Config{}, false},
+		{"full", Config{Baud: 9600, Parity: "even", DataBits: 7, StopBits: 2}, false},
+		{"bad baud", Config{Baud: 12345}, true},
+		{"bad parity", Config{Parity: "mark"}, true},
+		{"bad data bits", Config{DataBits: 9}, true},
+		{"bad stop bits", Config{StopBits: 3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenPTY(t *testing.T) {
+	controller, device, err := OpenPTY()
+	if err != nil {
+		t.Skipf("pseudo-terminals unavailable: %v", err)
+	}
+	defer controller.Close()
+
+	port, err := Open(device, Config{Baud: 57600, Parity: "odd"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// raw mode must pass every byte through unchanged
+	data := []byte{0x00, 0x03, 0x0A, 0x0D, 0x11, 0x13, 0x7F, 0xFF}
+	if _, err := controller.Write(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	received := make([]byte, len(data))
+	if err := port.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := io.ReadFull(port, received); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Errorf("expected % X, got % X", data, received)
+	}
+
+	// closing the port unblocks a pending read
+	done := make(chan error, 1)
+	go func() {
+		_, err := port.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	port.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected error from closed port, got nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("read was not interrupted by close")
+	}
+}
@@ -0,0 +1,55 @@
+package tlm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/ccsds"
+)
+
+// CCSDSConfig marks a telemetry packet as a CCSDS Space Packet.
+// Space Packets received on the same port are routed to telemetry packets by APID,
+// and the packet measurements describe the packet data field that follows the primary header.
+type CCSDSConfig struct {
+	APID     int             `yaml:"apid"`                // Application process identifier of the packet (0-2046)
+	TimeCode *TimeCodeConfig `yaml:"time_code,omitempty"` // Time code starting the secondary header, used as the packet timestamp (optional)
+}
+
+// TimeCodeConfig describes a CCSDS Unsegmented time Code (CUC) without a preamble field.
+type TimeCodeConfig struct {
+	CoarseSize int    `yaml:"coarse_size,omitempty"` // Size of the seconds count in bytes (1-4). Defaults to 4
+	FineSize   int    `yaml:"fine_size,omitempty"`   // Size of the fraction of a second in bytes (0-3)
+	Epoch      string `yaml:"epoch,omitempty"`       // RFC 3339 time the count starts at. Defaults to the CCSDS epoch, 1958-01-01
+}
+
+// Validate checks that the APID and time code are usable.
+func (c CCSDSConfig) Validate() error {
+	if c.APID < 0 || c.APID > ccsds.MaxAPID {
+		return fmt.Errorf("apid specified as %d, instead of 0-%d", c.APID, ccsds.MaxAPID)
+	}
+	if c.TimeCode != nil {
+		if _, err := c.TimeCode.CUC(); err != nil {
+			return fmt.Errorf("invalid time_code: %w", err)
+		}
+	}
+	return nil
+}
+
+// CUC returns the time code decoder described by the config.
+func (c TimeCodeConfig) CUC() (ccsds.CUC, error) {
+	cuc := ccsds.CUC{CoarseSize: c.CoarseSize, FineSize: c.FineSize, Epoch: ccsds.TAIEpoch}
+	if cuc.CoarseSize == 0 {
+		cuc.CoarseSize = 4
+	}
+	if c.Epoch != "" {
+		epoch, err := time.Parse(time.RFC3339, c.Epoch)
+		if err != nil {
+			return ccsds.CUC{}, fmt.Errorf("parsing epoch: %w", err)
+		}
+		cuc.Epoch = epoch
+	}
+	if err := cuc.Validate(); err != nil {
+		return ccsds.CUC{}, err
+	}
+	return cuc, nil
+}
@@ -0,0 +1,57 @@
+package tlm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/ccsds"
+)
+
+func TestCCSDSConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     CCSDSConfig
+		wantErr bool
+	}{
+		{"apid only", CCSDSConfig{APID: 100}, false},
+		{"max apid", CCSDSConfig{APID: ccsds.MaxAPID}, false},
+		{"time code", CCSDSConfig{APID: 1, TimeCode: &TimeCodeConfig{FineSize: 2, Epoch: "1970-01-01T00:00:00Z"}}, false},
+		{"negative apid", CCSDSConfig{APID: -1}, true},
+		{"idle apid", CCSDSConfig{APID: ccsds.IdleAPID}, true},
+		{"bad coarse size", CCSDSConfig{TimeCode: &TimeCodeConfig{CoarseSize: 5}}, true},
+		{"bad fine size", CCSDSConfig{TimeCode: &TimeCodeConfig{FineSize: 4}}, true},
+		{"bad epoch", CCSDSConfig{TimeCode: &TimeCodeConfig{Epoch: "1970-01-01"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTimeCodeConfigCUC(t *testing.T) {
+	cuc, err := TimeCodeConfig{}.CUC()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := ccsds.CUC{CoarseSize: 4, Epoch: ccsds.TAIEpoch}
+	if cuc != expected {
+		t.Errorf("expected %+v, got %+v", expected, cuc)
+	}
+
+	cuc, err = TimeCodeConfig{CoarseSize: 2, FineSize: 1, Epoch: "2000-01-01T12:00:00Z"}.CUC()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = ccsds.CUC{CoarseSize: 2, FineSize: 1, Epoch: time.Date(2000, time.January, 1, 12, 0, 0, 0, time.UTC)}
+	if cuc != expected {
+		t.Errorf("expected %+v, got %+v", expected, cuc)
+	}
+}
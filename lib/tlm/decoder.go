@@ -0,0 +1,287 @@
+package tlm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ValueKind identifies which field of a Value holds the decoded measurement.
+type ValueKind uint8
+
+const (
+	ValueInvalid ValueKind = iota // Value has not been decoded
+	ValueInt                      // Value is stored in Int
+	ValueUint                     // Value is stored in Uint
+	ValueFloat32                  // Value is stored in Float and was sent as a 32-bit float
+	ValueFloat64                  // Value is stored in Float
+)
+
+// Value is a decoded measurement value.
+// Only the field selected by Kind is meaningful.
+type Value struct {
+	Kind  ValueKind
+	Int   int64
+	Uint  uint64
+	Float float64
+}
+
+// IntValue returns a Value holding a signed integer.
+func IntValue(v int64) Value {
+	return Value{Kind: ValueInt, Int: v}
+}
+
+// UintValue returns a Value holding an unsigned integer.
+func UintValue(v uint64) Value {
+	return Value{Kind: ValueUint, Uint: v}
+}
+
+// FloatValue returns a Value holding a floating point number.
+func FloatValue(v float64) Value {
+	return Value{Kind: ValueFloat64, Float: v}
+}
+
+// Float64 returns the value converted to a float64.
+func (v Value) Float64() float64 {
+	switch v.Kind {
+	case ValueInt:
+		return float64(v.Int)
+	case ValueUint:
+		return float64(v.Uint)
+	case ValueFloat32, ValueFloat64:
+		return v.Float
+	default:
+		return 0
+	}
+}
+
+// AppendFormat appends the text form of the value to dst.
+// Integers are written in base 10; floats use the strconv format byte and precision.
+func (v Value) AppendFormat(dst []byte, format byte, prec int) []byte {
+	switch v.Kind {
+	case ValueInt:
+		return strconv.AppendInt(dst, v.Int, 10)
+	case ValueUint:
+		return strconv.AppendUint(dst, v.Uint, 10)
+	case ValueFloat32:
+		return strconv.AppendFloat(dst, v.Float, format, prec, 32)
+	case ValueFloat64:
+		return strconv.AppendFloat(dst, v.Float, format, prec, 64)
+	default:
+		return dst
+	}
+}
+
+// String returns the value formatted the same way as InterpretMeasurementValueString.
+func (v Value) String() string {
+	return string(v.AppendFormat(nil, 'f', 6))
+}
+
+// Interface returns the value as an int64, uint64, float32 or float64.
+// This allocates and should be avoided on hot paths.
+func (v Value) Interface() interface{} {
+	switch v.Kind {
+	case ValueInt:
+		return v.Int
+	case ValueUint:
+		return v.Uint
+	case ValueFloat32:
+		return float32(v.Float)
+	case ValueFloat64:
+		return v.Float
+	default:
+		return nil
+	}
+}
+
+// decoderField is a measurement with its position resolved within a packet.
+type decoderField struct {
+	measurement Measurement
+	offset      int
+	read        func(data []byte) Value
+}
+
+// Decoder decodes a telemetry packet using offsets and readers resolved once at construction.
+// A Decoder is safe for concurrent use, as long as each goroutine passes its own value slice.
+type Decoder struct {
+	packet TelemetryPacket
+	size   int
+	fields []decoderField
+}
+
+// NewDecoder compiles a decoder for a telemetry packet.
+// Every measurement in the packet must exist in measurements and have a supported type and size.
+func NewDecoder(packet TelemetryPacket, measurements map[string]Measurement) (*Decoder, error) {
+	decoder := &Decoder{
+		packet: packet,
+		fields: make([]decoderField, 0, len(packet.Measurements)),
+	}
+
+	for _, name := range packet.Measurements {
+		measurement, ok := measurements[name]
+		if !ok {
+			return nil, fmt.Errorf("measurement %s not found", name)
+		}
+
+		read, err := newMeasurementReader(measurement)
+		if err != nil {
+			return nil, fmt.Errorf("measurement %s: %w", name, err)
+		}
+
+		decoder.fields = append(decoder.fields, decoderField{
+			measurement: measurement,
+			offset:      decoder.size,
+			read:        read,
+		})
+		decoder.size += measurement.Size
+	}
+
+	return decoder, nil
+}
+
+// Packet returns the telemetry packet the decoder was built for.
+func (d *Decoder) Packet() TelemetryPacket {
+	return d.packet
+}
+
+// Size returns the packet size in bytes.
+func (d *Decoder) Size() int {
+	return d.size
+}
+
+// Len returns the number of measurements in the packet.
+func (d *Decoder) Len() int {
+	return len(d.fields)
+}
+
+// Measurement returns the i-th measurement in the packet.
+func (d *Decoder) Measurement(i int) Measurement {
+	return d.fields[i].measurement
+}
+
+// Offset returns the byte offset of the i-th measurement in the packet.
+func (d *Decoder) Offset(i int) int {
+	return d.fields[i].offset
+}
+
+// NewValues allocates a value slice sized for the packet.
+func (d *Decoder) NewValues() []Value {
+	return make([]Value, len(d.fields))
+}
+
+// Decode decodes data into values, which must hold at least Len elements.
+// Decode does not allocate unless it returns an error.
+func (d *Decoder) Decode(data []byte, values []Value) error {
+	if len(data) < d.size {
+		return fmt.Errorf("packet %s is %d bytes, expected %d", d.packet.Name, len(data), d.size)
+	}
+	if len(values) < len(d.fields) {
+		return fmt.Errorf("value slice holds %d values, expected %d", len(values), len(d.fields))
+	}
+
+	for i := range d.fields {
+		field := &d.fields[i]
+		values[i] = field.read(data[field.offset : field.offset+field.measurement.Size])
+	}
+
+	return nil
+}
+
+// DecodeMeasurement decodes only the i-th measurement of data.
+func (d *Decoder) DecodeMeasurement(data []byte, i int) (Value, error) {
+	if len(data) < d.size {
+		return Value{}, fmt.Errorf("packet %s is %d bytes, expected %d", d.packet.Name, len(data), d.size)
+	}
+	field := &d.fields[i]
+	return field.read(data[field.offset : field.offset+field.measurement.Size]), nil
+}
+
+// newMeasurementReader returns a reader specialized for the measurement's type, size, endianness and scaling.
+func newMeasurementReader(measurement Measurement) (func([]byte) Value, error) {
+	if measurement.Size < 1 || measurement.Size > 8 {
+		return nil, fmt.Errorf("unsupported size: %d bytes", measurement.Size)
+	}
+
+	readUint := newUintReader(measurement.Size, measurement.Endianness == "little")
+
+	var read func([]byte) Value
+	switch measurement.Type {
+	case "int":
+		if measurement.Unsigned {
+			read = func(data []byte) Value {
+				return Value{Kind: ValueUint, Uint: readUint(data)}
+			}
+		} else {
+			shift := uint(64 - 8*measurement.Size)
+			read = func(data []byte) Value {
+				// sign extend by shifting the top bit of the measurement into the top bit of an int64
+				return Value{Kind: ValueInt, Int: int64(readUint(data)<<shift) >> shift}
+			}
+		}
+	case "float":
+		switch measurement.Size {
+		case 4:
+			read = func(data []byte) Value {
+				return Value{Kind: ValueFloat32, Float: float64(math.Float32frombits(uint32(readUint(data))))}
+			}
+		case 8:
+			read = func(data []byte) Value {
+				return Value{Kind: ValueFloat64, Float: math.Float64frombits(readUint(data))}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported size for float: %d bytes", measurement.Size)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type for measurement: %s", measurement.Type)
+	}
+
+	scale := measurement.ScalingFactor
+	if scale == 0 || scale == 1.0 {
+		return read, nil
+	}
+
+	return func(data []byte) Value {
+		return Value{Kind: ValueFloat64, Float: read(data).Float64() * scale}
+	}, nil
+}
+
+// newUintReader returns a function reading an unsigned integer of the given size and byte order.
+func newUintReader(size int, little bool) func([]byte) uint64 {
+	switch size {
+	case 1:
+		return func(data []byte) uint64 { return uint64(data[0]) }
+	case 2:
+		if little {
+			return func(data []byte) uint64 { return uint64(binary.LittleEndian.Uint16(data)) }
+		}
+		return func(data []byte) uint64 { return uint64(binary.BigEndian.Uint16(data)) }
+	case 4:
+		if little {
+			return func(data []byte) uint64 { return uint64(binary.LittleEndian.Uint32(data)) }
+		}
+		return func(data []byte) uint64 { return uint64(binary.BigEndian.Uint32(data)) }
+	case 8:
+		if little {
+			return binary.LittleEndian.Uint64
+		}
+		return binary.BigEndian.Uint64
+	}
+
+	if little {
+		return func(data []byte) uint64 {
+			var val uint64
+			for i := 0; i < size; i++ {
+				val |= uint64(data[i]) << (8 * i)
+			}
+			return val
+		}
+	}
+	return func(data []byte) uint64 {
+		var val uint64
+		for i := 0; i < size; i++ {
+			val |= uint64(data[i]) << (8 * (size - 1 - i))
+		}
+		return val
+	}
+}
@@ -0,0 +1,236 @@
+package tlm
+
+import (
+	"math"
+	"testing"
+)
+
+var decoderTestMeasurements = map[string]Measurement{
+	"U8":      {Name: "U8", Size: 1, Type: "int", Unsigned: true, Endianness: "big", ScalingFactor: 1},
+	"I16LE":   {Name: "I16LE", Size: 2, Type: "int", Endianness: "little", ScalingFactor: 1},
+	"I24":     {Name: "I24", Size: 3, Type: "int", Endianness: "big", ScalingFactor: 1},
+	"U32":     {Name: "U32", Size: 4, Type: "int", Unsigned: true, Endianness: "big", ScalingFactor: 1},
+	"I64LE":   {Name: "I64LE", Size: 8, Type: "int", Endianness: "little", ScalingFactor: 1},
+	"F32LE":   {Name: "F32LE", Size: 4, Type: "float", Endianness: "little", ScalingFactor: 1},
+	"F64":     {Name: "F64", Size: 8, Type: "float", Endianness: "big", ScalingFactor: 1},
+	"Scaled":  {Name: "Scaled", Size: 2, Type: "int", Unsigned: true, Endianness: "big", ScalingFactor: 0.5},
+	"BadType": {Name: "BadType", Size: 4, Type: "string", Endianness: "big", ScalingFactor: 1},
+}
+
+var decoderTestPacket = TelemetryPacket{
+	Name:         "Decoder",
+	Port:         10000,
+	Measurements: []string{"U8", "I16LE", "I24", "U32", "I64LE", "F32LE", "F64", "Scaled"},
+}
+
+var decoderTestData = []byte{
+	0xAB,       // U8
+	0x82, 0xFF, // I16LE
+	0xFF, 0xFF, 0x82, // I24
+	0x12, 0x34, 0x56, 0x78, // U32
+	0x82, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // I64LE
+	0x00, 0x00, 0x80, 0x3F, // F32LE
+	0x3F, 0xF0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // F64
+	0x00, 0x05, // Scaled
+}
+
+func TestDecoderDecode(t *testing.T) {
+	decoder, err := NewDecoder(decoderTestPacket, decoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if decoder.Size() != len(decoderTestData) {
+		t.Fatalf("expected size %d, got %d", len(decoderTestData), decoder.Size())
+	}
+
+	values := decoder.NewValues()
+	if err := decoder.Decode(decoderTestData, values); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Value{
+		UintValue(0xAB),
+		IntValue(-126),
+		IntValue(-126),
+		UintValue(0x12345678),
+		IntValue(-126),
+		{Kind: ValueFloat32, Float: 1.0},
+		FloatValue(1.0),
+		FloatValue(2.5),
+	}
+
+	for i, want := range expected {
+		if values[i] != want {
+			t.Errorf("measurement %s: expected %+v, got %+v", decoderTestPacket.Measurements[i], want, values[i])
+		}
+	}
+}
+
+func TestDecoderDecodeMeasurement(t *testing.T) {
+	decoder, err := NewDecoder(decoderTestPacket, decoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	values := decoder.NewValues()
+	if err := decoder.Decode(decoderTestData, values); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range values {
+		value, err := decoder.DecodeMeasurement(decoderTestData, i)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if value != values[i] {
+			t.Errorf("measurement %d: expected %v, got %v", i, values[i], value)
+		}
+	}
+
+	if _, err := decoder.DecodeMeasurement(decoderTestData[:4], 0); err == nil {
+		t.Errorf("expected error for short packet, got nil")
+	}
+}
+
+func TestDecoderMatchesInterpreter(t *testing.T) {
+	decoder, err := NewDecoder(decoderTestPacket, decoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	values := decoder.NewValues()
+	if err := decoder.Decode(decoderTestData, values); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	offset := 0
+	for i, name := range decoderTestPacket.Measurements {
+		measurement := decoderTestMeasurements[name]
+		expected, err := InterpretMeasurementValue(measurement, decoderTestData[offset:offset+measurement.Size])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		offset += measurement.Size
+
+		var expectedFloat float64
+		switch v := expected.(type) {
+		case uint8:
+			expectedFloat = float64(v)
+		case int16:
+			expectedFloat = float64(v)
+		case int32:
+			expectedFloat = float64(v)
+		case uint32:
+			expectedFloat = float64(v)
+		case int64:
+			expectedFloat = float64(v)
+		case float32:
+			expectedFloat = float64(v)
+		case float64:
+			expectedFloat = v
+		default:
+			t.Fatalf("unexpected type %T", v)
+		}
+
+		if values[i].Float64() != expectedFloat {
+			t.Errorf("measurement %s: expected %v, got %v", name, expectedFloat, values[i].Float64())
+		}
+	}
+}
+
+func TestNewDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet TelemetryPacket
+	}{
+		{"missing measurement", TelemetryPacket{Name: "Missing", Measurements: []string{"U8", "Missing"}}},
+		{"unsupported type", TelemetryPacket{Name: "BadType", Measurements: []string{"BadType"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoder(tt.packet, decoderTestMeasurements); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestDecoderShortPacket(t *testing.T) {
+	decoder, err := NewDecoder(decoderTestPacket, decoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := decoder.Decode(decoderTestData[:len(decoderTestData)-1], decoder.NewValues()); err == nil {
+		t.Errorf("expected error for short packet, got nil")
+	}
+
+	if err := decoder.Decode(decoderTestData, make([]Value, 1)); err == nil {
+		t.Errorf("expected error for short value slice, got nil")
+	}
+}
+
+func TestValueFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    Value
+		expected string
+	}{
+		{"int", IntValue(-126), "-126"},
+		{"uint", UintValue(0xFFFFFFFFFFFFFFFF), "18446744073709551615"},
+		{"float32", Value{Kind: ValueFloat32, Float: float64(float32(0.1))}, "0.100000"},
+		{"float64", FloatValue(math.Pi), "3.141593"},
+		{"invalid", Value{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.value.String(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecoderDoesNotAllocate(t *testing.T) {
+	decoder, err := NewDecoder(decoderTestPacket, decoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	values := decoder.NewValues()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = decoder.Decode(decoderTestData, values)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+// BenchmarkInterpretMeasurementValue is the per-packet decode loop the decoder replaces.
+func BenchmarkInterpretMeasurementValue(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		offset := 0
+		for _, name := range decoderTestPacket.Measurements {
+			measurement := decoderTestMeasurements[name]
+			_, _ = InterpretMeasurementValue(measurement, decoderTestData[offset:offset+measurement.Size])
+			offset += measurement.Size
+		}
+	}
+}
+
+func BenchmarkDecoderDecode(b *testing.B) {
+	decoder, err := NewDecoder(decoderTestPacket, decoderTestMeasurements)
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+	values := decoder.NewValues()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = decoder.Decode(decoderTestData, values)
+	}
+}
@@ -0,0 +1,210 @@
+package tlm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Encoder builds raw telemetry packets from engineering values.
+// It is the inverse of Decoder: calibration is removed and values are written with the measurement's size and endianness.
+type Encoder struct {
+	packet  TelemetryPacket
+	size    int
+	fields  []decoderField
+	indexes map[string]int
+}
+
+// NewEncoder compiles an encoder for a telemetry packet.
+// Every measurement in the packet must exist in measurements and have a supported type and size.
+func NewEncoder(packet TelemetryPacket, measurements map[string]Measurement) (*Encoder, error) {
+	decoder, err := NewDecoder(packet, measurements)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := &Encoder{
+		packet:  packet,
+		size:    decoder.size,
+		fields:  decoder.fields,
+		indexes: make(map[string]int, len(decoder.fields)),
+	}
+	for i, field := range decoder.fields {
+		encoder.indexes[field.measurement.Name] = i
+	}
+
+	return encoder, nil
+}
+
+// Size returns the packet size in bytes.
+func (e *Encoder) Size() int {
+	return e.size
+}
+
+// Encode returns a new packet holding values, keyed by measurement name.
+// Measurements without a value are encoded as zero bytes.
+func (e *Encoder) Encode(values map[string]Value) ([]byte, error) {
+	data := make([]byte, e.size)
+	if err := e.EncodeInto(data, values); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// EncodeInto writes values, keyed by measurement name, into dst, which must hold at least Size bytes.
+// Measurements without a value are left untouched.
+func (e *Encoder) EncodeInto(dst []byte, values map[string]Value) error {
+	if len(dst) < e.size {
+		return fmt.Errorf("buffer is %d bytes, expected %d", len(dst), e.size)
+	}
+
+	for name, value := range values {
+		i, ok := e.indexes[name]
+		if !ok {
+			return fmt.Errorf("measurement %s is not in packet %s", name, e.packet.Name)
+		}
+
+		field := &e.fields[i]
+		if err := EncodeMeasurement(field.measurement, value, dst[field.offset:field.offset+field.measurement.Size]); err != nil {
+			return fmt.Errorf("measurement %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// EncodeMeasurement removes calibration from value and writes the raw measurement into dst,
+// which must hold the measurement's size.
+func EncodeMeasurement(measurement Measurement, value Value, dst []byte) error {
+	if value.Kind == ValueInvalid {
+		return fmt.Errorf("value is not set")
+	}
+
+	scale := measurement.ScalingFactor
+	if scale == 0 {
+		scale = 1.0
+	}
+	little := measurement.Endianness == "little"
+
+	switch measurement.Type {
+	case "int":
+		raw, err := rawInteger(measurement, value, scale)
+		if err != nil {
+			return err
+		}
+		putUint(dst, raw, little)
+	case "float":
+		switch measurement.Size {
+		case 4:
+			putUint(dst, uint64(math.Float32bits(float32(value.Float64()/scale))), little)
+		case 8:
+			putUint(dst, math.Float64bits(value.Float64()/scale), little)
+		default:
+			return fmt.Errorf("unsupported size for float: %d bytes", measurement.Size)
+		}
+	default:
+		return fmt.Errorf("unsupported type for measurement: %s", measurement.Type)
+	}
+
+	return nil
+}
+
+// rawInteger converts an engineering value to the raw integer bits of a measurement, checking it fits in the measurement size.
+func rawInteger(measurement Measurement, value Value, scale float64) (uint64, error) {
+	if measurement.Size < 1 || measurement.Size > 8 {
+		return 0, fmt.Errorf("unsupported size for integer: %d bytes", measurement.Size)
+	}
+	bits := uint(8 * measurement.Size)
+
+	// Calibrated and float values go through float64, uncalibrated integers are converted exactly.
+	if scale != 1.0 || value.Kind == ValueFloat32 || value.Kind == ValueFloat64 {
+		f := value.Float64() / scale
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, fmt.Errorf("value %v can't be encoded as an integer", value.Float64())
+		}
+		if scale == 1.0 && f != math.Trunc(f) {
+			return 0, fmt.Errorf("value %v is not an integer", f)
+		}
+		f = math.Round(f)
+
+		if measurement.Unsigned {
+			if f < 0 || f >= math.Ldexp(1, int(bits)) {
+				return 0, fmt.Errorf("value %v out of range for %d-bit unsigned integer", f, bits)
+			}
+			return uint64(f), nil
+		}
+		if f < -math.Ldexp(1, int(bits-1)) || f >= math.Ldexp(1, int(bits-1)) {
+			return 0, fmt.Errorf("value %v out of range for %d-bit signed integer", f, bits)
+		}
+		value = IntValue(int64(f))
+	}
+
+	if measurement.Unsigned {
+		if value.Kind == ValueInt {
+			if value.Int < 0 {
+				return 0, fmt.Errorf("value %d out of range for %d-bit unsigned integer", value.Int, bits)
+			}
+			value = UintValue(uint64(value.Int))
+		}
+		if bits < 64 && value.Uint>>bits != 0 {
+			return 0, fmt.Errorf("value %d out of range for %d-bit unsigned integer", value.Uint, bits)
+		}
+		return value.Uint, nil
+	}
+
+	if value.Kind == ValueUint {
+		if value.Uint > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d out of range for %d-bit signed integer", value.Uint, bits)
+		}
+		value = IntValue(int64(value.Uint))
+	}
+	if bits < 64 {
+		limit := int64(1) << (bits - 1)
+		if value.Int < -limit || value.Int >= limit {
+			return 0, fmt.Errorf("value %d out of range for %d-bit signed integer", value.Int, bits)
+		}
+	}
+
+	// Keep only the low bits, which holds the two's complement representation of the value.
+	return uint64(value.Int) & (^uint64(0) >> (64 - bits)), nil
+}
+
+// putUint writes the low len(dst) bytes of val into dst.
+func putUint(dst []byte, val uint64, little bool) {
+	size := len(dst)
+	for i := 0; i < size; i++ {
+		b := byte(val >> (8 * i))
+		if little {
+			dst[i] = b
+		} else {
+			dst[size-1-i] = b
+		}
+	}
+}
+
+// ParseValue parses the text form of an engineering value for a measurement.
+// Uncalibrated integers accept any base understood by strconv.ParseInt (e.g. 0x1F), everything else is parsed as a float.
+func ParseValue(measurement Measurement, text string) (Value, error) {
+	scale := measurement.ScalingFactor
+	if measurement.Type == "int" && (scale == 0 || scale == 1.0) {
+		if measurement.Unsigned {
+			v, err := strconv.ParseUint(text, 0, 64)
+			if err != nil {
+				return Value{}, fmt.Errorf("parsing unsigned integer: %w", err)
+			}
+			return UintValue(v), nil
+		}
+
+		v, err := strconv.ParseInt(text, 0, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("parsing integer: %w", err)
+		}
+		return IntValue(v), nil
+	}
+
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Value{}, fmt.Errorf("parsing float: %w", err)
+	}
+	return FloatValue(v), nil
+}
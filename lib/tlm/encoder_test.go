@@ -0,0 +1,227 @@
+package tlm
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var encoderTestMeasurements = map[string]Measurement{
+	"U8":       {Name: "U8", Size: 1, Type: "int", Unsigned: true, Endianness: "big", ScalingFactor: 1},
+	"I16LE":    {Name: "I16LE", Size: 2, Type: "int", Endianness: "little", ScalingFactor: 1},
+	"I24":      {Name: "I24", Size: 3, Type: "int", Endianness: "big", ScalingFactor: 1},
+	"U40LE":    {Name: "U40LE", Size: 5, Type: "int", Unsigned: true, Endianness: "little", ScalingFactor: 1},
+	"I64":      {Name: "I64", Size: 8, Type: "int", Endianness: "big", ScalingFactor: 1},
+	"U64LE":    {Name: "U64LE", Size: 8, Type: "int", Unsigned: true, Endianness: "little", ScalingFactor: 1},
+	"F32LE":    {Name: "F32LE", Size: 4, Type: "float", Endianness: "little", ScalingFactor: 1},
+	"F64":      {Name: "F64", Size: 8, Type: "float", Endianness: "big", ScalingFactor: 1},
+	"ScaledU":  {Name: "ScaledU", Size: 2, Type: "int", Unsigned: true, Endianness: "big", ScalingFactor: 0.01},
+	"ScaledI":  {Name: "ScaledI", Size: 4, Type: "int", Endianness: "little", ScalingFactor: 0.25},
+	"ScaledF":  {Name: "ScaledF", Size: 8, Type: "float", Endianness: "little", ScalingFactor: 2},
+	"Unsigned": {Name: "Unsigned", Size: 1, Type: "int", Unsigned: true, Endianness: "big", ScalingFactor: 1},
+}
+
+var encoderTestPacket = TelemetryPacket{
+	Name:         "Encoder",
+	Port:         10000,
+	Measurements: []string{"U8", "I16LE", "I24", "U40LE", "I64", "U64LE", "F32LE", "F64", "ScaledU", "ScaledI", "ScaledF"},
+}
+
+// randomPacket fills a packet with random bytes, avoiding NaN floats since their payload bits are not preserved
+// and infinite values, which are produced when calibrating a float near its limit.
+func randomPacket(rng *rand.Rand, decoder *Decoder) []byte {
+	data := make([]byte, decoder.Size())
+	values := decoder.NewValues()
+	for {
+		rng.Read(data)
+		if err := decoder.Decode(data, values); err != nil {
+			panic(err)
+		}
+
+		valid := true
+		for _, v := range values {
+			if math.IsNaN(v.Float) || math.IsInf(v.Float, 0) {
+				valid = false
+			}
+		}
+		if valid {
+			return data
+		}
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	decoder, err := NewDecoder(encoderTestPacket, encoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	encoder, err := NewEncoder(encoderTestPacket, encoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	values := decoder.NewValues()
+
+	for iteration := 0; iteration < 10000; iteration++ {
+		data := randomPacket(rng, decoder)
+		if err := decoder.Decode(data, values); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		named := make(map[string]Value, len(values))
+		for i, name := range encoderTestPacket.Measurements {
+			named[name] = values[i]
+		}
+
+		encoded, err := encoder.Encode(named)
+		if err != nil {
+			t.Fatalf("unexpected error encoding % X: %v", data, err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("round trip mismatch:\nexp: % X\ngot: % X", data, encoded)
+		}
+	}
+}
+
+func TestEncodeEngineeringValues(t *testing.T) {
+	decoder, err := NewDecoder(encoderTestPacket, encoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	encoder, err := NewEncoder(encoderTestPacket, encoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(2))
+	values := decoder.NewValues()
+
+	for iteration := 0; iteration < 10000; iteration++ {
+		input := map[string]Value{
+			"U8":      UintValue(uint64(rng.Intn(256))),
+			"I16LE":   IntValue(int64(rng.Intn(1<<16) - 1<<15)),
+			"I24":     IntValue(int64(rng.Intn(1<<24) - 1<<23)),
+			"U40LE":   UintValue(uint64(rng.Int63n(1 << 40))),
+			"I64":     IntValue(rng.Int63() - rng.Int63()),
+			"U64LE":   UintValue(rng.Uint64()),
+			"F32LE":   FloatValue(float64(float32(rng.NormFloat64() * 1000))),
+			"F64":     FloatValue(rng.NormFloat64() * 1e6),
+			"ScaledU": FloatValue(float64(rng.Intn(1<<16)) * 0.01),
+			"ScaledI": FloatValue(float64(rng.Intn(1<<20)-1<<19) * 0.25),
+			"ScaledF": FloatValue(rng.NormFloat64()),
+		}
+
+		data, err := encoder.Encode(input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := decoder.Decode(data, values); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for i, name := range encoderTestPacket.Measurements {
+			expected := input[name].Float64()
+			got := values[i].Float64()
+			if math.Abs(expected-got) > math.Abs(expected)*1e-12 {
+				t.Fatalf("measurement %s: expected %v, got %v", name, expected, got)
+			}
+		}
+	}
+}
+
+func TestEncodeKnownPacket(t *testing.T) {
+	encoder, err := NewEncoder(decoderTestPacket, decoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := encoder.Encode(map[string]Value{
+		"U8":     UintValue(0xAB),
+		"I16LE":  IntValue(-126),
+		"I24":    IntValue(-126),
+		"U32":    UintValue(0x12345678),
+		"I64LE":  IntValue(-126),
+		"F32LE":  FloatValue(1.0),
+		"F64":    FloatValue(1.0),
+		"Scaled": FloatValue(2.5),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(data, decoderTestData) {
+		t.Errorf("\nexp: % X\ngot: % X", decoderTestData, data)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	encoder, err := NewEncoder(encoderTestPacket, encoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]Value
+	}{
+		{"unknown measurement", map[string]Value{"Unsigned": UintValue(1)}},
+		{"unsigned overflow", map[string]Value{"U8": UintValue(256)}},
+		{"unsigned negative", map[string]Value{"U8": IntValue(-1)}},
+		{"signed overflow", map[string]Value{"I16LE": IntValue(1 << 15)}},
+		{"signed underflow", map[string]Value{"I24": IntValue(-1<<23 - 1)}},
+		{"signed from large unsigned", map[string]Value{"I64": UintValue(math.MaxUint64)}},
+		{"fractional integer", map[string]Value{"I16LE": FloatValue(1.5)}},
+		{"scaled overflow", map[string]Value{"ScaledU": FloatValue(655.36)}},
+		{"NaN integer", map[string]Value{"ScaledI": FloatValue(math.NaN())}},
+		{"invalid value", map[string]Value{"U8": {}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := encoder.Encode(tt.values); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+
+	if err := encoder.EncodeInto(make([]byte, 1), nil); err == nil {
+		t.Errorf("expected error for short buffer, got nil")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		measurement Measurement
+		text        string
+		expected    Value
+		wantErr     bool
+	}{
+		{"signed", encoderTestMeasurements["I16LE"], "-42", IntValue(-42), false},
+		{"unsigned hex", encoderTestMeasurements["U8"], "0xAB", UintValue(0xAB), false},
+		{"unsigned negative", encoderTestMeasurements["U8"], "-1", Value{}, true},
+		{"float", encoderTestMeasurements["F32LE"], "1.5", FloatValue(1.5), false},
+		{"scaled integer", encoderTestMeasurements["ScaledU"], "3.3", FloatValue(3.3), false},
+		{"garbage", encoderTestMeasurements["F64"], "abc", Value{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseValue(tt.measurement, tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
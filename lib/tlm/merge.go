@@ -0,0 +1,77 @@
+package tlm
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// MaxStations is the largest number of stations that can be merged.
+const MaxStations = 63
+
+// UnknownStation names the packets merged from sources that aren't a configured station.
+const UnknownStation = "unknown"
+
+// DefaultMergeWindow is how long a packet is remembered when the merge window isn't set.
+const DefaultMergeWindow = time.Second
+
+// MergeConfig merges the packets received by several ground stations into one stream,
+// dropping the copies of a packet delivered by more than one station.
+type MergeConfig struct {
+	Window   time.Duration `yaml:"window,omitempty"` // How long a packet is remembered to drop its copies. Defaults to 1s
+	Stations []Station     `yaml:"stations"`         // Stations forwarding the packets they receive
+}
+
+// Station is a ground station forwarding the packets it receives, identified by the addresses it sends from.
+type Station struct {
+	Name    string   `yaml:"name"`    // Name of the station, used to tag the packets it delivered first
+	Sources []string `yaml:"sources"` // Addresses or subnets the station forwards from (e.g. 10.0.2.20, 10.0.3.0/24)
+}
+
+// Validate checks the merge window and the stations.
+func (c MergeConfig) Validate() error {
+	if c.Window < 0 {
+		return fmt.Errorf("merge window %s is negative", c.Window)
+	}
+	if len(c.Stations) == 0 {
+		return fmt.Errorf("merge has no stations")
+	}
+	if len(c.Stations) > MaxStations {
+		return fmt.Errorf("merge has %d stations, more than %d", len(c.Stations), MaxStations)
+	}
+
+	names := make(map[string]bool)
+	for _, station := range c.Stations {
+		if !vehicleNamePattern.MatchString(station.Name) || station.Name == UnknownStation {
+			return fmt.Errorf("station name %q must only contain letters, digits, '-' and '_', and can't be %s", station.Name, UnknownStation)
+		}
+		if names[station.Name] {
+			return fmt.Errorf("station %s is defined more than once", station.Name)
+		}
+		names[station.Name] = true
+		if len(station.Sources) == 0 {
+			return fmt.Errorf("station %s has no sources", station.Name)
+		}
+		if _, err := station.SourcePrefixes(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WindowOrDefault returns the merge window, or DefaultMergeWindow if it isn't set.
+func (c MergeConfig) WindowOrDefault() time.Duration {
+	if c.Window == 0 {
+		return DefaultMergeWindow
+	}
+	return c.Window
+}
+
+// SourcePrefixes parses the station's sources. Plain addresses match only themselves.
+func (s Station) SourcePrefixes() ([]netip.Prefix, error) {
+	prefixes, err := parsePrefixes(s.Sources)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source for station %s: %w", s.Name, err)
+	}
+	return prefixes, nil
+}
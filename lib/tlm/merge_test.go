@@ -0,0 +1,45 @@
+package tlm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMergeConfigValidate(t *testing.T) {
+	pad := Station{Name: "pad", Sources: []string{"10.0.0.0/24"}}
+	tent := Station{Name: "tent", Sources: []string{"10.0.2.20"}}
+	tooMany := make([]Station, MaxStations+1)
+	for i := range tooMany {
+		tooMany[i] = Station{Name: fmt.Sprintf("s%d", i), Sources: []string{"10.0.0.1"}}
+	}
+
+	tests := []struct {
+		name    string
+		config  MergeConfig
+		wantErr bool
+	}{
+		{"stations", MergeConfig{Stations: []Station{pad, tent}}, false},
+		{"window", MergeConfig{Window: 2 * time.Second, Stations: []Station{pad}}, false},
+		{"no stations", MergeConfig{}, true},
+		{"negative window", MergeConfig{Window: -time.Second, Stations: []Station{pad}}, true},
+		{"duplicate", MergeConfig{Stations: []Station{pad, pad}}, true},
+		{"bad name", MergeConfig{Stations: []Station{{Name: "a b", Sources: []string{"10.0.0.1"}}}}, true},
+		{"reserved name", MergeConfig{Stations: []Station{{Name: UnknownStation, Sources: []string{"10.0.0.1"}}}}, true},
+		{"no sources", MergeConfig{Stations: []Station{{Name: "pad"}}}, true},
+		{"bad source", MergeConfig{Stations: []Station{{Name: "pad", Sources: []string{"10.0.0"}}}}, true},
+		{"too many", MergeConfig{Stations: tooMany}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package tlm
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/framing"
+	"github.com/AarC10/GSW-V2/lib/serial"
+)
+
+// TCPConfig describes how a telemetry packet is received over a TCP stream.
+// By default GSW listens on the packet port and accepts any number of clients.
+type TCPConfig struct {
+	Connect        string         `yaml:"connect,omitempty"`         // Address to dial instead of listening (e.g. bridge.local:4000)
+	ReconnectDelay time.Duration  `yaml:"reconnect_delay,omitempty"` // Initial delay before redialing a lost connection. Defaults to 1s
+	Framing        framing.Config `yaml:"framing,omitempty"`         // How packets are delimited in the stream
+}
+
+// SerialConfig describes how a telemetry packet is received from a serial device.
+// The device is reopened if it goes away, such as when a USB receiver is unplugged.
+type SerialConfig struct {
+	Device      string         `yaml:"device"`                 // Path to the serial device (e.g. /dev/ttyUSB0)
+	ReopenDelay time.Duration  `yaml:"reopen_delay,omitempty"` // Initial delay before reopening a lost device. Defaults to 1s
+	Framing     framing.Config `yaml:"framing,omitempty"`      // How packets are delimited in the stream
+
+	serial.Config `yaml:",inline"` // Line settings (baud, parity, data_bits, stop_bits)
+}
+
+// UDPConfig restricts where UDP telemetry is received from.
+// It can be set for all packets with the ingest section and overridden per packet.
+type UDPConfig struct {
+	Bind           string   `yaml:"bind,omitempty"`            // Local address to bind (e.g. 192.168.1.10). Defaults to all addresses
+	Interface      string   `yaml:"interface,omitempty"`       // Network interface to receive on and join multicast groups with (e.g. eth0)
+	Multicast      []string `yaml:"multicast,omitempty"`       // Multicast groups to join (e.g. 239.1.2.3)
+	AllowedSources []string `yaml:"allowed_sources,omitempty"` // Source addresses or subnets to accept (e.g. 10.0.0.5, 10.0.1.0/24). Defaults to any
+	ReceiveBuffer  int      `yaml:"receive_buffer,omitempty"`  // Socket receive buffer size in bytes (SO_RCVBUF). Defaults to the system default
+	BatchSize      int      `yaml:"batch_size,omitempty"`      // Maximum datagrams read per receive call. Defaults to 32
+}
+
+// MaxBatchSize is the largest number of datagrams that can be read per receive call
+const MaxBatchSize = 1024
+
+// Override returns the config with any fields set in other taking precedence.
+func (c UDPConfig) Override(other *UDPConfig) UDPConfig {
+	if other == nil {
+		return c
+	}
+	if other.Bind != "" {
+		c.Bind = other.Bind
+	}
+	if other.Interface != "" {
+		c.Interface = other.Interface
+	}
+	if other.Multicast != nil {
+		c.Multicast = other.Multicast
+	}
+	if other.AllowedSources != nil {
+		c.AllowedSources = other.AllowedSources
+	}
+	if other.ReceiveBuffer != 0 {
+		c.ReceiveBuffer = other.ReceiveBuffer
+	}
+	if other.BatchSize != 0 {
+		c.BatchSize = other.BatchSize
+	}
+	return c
+}
+
+// Validate checks that the addresses in the config are well formed.
+func (c UDPConfig) Validate() error {
+	if c.Bind != "" {
+		if _, err := netip.ParseAddr(c.Bind); err != nil {
+			return fmt.Errorf("invalid bind address: %w", err)
+		}
+	}
+	if _, err := c.MulticastGroups(); err != nil {
+		return err
+	}
+	if _, err := c.AllowedPrefixes(); err != nil {
+		return err
+	}
+	if c.ReceiveBuffer < 0 {
+		return fmt.Errorf("receive_buffer can't be negative")
+	}
+	if c.BatchSize < 0 || c.BatchSize > MaxBatchSize {
+		return fmt.Errorf("batch_size specified as %d, instead of 1-%d", c.BatchSize, MaxBatchSize)
+	}
+	return nil
+}
+
+// MulticastGroups parses the multicast groups to join.
+func (c UDPConfig) MulticastGroups() ([]netip.Addr, error) {
+	groups := make([]netip.Addr, 0, len(c.Multicast))
+	for _, group := range c.Multicast {
+		addr, err := netip.ParseAddr(group)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multicast group: %w", err)
+		}
+		if !addr.IsMulticast() {
+			return nil, fmt.Errorf("%s is not a multicast address", group)
+		}
+		groups = append(groups, addr)
+	}
+	return groups, nil
+}
+
+// AllowedPrefixes parses the allowed sources. Plain addresses match only themselves.
+// An empty result means datagrams from any source are accepted.
+func (c UDPConfig) AllowedPrefixes() ([]netip.Prefix, error) {
+	prefixes, err := parsePrefixes(c.AllowedSources)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed source: %w", err)
+	}
+	return prefixes, nil
+}
+
+// parsePrefixes parses addresses and subnets. Plain addresses become single address prefixes.
+func parsePrefixes(sources []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(sources))
+	for _, source := range sources {
+		if strings.Contains(source, "/") {
+			prefix, err := netip.ParsePrefix(source)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(source)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,70 @@
+package tlm
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestUDPConfigOverride(t *testing.T) {
+	global := UDPConfig{Bind: "10.0.0.1", AllowedSources: []string{"10.0.0.0/24"}}
+
+	if got := global.Override(nil); !reflect.DeepEqual(got, global) {
+		t.Errorf("expected %+v, got %+v", global, got)
+	}
+
+	got := global.Override(&UDPConfig{Multicast: []string{"239.1.2.3"}, AllowedSources: []string{}, BatchSize: 1})
+	expected := UDPConfig{Bind: "10.0.0.1", Multicast: []string{"239.1.2.3"}, AllowedSources: []string{}, BatchSize: 1}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestUDPConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     UDPConfig
+		wantErr bool
+	}{
+		{"empty", UDPConfig{}, false},
+		{"full", UDPConfig{Bind: "0.0.0.0", Interface: "eth0", Multicast: []string{"239.1.2.3", "ff02::1"}, AllowedSources: []string{"10.0.0.5", "10.0.1.0/24", "fd00::/8"}}, false},
+		{"bad bind", UDPConfig{Bind: "example.com"}, true},
+		{"bad multicast", UDPConfig{Multicast: []string{"239.1.2"}}, true},
+		{"unicast group", UDPConfig{Multicast: []string{"10.0.0.1"}}, true},
+		{"bad source", UDPConfig{AllowedSources: []string{"10.0.0"}}, true},
+		{"bad subnet", UDPConfig{AllowedSources: []string{"10.0.0.0/33"}}, true},
+		{"socket settings", UDPConfig{ReceiveBuffer: 8 << 20, BatchSize: MaxBatchSize}, false},
+		{"negative receive buffer", UDPConfig{ReceiveBuffer: -1}, true},
+		{"negative batch size", UDPConfig{BatchSize: -1}, true},
+		{"batch size too large", UDPConfig{BatchSize: MaxBatchSize + 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestUDPConfigAllowedPrefixes(t *testing.T) {
+	cfg := UDPConfig{AllowedSources: []string{"10.0.0.5", "10.0.1.7/24", "fd00::1"}}
+	prefixes, err := cfg.AllowedPrefixes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.5/32"),
+		netip.MustParsePrefix("10.0.1.0/24"),
+		netip.MustParsePrefix("fd00::1/128"),
+	}
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("expected %v, got %v", expected, prefixes)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math"
 	"strings"
+
+	"github.com/AarC10/GSW-V2/lib/auth"
 )
 
 // Measurement represents a single measurement in a telemetry packet.
@@ -19,9 +21,16 @@ type Measurement struct {
 
 // TelemetryPacket represents information about a telemetry packet received over Ethernet.
 type TelemetryPacket struct {
-	Name         string   `yaml:"name"`         // Name of the telemetry packet
-	Port         int      `yaml:"port"`         // Port number for the telemetry packet
-	Measurements []string `yaml:"measurements"` // List of measurements in the telemetry packet
+	Name         string        `yaml:"name"`                 // Name of the telemetry packet
+	Port         int           `yaml:"port"`                 // Port number for the telemetry packet
+	Measurements []string      `yaml:"measurements"`         // List of measurements in the telemetry packet
+	VehicleID    string        `yaml:"vehicle_id,omitempty"` // Measurement holding the ID of the vehicle that sent the packet (optional)
+	Sequence     string        `yaml:"sequence,omitempty"`   // Measurement holding a counter identifying the copies of the packet when merging stations (optional)
+	UDP          *UDPConfig    `yaml:"udp,omitempty"`        // Overrides the global UDP ingest settings for this packet (optional)
+	TCP          *TCPConfig    `yaml:"tcp,omitempty"`        // Receive the packet over TCP instead of UDP (optional)
+	Serial       *SerialConfig `yaml:"serial,omitempty"`     // Receive the packet from a serial device instead of UDP (optional)
+	CCSDS        *CCSDSConfig  `yaml:"ccsds,omitempty"`      // Receive the packet as a CCSDS Space Packet, sharing its port with other APIDs (optional)
+	Auth         *auth.Config  `yaml:"auth,omitempty"`       // Drop packets without a valid HMAC tag appended to them (optional)
 }
 
 // InterpretUnsignedInteger interprets a byte slice as an unsigned integer.
@@ -0,0 +1,119 @@
+package tlm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// ValueRecordSize is the size in bytes of each value in a value record.
+// A value takes its kind, its quality flags, 6 reserved bytes, then its
+// int64, uint64 or float64 bits in little endian, so records have a fixed layout
+// that readers can decode without the packet's measurement definitions.
+// Measurements are only ever ints or floats, so values have no string form to hold.
+const ValueRecordSize = 16
+
+// Quality flags problems with a value in a value record. A value without flags is good.
+type Quality uint8
+
+const (
+	QualityInvalid   Quality = 1 << iota // Value could not be decoded
+	QualityNotFinite                     // Value is NaN or infinite
+)
+
+// Good returns whether no problems are flagged.
+func (q Quality) Good() bool {
+	return q == 0
+}
+
+// String returns the names of the flags set.
+func (q Quality) String() string {
+	switch q {
+	case 0:
+		return "good"
+	case QualityInvalid:
+		return "invalid"
+	case QualityNotFinite:
+		return "not finite"
+	}
+	return fmt.Sprintf("Quality(%#x)", uint8(q))
+}
+
+// ValueQuality returns the quality flags of a decoded value.
+func ValueQuality(v Value) Quality {
+	switch v.Kind {
+	case ValueInt, ValueUint:
+		return 0
+	case ValueFloat32, ValueFloat64:
+		if math.IsNaN(v.Float) || math.IsInf(v.Float, 0) {
+			return QualityNotFinite
+		}
+		return 0
+	}
+	return QualityInvalid
+}
+
+// ValueRecordLen returns the size in bytes of a record of n values.
+func ValueRecordLen(n int) int {
+	return n * ValueRecordSize
+}
+
+// EncodeValueRecord encodes values and their quality flags into dst, which must hold ValueRecordLen(len(values)) bytes.
+func EncodeValueRecord(dst []byte, values []Value) error {
+	if len(dst) < ValueRecordLen(len(values)) {
+		return fmt.Errorf("value record holds %d bytes, expected %d", len(dst), ValueRecordLen(len(values)))
+	}
+	for i, value := range values {
+		slot := dst[i*ValueRecordSize : (i+1)*ValueRecordSize]
+		clear(slot[:8])
+		slot[0] = byte(value.Kind)
+		slot[1] = byte(ValueQuality(value))
+
+		var bits uint64
+		switch value.Kind {
+		case ValueInt:
+			bits = uint64(value.Int)
+		case ValueUint:
+			bits = value.Uint
+		case ValueFloat32, ValueFloat64:
+			bits = math.Float64bits(value.Float)
+		}
+		binary.LittleEndian.PutUint64(slot[8:], bits)
+	}
+	return nil
+}
+
+// DecodeValueRecord decodes a value record into values and their quality flags,
+// which must hold at least one element for each value in the record.
+// Decode does not allocate unless it returns an error.
+func DecodeValueRecord(data []byte, values []Value, quality []Quality) error {
+	if len(data)%ValueRecordSize != 0 {
+		return fmt.Errorf("value record is %d bytes, expected a multiple of %d", len(data), ValueRecordSize)
+	}
+	n := len(data) / ValueRecordSize
+	if len(values) < n || len(quality) < n {
+		return fmt.Errorf("value slices hold %d values and %d flags, expected %d", len(values), len(quality), n)
+	}
+
+	for i := 0; i < n; i++ {
+		slot := data[i*ValueRecordSize : (i+1)*ValueRecordSize]
+		bits := binary.LittleEndian.Uint64(slot[8:])
+		value := Value{Kind: ValueKind(slot[0])}
+		switch value.Kind {
+		case ValueInt:
+			value.Int = int64(bits)
+		case ValueUint:
+			value.Uint = bits
+		case ValueFloat32, ValueFloat64:
+			value.Float = math.Float64frombits(bits)
+		default:
+			value.Kind = ValueInvalid
+		}
+		values[i] = value
+		quality[i] = Quality(slot[1])
+		if value.Kind == ValueInvalid {
+			quality[i] |= QualityInvalid
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package tlm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValueRecord(t *testing.T) {
+	decoder, err := NewDecoder(decoderTestPacket, decoderTestMeasurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	values := decoder.NewValues()
+	if err := decoder.Decode(decoderTestData, values); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	record := make([]byte, ValueRecordLen(len(values)))
+	if err := EncodeValueRecord(record, values); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decoded := make([]Value, len(values))
+	quality := make([]Quality, len(values))
+	if err := DecodeValueRecord(record, decoded, quality); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range values {
+		if decoded[i] != values[i] {
+			t.Errorf("%s: expected %+v, got %+v", decoderTestPacket.Measurements[i], values[i], decoded[i])
+		}
+		if !quality[i].Good() {
+			t.Errorf("%s: expected good, got %v", decoderTestPacket.Measurements[i], quality[i])
+		}
+	}
+}
+
+func TestValueRecordQuality(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    Value
+		expected Quality
+	}{
+		{"int", IntValue(-1), 0},
+		{"float", FloatValue(1.5), 0},
+		{"NaN", FloatValue(math.NaN()), QualityNotFinite},
+		{"infinity", Value{Kind: ValueFloat32, Float: math.Inf(-1)}, QualityNotFinite},
+		{"not decoded", Value{}, QualityInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := make([]byte, ValueRecordSize)
+			if err := EncodeValueRecord(record, []Value{tt.value}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			values := make([]Value, 1)
+			quality := make([]Quality, 1)
+			if err := DecodeValueRecord(record, values, quality); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if quality[0] != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, quality[0])
+			}
+			if values[0].Kind != tt.value.Kind {
+				t.Errorf("expected kind %d, got %d", tt.value.Kind, values[0].Kind)
+			}
+		})
+	}
+}
+
+func TestValueRecordErrors(t *testing.T) {
+	values := make([]Value, 2)
+	quality := make([]Quality, 2)
+	if err := EncodeValueRecord(make([]byte, ValueRecordSize), values); err == nil {
+		t.Errorf("expected an error for a short record, got nil")
+	}
+	if err := DecodeValueRecord(make([]byte, ValueRecordSize+1), values, quality); err == nil {
+		t.Errorf("expected an error for a partial value, got nil")
+	}
+	if err := DecodeValueRecord(make([]byte, 3*ValueRecordSize), values, quality); err == nil {
+		t.Errorf("expected an error for short value slices, got nil")
+	}
+
+	// an unknown kind, such as from a newer writer, is flagged instead of misread
+	record := make([]byte, ValueRecordSize)
+	record[0] = 0xFF
+	if err := DecodeValueRecord(record, values, quality); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if values[0].Kind != ValueInvalid || quality[0] != QualityInvalid {
+		t.Errorf("expected an invalid value, got %+v (%v)", values[0], quality[0])
+	}
+}
@@ -0,0 +1,39 @@
+package tlm
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+)
+
+// vehicleNamePattern limits vehicle and station names to characters that are safe in file names, topics and database tags
+var vehicleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Vehicle is one of several vehicles sending the same telemetry packets.
+// Packets are attributed to a vehicle by the value of the packet's vehicle_id measurement,
+// or by the address they were sent from when the packet has no vehicle_id.
+type Vehicle struct {
+	Name    string   `yaml:"name"`              // Name of the vehicle, used to tag its data
+	ID      *uint64  `yaml:"id,omitempty"`      // Value of the vehicle_id measurement in packets sent by the vehicle
+	Sources []string `yaml:"sources,omitempty"` // Addresses or subnets the vehicle sends from (e.g. 10.0.0.5, 10.0.1.0/24)
+}
+
+// Validate checks that the vehicle name is usable and its sources are well formed.
+func (v Vehicle) Validate() error {
+	if !vehicleNamePattern.MatchString(v.Name) {
+		return fmt.Errorf("vehicle name %q must only contain letters, digits, '-' and '_'", v.Name)
+	}
+	if _, err := v.SourcePrefixes(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SourcePrefixes parses the vehicle's sources. Plain addresses match only themselves.
+func (v Vehicle) SourcePrefixes() ([]netip.Prefix, error) {
+	prefixes, err := parsePrefixes(v.Sources)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source for vehicle %s: %w", v.Name, err)
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,30 @@
+package tlm
+
+import "testing"
+
+func TestVehicleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		vehicle Vehicle
+		wantErr bool
+	}{
+		{"name only", Vehicle{Name: "alpha"}, false},
+		{"sources", Vehicle{Name: "Bravo_2-b", Sources: []string{"10.0.0.5", "10.0.1.0/24"}}, false},
+		{"empty name", Vehicle{}, true},
+		{"name with slash", Vehicle{Name: "a/b"}, true},
+		{"name with space", Vehicle{Name: "a b"}, true},
+		{"bad source", Vehicle{Name: "alpha", Sources: []string{"10.0.0"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.vehicle.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package proc
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/archive"
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"go.uber.org/zap"
+)
+
+// archiveFlushInterval is how often buffered archive records are written to disk.
+const archiveFlushInterval = time.Second
+
+var archiveQueue atomic.Pointer[chan archive.Record] // Channel read by the archive writer, if there is one
+var archiveErrors atomic.Uint64                      // Records that couldn't be written to the archive
+
+// archivingHandler archives every datagram or frame received for a port before passing it on.
+type archivingHandler struct {
+	packetHandler
+	port uint16
+}
+
+func (h archivingHandler) handle(data []byte, source netip.Addr) {
+	if queue := archiveQueue.Load(); queue != nil {
+		record := archive.Record{Time: time.Now(), Port: h.port, Source: source.Unmap(), Data: bytes.Clone(data)}
+		select {
+		case *queue <- record:
+		default:
+			h.ingestCounters().archiveDrops.Add(1)
+		}
+	}
+	h.packetHandler.handle(data, source)
+}
+
+// ArchiveWriter writes the raw datagrams received by packet writers to the archive until ctx is done.
+// Received datagrams are dropped and counted when the queue is full. The writer is closed on return.
+func ArchiveWriter(ctx context.Context, writer *archive.Writer, queue chan archive.Record) {
+	log := logger.Log().Named("archive")
+	archiveQueue.Store(&queue)
+	defer archiveQueue.Store(nil)
+	defer func() {
+		if err := writer.Close(); err != nil {
+			log.Error("couldn't close archive", zap.Error(err))
+		}
+	}()
+
+	ticker := time.NewTicker(archiveFlushInterval)
+	defer ticker.Stop()
+
+	write := func(record archive.Record) {
+		if err := writer.Write(record); err != nil {
+			// later errors are only counted, as they usually share a cause such as a full disk
+			if archiveErrors.Add(1) == 1 {
+				log.Error("couldn't write to archive", zap.Error(err))
+			}
+		}
+	}
+
+	log.Info("Started archive writer")
+	for {
+		select {
+		case <-ctx.Done():
+			// archive what was received before shutting down
+			for {
+				select {
+				case record := <-queue:
+					write(record)
+				default:
+					log.Info("archive writer shutting down")
+					return
+				}
+			}
+		case record := <-queue:
+			write(record)
+		case <-ticker.C:
+			if err := writer.Flush(); err != nil {
+				log.Error("couldn't flush archive", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package proc
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/archive"
+)
+
+// startArchiveWriter runs ArchiveWriter on a new archive and returns a function stopping it.
+func startArchiveWriter(test *testing.T, dir string) func() {
+	test.Helper()
+	writer, err := archive.NewWriter(archive.Config{Dir: dir})
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ArchiveWriter(ctx, writer, make(chan archive.Record, 16))
+	}()
+	for archiveQueue.Load() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	stop := func() {
+		cancel()
+		<-done
+	}
+	test.Cleanup(stop)
+	return stop
+}
+
+func TestArchiveWriter(test *testing.T) {
+	test.Cleanup(resetState)
+	dir := test.TempDir()
+	stop := startArchiveWriter(test, dir)
+
+	packet := vehicleTestPacket(test, 1)
+	readers, _ := startVehiclePacketWriter(test, packet)
+
+	// every datagram is archived, including those with the wrong size
+	datagrams := [][]byte{{1, 2, 3}, {0, 0, 0, 1}}
+	for _, data := range datagrams {
+		sendUDPPacket(test, "127.0.0.3", packet.Port, data)
+	}
+	expectShmPacket(test, readers["bravo"], datagrams[1])
+	stop()
+
+	var records []archive.Record
+	err := archive.Read(dir, archive.Filter{Ports: []uint16{uint16(packet.Port)}}, func(record archive.Record) error {
+		record.Data = bytes.Clone(record.Data)
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	if len(records) != len(datagrams) {
+		test.Fatalf("Expected %d records, got %d", len(datagrams), len(records))
+	}
+	for i, record := range records {
+		if !bytes.Equal(record.Data, datagrams[i]) || record.Source != netip.MustParseAddr("127.0.0.3") {
+			test.Errorf("Expected % X from 127.0.0.3, got % X from %s", datagrams[i], record.Data, record.Source)
+		}
+		if time.Since(record.Time) > time.Minute {
+			test.Errorf("Expected a recent receive time, got %s", record.Time)
+		}
+	}
+}
+
+func TestArchiveDrops(test *testing.T) {
+	test.Cleanup(resetState)
+	queue := make(chan archive.Record, 1)
+	archiveQueue.Store(&queue)
+	defer archiveQueue.Store(nil)
+
+	counters := countersForPacket("ArchiveDrops")
+	handler := archivingHandler{packetHandler: &recordingPacketHandler{counters: counters}, port: 10000}
+	for i := 0; i < 3; i++ {
+		handler.handle([]byte{byte(i)}, netip.Addr{})
+	}
+
+	if counters.archiveDrops.Load() != 2 {
+		test.Errorf("Expected 2 drops, got %d", counters.archiveDrops.Load())
+	}
+	if record := <-queue; record.Port != 10000 || !bytes.Equal(record.Data, []byte{0}) {
+		test.Errorf("Expected the first datagram on port 10000, got %+v", record)
+	}
+	if handled := handler.packetHandler.(*recordingPacketHandler).handled; handled != 3 {
+		test.Errorf("Expected every datagram to be handled, got %d", handled)
+	}
+}
+
+// recordingPacketHandler counts the packets it handles.
+type recordingPacketHandler struct {
+	counters *packetCounters
+	handled  int
+}
+
+func (h *recordingPacketHandler) handle([]byte, netip.Addr) {
+	h.handled++
+}
+
+func (h *recordingPacketHandler) frameSize() int {
+	return 0
+}
+
+func (h *recordingPacketHandler) ingestCounters() *packetCounters {
+	return h.counters
+}
@@ -0,0 +1,139 @@
+package proc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/capture"
+	"github.com/AarC10/GSW-V2/lib/ccsds"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+// DecodedPacket is a telemetry packet decoded from a capture.
+type DecodedPacket struct {
+	Time    time.Time           // Time the packet was captured
+	Packet  tlm.TelemetryPacket // Telemetry packet the datagram was decoded as
+	Vehicle string              // Vehicle that sent the packet. Empty if the packet isn't attributed to a vehicle
+	Values  []tlm.Value         // Engineering values of the packet's measurements, valid until the next call to Decode
+}
+
+// CaptureStats counts the datagrams of a capture by outcome.
+type CaptureStats struct {
+	Decoded      map[string]uint64 // Packet name -> datagrams decoded
+	WrongSize    map[string]uint64 // Packet name -> datagrams with the wrong size, ccsds-<port> for invalid CCSDS packets
+	Unroutable   map[string]uint64 // ccsds-<port> -> CCSDS packets with an unknown APID or segmented user data
+	UnknownPorts map[uint16]uint64 // Destination port -> datagrams sent to a port without telemetry packets
+}
+
+// captureRoute decodes the datagrams of a telemetry packet.
+type captureRoute struct {
+	packet  tlm.TelemetryPacket
+	decoder *tlm.Decoder
+	values  []tlm.Value
+	vehicle *vehicleRouter
+	tagSize int // Size of the authentication tag, stripped without being verified since the key may not be available offline
+}
+
+// capturePort holds the telemetry packets received on a port.
+type capturePort struct {
+	name   string                   // Name CCSDS packets that can't be routed are counted under
+	single *captureRoute            // The packet on the port, if it isn't shared by CCSDS packets
+	apids  map[uint16]*captureRoute // APID -> packet, for CCSDS packets
+}
+
+// CaptureDecoder decodes the UDP datagrams of a capture as the telemetry packets of the global configuration,
+// the same way TelemetryPacketWriter and CCSDSPacketWriter would have received them.
+type CaptureDecoder struct {
+	ports map[uint16]*capturePort
+	Stats CaptureStats
+}
+
+// NewCaptureDecoder creates a CaptureDecoder for the packets in the global configuration.
+func NewCaptureDecoder() (*CaptureDecoder, error) {
+	d := &CaptureDecoder{
+		ports: make(map[uint16]*capturePort),
+		Stats: CaptureStats{
+			Decoded:      make(map[string]uint64),
+			WrongSize:    make(map[string]uint64),
+			Unroutable:   make(map[string]uint64),
+			UnknownPorts: make(map[uint16]uint64),
+		},
+	}
+
+	for _, packet := range GswConfig.TelemetryPackets {
+		decoder, err := NewPacketDecoder(packet)
+		if err != nil {
+			return nil, fmt.Errorf("creating decoder for %s: %w", packet.Name, err)
+		}
+		router, err := newVehicleRouter(packet)
+		if err != nil {
+			return nil, fmt.Errorf("creating vehicle router for %s: %w", packet.Name, err)
+		}
+		route := &captureRoute{packet: packet, decoder: decoder, values: decoder.NewValues(), vehicle: router}
+		if packet.Auth != nil {
+			route.tagSize = packet.Auth.TagSizeOrDefault()
+		}
+
+		port, ok := d.ports[uint16(packet.Port)]
+		if !ok {
+			port = &capturePort{name: packet.Name}
+			d.ports[uint16(packet.Port)] = port
+		}
+		if packet.CCSDS == nil {
+			port.single = route
+			continue
+		}
+		if port.apids == nil {
+			port.name = ccsdsPortName(packet.Port)
+			port.apids = make(map[uint16]*captureRoute)
+		}
+		port.apids[uint16(packet.CCSDS.APID)] = route
+	}
+	return d, nil
+}
+
+// Decode decodes a datagram, returning false if it isn't a valid telemetry packet.
+// Every datagram is counted in Stats.
+func (d *CaptureDecoder) Decode(datagram capture.Datagram) (DecodedPacket, bool) {
+	port, ok := d.ports[datagram.Destination.Port()]
+	if !ok {
+		d.Stats.UnknownPorts[datagram.Destination.Port()]++
+		return DecodedPacket{}, false
+	}
+
+	route, data := port.single, datagram.Payload
+	if port.apids != nil {
+		header, err := ccsds.ParsePrimaryHeader(data)
+		if err != nil || header.PacketSize() != len(data) {
+			d.Stats.WrongSize[port.name]++
+			return DecodedPacket{}, false
+		}
+		if header.APID == ccsds.IdleAPID {
+			return DecodedPacket{}, false
+		}
+		route = port.apids[header.APID]
+		if route == nil || header.SequenceFlags != ccsds.SequenceUnsegmented {
+			d.Stats.Unroutable[port.name]++
+			return DecodedPacket{}, false
+		}
+		data = data[ccsds.PrimaryHeaderSize:]
+	}
+
+	name := route.packet.Name
+	if len(data) != route.decoder.Size()+route.tagSize {
+		d.Stats.WrongSize[name]++
+		return DecodedPacket{}, false
+	}
+	data = data[:route.decoder.Size()]
+	if err := route.decoder.Decode(data, route.values); err != nil {
+		d.Stats.WrongSize[name]++
+		return DecodedPacket{}, false
+	}
+	d.Stats.Decoded[name]++
+
+	decoded := DecodedPacket{Time: datagram.Time, Packet: route.packet, Values: route.values}
+	if vehicle := route.vehicle.route(data, datagram.Source.Addr()); vehicle >= 0 {
+		decoded.Vehicle = GswConfig.Vehicles[vehicle].Name
+	}
+	return decoded, true
+}
@@ -0,0 +1,102 @@
+package proc
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/capture"
+)
+
+// captureDatagram builds a captured datagram sent from source to a local port.
+func captureDatagram(source string, port uint16, payload []byte) capture.Datagram {
+	return capture.Datagram{
+		Time:        time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC),
+		Source:      netip.AddrPortFrom(netip.MustParseAddr(source), 40000),
+		Destination: netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), port),
+		Payload:     payload,
+	}
+}
+
+func TestCaptureDecoder(test *testing.T) {
+	test.Cleanup(resetState)
+	if _, err := ParseConfig(TestDataDir + "vehicles.yaml"); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	decoder, err := NewCaptureDecoder()
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		datagram capture.Datagram
+		packet   string
+		vehicle  string
+		values   []string
+	}{
+		{"by id", captureDatagram("10.0.0.1", 10000, []byte{2, 0, 0, 0, 20}), "ById", "bravo", []string{"2", "20"}},
+		{"by source", captureDatagram("127.0.0.2", 10001, []byte{0, 0, 1, 0}), "BySource", "alpha", []string{"256"}},
+		{"unattributed", captureDatagram("10.0.0.1", 10001, []byte{0xFF, 0xFF, 0xFF, 0xFF}), "BySource", "", []string{"-1"}},
+		{"wrong size", captureDatagram("10.0.0.1", 10000, []byte{1, 0}), "", "", nil},
+		{"unknown port", captureDatagram("10.0.0.1", 9999, []byte{1}), "", "", nil},
+	}
+
+	for _, tt := range tests {
+		decoded, ok := decoder.Decode(tt.datagram)
+		if ok != (tt.packet != "") {
+			test.Fatalf("%s: Expected decoded %t, got %t", tt.name, tt.packet != "", ok)
+		}
+		if !ok {
+			continue
+		}
+		if decoded.Packet.Name != tt.packet || decoded.Vehicle != tt.vehicle || !decoded.Time.Equal(tt.datagram.Time) {
+			test.Errorf("%s: Expected %s from %q, got %s from %q at %s", tt.name, tt.packet, tt.vehicle, decoded.Packet.Name, decoded.Vehicle, decoded.Time)
+		}
+		if len(decoded.Values) != len(tt.values) {
+			test.Fatalf("%s: Expected %d values, got %d", tt.name, len(tt.values), len(decoded.Values))
+		}
+		for i, value := range decoded.Values {
+			if value.String() != tt.values[i] {
+				test.Errorf("%s: Expected %s, got %s", tt.name, tt.values[i], value.String())
+			}
+		}
+	}
+
+	stats := decoder.Stats
+	if stats.Decoded["ById"] != 1 || stats.Decoded["BySource"] != 2 || stats.WrongSize["ById"] != 1 || stats.UnknownPorts[9999] != 1 {
+		test.Errorf("Expected 1 ById, 2 BySource, 1 wrong size and 1 unknown port, got %+v", stats)
+	}
+}
+
+func TestCaptureDecoderCCSDS(test *testing.T) {
+	test.Cleanup(resetState)
+	if _, err := ParseConfig(TestDataDir + "ccsds.yaml"); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	decoder, err := NewCaptureDecoder()
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	decoded, ok := decoder.Decode(captureDatagram("10.0.0.1", 10000, spacePacket(101, 0, []byte{7})))
+	if !ok || decoded.Packet.Name != "Health" || decoded.Values[0].String() != "7" {
+		test.Fatalf("Expected Health with status 7, got %+v", decoded)
+	}
+
+	for _, payload := range [][]byte{
+		spacePacket(200, 0, []byte{7}),
+		append(spacePacket(101, 1, []byte{7}), 0),
+		spacePacket(100, 0, []byte{7}),
+	} {
+		if _, ok := decoder.Decode(captureDatagram("10.0.0.1", 10000, payload)); ok {
+			test.Errorf("Expected % X not to be decoded", payload)
+		}
+	}
+
+	portName := ccsdsPortName(10000)
+	stats := decoder.Stats
+	if stats.Decoded["Health"] != 1 || stats.Unroutable[portName] != 1 || stats.WrongSize[portName] != 1 || stats.WrongSize["Navigation"] != 1 {
+		test.Errorf("Expected 1 decoded, 1 unroutable and 2 wrong size, got %+v", stats)
+	}
+}
@@ -0,0 +1,210 @@
+package proc
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/ccsds"
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"go.uber.org/zap"
+)
+
+// ccsdsPortName names the counters of a port shared by CCSDS packets.
+// Packets that can't be attributed to an APID are counted there.
+func ccsdsPortName(port int) string {
+	return fmt.Sprintf("ccsds-%d", port)
+}
+
+// ccsdsRoute is the destination of an APID.
+type ccsdsRoute struct {
+	sink     *packetSink
+	sequence ccsds.SequenceTracker
+}
+
+// ccsdsDemux validates the primary header of received Space Packets and routes them to their packet's sink by APID.
+// The primary header is stripped, so sinks receive the packet data field.
+// It is safe for concurrent use by multiple connections.
+type ccsdsDemux struct {
+	log      *zap.Logger
+	port     uint16
+	counters *packetCounters // Counters of the port
+	routes   map[uint16]*ccsdsRoute
+	maxSize  int
+
+	mu     sync.Mutex
+	logged map[uint16]bool // APIDs that have been logged as unroutable
+}
+
+func (d *ccsdsDemux) handle(data []byte, source netip.Addr) {
+	header, err := ccsds.ParsePrimaryHeader(data)
+	if err != nil {
+		d.counters.wrongSize.Add(1)
+		d.log.Error("received invalid CCSDS packet", zap.Error(err))
+		return
+	}
+	if header.PacketSize() != len(data) {
+		d.counters.wrongSize.Add(1)
+		d.log.Error("received CCSDS packet with incorrect length", zap.Uint16("apid", header.APID),
+			zap.Int("declared", header.PacketSize()), zap.Int("received", len(data)))
+		return
+	}
+	if header.APID == ccsds.IdleAPID {
+		return
+	}
+
+	route, ok := d.routes[header.APID]
+	if !ok || header.SequenceFlags != ccsds.SequenceUnsegmented {
+		d.counters.unroutable.Add(1)
+		d.mu.Lock()
+		if !d.logged[header.APID] {
+			d.logged[header.APID] = true
+			d.log.Warn("received CCSDS packet with an unknown APID or segmented user data",
+				zap.Uint16("apid", header.APID), zap.Uint8("sequenceFlags", header.SequenceFlags))
+		}
+		d.mu.Unlock()
+		return
+	}
+
+	if !route.sink.validSize(data[ccsds.PrimaryHeaderSize:]) {
+		return
+	}
+	authenticated, ok := route.sink.authenticate(data)
+	if !ok {
+		return
+	}
+	packetData := authenticated[ccsds.PrimaryHeaderSize:]
+	// copies delivered by several stations are identified by their vehicle and sequence count, before it's tracked
+	vehicle := route.sink.route(packetData, source)
+	station := ""
+	if merger := route.sink.merger; merger != nil {
+		var first bool
+		if station, first = merger.accept(vehicle, uint64(header.SequenceCount), source, time.Now()); !first {
+			return
+		}
+	}
+
+	d.mu.Lock()
+	lost := route.sequence.Next(header.SequenceCount)
+	d.mu.Unlock()
+	if lost > 0 {
+		route.sink.counters.sequenceLost.Add(uint64(lost))
+	}
+
+	forwardPacket(d.port, data, source)
+	route.sink.publish(packetData, vehicle, station)
+}
+
+func (d *ccsdsDemux) frameSize() int {
+	return d.maxSize
+}
+
+func (d *ccsdsDemux) ingestCounters() *packetCounters {
+	return d.counters
+}
+
+// CCSDSPacketWriter receives CCSDS Space Packets on the port shared by packets and writes each to its packet's shared memory.
+// Packets are routed by APID, and outChannels holds the output channel of each packet.
+// The source settings (UDP, TCP or serial) are taken from the first packet.
+func CCSDSPacketWriter(ctx context.Context, packets []tlm.TelemetryPacket, outChannels []chan ReceivedPacket, shmDir string) error {
+	port := packets[0].Port
+	name := ccsdsPortName(port)
+	log := logger.Log().Named("decom").With(zap.String("packet", name))
+
+	demux := &ccsdsDemux{
+		log:      log,
+		port:     uint16(port),
+		counters: countersForPacket(name),
+		routes:   make(map[uint16]*ccsdsRoute, len(packets)),
+		logged:   make(map[uint16]bool),
+	}
+	for i, packet := range packets {
+		packetLog := logger.Log().Named("decom").With(zap.String("packet", packet.Name))
+		sink, err := newPacketSink(packetLog, packet, outChannels[i], shmDir)
+		if err != nil {
+			return fmt.Errorf("creating shared memory writer for %s: %w", packet.Name, err)
+		}
+		defer sink.cleanup()
+
+		demux.routes[uint16(packet.CCSDS.APID)] = &ccsdsRoute{sink: sink}
+		demux.maxSize = max(demux.maxSize, ccsds.PrimaryHeaderSize+sink.frameSize())
+		packetLog.Info(fmt.Sprintf("Packet size: %d bytes %d bits", sink.packetSize, sink.packetSize*8), zap.Int("apid", packet.CCSDS.APID))
+	}
+
+	source := packets[0]
+	source.Name = name
+	return receivePackets(ctx, log, source, demux)
+}
+
+// ReceiverGroups returns the telemetry packets grouped by receiver, in config order.
+// CCSDS packets sharing a port are grouped together, and every other packet has its own receiver.
+func ReceiverGroups() [][]tlm.TelemetryPacket {
+	var groups [][]tlm.TelemetryPacket
+	ccsdsGroups := make(map[int]int) // Port -> index of the group
+	for _, packet := range GswConfig.TelemetryPackets {
+		if packet.CCSDS == nil {
+			groups = append(groups, []tlm.TelemetryPacket{packet})
+			continue
+		}
+		if i, ok := ccsdsGroups[packet.Port]; ok {
+			groups[i] = append(groups[i], packet)
+			continue
+		}
+		ccsdsGroups[packet.Port] = len(groups)
+		groups = append(groups, []tlm.TelemetryPacket{packet})
+	}
+	return groups
+}
+
+// validateCCSDS checks the CCSDS settings of each packet and that packets sharing a port can be routed by APID.
+func validateCCSDS(config *Configuration) error {
+	ports := make(map[int]tlm.TelemetryPacket) // Port -> first packet received on it
+	apids := make(map[int]map[int]string)      // Port -> APID -> packet name
+	for _, packet := range config.TelemetryPackets {
+		first, shared := ports[packet.Port]
+		if !shared {
+			ports[packet.Port] = packet
+			apids[packet.Port] = make(map[int]string)
+		}
+		if packet.CCSDS == nil {
+			if shared && first.CCSDS != nil {
+				return fmt.Errorf("packet %s shares port %d with CCSDS packet %s, but has no ccsds section", packet.Name, packet.Port, first.Name)
+			}
+			continue
+		}
+		if shared && first.CCSDS == nil {
+			return fmt.Errorf("CCSDS packet %s shares port %d with packet %s, which has no ccsds section", packet.Name, packet.Port, first.Name)
+		}
+
+		if err := packet.CCSDS.Validate(); err != nil {
+			return fmt.Errorf("invalid ccsds for packet %s: %w", packet.Name, err)
+		}
+		if other, ok := apids[packet.Port][packet.CCSDS.APID]; ok {
+			return fmt.Errorf("packets %s and %s on port %d have the same apid %d", other, packet.Name, packet.Port, packet.CCSDS.APID)
+		}
+		apids[packet.Port][packet.CCSDS.APID] = packet.Name
+
+		size := 0
+		for _, name := range packet.Measurements {
+			size += config.Measurements[name].Size
+		}
+		if size < 1 || size > ccsds.MaxDataSize {
+			return fmt.Errorf("CCSDS packet %s data field is %d bytes, instead of 1-%d", packet.Name, size, ccsds.MaxDataSize)
+		}
+		if packet.CCSDS.TimeCode != nil {
+			cuc, _ := packet.CCSDS.TimeCode.CUC()
+			if size < cuc.Size() {
+				return fmt.Errorf("CCSDS packet %s data field is %d bytes, smaller than its %d byte time code", packet.Name, size, cuc.Size())
+			}
+		}
+
+		if shared && (!reflect.DeepEqual(first.UDP, packet.UDP) || !reflect.DeepEqual(first.TCP, packet.TCP) || !reflect.DeepEqual(first.Serial, packet.Serial)) {
+			return fmt.Errorf("CCSDS packets %s and %s share port %d, but have different udp, tcp or serial settings", first.Name, packet.Name, packet.Port)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package proc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/auth"
+	"github.com/AarC10/GSW-V2/lib/ccsds"
+	"github.com/AarC10/GSW-V2/lib/db"
+	"github.com/AarC10/GSW-V2/lib/framing"
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+const ccsdsTestConfig = `
+name: ccsds_test
+measurements:
+  Seconds:
+    name: Seconds
+    size: 4
+    type: int
+  Status:
+    name: Status
+    size: 1
+    type: int
+`
+
+func TestParseCCSDSConfig(test *testing.T) {
+	test.Cleanup(resetState)
+	config, err := ParseConfig(TestDataDir + "ccsds.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	navigation := config.TelemetryPackets[0]
+	if navigation.CCSDS == nil || navigation.CCSDS.APID != 100 {
+		test.Fatalf("Expected apid 100, got %+v", navigation.CCSDS)
+	}
+	cuc, err := navigation.CCSDS.TimeCode.CUC()
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	if cuc.CoarseSize != 4 || cuc.FineSize != 2 || !cuc.Epoch.Equal(time.Unix(0, 0)) {
+		test.Errorf("Expected 4+2 byte time code from the Unix epoch, got %+v", cuc)
+	}
+	if health := config.TelemetryPackets[1]; health.CCSDS == nil || health.CCSDS.APID != 101 || health.CCSDS.TimeCode != nil {
+		test.Errorf("Expected apid 101 without a time code, got %+v", health.CCSDS)
+	}
+}
+
+func TestBadCCSDSConfig(test *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"apid out of range", "telemetry_packets:\n  - name: A\n    port: 10000\n    ccsds: {apid: 2047}\n    measurements: [Status]\n"},
+		{"duplicate apid", "telemetry_packets:\n  - name: A\n    port: 10000\n    ccsds: {apid: 1}\n    measurements: [Status]\n  - name: B\n    port: 10000\n    ccsds: {apid: 1}\n    measurements: [Status]\n"},
+		{"shared with plain packet", "telemetry_packets:\n  - name: A\n    port: 10000\n    ccsds: {apid: 1}\n    measurements: [Status]\n  - name: B\n    port: 10000\n    measurements: [Status]\n"},
+		{"plain packet first", "telemetry_packets:\n  - name: A\n    port: 10000\n    measurements: [Status]\n  - name: B\n    port: 10000\n    ccsds: {apid: 1}\n    measurements: [Status]\n"},
+		{"different sources", "telemetry_packets:\n  - name: A\n    port: 10000\n    ccsds: {apid: 1}\n    measurements: [Status]\n  - name: B\n    port: 10000\n    ccsds: {apid: 2}\n    tcp: {}\n    measurements: [Status]\n"},
+		{"data smaller than time code", "telemetry_packets:\n  - name: A\n    port: 10000\n    ccsds: {apid: 1, time_code: {}}\n    measurements: [Status]\n"},
+		{"bad time code", "telemetry_packets:\n  - name: A\n    port: 10000\n    ccsds: {apid: 1, time_code: {coarse_size: 5}}\n    measurements: [Seconds, Seconds]\n"},
+	}
+
+	for _, tt := range tests {
+		test.Run(tt.name, func(test *testing.T) {
+			test.Cleanup(resetState)
+			if _, err := ParseConfigBytes([]byte(ccsdsTestConfig + tt.config)); err == nil {
+				test.Errorf("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestReceiverGroups(test *testing.T) {
+	test.Cleanup(resetState)
+	config := ccsdsTestConfig + `telemetry_packets:
+  - name: A
+    port: 10000
+    ccsds: {apid: 1}
+    measurements: [Status]
+  - name: B
+    port: 10001
+    measurements: [Status]
+  - name: C
+    port: 10000
+    ccsds: {apid: 2}
+    measurements: [Status]
+`
+	if _, err := ParseConfigBytes([]byte(config)); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	groups := ReceiverGroups()
+	expected := [][]string{{"A", "C"}, {"B"}}
+	if len(groups) != len(expected) {
+		test.Fatalf("Expected %d groups, got %d", len(expected), len(groups))
+	}
+	for i, group := range groups {
+		if len(group) != len(expected[i]) {
+			test.Fatalf("Expected group %v, got %d packets", expected[i], len(group))
+		}
+		for j, packet := range group {
+			if packet.Name != expected[i][j] {
+				test.Errorf("Expected %s, got %s", expected[i][j], packet.Name)
+			}
+		}
+	}
+}
+
+// ccsdsTestPackets loads the packets of ccsds.yaml onto a free port.
+func ccsdsTestPackets(test *testing.T) []tlm.TelemetryPacket {
+	test.Helper()
+	config, err := ParseConfig(TestDataDir + "ccsds.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	port := freePort(test)
+	packets := append([]tlm.TelemetryPacket(nil), config.TelemetryPackets...)
+	for i := range packets {
+		packets[i].Port = port
+	}
+	return packets
+}
+
+// startCCSDSPacketWriter runs CCSDSPacketWriter and returns a shared memory reader and output for each packet.
+func startCCSDSPacketWriter(test *testing.T, packets []tlm.TelemetryPacket) ([]ipc.Reader, []chan ReceivedPacket) {
+	test.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	outs := make([]chan ReceivedPacket, len(packets))
+	for i := range outs {
+		outs[i] = make(chan ReceivedPacket, 16)
+	}
+	errs := make(chan error, 1)
+	shmDir := test.TempDir()
+	go func() {
+		errs <- CCSDSPacketWriter(ctx, packets, outs, shmDir)
+	}()
+	test.Cleanup(func() {
+		cancel()
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			test.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	readers := make([]ipc.Reader, len(packets))
+	for i, packet := range packets {
+		readers[i] = waitShmReader(test, packet, shmDir)
+	}
+	return readers, outs
+}
+
+// spacePacket builds an unsegmented telemetry Space Packet.
+func spacePacket(apid uint16, count uint16, data []byte) []byte {
+	header := ccsds.PrimaryHeader{
+		APID:          apid,
+		SequenceFlags: ccsds.SequenceUnsegmented,
+		SequenceCount: count,
+		DataLength:    uint16(len(data) - 1),
+	}
+	return append(header.Append(nil), data...)
+}
+
+// waitIngestStats waits until the stats of a packet satisfy done.
+func waitIngestStats(test *testing.T, name string, done func(PacketStats) bool) PacketStats {
+	test.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := IngestStats()[name]
+		if done(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			test.Fatalf("Timed out waiting for stats of %s, got %+v", name, stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCCSDSRouting(test *testing.T) {
+	test.Cleanup(resetState)
+	packets := ccsdsTestPackets(test)
+	readers, outs := startCCSDSPacketWriter(test, packets)
+	port := packets[0].Port
+	waitUDPListening(test, port)
+
+	navigation := []byte{0, 0, 0, 10, 0x80, 0, 0, 0, 1, 0}
+	health := []byte{7}
+	sendUDPPacket(test, "127.0.0.1", port, spacePacket(100, 0, navigation))
+	expectShmPacket(test, readers[0], navigation)
+	expectReceived(test, outs[0], "", navigation)
+
+	sendUDPPacket(test, "127.0.0.1", port, spacePacket(101, 5, health))
+	expectShmPacket(test, readers[1], health)
+	expectReceived(test, outs[1], "", health)
+
+	// idle packets, unknown APIDs and packets whose length doesn't match are not routed
+	sendUDPPacket(test, "127.0.0.1", port, spacePacket(ccsds.IdleAPID, 0, []byte{0xFF}))
+	sendUDPPacket(test, "127.0.0.1", port, spacePacket(200, 0, health))
+	sendUDPPacket(test, "127.0.0.1", port, append(spacePacket(101, 6, health), 0))
+	sendUDPPacket(test, "127.0.0.1", port, []byte{0x08, 0x64, 0xC0})
+	waitIngestStats(test, ccsdsPortName(port), func(stats PacketStats) bool {
+		return stats.Unroutable == 1 && stats.WrongSize == 2
+	})
+
+	// gaps in the sequence count of an APID are counted as lost
+	sendUDPPacket(test, "127.0.0.1", port, spacePacket(101, 9, health))
+	expectShmPacket(test, readers[1], health)
+	waitIngestStats(test, packets[1].Name, func(stats PacketStats) bool {
+		return stats.Received == 2 && stats.SequenceLost == 3
+	})
+	if stats := IngestStats()[packets[0].Name]; stats.SequenceLost != 0 || stats.Received != 1 {
+		test.Errorf("Expected 1 received and none lost, got %+v", stats)
+	}
+	if len(outs[0]) != 0 {
+		test.Errorf("Expected no more %s packets, got %d", packets[0].Name, len(outs[0]))
+	}
+}
+
+func TestCCSDSTCP(test *testing.T) {
+	test.Cleanup(resetState)
+	packets := ccsdsTestPackets(test)
+	for i := range packets {
+		packets[i].TCP = &tlm.TCPConfig{Framing: framing.Config{Type: framing.TypeCCSDS}}
+	}
+	readers, _ := startCCSDSPacketWriter(test, packets)
+
+	conn := dialRetry(test, net.JoinHostPort("127.0.0.1", strconv.Itoa(packets[0].Port)))
+	defer conn.Close()
+
+	navigation := []byte{0, 0, 0, 10, 0x80, 0, 0, 0, 1, 0}
+	health := []byte{7}
+	stream := append(spacePacket(101, 0, health), spacePacket(100, 0, navigation)...)
+	if _, err := conn.Write(stream); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	expectShmPacket(test, readers[1], health)
+	expectShmPacket(test, readers[0], navigation)
+}
+
+func TestCCSDSAuthentication(test *testing.T) {
+	test.Cleanup(resetState)
+	key := bytes.Repeat([]byte{0x5A}, auth.MinKeySize)
+	test.Setenv("GSW_TEST_KEY", hex.EncodeToString(key))
+	authenticator, err := auth.NewAuthenticator(key, auth.DefaultTagSize)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	packets := ccsdsTestPackets(test)
+	packets[1].Auth = &auth.Config{KeyEnv: "GSW_TEST_KEY"}
+	readers, _ := startCCSDSPacketWriter(test, packets)
+	port := packets[0].Port
+	waitUDPListening(test, port)
+
+	// the tag ends the packet data field and covers the primary header
+	signed := func(count uint16, health byte) []byte {
+		packet := spacePacket(101, count, make([]byte, 1+auth.DefaultTagSize))
+		packet[ccsds.PrimaryHeaderSize] = health
+		return authenticator.Append(nil, packet[:len(packet)-auth.DefaultTagSize])
+	}
+	tampered := signed(1, 7)
+	tampered[2] ^= 0x01 // sequence count
+	sendUDPPacket(test, "127.0.0.1", port, tampered)
+	sendUDPPacket(test, "127.0.0.1", port, signed(2, 8))
+	expectShmPacket(test, readers[1], []byte{8})
+
+	stats := waitIngestStats(test, packets[1].Name, func(stats PacketStats) bool { return stats.Received == 1 })
+	if stats.AuthFailed != 1 {
+		test.Errorf("Expected 1 failed authentication, got %d", stats.AuthFailed)
+	}
+}
+
+func TestDatabaseWriterCCSDSTimestamp(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := ccsdsTestPackets(test)[0]
+	handler := &recordingHandler{groups: make(chan db.MeasurementGroup, 1)}
+	channel := make(chan ReceivedPacket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go DatabaseWriter(ctx, handler, packet, channel)
+
+	channel <- ReceivedPacket{Data: []byte{0, 0, 0, 10, 0x80, 0, 0, 0, 1, 0}}
+	group := <-handler.groups
+	expected := time.Unix(10, 500000000).UnixNano()
+	if group.Timestamp != expected {
+		test.Errorf("Expected timestamp %d, got %d", expected, group.Timestamp)
+	}
+	if group.Measurements[2].Value != "256" {
+		test.Errorf("Expected altitude 256, got %s", group.Measurements[2].Value)
+	}
+}
@@ -1,38 +1,91 @@
 package proc
 
 import (
+	"bytes"
 	"fmt"
+	"sync"
 
 	"github.com/AarC10/GSW-V2/lib/ipc"
 )
 
 const telemetryConfigKey = "telemetry-config"
 
-// WriteTelemetryConfigToShm writes to the config in SHM,
+var (
+	configMu     sync.Mutex     // Guards the config last loaded from shared memory while readers reattach
+	loadedData   []byte         // Shared config last loaded
+	loadedConfig *Configuration // Config parsed from loadedData, shared by the readers attaching with it
+)
+
+// WriteTelemetryConfigToShm shares the config with IpcBackend, in SHM by default,
 // returning a cleanup function to remove it.
 func WriteTelemetryConfigToShm(shmDir string, data []byte) (cleanup func(), err error) {
-	configWriter, err := ipc.NewShmHandler(telemetryConfigKey, len(data), true, shmDir)
+	configWriter, err := ipc.NewWriter(IpcBackend, telemetryConfigKey, telemetryConfigKey, len(data), shmDir)
 	if err != nil {
-		return nil, fmt.Errorf("creating shm handler: %w", err)
+		return nil, fmt.Errorf("creating %s writer: %w", IpcBackend, err)
 	}
 	if err := configWriter.Write(data); err != nil {
 		configWriter.Cleanup()
-		return nil, fmt.Errorf("writing to shm handler: %w", err)
+		return nil, fmt.Errorf("writing to %s writer: %w", IpcBackend, err)
 	}
 	return configWriter.Cleanup, nil
 }
 
-// ReadTelemetryConfigFromShm reads the config from SHM and returns it.
+// ReadTelemetryConfigFromShm reads the config shared with IpcBackend and returns it.
 func ReadTelemetryConfigFromShm(shmDir string) ([]byte, error) {
-	configReader, err := ipc.CreateShmReader(telemetryConfigKey, shmDir)
+	configReader, err := ipc.NewReader(IpcBackend, telemetryConfigKey, -1, shmDir)
 	if err != nil {
-		return nil, fmt.Errorf("creating shm handler: %w", err)
+		return nil, fmt.Errorf("creating %s reader: %w", IpcBackend, err)
 	}
 	defer configReader.Cleanup()
 
 	data, err := configReader.ReadRaw()
 	if err != nil {
-		return nil, fmt.Errorf("reading from shm handler: %w", err)
+		return nil, fmt.Errorf("reading from %s reader: %w", IpcBackend, err)
 	}
 	return data, nil
 }
+
+// LoadConfig parses a telemetry config file into the global config,
+// or the config shared by a running gsw_service in shmDir if path is empty.
+func LoadConfig(path string, shmDir string) (*Configuration, error) {
+	if path != "" {
+		return ParseConfig(path)
+	}
+	data, err := ReadTelemetryConfigFromShm(shmDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading config from gsw_service: %w", err)
+	}
+	return ParseConfigBytes(data)
+}
+
+// LoadSharedConfig parses the config shared by a running gsw_service in shmDir, without changing the global config.
+// The config returned may be shared with other readers of the same config and must not be modified.
+func LoadSharedConfig(shmDir string) (*Configuration, error) {
+	config, err := loadTelemetryConfigFromShm(shmDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading config from gsw_service: %w", err)
+	}
+	return config, nil
+}
+
+// loadTelemetryConfigFromShm parses the shared config, without changing the global config,
+// unless it is the config last loaded. The config returned is shared and must not be modified.
+func loadTelemetryConfigFromShm(shmDir string) (*Configuration, error) {
+	data, err := ReadTelemetryConfigFromShm(shmDir)
+	if err != nil {
+		return nil, err
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	if loadedConfig != nil && bytes.Equal(data, loadedData) {
+		return loadedConfig, nil
+	}
+	config := &Configuration{}
+	if err := parseConfig(data, config); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	loadedData = data
+	loadedConfig = config
+	return config, nil
+}
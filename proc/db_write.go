@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/AarC10/GSW-V2/lib/ccsds"
 	"github.com/AarC10/GSW-V2/lib/db"
 	"github.com/AarC10/GSW-V2/lib/logger"
 	"github.com/AarC10/GSW-V2/lib/tlm"
@@ -11,10 +12,33 @@ import (
 )
 
 // DatabaseWriter writes telemetry data to the database
-// It reads data from the channel and writes it to the database
-func DatabaseWriter(ctx context.Context, handler db.Handler, packet tlm.TelemetryPacket, channel chan []byte) {
+// It reads data from the channel and writes it to the database, tagged with the vehicle that sent it
+func DatabaseWriter(ctx context.Context, handler db.Handler, packet tlm.TelemetryPacket, channel chan ReceivedPacket) {
 	log := logger.Log().Named("database").With(zap.String("packet", packet.Name))
+	decoder, err := newUnscaledPacketDecoder(packet)
+	if err != nil {
+		log.Error("couldn't create packet decoder", zap.Error(err))
+		return
+	}
+	values := decoder.NewValues()
 	measGroup := initMeasurementGroup(packet)
+
+	// CCSDS packets with a time code are timestamped with it instead of the time they were received
+	var timeCode *ccsds.CUC
+	if packet.CCSDS != nil && packet.CCSDS.TimeCode != nil {
+		cuc, err := packet.CCSDS.TimeCode.CUC()
+		if err != nil {
+			log.Error("couldn't create time code decoder", zap.Error(err))
+			return
+		}
+		timeCode = &cuc
+	}
+	tags := make([]db.Tag, 0, 2)
+
+	counters := countersForPacket(packet.Name)
+	counters.dbQueue.Store(&channel)
+	defer counters.dbQueue.Store(nil)
+	registerDatabaseHandler(handler)
 	log.Info("Started database writer")
 
 	for {
@@ -22,12 +46,34 @@ func DatabaseWriter(ctx context.Context, handler db.Handler, packet tlm.Telemetr
 		case <-ctx.Done():
 			log.Info("database writer shutting down")
 			return
-		case data, ok := <-channel:
+		case received, ok := <-channel:
 			if !ok {
 				return
 			}
-			UpdateMeasurementGroup(packet, measGroup, data)
+			tags = tags[:0]
+			if received.Vehicle != "" {
+				tags = append(tags, db.Tag{Key: VehicleTag, Value: received.Vehicle})
+			}
+			if received.Station != "" {
+				tags = append(tags, db.Tag{Key: StationTag, Value: received.Station})
+			}
+			measGroup.Tags = nil
+			if len(tags) > 0 {
+				measGroup.Tags = tags
+			}
+			start := time.Now()
+			if err := UpdateMeasurementGroup(decoder, values, &measGroup, received.Data); err != nil {
+				log.Error("couldn't decode packet", zap.Error(err))
+				continue
+			}
+			if timeCode != nil {
+				if timestamp, err := timeCode.Decode(received.Data); err == nil {
+					measGroup.Timestamp = timestamp.UnixNano()
+				}
+			}
+			counters.decode.observe(time.Since(start))
 			if err := handler.Insert(measGroup); err != nil {
+				counters.dbErrors.Add(1)
 				log.Error("couldn't insert measurement group", zap.Error(err))
 			}
 		}
@@ -46,19 +92,17 @@ func initMeasurementGroup(packet tlm.TelemetryPacket) db.MeasurementGroup {
 	return measurementGroup
 }
 
-// UpdateMeasurementGroup updates the values of the measurements in the MeasurementGroup
-func UpdateMeasurementGroup(packet tlm.TelemetryPacket, measurements db.MeasurementGroup, data []byte) {
-	offset := 0
+// UpdateMeasurementGroup decodes data into values and updates the values and timestamp of the MeasurementGroup.
+// values must be allocated by the decoder, and measurements must hold one entry per packet measurement.
+func UpdateMeasurementGroup(decoder *tlm.Decoder, values []tlm.Value, measurements *db.MeasurementGroup, data []byte) error {
+	if err := decoder.Decode(data, values); err != nil {
+		return err
+	}
 
 	measurements.Timestamp = time.Now().UnixNano()
-	for i, measurementName := range packet.Measurements {
-		measurement, ok := GswConfig.Measurements[measurementName]
-		if !ok {
-			logger.Error("measurement not found", zap.String("measurement", measurementName))
-			continue
-		}
-
-		measurements.Measurements[i].Value, _ = tlm.InterpretMeasurementValueString(measurement, data[offset:offset+measurement.Size])
-		offset += measurement.Size
+	for i := range measurements.Measurements {
+		measurements.Measurements[i].Value = values[i].String()
 	}
+
+	return nil
 }
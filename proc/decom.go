@@ -2,104 +2,314 @@ package proc
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"net"
+	"net/netip"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/AarC10/GSW-V2/lib/auth"
 	"github.com/AarC10/GSW-V2/lib/ipc"
 	"github.com/AarC10/GSW-V2/lib/logger"
 	"github.com/AarC10/GSW-V2/lib/tlm"
 	"go.uber.org/zap"
 )
 
-// newIpcShmHandlerForPacket creates a shared memory IPC handler for a telemetry packet
-// If write is true, the handler will be created for writing to shared memory
-// If write is false, the handler will be created for reading from shared memory
-func newIpcShmHandlerForPacket(packet tlm.TelemetryPacket, write bool, shmDir string) (*ipc.ShmHandler, error) {
-	handler, err := ipc.NewShmHandler(strconv.Itoa(packet.Port), GetPacketSize(packet), write, shmDir)
+// shmIdentifier returns the shared memory identifier of a packet's ring for a vehicle.
+// The ring for packets that aren't attributed to a vehicle is identified by the port alone.
+// CCSDS packets share their port, so their APID is added to it.
+func shmIdentifier(packet tlm.TelemetryPacket, vehicle string) string {
+	identifier := strconv.Itoa(packet.Port)
+	if packet.CCSDS != nil {
+		identifier += "." + strconv.Itoa(packet.CCSDS.APID)
+	}
+	if vehicle == "" {
+		return identifier
+	}
+	return identifier + "-" + vehicle
+}
+
+// IpcBackend is the backend packets are shared with, between gsw_service and the tools reading them.
+// Tools set it with a flag, such as flag.Var(&proc.IpcBackend, "ipc", ...), so every process uses the same one.
+var IpcBackend = ipc.BackendShm
+
+// newIpcWriterForPacket creates an IPC writer for a telemetry packet sent by a vehicle with IpcBackend.
+// The packet name is recorded in the header of the segments written.
+func newIpcWriterForPacket(packet tlm.TelemetryPacket, vehicle string, shmDir string) (ipc.Writer, error) {
+	writer, err := ipc.NewWriter(IpcBackend, shmIdentifier(packet, vehicle), packet.Name, GetPacketSize(packet), shmDir)
 	if err != nil {
-		return nil, fmt.Errorf("error creating shared memory handler: %v", err)
+		return nil, fmt.Errorf("error creating %s writer: %w", IpcBackend, err)
 	}
+	return writer, nil
+}
 
-	return handler, nil
+// newIpcReaderForPacket creates an IPC reader for a telemetry packet sent by a vehicle with IpcBackend,
+// sizing its messages with the given measurement definitions.
+func newIpcReaderForPacket(packet tlm.TelemetryPacket, measurements map[string]tlm.Measurement, vehicle string, shmDir string) (ipc.RingReader, error) {
+	reader, err := ipc.NewReader(IpcBackend, shmIdentifier(packet, vehicle), packetSize(packet, measurements), shmDir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s reader: %w", IpcBackend, err)
+	}
+	return reader, nil
 }
 
-// TelemetryPacketWriter is a goroutine that listens for telemetry data on a UDP port and writes it to shared memory
-func TelemetryPacketWriter(ctx context.Context, packet tlm.TelemetryPacket, outChannel chan []byte, shmDir string) error {
-	log := logger.Log().Named("decom").With(zap.String("packet", packet.Name))
-	packetSize := GetPacketSize(packet)
-	shmWriter, err := newIpcShmHandlerForPacket(packet, true, shmDir)
-	if shmWriter == nil {
-		return fmt.Errorf("creating shared memory writer: %w", err)
+// packetHandler publishes the packets read by a telemetry source.
+type packetHandler interface {
+	// handle publishes a packet received from source. data is only valid during the call.
+	handle(data []byte, source netip.Addr)
+	// frameSize returns the size of the largest packet accepted, used to size receive buffers and fixed frames.
+	frameSize() int
+	// ingestCounters returns the counters for packets dropped before reaching the handler, such as kernel drops.
+	ingestCounters() *packetCounters
+}
+
+// packetSink validates received packets and publishes them to shared memory and the output channel.
+// It is safe for concurrent use by multiple connections.
+type packetSink struct {
+	log            *zap.Logger
+	packetSize     int
+	shmWriter      ipc.Writer      // Ring for packets that aren't attributed to a vehicle
+	vehicles       []string        // Names of the configured vehicles
+	vehicleWriters []ipc.Writer    // Ring for each vehicle
+	router         *vehicleRouter  // Attributes packets to vehicles. nil if no vehicles are configured
+	values         *valuePublisher // Publishes the packet's engineering values. nil if the packet can't be decoded
+	outChannel     chan ReceivedPacket
+	counters       *packetCounters
+	port           uint16              // Port the packet is forwarded to
+	merger         *packetMerger       // Drops copies delivered by several stations. nil unless merging
+	auth           *auth.Authenticator // Verifies the tag appended to packets. nil unless the packet is authenticated
+	loggedUnknown  bool                // Whether a packet from an unknown vehicle has been logged
+	mu             sync.Mutex
+}
+
+// newPacketSink creates the shared memory rings for a packet and each configured vehicle.
+func newPacketSink(log *zap.Logger, packet tlm.TelemetryPacket, outChannel chan ReceivedPacket, shmDir string) (*packetSink, error) {
+	sink := &packetSink{
+		log:        log,
+		packetSize: GetPacketSize(packet),
+		outChannel: outChannel,
+		counters:   countersForPacket(packet.Name),
+		port:       uint16(packet.Port),
 	}
-	defer shmWriter.Cleanup()
 
-	log.Info(fmt.Sprintf("Packet size: %d bytes %d bits", packetSize, packetSize*8))
+	var err error
+	if packet.Auth != nil {
+		if sink.auth, err = packet.Auth.NewAuthenticator(); err != nil {
+			return nil, fmt.Errorf("creating authenticator: %w", err)
+		}
+	}
+	if GswConfig.Merge != nil {
+		if sink.merger, err = newPacketMerger(packet, sink.counters); err != nil {
+			return nil, fmt.Errorf("creating merger: %w", err)
+		}
+	}
 
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", packet.Port))
+	sink.shmWriter, err = newIpcWriterForPacket(packet, "", shmDir)
 	if err != nil {
-		return fmt.Errorf("resolving listen address: %w", err)
+		return nil, err
 	}
-
-	conn, err := net.ListenUDP("udp", addr)
+	sink.values, err = newValuePublisher(log, packet, shmDir)
 	if err != nil {
-		return fmt.Errorf("listening: %w", err)
+		sink.cleanup()
+		return nil, err
 	}
 
-	var closeConnOnce sync.Once
-	closeConn := func() {
-		closeConnOnce.Do(func() {
-			if err := conn.Close(); err != nil {
-				log.Error("error closing UDP connection", zap.Error(err))
-			}
-		})
+	if len(GswConfig.Vehicles) == 0 {
+		return sink, nil
 	}
-	defer closeConn()
 
-	stopf := context.AfterFunc(ctx, closeConn)
-	defer stopf()
+	sink.router, err = newVehicleRouter(packet)
+	if err != nil {
+		sink.cleanup()
+		return nil, fmt.Errorf("creating vehicle router: %w", err)
+	}
+	for _, vehicle := range GswConfig.Vehicles {
+		writer, err := newIpcWriterForPacket(packet, vehicle.Name, shmDir)
+		if err != nil {
+			sink.cleanup()
+			return nil, err
+		}
+		sink.vehicles = append(sink.vehicles, vehicle.Name)
+		sink.vehicleWriters = append(sink.vehicleWriters, writer)
+	}
 
-	log.Info(fmt.Sprintf("Listening on %d for telemetry packet...", packet.Port))
+	return sink, nil
+}
 
-	// Receive data
-	buffer := make([]byte, packetSize)
-	for {
-		n, _, err := conn.ReadFromUDP(buffer)
-		if err != nil {
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
+// cleanup removes the sink's shared memory rings, including those of its engineering values.
+func (s *packetSink) cleanup() {
+	s.shmWriter.Cleanup()
+	for _, writer := range s.vehicleWriters {
+		writer.Cleanup()
+	}
+	s.values.cleanup()
+}
 
-			// a closed connection would be unrecoverable, so return the error
-			if errors.Is(err, net.ErrClosed) {
-				return err
-			}
+// handle publishes a packet received from a source address, which is invalid for sources without one.
+// The packet is dropped if it has the wrong size, an invalid tag or is a copy delivered by another station,
+// and otherwise forwarded to other ground stations with its tag. data is not retained, so receivers can reuse their buffers.
+func (s *packetSink) handle(data []byte, source netip.Addr) {
+	if !s.validSize(data) {
+		return
+	}
+	packetData, ok := s.authenticate(data)
+	if !ok {
+		return
+	}
+	vehicle := s.route(packetData, source)
+	station := ""
+	if s.merger != nil {
+		var first bool
+		if station, first = s.merger.accept(vehicle, s.merger.key(packetData), source, time.Now()); !first {
+			return
+		}
+	}
+	forwardPacket(s.port, data, source)
+	s.publish(packetData, vehicle, station)
+}
 
-			log.Error("error reading from UDP", zap.Error(err))
-			continue
+// route returns the index of the vehicle that sent a packet, or -1 if it can't be attributed to one.
+func (s *packetSink) route(data []byte, source netip.Addr) int {
+	if s.router == nil {
+		return -1
+	}
+	vehicle := s.router.route(data, source)
+	if vehicle < 0 {
+		s.mu.Lock()
+		if !s.loggedUnknown {
+			s.loggedUnknown = true
+			s.log.Warn("received packet from unknown vehicle, publishing without a vehicle", zap.Stringer("source", source))
 		}
+		s.mu.Unlock()
+	}
+	return vehicle
+}
 
-		if n == packetSize {
-			err := shmWriter.Write(buffer)
-			if err != nil {
-				log.Error("error writing to shared memory", zap.Error(err))
-			}
-
-			select {
-			case outChannel <- buffer:
-				break
-			default:
-				break
-			}
-		} else {
-			log.Error("received packet of incorrect size", zap.Int("expected", packetSize), zap.Int("received", n))
+// validSize checks the size of a packet, including its tag, counting it if it's wrong.
+func (s *packetSink) validSize(data []byte) bool {
+	if len(data) != s.frameSize() {
+		s.counters.wrongSize.Add(1)
+		s.log.Error("received packet of incorrect size", zap.Int("expected", s.frameSize()), zap.Int("received", len(data)))
+		return false
+	}
+	return true
+}
+
+// authenticate verifies the tag at the end of a packet, counting it if it's invalid, and returns the packet without it.
+// The tag of a CCSDS packet also covers its primary header.
+func (s *packetSink) authenticate(data []byte) ([]byte, bool) {
+	if s.auth == nil {
+		return data, true
+	}
+	data, err := s.auth.Verify(data)
+	if err != nil {
+		s.counters.authFailed.Add(1)
+		s.log.Error("received packet that failed authentication", zap.Error(err))
+		return nil, false
+	}
+	return data, true
+}
+
+// publish writes a validated packet sent by the vehicle at index vehicleIndex, or -1 if it isn't attributed to one,
+// to shared memory and the output channel. station is the station that delivered it, if merging stations.
+func (s *packetSink) publish(data []byte, vehicleIndex int, station string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writer := s.shmWriter
+	vehicle := ""
+	if vehicleIndex >= 0 {
+		writer = s.vehicleWriters[vehicleIndex]
+		vehicle = s.vehicles[vehicleIndex]
+	}
+
+	if err := writer.Write(data); err != nil {
+		s.counters.shmErrors.Add(1)
+		s.log.Error("error writing to shared memory", zap.Error(err))
+	}
+	if err := s.values.publish(vehicleIndex, data); err != nil {
+		s.counters.shmErrors.Add(1)
+		s.log.Error("error publishing engineering values", zap.Error(err))
+	}
+	s.counters.received.Add(1)
+	s.counters.lastReceived.Store(time.Now().UnixNano())
+
+	select {
+	case s.outChannel <- ReceivedPacket{Vehicle: vehicle, Station: station, Data: append([]byte(nil), data...)}:
+		break
+	default:
+		// only a drop if a database writer is behind, the channel may have no reader at all
+		if s.counters.dbQueue.Load() != nil {
+			s.counters.dbDrops.Add(1)
 		}
 	}
 }
 
+func (s *packetSink) frameSize() int {
+	if s.auth != nil {
+		return s.packetSize + s.auth.TagSize()
+	}
+	return s.packetSize
+}
+
+func (s *packetSink) ingestCounters() *packetCounters {
+	return s.counters
+}
+
+// TelemetryPacketWriter is a goroutine that receives telemetry data and writes it to shared memory.
+// Packets are received on the packet's UDP port, unless the packet is configured for TCP or serial.
+// When vehicles are configured, each vehicle's packets are written to their own shared memory ring.
+// A CCSDS packet is received by CCSDSPacketWriter, as the only APID on its port.
+func TelemetryPacketWriter(ctx context.Context, packet tlm.TelemetryPacket, outChannel chan ReceivedPacket, shmDir string) error {
+	if packet.CCSDS != nil {
+		return CCSDSPacketWriter(ctx, []tlm.TelemetryPacket{packet}, []chan ReceivedPacket{outChannel}, shmDir)
+	}
+
+	log := logger.Log().Named("decom").With(zap.String("packet", packet.Name))
+	sink, err := newPacketSink(log, packet, outChannel, shmDir)
+	if err != nil {
+		return fmt.Errorf("creating shared memory writer: %w", err)
+	}
+	defer sink.cleanup()
+
+	log.Info(fmt.Sprintf("Packet size: %d bytes %d bits", sink.packetSize, sink.packetSize*8))
+	return receivePackets(ctx, log, packet, sink)
+}
+
+// receivePackets receives packets into the handler from the source configured for the packet.
+// Everything received is archived while an ArchiveWriter is running.
+func receivePackets(ctx context.Context, log *zap.Logger, packet tlm.TelemetryPacket, handler packetHandler) error {
+	handler = archivingHandler{packetHandler: handler, port: uint16(packet.Port)}
+	switch {
+	case packet.TCP != nil:
+		// TCP listeners bind to the same address as UDP sockets
+		return tcpPacketReceiver(ctx, log, packet, *packet.TCP, PacketUDPConfig(packet).Bind, handler)
+	case packet.Serial != nil:
+		return serialPacketReceiver(ctx, log, *packet.Serial, handler)
+	}
+	return udpPacketReceiver(ctx, log, packet, PacketUDPConfig(packet), handler)
+}
+
 // NewIpcShmReaderForPacket creates a shared memory IPC reader for a telemetry packet.
+// It reads the packets that aren't attributed to a vehicle, which is all of them if no vehicles are configured.
 func NewIpcShmReaderForPacket(packet tlm.TelemetryPacket, shmDir string) (ipc.Reader, error) {
-	return newIpcShmHandlerForPacket(packet, false, shmDir)
+	return newIpcReaderForPacket(packet, GswConfig.Measurements, "", shmDir)
+}
+
+// NewIpcShmReaderForVehicle creates a shared memory IPC reader for a telemetry packet sent by a vehicle.
+// An empty vehicle reads the packets that aren't attributed to a vehicle.
+func NewIpcShmReaderForVehicle(packet tlm.TelemetryPacket, vehicle string, shmDir string) (ipc.Reader, error) {
+	return newIpcReaderForPacket(packet, GswConfig.Measurements, vehicle, shmDir)
+}
+
+// NewIpcShmCatchUpReader creates a shared memory IPC reader for a telemetry packet sent by a vehicle
+// that reads every packet in order instead of only the newest, for consumers that must not skip samples.
+// Packets overwritten before they could be read are reported by the messages read.
+func NewIpcShmCatchUpReader(packet tlm.TelemetryPacket, vehicle string, shmDir string) (ipc.RingReader, error) {
+	reader, err := newIpcReaderForPacket(packet, GswConfig.Measurements, vehicle, shmDir)
+	if err != nil {
+		return nil, err
+	}
+	reader.SetReadMode(ipc.ReadAll)
+	return reader, nil
 }
@@ -0,0 +1,427 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	forwardQueueSize     = 1024        // Packets waiting to be sent to each destination
+	forwardTimeout       = time.Second // Timeout for connecting and writing to TCP destinations
+	forwardRetryDelay    = time.Second // Time after a failed connection or resolution before retrying
+	maxForwardedDatagram = 65507       // Largest packet that can be forwarded over UDP
+)
+
+// ErrUnknownDestination is returned when changing a forwarding destination that isn't configured.
+var ErrUnknownDestination = errors.New("unknown forwarding destination")
+
+// destinationNamePattern matches valid destination names, which are used in metric labels and API paths.
+var destinationNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var activeForwarder atomic.Pointer[Forwarder] // Forwarder used by packet writers, if forwarding is running
+
+// ForwardDestination is another ground station validated packets are re-sent to.
+// Each packet is sent to its own port on the destination, as the destination receives it with the same telemetry config.
+type ForwardDestination struct {
+	Name     string `json:"name" mapstructure:"name"`         // Name identifying the destination
+	Address  string `json:"address" mapstructure:"address"`   // Host name or address of the destination
+	Protocol string `json:"protocol" mapstructure:"protocol"` // udp or tcp. Defaults to udp
+	Disabled bool   `json:"disabled" mapstructure:"disabled"` // Don't send packets until the destination is enabled
+}
+
+// validate checks a destination and fills in its defaults.
+func (d *ForwardDestination) validate() error {
+	if !destinationNamePattern.MatchString(d.Name) {
+		return fmt.Errorf("invalid destination name %q, must be letters, digits, '-' and '_'", d.Name)
+	}
+	if d.Address == "" {
+		return fmt.Errorf("destination %s has no address", d.Name)
+	}
+	if _, _, err := net.SplitHostPort(d.Address); err == nil {
+		return fmt.Errorf("destination %s address %s has a port, packets are sent to their own port", d.Name, d.Address)
+	}
+	if d.Protocol == "" {
+		d.Protocol = "udp"
+	}
+	if d.Protocol != "udp" && d.Protocol != "tcp" {
+		return fmt.Errorf("destination %s has unknown protocol %q, must be udp or tcp", d.Name, d.Protocol)
+	}
+	return nil
+}
+
+// ForwardStatus holds the state of a forwarding destination.
+type ForwardStatus struct {
+	ForwardDestination
+	Sent       uint64 `json:"sent"`        // Packets sent
+	Dropped    uint64 `json:"dropped"`     // Packets dropped because the destination was behind
+	SendErrors uint64 `json:"send_errors"` // Packets that couldn't be sent
+}
+
+// forwardedPacket is a raw packet waiting to be sent to a destination.
+type forwardedPacket struct {
+	port uint16
+	data []byte
+}
+
+// forwardTarget sends the packets queued for a destination.
+type forwardTarget struct {
+	destination ForwardDestination
+	enabled     atomic.Bool
+	queue       chan forwardedPacket
+	cancel      context.CancelFunc
+	done        chan struct{}
+
+	sources    atomic.Pointer[[]netip.Addr] // Addresses of the destination, to recognize the packets it forwards. nil until resolved
+	sent       atomic.Uint64
+	dropped    atomic.Uint64
+	sendErrors atomic.Uint64
+}
+
+// Forwarder re-sends the raw packets that passed validation to other ground stations.
+// Destinations can be added, changed and removed while packets are received.
+type Forwarder struct {
+	log     *zap.Logger
+	mu      sync.Mutex
+	targets atomic.Pointer[[]*forwardTarget] // Replaced on every change, so forward doesn't lock
+	closed  bool
+}
+
+// NewForwarder creates a forwarder without destinations.
+func NewForwarder() *Forwarder {
+	f := &Forwarder{log: logger.Log().Named("forward")}
+	f.targets.Store(&[]*forwardTarget{})
+	return f
+}
+
+// Set adds a destination, or replaces the destination with the same name, resetting its counters.
+func (f *Forwarder) Set(destination ForwardDestination) error {
+	if err := destination.validate(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return errors.New("forwarder is stopped")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	target := &forwardTarget{
+		destination: destination,
+		queue:       make(chan forwardedPacket, forwardQueueSize),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	target.enabled.Store(!destination.Disabled)
+	if addr, err := netip.ParseAddr(destination.Address); err == nil {
+		target.sources.Store(&[]netip.Addr{addr.Unmap()})
+	}
+	go target.run(ctx, f.log.With(zap.String("destination", destination.Name)))
+
+	targets := slices.Clone(*f.targets.Load())
+	if i := f.index(targets, destination.Name); i >= 0 {
+		targets[i].stop()
+		targets[i] = target
+	} else {
+		targets = append(targets, target)
+	}
+	f.targets.Store(&targets)
+	f.log.Info("Forwarding to destination", zap.String("destination", destination.Name),
+		zap.String("address", destination.Address), zap.String("protocol", destination.Protocol), zap.Bool("enabled", !destination.Disabled))
+	return nil
+}
+
+// SetEnabled enables or disables sending packets to a destination, keeping its counters.
+func (f *Forwarder) SetEnabled(name string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	targets := *f.targets.Load()
+	i := f.index(targets, name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownDestination, name)
+	}
+	targets[i].enabled.Store(enabled)
+	f.log.Info("Changed forwarding destination", zap.String("destination", name), zap.Bool("enabled", enabled))
+	return nil
+}
+
+// Remove stops sending packets to a destination.
+func (f *Forwarder) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	targets := slices.Clone(*f.targets.Load())
+	i := f.index(targets, name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownDestination, name)
+	}
+	targets[i].stop()
+	targets = slices.Delete(targets, i, i+1)
+	f.targets.Store(&targets)
+	f.log.Info("Removed forwarding destination", zap.String("destination", name))
+	return nil
+}
+
+// index returns the index of the named destination in targets, or -1.
+func (f *Forwarder) index(targets []*forwardTarget, name string) int {
+	return slices.IndexFunc(targets, func(target *forwardTarget) bool {
+		return target.destination.Name == name
+	})
+}
+
+// Destinations returns the state of every destination, in the order they were added.
+func (f *Forwarder) Destinations() []ForwardStatus {
+	targets := *f.targets.Load()
+	statuses := make([]ForwardStatus, 0, len(targets))
+	for _, target := range targets {
+		destination := target.destination
+		destination.Disabled = !target.enabled.Load()
+		statuses = append(statuses, ForwardStatus{
+			ForwardDestination: destination,
+			Sent:               target.sent.Load(),
+			Dropped:            target.dropped.Load(),
+			SendErrors:         target.sendErrors.Load(),
+		})
+	}
+	return statuses
+}
+
+// forward queues a raw packet received on port from source for every enabled destination.
+// A packet is dropped and counted for destinations that are behind.
+// Packets received from a destination aren't forwarded to any, so two stations forwarding to each other don't loop.
+func (f *Forwarder) forward(port uint16, data []byte, source netip.Addr) {
+	targets := *f.targets.Load()
+	if len(targets) == 0 {
+		return
+	}
+	source = source.Unmap()
+	for _, target := range targets {
+		if sources := target.sources.Load(); sources != nil && slices.Contains(*sources, source) {
+			return
+		}
+	}
+
+	packet := forwardedPacket{port: port, data: append([]byte(nil), data...)}
+	for _, target := range targets {
+		if !target.enabled.Load() {
+			continue
+		}
+		select {
+		case target.queue <- packet:
+		default:
+			target.dropped.Add(1)
+		}
+	}
+}
+
+// close stops sending to every destination.
+func (f *Forwarder) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for _, target := range *f.targets.Load() {
+		target.stop()
+	}
+}
+
+// ForwardPackets forwards the validated packets received by packet writers until ctx is done.
+func ForwardPackets(ctx context.Context, forwarder *Forwarder) {
+	activeForwarder.Store(forwarder)
+	<-ctx.Done()
+	activeForwarder.Store(nil)
+	forwarder.close()
+}
+
+// forwardPacket passes a validated raw packet received on port from source to the running forwarder, if there is one.
+func forwardPacket(port uint16, data []byte, source netip.Addr) {
+	if forwarder := activeForwarder.Load(); forwarder != nil {
+		forwarder.forward(port, data, source)
+	}
+}
+
+// stop stops the target's sender and waits for it to return.
+func (t *forwardTarget) stop() {
+	t.cancel()
+	<-t.done
+}
+
+// run sends queued packets to the destination until ctx is done.
+func (t *forwardTarget) run(ctx context.Context, log *zap.Logger) {
+	defer close(t.done)
+	var send func(forwardedPacket) error
+	var cleanup func()
+	if t.destination.Protocol == "tcp" {
+		send, cleanup = t.tcpSender()
+	} else {
+		send, cleanup = t.udpSender()
+	}
+	defer cleanup()
+
+	var resolveRetry retryAfter
+	resolveSources := func() {
+		if t.sources.Load() != nil || resolveRetry.blocked() != nil {
+			return
+		}
+		if err := t.resolveSources(ctx); err != nil {
+			_ = resolveRetry.fail(err)
+			log.Warn("couldn't resolve destination, packets it forwards may be forwarded back", zap.Error(err))
+		}
+	}
+	resolveSources()
+
+	logged := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet := <-t.queue:
+			resolveSources()
+			if err := send(packet); err != nil {
+				t.sendErrors.Add(1)
+				// an unreachable destination fails every packet, so only the first failure is logged until one succeeds
+				if !logged {
+					logged = true
+					log.Warn("couldn't forward packet", zap.Uint16("port", packet.port), zap.Error(err))
+				}
+				continue
+			}
+			logged = false
+			t.sent.Add(1)
+		}
+	}
+}
+
+// resolveSources records the addresses of the destination, to recognize the packets it forwards.
+func (t *forwardTarget) resolveSources(ctx context.Context) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", t.destination.Address)
+	if err != nil {
+		return err
+	}
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap()
+	}
+	t.sources.Store(&addrs)
+	return nil
+}
+
+// retryAfter remembers when a failed operation can be retried.
+type retryAfter struct {
+	until time.Time
+	err   error
+}
+
+// blocked returns the last error until the retry delay has passed.
+func (r *retryAfter) blocked() error {
+	if time.Now().Before(r.until) {
+		return r.err
+	}
+	return nil
+}
+
+// fail records an error, blocking retries for forwardRetryDelay.
+func (r *retryAfter) fail(err error) error {
+	r.until = time.Now().Add(forwardRetryDelay)
+	r.err = err
+	return err
+}
+
+// udpSender returns a function sending each packet as a datagram to its port on the destination.
+func (t *forwardTarget) udpSender() (func(forwardedPacket) error, func()) {
+	var conn *net.UDPConn
+	var host netip.Addr
+	var retry retryAfter
+
+	send := func(packet forwardedPacket) error {
+		if len(packet.data) > maxForwardedDatagram {
+			return fmt.Errorf("%d byte packet is too large for a datagram", len(packet.data))
+		}
+		if !host.IsValid() {
+			if err := retry.blocked(); err != nil {
+				return err
+			}
+			addr, err := resolveHost(t.destination.Address)
+			if err != nil {
+				return retry.fail(err)
+			}
+			network := "udp4"
+			if addr.Is6() {
+				network = "udp6"
+			}
+			if conn, err = net.ListenUDP(network, nil); err != nil {
+				return retry.fail(err)
+			}
+			host = addr
+		}
+		_, err := conn.WriteToUDPAddrPort(packet.data, netip.AddrPortFrom(host, packet.port))
+		return err
+	}
+	cleanup := func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+	return send, cleanup
+}
+
+// resolveHost returns the first address of a host name or address.
+func resolveHost(host string) (netip.Addr, error) {
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	ip, _ := netip.AddrFromSlice(addr.IP)
+	return ip.Unmap(), nil
+}
+
+// tcpSender returns a function writing each packet to a connection to its port on the destination.
+// Packets are written back to back, so the destination must delimit them with fixed or ccsds framing.
+// A lost connection is redialed on the next packet.
+func (t *forwardTarget) tcpSender() (func(forwardedPacket) error, func()) {
+	conns := make(map[uint16]net.Conn)
+	retries := make(map[uint16]*retryAfter)
+
+	send := func(packet forwardedPacket) error {
+		conn, ok := conns[packet.port]
+		if !ok {
+			retry := retries[packet.port]
+			if retry == nil {
+				retry = &retryAfter{}
+				retries[packet.port] = retry
+			}
+			if err := retry.blocked(); err != nil {
+				return err
+			}
+			address := net.JoinHostPort(t.destination.Address, strconv.Itoa(int(packet.port)))
+			var err error
+			if conn, err = net.DialTimeout("tcp", address, forwardTimeout); err != nil {
+				return retry.fail(err)
+			}
+			conns[packet.port] = conn
+		}
+
+		_ = conn.SetWriteDeadline(time.Now().Add(forwardTimeout))
+		if _, err := conn.Write(packet.data); err != nil {
+			_ = conn.Close()
+			delete(conns, packet.port)
+			return err
+		}
+		return nil
+	}
+	cleanup := func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+	return send, cleanup
+}
@@ -0,0 +1,336 @@
+package proc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/logger"
+)
+
+// startForwarder runs ForwardPackets with a forwarder until the test ends.
+func startForwarder(test *testing.T) *Forwarder {
+	test.Helper()
+	forwarder := NewForwarder()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ForwardPackets(ctx, forwarder)
+	}()
+	for activeForwarder.Load() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	test.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return forwarder
+}
+
+// listenForwarded listens for forwarded datagrams on a free local port.
+func listenForwarded(test *testing.T) (*net.UDPConn, uint16) {
+	test.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	test.Cleanup(func() { conn.Close() })
+	return conn, uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+// expectDatagram reads a datagram, failing the test if it doesn't match.
+func expectDatagram(test *testing.T, conn *net.UDPConn, expected []byte) {
+	test.Helper()
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buffer)
+	if err != nil {
+		test.Fatalf("Expected % X, got %v", expected, err)
+	}
+	if !bytes.Equal(buffer[:n], expected) {
+		test.Errorf("Expected % X, got % X", expected, buffer[:n])
+	}
+}
+
+// waitForwardStatus polls the first destination of a forwarder until cond holds, failing the test after a timeout.
+func waitForwardStatus(test *testing.T, forwarder *Forwarder, cond func(ForwardStatus) bool) ForwardStatus {
+	test.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := forwarder.Destinations()[0]
+		if cond(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			test.Fatalf("Timed out waiting for forwarding status, got %+v", status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestForwardDestinationValidate(test *testing.T) {
+	tests := []struct {
+		name        string
+		destination ForwardDestination
+		valid       bool
+	}{
+		{"udp", ForwardDestination{Name: "tent", Address: "10.0.2.20"}, true},
+		{"tcp", ForwardDestination{Name: "pad-2", Address: "ground.local", Protocol: "tcp"}, true},
+		{"ipv6", ForwardDestination{Name: "tent", Address: "fd00::20"}, true},
+		{"bad name", ForwardDestination{Name: "tent/1", Address: "10.0.2.20"}, false},
+		{"no address", ForwardDestination{Name: "tent"}, false},
+		{"port", ForwardDestination{Name: "tent", Address: "10.0.2.20:11000"}, false},
+		{"bad protocol", ForwardDestination{Name: "tent", Address: "10.0.2.20", Protocol: "sctp"}, false},
+	}
+
+	for _, tt := range tests {
+		test.Run(tt.name, func(test *testing.T) {
+			err := tt.destination.validate()
+			if (err == nil) != tt.valid {
+				test.Fatalf("Expected valid %v, got %v", tt.valid, err)
+			}
+			if tt.valid && tt.destination.Protocol == "" {
+				test.Errorf("Expected a default protocol, got none")
+			}
+		})
+	}
+}
+
+func TestForwardUDP(test *testing.T) {
+	forwarder := startForwarder(test)
+	conn, port := listenForwarded(test)
+	if err := forwarder.Set(ForwardDestination{Name: "tent", Address: "127.0.0.1"}); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+
+	forwardPacket(port, []byte{1, 2, 3}, netip.Addr{})
+	expectDatagram(test, conn, []byte{1, 2, 3})
+
+	// a disabled destination is skipped without counting drops
+	if err := forwarder.SetEnabled("tent", false); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	forwardPacket(port, []byte{4}, netip.Addr{})
+	if err := forwarder.SetEnabled("tent", true); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	forwardPacket(port, []byte{5}, netip.Addr{})
+	expectDatagram(test, conn, []byte{5})
+
+	status := waitForwardStatus(test, forwarder, func(status ForwardStatus) bool { return status.Sent == 2 })
+	if status.Dropped != 0 || status.SendErrors != 0 || status.Disabled {
+		test.Errorf("Expected an enabled destination without errors, got %+v", status)
+	}
+
+	var metrics bytes.Buffer
+	if err := WriteMetrics(&metrics); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	if line := `gsw_forward_sent_total{destination="tent"} 2`; !strings.Contains(metrics.String(), line+"\n") {
+		test.Errorf("Expected line %q in:\n%s", line, metrics.String())
+	}
+
+	if err := forwarder.SetEnabled("pad", false); err == nil {
+		test.Errorf("Expected an error for an unknown destination, got nil")
+	}
+}
+
+func TestForwardTCP(test *testing.T) {
+	forwarder := startForwarder(test)
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	if err := forwarder.Set(ForwardDestination{Name: "tent", Address: "127.0.0.1", Protocol: "tcp"}); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	forwardPacket(port, []byte{1, 2}, netip.Addr{})
+	forwardPacket(port, []byte{3, 4}, netip.Addr{})
+
+	conn, err := listener.Accept()
+	if err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	received := make([]byte, 4)
+	if _, err := io.ReadFull(conn, received); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	// packets are written back to back
+	if !bytes.Equal(received, []byte{1, 2, 3, 4}) {
+		test.Errorf("Expected 01 02 03 04, got % X", received)
+	}
+	waitForwardStatus(test, forwarder, func(status ForwardStatus) bool { return status.Sent == 2 })
+}
+
+func TestForwardLoop(test *testing.T) {
+	test.Cleanup(resetState)
+	forwarder := startForwarder(test)
+	conn, port := listenForwarded(test)
+	if err := forwarder.Set(ForwardDestination{Name: "tent", Address: "127.0.0.1"}); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+
+	// packets forwarded by a destination aren't forwarded back
+	forwardPacket(port, []byte{1}, netip.MustParseAddr("127.0.0.1"))
+	forwardPacket(port, []byte{2}, netip.MustParseAddr("::ffff:127.0.0.1"))
+	forwardPacket(port, []byte{3}, netip.MustParseAddr("127.0.0.2"))
+	expectDatagram(test, conn, []byte{3})
+	status := waitForwardStatus(test, forwarder, func(status ForwardStatus) bool { return status.Sent == 1 })
+	if status.Dropped != 0 {
+		test.Errorf("Expected nothing dropped, got %d", status.Dropped)
+	}
+}
+
+func TestForwardSendErrors(test *testing.T) {
+	forwarder := startForwarder(test)
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	if err := forwarder.Set(ForwardDestination{Name: "tent", Address: "127.0.0.1", Protocol: "tcp"}); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		forwardPacket(port, []byte{byte(i)}, netip.Addr{})
+	}
+	status := waitForwardStatus(test, forwarder, func(status ForwardStatus) bool { return status.SendErrors == 3 })
+	if status.Sent != 0 {
+		test.Errorf("Expected nothing sent, got %d", status.Sent)
+	}
+}
+
+func TestForwardValidatedPackets(test *testing.T) {
+	test.Cleanup(resetState)
+	forwarder := startForwarder(test)
+	conn, port := listenForwarded(test)
+	if err := forwarder.Set(ForwardDestination{Name: "tent", Address: "127.0.0.1"}); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+
+	packet := vehicleTestPacket(test, 1)
+	packet.Port = int(port)
+	sink, err := newPacketSink(logger.Log(), packet, make(chan ReceivedPacket, 4), test.TempDir())
+	if err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	defer sink.cleanup()
+
+	// only packets with the right size are forwarded
+	sink.handle([]byte{1, 2, 3}, netip.Addr{})
+	sink.handle([]byte{0, 0, 0, 1}, netip.Addr{})
+	expectDatagram(test, conn, []byte{0, 0, 0, 1})
+	waitForwardStatus(test, forwarder, func(status ForwardStatus) bool { return status.Sent == 1 })
+}
+
+func TestForwardingAPI(test *testing.T) {
+	test.Cleanup(resetState)
+	forwarder := startForwarder(test)
+	server := NewStatusServer(StatusInfo{Forwarder: forwarder, ForwardingToken: "secret"})
+
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		server.Handler().ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		code     int
+		disabled []bool // Disabled state of each destination afterwards
+	}{
+		{http.MethodGet, "/forwarding", "", http.StatusOK, []bool{}},
+		{http.MethodPut, "/forwarding/tent", `{"address": "127.0.0.1"}`, http.StatusOK, []bool{false}},
+		{http.MethodPut, "/forwarding/pad", `{"address": "127.0.0.1", "protocol": "tcp", "disabled": true}`, http.StatusOK, []bool{false, true}},
+		{http.MethodPut, "/forwarding/bad", `{"address": "127.0.0.1:80"}`, http.StatusBadRequest, []bool{false, true}},
+		{http.MethodPut, "/forwarding/bad", `{`, http.StatusBadRequest, []bool{false, true}},
+		{http.MethodPost, "/forwarding/tent/disable", "", http.StatusOK, []bool{true, true}},
+		{http.MethodPost, "/forwarding/pad/enable", "", http.StatusOK, []bool{true, false}},
+		{http.MethodPost, "/forwarding/nothing/enable", "", http.StatusNotFound, []bool{true, false}},
+		{http.MethodDelete, "/forwarding/tent", "", http.StatusOK, []bool{false}},
+		{http.MethodDelete, "/forwarding/tent", "", http.StatusNotFound, []bool{false}},
+	}
+
+	for _, tt := range tests {
+		response := request(tt.method, tt.path, tt.body)
+		if response.Code != tt.code {
+			test.Errorf("%s %s: Expected %d, got %d: %s", tt.method, tt.path, tt.code, response.Code, response.Body.String())
+		}
+		destinations := forwarder.Destinations()
+		if len(destinations) != len(tt.disabled) {
+			test.Fatalf("%s %s: Expected %d destinations, got %d", tt.method, tt.path, len(tt.disabled), len(destinations))
+		}
+		for i, destination := range destinations {
+			if destination.Disabled != tt.disabled[i] {
+				test.Errorf("%s %s: Expected %s disabled %v, got %v", tt.method, tt.path, destination.Name, tt.disabled[i], destination.Disabled)
+			}
+		}
+	}
+
+	var status ServiceStatus
+	if err := json.Unmarshal(request(http.MethodGet, "/status", "").Body.Bytes(), &status); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	if len(status.Forwarding) != 1 || status.Forwarding[0].Name != "pad" || status.Forwarding[0].Protocol != "tcp" {
+		test.Errorf("Expected the pad destination, got %+v", status.Forwarding)
+	}
+}
+
+func TestForwardingAPIToken(test *testing.T) {
+	test.Cleanup(resetState)
+	forwarder := startForwarder(test)
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		code          int
+	}{
+		{"no token configured", "", "Bearer ", http.StatusNotFound},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		test.Run(tt.name, func(test *testing.T) {
+			server := NewStatusServer(StatusInfo{Forwarder: forwarder, ForwardingToken: tt.token})
+			recorder := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/forwarding/tent", strings.NewReader(`{"address": "127.0.0.1"}`))
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			server.Handler().ServeHTTP(recorder, r)
+			if recorder.Code != tt.code {
+				test.Errorf("Expected %d, got %d", tt.code, recorder.Code)
+			}
+			// listing destinations doesn't need the token
+			if response := getStatus(test, server, http.MethodGet, "/forwarding"); response.Code != http.StatusOK {
+				test.Errorf("Expected %d, got %d", http.StatusOK, response.Code)
+			}
+		})
+	}
+	if destinations := forwarder.Destinations(); len(destinations) != 1 {
+		test.Errorf("Expected 1 destination, got %d", len(destinations))
+	}
+}
@@ -0,0 +1,232 @@
+package proc
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+// StationTag is the database tag that identifies the station that delivered a merged packet first.
+// Later copies from other stations aren't recorded with the packet, only counted in StationStats.
+const StationTag = "station"
+
+// StationStats holds the delivery counters of a station for a packet.
+type StationStats struct {
+	Station   string `json:"station"`
+	Delivered uint64 `json:"delivered"` // Copies of the packet delivered by the station
+	First     uint64 `json:"first"`     // Packets the station delivered first, which were published
+	Exclusive uint64 `json:"exclusive"` // Packets no other station delivered within the merge window
+}
+
+// validateMerge checks the merge settings and the sequence measurement of each packet.
+func validateMerge(config *Configuration) error {
+	if config.Merge != nil {
+		if err := config.Merge.Validate(); err != nil {
+			return err
+		}
+		for _, vehicle := range config.Vehicles {
+			if len(vehicle.Sources) > 0 {
+				return fmt.Errorf("vehicle %s is identified by its sources, but sources identify stations when merging", vehicle.Name)
+			}
+		}
+	}
+
+	for _, packet := range config.TelemetryPackets {
+		if packet.Sequence == "" {
+			continue
+		}
+		if config.Merge == nil {
+			return fmt.Errorf("packet %s has a sequence but no merge stations are defined", packet.Name)
+		}
+		if packet.CCSDS != nil {
+			return fmt.Errorf("CCSDS packet %s is merged by its sequence count, and can't have a sequence", packet.Name)
+		}
+		if !slices.Contains(packet.Measurements, packet.Sequence) {
+			return fmt.Errorf("packet %s sequence %s is not one of its measurements", packet.Name, packet.Sequence)
+		}
+		measurement := config.Measurements[packet.Sequence]
+		if measurement.Type != "int" || measurement.ScalingFactor != 1 {
+			return fmt.Errorf("packet %s sequence %s must be an unscaled int", packet.Name, packet.Sequence)
+		}
+	}
+	return nil
+}
+
+// mergeKey identifies the copies of a packet sent by a vehicle.
+type mergeKey struct {
+	vehicle  int // Index of the vehicle that sent the packet, -1 if it isn't attributed to one
+	sequence uint64
+}
+
+// mergeEntry is a packet remembered to drop its copies.
+type mergeEntry struct {
+	key       mergeKey
+	received  time.Time // Time the first copy was received
+	delivered uint64    // Bit set for each station that delivered a copy, to count exclusive deliveries
+}
+
+// packetMerger drops the copies of a packet delivered by several stations within the merge window,
+// identifying copies by the vehicle that sent the packet and its sequence measurement, CCSDS sequence count or a hash of its data,
+// so vehicles sharing a packet don't drop each other's packets.
+// It counts the packets delivered by each station, the last station counting sources that aren't configured.
+// It is safe for concurrent use.
+type packetMerger struct {
+	window   time.Duration
+	names    []string
+	sources  [][]netip.Prefix
+	decoder  *tlm.Decoder // Decodes the sequence measurement. nil if packets are identified by a hash
+	sequence int          // Index of the sequence measurement in the packet
+	counters *packetCounters
+
+	mu       sync.Mutex
+	entries  map[mergeKey]*mergeEntry
+	order    []*mergeEntry // Entries oldest first, to expire them
+	stations []StationStats
+}
+
+// newPacketMerger creates a merger for a packet using the stations in the global configuration.
+func newPacketMerger(packet tlm.TelemetryPacket, counters *packetCounters) (*packetMerger, error) {
+	merge := GswConfig.Merge
+	merger := &packetMerger{
+		window:   merge.WindowOrDefault(),
+		counters: counters,
+		entries:  make(map[mergeKey]*mergeEntry),
+	}
+
+	if packet.Sequence != "" {
+		decoder, err := NewPacketDecoder(packet)
+		if err != nil {
+			return nil, err
+		}
+		merger.decoder = decoder
+		merger.sequence = slices.Index(packet.Measurements, packet.Sequence)
+	}
+
+	for _, station := range merge.Stations {
+		sources, err := station.SourcePrefixes()
+		if err != nil {
+			return nil, err
+		}
+		merger.names = append(merger.names, station.Name)
+		merger.sources = append(merger.sources, sources)
+	}
+	merger.names = append(merger.names, tlm.UnknownStation)
+	merger.stations = make([]StationStats, len(merger.names))
+	for i, name := range merger.names {
+		merger.stations[i].Station = name
+	}
+
+	counters.merger.Store(merger)
+	return merger, nil
+}
+
+// key identifies the copies of a packet by its sequence measurement, or by a hash of its data.
+func (m *packetMerger) key(data []byte) uint64 {
+	if m.decoder != nil {
+		if value, err := m.decoder.DecodeMeasurement(data, m.sequence); err == nil {
+			switch value.Kind {
+			case tlm.ValueUint:
+				return value.Uint
+			case tlm.ValueInt:
+				return uint64(value.Int)
+			}
+		}
+	}
+	hash := fnv.New64a()
+	hash.Write(data)
+	return hash.Sum64()
+}
+
+// station returns the index of the station a packet was delivered by.
+func (m *packetMerger) station(source netip.Addr) int {
+	source = source.Unmap()
+	for i, prefixes := range m.sources {
+		for _, prefix := range prefixes {
+			if prefix.Contains(source) {
+				return i
+			}
+		}
+	}
+	return len(m.sources)
+}
+
+// accept records a packet identified by sequence sent by the vehicle at index vehicle, or -1 if it isn't attributed,
+// delivered from source at time now.
+// It returns the station that delivered it, and whether it is the first copy, which should be published.
+// Only the first station is recorded with a published packet, since copies arrive after it is published.
+// A packet is only a copy if another station delivered the same key within the window.
+func (m *packetMerger) accept(vehicle int, sequence uint64, source netip.Addr, now time.Time) (string, bool) {
+	station := m.station(source)
+	key := mergeKey{vehicle: vehicle, sequence: sequence}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(now)
+
+	m.stations[station].Delivered++
+	if entry, ok := m.entries[key]; ok && entry.delivered&(1<<station) == 0 {
+		entry.delivered |= 1 << station
+		m.counters.duplicates.Add(1)
+		return m.names[station], false
+	}
+
+	// a station repeating a key sent a new packet, such as unchanged telemetry or a wrapped counter,
+	// so it starts a new entry and later copies are compared with it
+
+	entry := &mergeEntry{key: key, received: now, delivered: 1 << station}
+	m.entries[key] = entry
+	m.order = append(m.order, entry)
+	m.stations[station].First++
+	return m.names[station], true
+}
+
+// expire forgets the packets first received more than the merge window before now,
+// counting those that were delivered by a single station.
+func (m *packetMerger) expire(now time.Time) {
+	expired := 0
+	for _, entry := range m.order {
+		if now.Sub(entry.received) < m.window {
+			break
+		}
+		if bits.OnesCount64(entry.delivered) == 1 {
+			m.stations[bits.TrailingZeros64(entry.delivered)].Exclusive++
+		}
+		if m.entries[entry.key] == entry {
+			delete(m.entries, entry.key)
+		}
+		expired++
+	}
+	m.order = m.order[expired:]
+}
+
+// stats returns the delivery counters of each station, the last being for sources that aren't configured.
+func (m *packetMerger) stats() []StationStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(time.Now())
+	return slices.Clone(m.stations)
+}
+
+// MergedStationStats returns the delivery counters of each station for each merged packet, keyed by packet name.
+func MergedStationStats() map[string][]StationStats {
+	countersMu.Lock()
+	mergers := make(map[string]*packetMerger)
+	for packet, counters := range countersByPacket {
+		if merger := counters.merger.Load(); merger != nil {
+			mergers[packet] = merger
+		}
+	}
+	countersMu.Unlock()
+
+	stats := make(map[string][]StationStats, len(mergers))
+	for packet, merger := range mergers {
+		stats[packet] = merger.stats()
+	}
+	return stats
+}
@@ -0,0 +1,291 @@
+package proc
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+const mergeTestMeasurements = `
+name: merge_test
+measurements:
+  Counter:
+    name: Counter
+    size: 2
+    type: int
+    unsigned: true
+  Altitude:
+    name: Altitude
+    size: 4
+    type: int
+  Scaled:
+    name: Scaled
+    size: 2
+    type: int
+    scaling: 0.5
+  Vehicle:
+    name: Vehicle
+    size: 1
+    type: int
+`
+
+const mergeTestConfig = mergeTestMeasurements + `
+merge:
+  window: 2s
+  stations:
+    - name: pad
+      sources: [127.0.0.2]
+    - name: tent
+      sources: [127.0.0.3/32]
+`
+
+// parseMergeConfig parses the merge test config with the given packets.
+func parseMergeConfig(test *testing.T, packets string) {
+	test.Helper()
+	if _, err := ParseConfigBytes([]byte(mergeTestConfig + packets)); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+}
+
+func TestBadMergeConfig(test *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"sequence without merge", mergeTestMeasurements + "telemetry_packets:\n  - name: A\n    port: 10000\n    sequence: Counter\n    measurements: [Counter]\n"},
+		{"sequence not in packet", mergeTestConfig + "telemetry_packets:\n  - name: A\n    port: 10000\n    sequence: Counter\n    measurements: [Altitude]\n"},
+		{"sequence not an int", mergeTestConfig + "telemetry_packets:\n  - name: A\n    port: 10000\n    sequence: Scaled\n    measurements: [Scaled]\n"},
+		{"ccsds sequence", mergeTestConfig + "telemetry_packets:\n  - name: A\n    port: 10000\n    sequence: Counter\n    ccsds: {apid: 1}\n    measurements: [Counter]\n"},
+		{"vehicle sources", mergeTestConfig + "vehicles:\n  - name: alpha\n    sources: [10.0.0.5]\ntelemetry_packets:\n  - name: A\n    port: 10000\n    measurements: [Counter]\n"},
+		{"no stations", mergeTestMeasurements + "merge: {window: 1s}\ntelemetry_packets:\n  - name: A\n    port: 10000\n    measurements: [Counter]\n"},
+	}
+
+	for _, tt := range tests {
+		test.Run(tt.name, func(test *testing.T) {
+			test.Cleanup(resetState)
+			if _, err := ParseConfigBytes([]byte(tt.config)); err == nil {
+				test.Errorf("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestPacketMerger(test *testing.T) {
+	test.Cleanup(resetState)
+	parseMergeConfig(test, "telemetry_packets:\n  - name: A\n    port: 10000\n    sequence: Counter\n    measurements: [Counter, Altitude]\n")
+	counters := countersForPacket("A")
+	merger, err := newPacketMerger(GswConfig.TelemetryPackets[0], counters)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	pad := netip.MustParseAddr("127.0.0.2")
+	tent := netip.MustParseAddr("127.0.0.3")
+	other := netip.MustParseAddr("10.1.1.1")
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	deliveries := []struct {
+		key     uint64
+		source  netip.Addr
+		after   time.Duration
+		station string
+		first   bool
+	}{
+		{1, pad, 0, "pad", true},
+		{1, tent, 100 * time.Millisecond, "tent", false},
+		{2, tent, 200 * time.Millisecond, "tent", true},
+		{1, pad, 300 * time.Millisecond, "pad", true}, // a station repeating itself sent a new packet
+		{1, tent, 350 * time.Millisecond, "tent", false},
+		{3, other, 400 * time.Millisecond, tlm.UnknownStation, true},
+		{1, tent, 2400 * time.Millisecond, "tent", true}, // the window has passed, so the counter has wrapped
+	}
+	for i, delivery := range deliveries {
+		station, first := merger.accept(-1, delivery.key, delivery.source, start.Add(delivery.after))
+		if station != delivery.station || first != delivery.first {
+			test.Errorf("Delivery %d: Expected %s first %v, got %s first %v", i, delivery.station, delivery.first, station, first)
+		}
+	}
+	// forget every packet, counting those delivered by a single station
+	merger.mu.Lock()
+	merger.expire(start.Add(time.Hour))
+	merger.mu.Unlock()
+
+	expected := []StationStats{
+		{Station: "pad", Delivered: 2, First: 2, Exclusive: 0},
+		{Station: "tent", Delivered: 4, First: 2, Exclusive: 2},
+		{Station: tlm.UnknownStation, Delivered: 1, First: 1, Exclusive: 1},
+	}
+	stats := MergedStationStats()["A"]
+	if len(stats) != len(expected) {
+		test.Fatalf("Expected %d stations, got %+v", len(expected), stats)
+	}
+	for i := range expected {
+		if stats[i] != expected[i] {
+			test.Errorf("Expected %+v, got %+v", expected[i], stats[i])
+		}
+	}
+	if counters.duplicates.Load() != 2 {
+		test.Errorf("Expected 2 duplicates, got %d", counters.duplicates.Load())
+	}
+}
+
+func TestMergeKey(test *testing.T) {
+	test.Cleanup(resetState)
+	parseMergeConfig(test, `telemetry_packets:
+  - name: Sequenced
+    port: 10000
+    sequence: Counter
+    measurements: [Counter, Altitude]
+  - name: Hashed
+    port: 10001
+    measurements: [Counter, Altitude]
+`)
+
+	sequenced, err := newPacketMerger(GswConfig.TelemetryPackets[0], countersForPacket("Sequenced"))
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	hashed, err := newPacketMerger(GswConfig.TelemetryPackets[1], countersForPacket("Hashed"))
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	// packets with the same counter are copies even if the rest differs
+	a := []byte{0, 7, 0, 0, 0, 1}
+	b := []byte{0, 7, 0, 0, 0, 2}
+	if sequenced.key(a) != 7 || sequenced.key(b) != 7 {
+		test.Errorf("Expected key 7, got %d and %d", sequenced.key(a), sequenced.key(b))
+	}
+	if hashed.key(a) == hashed.key(b) || hashed.key(a) != hashed.key(bytes.Clone(a)) {
+		test.Errorf("Expected keys to match only for the same data")
+	}
+}
+
+func TestMergedUDP(test *testing.T) {
+	test.Cleanup(resetState)
+	parseMergeConfig(test, "telemetry_packets:\n  - name: A\n    port: 10000\n    sequence: Counter\n    measurements: [Counter, Altitude]\n")
+	packet := GswConfig.TelemetryPackets[0]
+	readers, out := startVehiclePacketWriter(test, packet)
+
+	// both stations deliver packet 1, and only the tent delivers packet 2
+	sendUDPPacket(test, "127.0.0.2", packet.Port, []byte{0, 1, 0, 0, 0, 10})
+	expectShmPacket(test, readers[""], []byte{0, 1, 0, 0, 0, 10})
+	sendUDPPacket(test, "127.0.0.3", packet.Port, []byte{0, 1, 0, 0, 0, 10})
+	sendUDPPacket(test, "127.0.0.3", packet.Port, []byte{0, 2, 0, 0, 0, 20})
+	expectShmPacket(test, readers[""], []byte{0, 2, 0, 0, 0, 20})
+
+	expected := []ReceivedPacket{{Station: "pad", Data: []byte{0, 1, 0, 0, 0, 10}}, {Station: "tent", Data: []byte{0, 2, 0, 0, 0, 20}}}
+	for _, want := range expected {
+		select {
+		case received := <-out:
+			if received.Station != want.Station || !bytes.Equal(received.Data, want.Data) {
+				test.Errorf("Expected % X from %s, got % X from %s", want.Data, want.Station, received.Data, received.Station)
+			}
+		case <-time.After(2 * time.Second):
+			test.Fatalf("Timed out waiting for % X", want.Data)
+		}
+	}
+
+	stats := waitIngestStats(test, "A", func(stats PacketStats) bool { return stats.Duplicates == 1 })
+	if stats.Received != 2 {
+		test.Errorf("Expected 2 received, got %d", stats.Received)
+	}
+	if delivered := MergedStationStats()["A"][1].Delivered; delivered != 2 {
+		test.Errorf("Expected 2 delivered by the tent, got %d", delivered)
+	}
+}
+
+func TestMergedRepeats(test *testing.T) {
+	test.Cleanup(resetState)
+	parseMergeConfig(test, "telemetry_packets:\n  - name: A\n    port: 10000\n    measurements: [Counter, Altitude]\n")
+	packet := GswConfig.TelemetryPackets[0]
+	packet.Port = freePort(test)
+	readers, out := startVehiclePacketWriter(test, packet)
+
+	// a station sending unchanged telemetry within the window delivers new packets, not copies
+	sendUDPPacket(test, "127.0.0.2", packet.Port, []byte{0, 1, 0, 0, 0, 10})
+	expectShmPacket(test, readers[""], []byte{0, 1, 0, 0, 0, 10})
+	sendUDPPacket(test, "127.0.0.2", packet.Port, []byte{0, 1, 0, 0, 0, 10})
+	expectShmPacket(test, readers[""], []byte{0, 1, 0, 0, 0, 10})
+	expectReceived(test, out, "", []byte{0, 1, 0, 0, 0, 10})
+	expectReceived(test, out, "", []byte{0, 1, 0, 0, 0, 10})
+
+	// the other station's copy is then a copy of the second packet
+	sendUDPPacket(test, "127.0.0.3", packet.Port, []byte{0, 1, 0, 0, 0, 10})
+	stats := waitIngestStats(test, "A", func(stats PacketStats) bool { return stats.Duplicates == 1 })
+	if stats.Received != 2 {
+		test.Errorf("Expected 2 received, got %d", stats.Received)
+	}
+}
+
+func TestMergedVehicles(test *testing.T) {
+	test.Cleanup(resetState)
+	parseMergeConfig(test, `vehicles:
+  - name: alpha
+    id: 1
+  - name: bravo
+    id: 2
+telemetry_packets:
+  - name: A
+    port: 10000
+    sequence: Counter
+    vehicle_id: Vehicle
+    measurements: [Vehicle, Counter]
+`)
+	packet := GswConfig.TelemetryPackets[0]
+	packet.Port = freePort(test)
+	readers, out := startVehiclePacketWriter(test, packet)
+
+	// both vehicles send counter 1, and each is only a copy of the same vehicle's packet
+	sendUDPPacket(test, "127.0.0.2", packet.Port, []byte{1, 0, 1})
+	expectShmPacket(test, readers["alpha"], []byte{1, 0, 1})
+	sendUDPPacket(test, "127.0.0.2", packet.Port, []byte{2, 0, 1})
+	expectShmPacket(test, readers["bravo"], []byte{2, 0, 1})
+	sendUDPPacket(test, "127.0.0.3", packet.Port, []byte{1, 0, 1})
+	sendUDPPacket(test, "127.0.0.3", packet.Port, []byte{2, 0, 1})
+	expectReceived(test, out, "alpha", []byte{1, 0, 1})
+	expectReceived(test, out, "bravo", []byte{2, 0, 1})
+
+	stats := waitIngestStats(test, "A", func(stats PacketStats) bool { return stats.Duplicates == 2 })
+	if stats.Received != 2 {
+		test.Errorf("Expected 2 received, got %d", stats.Received)
+	}
+}
+
+func TestMergedCCSDS(test *testing.T) {
+	test.Cleanup(resetState)
+	parseMergeConfig(test, "telemetry_packets:\n  - name: A\n    port: 10000\n    ccsds: {apid: 1}\n    measurements: [Counter]\n")
+	demux := &ccsdsDemux{
+		log:      logger.Log(),
+		counters: countersForPacket(ccsdsPortName(10000)),
+		routes:   make(map[uint16]*ccsdsRoute),
+		logged:   make(map[uint16]bool),
+	}
+	out := make(chan ReceivedPacket, 4)
+	sink, err := newPacketSink(logger.Log(), GswConfig.TelemetryPackets[0], out, test.TempDir())
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer sink.cleanup()
+	demux.routes[1] = &ccsdsRoute{sink: sink}
+
+	// copies are identified by their sequence count, and don't count as lost packets
+	demux.handle(spacePacket(1, 5, []byte{0, 1}), netip.MustParseAddr("127.0.0.2"))
+	demux.handle(spacePacket(1, 5, []byte{0, 1}), netip.MustParseAddr("127.0.0.3"))
+	demux.handle(spacePacket(1, 6, []byte{0, 2}), netip.MustParseAddr("127.0.0.3"))
+
+	if len(out) != 2 {
+		test.Fatalf("Expected 2 packets, got %d", len(out))
+	}
+	if received := <-out; received.Station != "pad" {
+		test.Errorf("Expected pad, got %s", received.Station)
+	}
+	stats := IngestStats()["A"]
+	if stats.Duplicates != 1 || stats.SequenceLost != 0 {
+		test.Errorf("Expected 1 duplicate and no lost packets, got %+v", stats)
+	}
+}
@@ -0,0 +1,195 @@
+package proc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AarC10/GSW-V2/lib/db"
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"go.uber.org/zap"
+)
+
+// labelEscaper escapes the characters that are special in Prometheus label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsBuffer formats metrics in the Prometheus text exposition format.
+type metricsBuffer struct {
+	bytes.Buffer
+}
+
+// family writes the HELP and TYPE lines starting a metric family.
+func (b *metricsBuffer) family(name string, metricType string, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// sample writes a sample with labels given as alternating names and values.
+func (b *metricsBuffer) sample(name string, value string, labels ...string) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// packetCounter writes a metric family with one sample per packet.
+func (b *metricsBuffer) packetCounter(name string, help string, names []string, packets []*packetCounters, value func(*packetCounters) uint64) {
+	b.family(name, "counter", help)
+	for i, counters := range packets {
+		b.sample(name, strconv.FormatUint(value(counters), 10), "packet", names[i])
+	}
+}
+
+// stationCounter writes a metric family with one sample per merged packet and station.
+func (b *metricsBuffer) stationCounter(name string, help string, names []string, stations map[string][]StationStats, value func(StationStats) uint64) {
+	b.family(name, "counter", help)
+	for _, packet := range names {
+		for _, station := range stations[packet] {
+			b.sample(name, strconv.FormatUint(value(station), 10), "packet", packet, "station", station.Station)
+		}
+	}
+}
+
+// forwardCounter writes a metric family with one sample per forwarding destination.
+func (b *metricsBuffer) forwardCounter(name string, help string, destinations []ForwardStatus, value func(ForwardStatus) uint64) {
+	b.family(name, "counter", help)
+	for _, destination := range destinations {
+		b.sample(name, strconv.FormatUint(value(destination), 10), "destination", destination.Name)
+	}
+}
+
+// histogram writes a decode latency histogram sample set for a packet.
+func (b *metricsBuffer) histogram(name string, packet string, h *histogram) {
+	var count uint64
+	for i := range h.counts {
+		count += h.counts[i].Load()
+		le := "+Inf"
+		if i < len(decodeBuckets) {
+			le = strconv.FormatFloat(decodeBuckets[i].Seconds(), 'g', -1, 64)
+		}
+		b.sample(name+"_bucket", strconv.FormatUint(count, 10), "packet", packet, "le", le)
+	}
+	b.sample(name+"_sum", strconv.FormatFloat(float64(h.sum.Load())/1e9, 'g', -1, 64), "packet", packet)
+	b.sample(name+"_count", strconv.FormatUint(count, 10), "packet", packet)
+}
+
+// WriteMetrics writes the counters of every packet in the Prometheus text exposition format.
+// Every metric has a packet label holding the packet name from the config.
+func WriteMetrics(w io.Writer) error {
+	countersMu.Lock()
+	names := make([]string, 0, len(countersByPacket))
+	for name := range countersByPacket {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	packets := make([]*packetCounters, len(names))
+	for i, name := range names {
+		packets[i] = countersByPacket[name]
+	}
+	handlers := append([]db.Handler(nil), databaseHandlers...)
+	countersMu.Unlock()
+
+	var b metricsBuffer
+	b.packetCounter("gsw_packets_received_total", "Packets published to shared memory.", names, packets,
+		func(c *packetCounters) uint64 { return c.received.Load() })
+	b.packetCounter("gsw_packets_wrong_size_total", "Packets dropped for having the wrong size.", names, packets,
+		func(c *packetCounters) uint64 { return c.wrongSize.Load() })
+	b.packetCounter("gsw_packets_kernel_dropped_total", "Datagrams dropped by the kernel because the socket receive buffer was full.", names, packets,
+		func(c *packetCounters) uint64 { return c.kernelDrops.Load() })
+	b.packetCounter("gsw_packets_sequence_lost_total", "CCSDS packets missing from gaps in the sequence count.", names, packets,
+		func(c *packetCounters) uint64 { return c.sequenceLost.Load() })
+	b.packetCounter("gsw_packets_unroutable_total", "CCSDS packets with an unknown APID or segmented user data, counted for the port.", names, packets,
+		func(c *packetCounters) uint64 { return c.unroutable.Load() })
+	b.packetCounter("gsw_shm_write_errors_total", "Packets that couldn't be written to shared memory.", names, packets,
+		func(c *packetCounters) uint64 { return c.shmErrors.Load() })
+	b.packetCounter("gsw_archive_dropped_total", "Datagrams not archived because the archive writer was behind.", names, packets,
+		func(c *packetCounters) uint64 { return c.archiveDrops.Load() })
+	b.packetCounter("gsw_packets_duplicate_total", "Copies of packets already delivered by another station, dropped when merging stations.", names, packets,
+		func(c *packetCounters) uint64 { return c.duplicates.Load() })
+	b.packetCounter("gsw_packets_auth_failed_total", "Packets dropped for a missing or invalid authentication tag.", names, packets,
+		func(c *packetCounters) uint64 { return c.authFailed.Load() })
+	b.packetCounter("gsw_db_dropped_total", "Packets not written to the database because the database writer was behind.", names, packets,
+		func(c *packetCounters) uint64 { return c.dbDrops.Load() })
+	b.packetCounter("gsw_db_write_errors_total", "Failed database inserts.", names, packets,
+		func(c *packetCounters) uint64 { return c.dbErrors.Load() })
+
+	b.family("gsw_packets_rejected_total", "counter", "Datagrams dropped for coming from a source outside allowed_sources.")
+	rejected := RejectedDatagrams()
+	for _, name := range names {
+		sources := make([]string, 0, len(rejected[name]))
+		for source := range rejected[name] {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		for _, source := range sources {
+			b.sample("gsw_packets_rejected_total", strconv.FormatUint(rejected[name][source], 10), "packet", name, "source", source)
+		}
+	}
+
+	stations := MergedStationStats()
+	b.stationCounter("gsw_station_delivered_total", "Copies of packets delivered by each station when merging stations.", names, stations,
+		func(s StationStats) uint64 { return s.Delivered })
+	b.stationCounter("gsw_station_first_total", "Packets published from each station, which delivered them first.", names, stations,
+		func(s StationStats) uint64 { return s.First })
+	b.stationCounter("gsw_station_exclusive_total", "Packets only delivered by one station within the merge window.", names, stations,
+		func(s StationStats) uint64 { return s.Exclusive })
+
+	b.family("gsw_db_queue_depth", "gauge", "Packets waiting for the database writer.")
+	for i, counters := range packets {
+		if queue := counters.dbQueue.Load(); queue != nil {
+			b.sample("gsw_db_queue_depth", strconv.Itoa(len(*queue)), "packet", names[i])
+		}
+	}
+
+	b.family("gsw_decode_duration_seconds", "histogram", "Time taken to decode packets for the database.")
+	for i, counters := range packets {
+		b.histogram("gsw_decode_duration_seconds", names[i], &counters.decode)
+	}
+
+	var asyncErrors uint64
+	for _, handler := range handlers {
+		if counter, ok := handler.(db.WriteErrorCounter); ok {
+			asyncErrors += counter.WriteErrors()
+		}
+	}
+	b.family("gsw_db_async_write_errors_total", "counter", "Failed asynchronous database writes, such as InfluxDB v2 batch writes.")
+	b.sample("gsw_db_async_write_errors_total", strconv.FormatUint(asyncErrors, 10))
+
+	b.family("gsw_archive_write_errors_total", "counter", "Datagrams that couldn't be written to the archive.")
+	b.sample("gsw_archive_write_errors_total", strconv.FormatUint(archiveErrors.Load(), 10))
+
+	var destinations []ForwardStatus
+	if forwarder := activeForwarder.Load(); forwarder != nil {
+		destinations = forwarder.Destinations()
+	}
+	b.forwardCounter("gsw_forward_sent_total", "Packets forwarded to another ground station.", destinations,
+		func(d ForwardStatus) uint64 { return d.Sent })
+	b.forwardCounter("gsw_forward_dropped_total", "Packets not forwarded because the destination was behind.", destinations,
+		func(d ForwardStatus) uint64 { return d.Dropped })
+	b.forwardCounter("gsw_forward_send_errors_total", "Packets that couldn't be sent to the destination.", destinations,
+		func(d ForwardStatus) uint64 { return d.SendErrors })
+
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// ServeMetrics serves the metrics written by WriteMetrics over HTTP.
+func ServeMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WriteMetrics(w); err != nil {
+		logger.Log().Named("metrics").Warn("couldn't write metrics", zap.Error(err))
+	}
+}
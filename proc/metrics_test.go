@@ -0,0 +1,148 @@
+package proc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/db"
+)
+
+func TestHistogramObserve(test *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		bucket   int
+	}{
+		{0, 0},
+		{time.Microsecond, 0},
+		{time.Microsecond + 1, 1},
+		{3 * time.Microsecond, 2},
+		{time.Millisecond, 9},
+		{5 * time.Millisecond, 10},
+		{time.Second, len(decodeBuckets)},
+	}
+
+	for _, tt := range tests {
+		var h histogram
+		h.observe(tt.duration)
+		if h.counts[tt.bucket].Load() != 1 {
+			test.Errorf("Expected %s in bucket %d", tt.duration, tt.bucket)
+		}
+		if h.sum.Load() != uint64(tt.duration) {
+			test.Errorf("Expected sum %d, got %d", tt.duration, h.sum.Load())
+		}
+	}
+}
+
+// errorCountingHandler is a db.Handler reporting a fixed number of asynchronous write errors.
+type errorCountingHandler struct {
+	recordingHandler
+	errors uint64
+}
+
+func (h *errorCountingHandler) WriteErrors() uint64 {
+	return h.errors
+}
+
+func TestWriteMetrics(test *testing.T) {
+	test.Cleanup(resetState)
+
+	counters := countersForPacket(`Stand "A"`)
+	counters.received.Add(5)
+	counters.wrongSize.Add(2)
+	counters.kernelDrops.Add(7)
+	counters.shmErrors.Add(1)
+	counters.dbDrops.Add(3)
+	counters.decode.observe(3 * time.Microsecond)
+	counters.decode.observe(2 * time.Second)
+	queue := make(chan ReceivedPacket, 4)
+	queue <- ReceivedPacket{}
+	queue <- ReceivedPacket{}
+	counters.dbQueue.Store(&queue)
+	countRejected(`Stand "A"`, netip.MustParseAddr("10.0.0.1"))
+	countersForPacket("Engine")
+	registerDatabaseHandler(&errorCountingHandler{errors: 4})
+	registerDatabaseHandler(&errorCountingHandler{errors: 5})
+
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	output := buf.String()
+
+	expected := []string{
+		"# TYPE gsw_packets_received_total counter",
+		`gsw_packets_received_total{packet="Engine"} 0`,
+		`gsw_packets_received_total{packet="Stand \"A\""} 5`,
+		`gsw_packets_wrong_size_total{packet="Stand \"A\""} 2`,
+		`gsw_packets_kernel_dropped_total{packet="Stand \"A\""} 7`,
+		`gsw_shm_write_errors_total{packet="Stand \"A\""} 1`,
+		`gsw_db_dropped_total{packet="Stand \"A\""} 3`,
+		`gsw_packets_rejected_total{packet="Stand \"A\"",source="10.0.0.1"} 1`,
+		`gsw_db_queue_depth{packet="Stand \"A\""} 2`,
+		"# TYPE gsw_decode_duration_seconds histogram",
+		`gsw_decode_duration_seconds_bucket{packet="Stand \"A\"",le="2.5e-06"} 0`,
+		`gsw_decode_duration_seconds_bucket{packet="Stand \"A\"",le="5e-06"} 1`,
+		`gsw_decode_duration_seconds_bucket{packet="Stand \"A\"",le="0.01"} 1`,
+		`gsw_decode_duration_seconds_bucket{packet="Stand \"A\"",le="+Inf"} 2`,
+		`gsw_decode_duration_seconds_sum{packet="Stand \"A\""} 2.000003`,
+		`gsw_decode_duration_seconds_count{packet="Stand \"A\""} 2`,
+		"gsw_db_async_write_errors_total 9",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			test.Errorf("Expected line %q in:\n%s", line, output)
+		}
+	}
+	if strings.Contains(output, `gsw_db_queue_depth{packet="Engine"}`) {
+		test.Errorf("Expected no queue depth for a packet without a database writer")
+	}
+}
+
+// failingHandler is a db.Handler whose inserts always fail.
+type failingHandler struct {
+	recordingHandler
+}
+
+func (h *failingHandler) Insert(measurements db.MeasurementGroup) error {
+	h.groups <- measurements
+	return errors.New("insert failed")
+}
+
+func TestDatabaseWriterMetrics(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := vehicleTestPacket(test, 1)
+	handler := &failingHandler{recordingHandler{groups: make(chan db.MeasurementGroup, 1)}}
+	channel := make(chan ReceivedPacket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go DatabaseWriter(ctx, handler, packet, channel)
+
+	channel <- ReceivedPacket{Data: []byte{0, 0, 0, 1}}
+	<-handler.groups
+
+	counters := countersForPacket(packet.Name)
+	deadline := time.Now().Add(2 * time.Second)
+	for counters.dbErrors.Load() != 1 {
+		if time.Now().After(deadline) {
+			test.Fatalf("Expected 1 database error, got %d", counters.dbErrors.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var decoded uint64
+	for i := range counters.decode.counts {
+		decoded += counters.decode.counts[i].Load()
+	}
+	if decoded != 1 {
+		test.Errorf("Expected 1 decoded packet, got %d", decoded)
+	}
+	if counters.dbQueue.Load() == nil {
+		test.Errorf("Expected the database writer to register its queue")
+	}
+}
@@ -0,0 +1,203 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"go.uber.org/zap"
+)
+
+// reattachInterval is how often a PacketReader tries to reattach while the writer is down.
+const reattachInterval = 500 * time.Millisecond
+
+// ReaderState is the state of a PacketReader.
+type ReaderState int32
+
+const (
+	// ReaderAttached means the reader is reading the packets written by gsw_service.
+	ReaderAttached ReaderState = iota
+	// ReaderWriterDown means gsw_service stopped writing the packet, and the reader is waiting for it to restart.
+	ReaderWriterDown
+)
+
+// String returns the name of the state.
+func (s ReaderState) String() string {
+	switch s {
+	case ReaderAttached:
+		return "attached"
+	case ReaderWriterDown:
+		return "writer down"
+	}
+	return fmt.Sprintf("ReaderState(%d)", int32(s))
+}
+
+// PacketReader reads a packet sent by a vehicle from shared memory, and reattaches when gsw_service restarts.
+// Reattaching reloads the telemetry config from shared memory, since it may have changed,
+// so the packet's definition can change too. The reloaded definitions are kept by the reader,
+// leaving the global config as it was. Like ipc.Reader, it is not thread safe.
+type PacketReader struct {
+	log          *zap.Logger
+	name         string // Name of the packet, to find it in a reloaded config
+	vehicle      string
+	mode         ipc.ReadMode
+	shmDir       string
+	packet       tlm.TelemetryPacket
+	measurements map[string]tlm.Measurement // Definitions of the packet's measurements. Shared, must not be modified
+	reader       ipc.RingReader             // nil while the writer is down
+	open         ringOpener                 // Opens the ring read
+	state        atomic.Int32
+	onState      func(state ReaderState, packet tlm.TelemetryPacket)
+}
+
+// NewPacketReader creates a reader for a telemetry packet sent by a vehicle, reading its packets in the given mode.
+// An empty vehicle reads the packets that aren't attributed to a vehicle.
+// The packet's measurements are defined by the global config until the reader reattaches.
+func NewPacketReader(packet tlm.TelemetryPacket, vehicle string, mode ipc.ReadMode, shmDir string) (*PacketReader, error) {
+	return newPacketReader(packet, GswConfig.Measurements, vehicle, mode, shmDir, newIpcReaderForPacket)
+}
+
+// ringOpener opens a reader for one of the rings of a packet sent by a vehicle, with the definitions of its measurements.
+type ringOpener func(packet tlm.TelemetryPacket, measurements map[string]tlm.Measurement, vehicle string, shmDir string) (ipc.RingReader, error)
+
+// newPacketReader creates a reader for the ring of a packet sent by a vehicle that open opens,
+// with the definitions of the packet's measurements.
+func newPacketReader(packet tlm.TelemetryPacket, measurements map[string]tlm.Measurement, vehicle string, mode ipc.ReadMode, shmDir string, open ringOpener) (*PacketReader, error) {
+	reader, err := open(packet, measurements, vehicle, shmDir)
+	if err != nil {
+		return nil, err
+	}
+	reader.SetReadMode(mode)
+
+	return &PacketReader{
+		log:          logger.Log().Named("packet_reader").With(zap.String("packet", packet.Name), zap.String("vehicle", vehicle)),
+		name:         packet.Name,
+		vehicle:      vehicle,
+		mode:         mode,
+		shmDir:       shmDir,
+		packet:       packet,
+		measurements: measurements,
+		reader:       reader,
+		open:         open,
+	}, nil
+}
+
+// SetStateHandler sets a function called by Read when the writer goes down, and when the reader reattaches.
+// It is passed the packet's definition, which is reloaded with the telemetry config when the reader reattaches,
+// so decoders for the packet can be rebuilt with NewDecoder.
+func (r *PacketReader) SetStateHandler(handler func(state ReaderState, packet tlm.TelemetryPacket)) {
+	r.onState = handler
+}
+
+// State returns whether the reader is attached or waiting for the writer. It is safe to call concurrently with Read.
+func (r *PacketReader) State() ReaderState {
+	return ReaderState(r.state.Load())
+}
+
+// Packet returns the packet's definition from the telemetry config the reader last attached with.
+func (r *PacketReader) Packet() tlm.TelemetryPacket {
+	return r.packet
+}
+
+// NewDecoder creates a decoder for the packet's current definition, from the telemetry config the reader last attached with.
+func (r *PacketReader) NewDecoder() (*tlm.Decoder, error) {
+	return tlm.NewDecoder(r.packet, r.measurements)
+}
+
+// Read reads a packet. While the writer is down, it waits for it to restart and reattaches,
+// until the context is done.
+func (r *PacketReader) Read(ctx context.Context) (ipc.ReaderMessage, error) {
+	for {
+		if r.reader == nil {
+			if err := r.reattach(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		message, err := r.reader.Read(ctx)
+		if !errors.Is(err, ipc.ErrWriterGone) {
+			return message, err
+		}
+		r.log.Warn("writer is down, waiting for gsw_service to restart", zap.Error(err))
+		r.reader.Cleanup()
+		r.reader = nil
+		r.setState(ReaderWriterDown)
+	}
+}
+
+// Cleanup cleans up the reader.
+func (r *PacketReader) Cleanup() {
+	if r.reader != nil {
+		r.reader.Cleanup()
+		r.reader = nil
+	}
+}
+
+// setState updates the reader's state and calls the state handler.
+func (r *PacketReader) setState(state ReaderState) {
+	r.state.Store(int32(state))
+	if r.onState != nil {
+		r.onState(state, r.packet)
+	}
+}
+
+// reattach retries attaching to the packet's new segment until it succeeds or the context is done.
+func (r *PacketReader) reattach(ctx context.Context) error {
+	ticker := time.NewTicker(reattachInterval)
+	defer ticker.Stop()
+	for {
+		err := r.attach()
+		if err == nil {
+			r.log.Info("reattached")
+			r.setState(ReaderAttached)
+			return nil
+		}
+		r.log.Debug("couldn't reattach", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// attach reloads the telemetry config and opens the packet's segment.
+func (r *PacketReader) attach() error {
+	config, err := loadTelemetryConfigFromShm(r.shmDir)
+	if err != nil {
+		return fmt.Errorf("reloading telemetry config: %w", err)
+	}
+	var packet *tlm.TelemetryPacket
+	for i := range config.TelemetryPackets {
+		if config.TelemetryPackets[i].Name == r.name {
+			packet = &config.TelemetryPackets[i]
+		}
+	}
+	if packet == nil {
+		return fmt.Errorf("packet %s is no longer in the telemetry config", r.name)
+	}
+
+	reader, err := r.open(*packet, config.Measurements, r.vehicle, r.shmDir)
+	if err != nil {
+		return err
+	}
+	// a segment left behind by a writer that didn't clean up isn't worth attaching to
+	if err := reader.CheckWriter(); err != nil {
+		reader.Cleanup()
+		return err
+	}
+	reader.SetReadMode(r.mode)
+	// the new segment is read from its start, so no packet written before reattaching is skipped in ReadAll mode
+	reader.Rewind()
+
+	r.packet = *packet
+	r.measurements = config.Measurements
+	r.reader = reader
+	return nil
+}
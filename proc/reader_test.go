@@ -0,0 +1,179 @@
+package proc
+
+import (
+	"context"
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+const readerTestConfig = `
+name: reader_test
+measurements:
+  Altitude:
+    name: Altitude
+    size: 4
+    type: int
+  Status:
+    name: Status
+    size: 2
+    type: int
+telemetry_packets:
+  - name: Packet
+    port: 10000
+    measurements:
+`
+
+// startTestService writes a config to SHM and creates the writer of its packet, like gsw_service starting.
+// It doesn't use the global config, which readers leave as it was.
+func startTestService(dir string, measurements string, packetSize int) (ipc.Writer, func(), error) {
+	cleanupConfig, err := WriteTelemetryConfigToShm(dir, []byte(readerTestConfig+measurements))
+	if err != nil {
+		return nil, nil, err
+	}
+	writer, err := ipc.NewWriter(IpcBackend, "10000", "Packet", packetSize, dir)
+	if err != nil {
+		cleanupConfig()
+		return nil, nil, err
+	}
+	return writer, func() {
+		writer.Cleanup()
+		cleanupConfig()
+	}, nil
+}
+
+func TestPacketReaderReattach(test *testing.T) {
+	for _, backend := range []ipc.Backend{ipc.BackendShm, ipc.BackendSocket} {
+		test.Run(string(backend), func(test *testing.T) {
+			IpcBackend = backend
+			test.Cleanup(func() { IpcBackend = ipc.BackendShm })
+			test.Cleanup(resetState)
+			dir := test.TempDir()
+			config, err := ParseConfigBytes([]byte(readerTestConfig + "      - Altitude\n"))
+			if err != nil {
+				test.Fatalf("Expected nil, got %v", err)
+			}
+			writer, stop, err := startTestService(dir, "      - Altitude\n", 4)
+			if err != nil {
+				test.Fatalf("Expected nil, got %v", err)
+			}
+
+			reader, err := NewPacketReader(config.TelemetryPackets[0], "", ipc.ReadAll, dir)
+			if err != nil {
+				stop()
+				test.Fatalf("Expected nil, got %v", err)
+			}
+			defer reader.Cleanup()
+
+			var states []ReaderState
+			down := make(chan struct{})
+			reader.SetStateHandler(func(state ReaderState, packet tlm.TelemetryPacket) {
+				states = append(states, state)
+				if state == ReaderWriterDown {
+					close(down)
+				}
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := writer.Write(binary.BigEndian.AppendUint32(nil, 1)); err != nil {
+				test.Fatalf("Expected nil, got %v", err)
+			}
+			message, err := reader.Read(ctx)
+			if err != nil {
+				test.Fatalf("Expected nil, got %v", err)
+			}
+			if value := binary.BigEndian.Uint32(message.Data()); value != 1 {
+				test.Errorf("Expected 1, got %d", value)
+			}
+
+			// gsw_service restarts with a config adding a measurement to the packet, and writes a packet right away
+			stop()
+			restarted := make(chan func(), 1)
+			go func() {
+				<-down
+				writer, stop, err := startTestService(dir, "      - Altitude\n      - Status\n", 6)
+				if err != nil {
+					test.Errorf("Expected nil, got %v", err)
+					close(restarted)
+					return
+				}
+				_ = writer.Write([]byte{0, 0, 0, 2, 0, 3})
+				restarted <- stop
+			}()
+			defer func() {
+				select {
+				case stop, ok := <-restarted:
+					if ok {
+						stop()
+					}
+				case <-time.After(time.Second):
+				}
+			}()
+
+			message, err = reader.Read(ctx)
+			if err != nil {
+				test.Fatalf("Expected nil, got %v", err)
+			}
+			if !slices.Equal(message.Data(), []byte{0, 0, 0, 2, 0, 3}) {
+				test.Errorf("Expected [0 0 0 2 0 3], got %v", message.Data())
+			}
+			if !slices.Equal(states, []ReaderState{ReaderWriterDown, ReaderAttached}) {
+				test.Errorf("Expected [writer down attached], got %v", states)
+			}
+			if reader.State() != ReaderAttached {
+				test.Errorf("Expected attached, got %v", reader.State())
+			}
+			if measurements := reader.Packet().Measurements; !slices.Equal(measurements, []string{"Altitude", "Status"}) {
+				test.Errorf("Expected [Altitude Status], got %v", measurements)
+			}
+			if decoder, err := reader.NewDecoder(); err != nil || decoder.Len() != 2 {
+				test.Errorf("Expected a decoder of 2 measurements, got %v", err)
+			}
+			// the reloaded config is the reader's own
+			if measurements := GswConfig.TelemetryPackets[0].Measurements; !slices.Equal(measurements, []string{"Altitude"}) {
+				test.Errorf("Expected [Altitude] in the global config, got %v", measurements)
+			}
+		})
+	}
+}
+
+func TestLoadTelemetryConfigFromShm(test *testing.T) {
+	test.Cleanup(resetState)
+	if _, err := ParseConfigBytes([]byte(readerTestConfig + "      - Altitude\n")); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	dir := test.TempDir()
+
+	cleanup, err := WriteTelemetryConfigToShm(dir, []byte(readerTestConfig+"      - Status\n"))
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	config, err := loadTelemetryConfigFromShm(dir)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	if again, _ := loadTelemetryConfigFromShm(dir); again != config {
+		test.Errorf("Expected the same config to be parsed once")
+	}
+	cleanup()
+
+	// a config that can't be parsed leaves every config as it was
+	if cleanup, err = WriteTelemetryConfigToShm(dir, []byte("name: broken\n")); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer cleanup()
+	if _, err := loadTelemetryConfigFromShm(dir); err == nil {
+		test.Errorf("Expected error, got nil")
+	}
+	if measurements := config.TelemetryPackets[0].Measurements; !slices.Equal(measurements, []string{"Status"}) {
+		test.Errorf("Expected [Status], got %v", measurements)
+	}
+	if measurements := GswConfig.TelemetryPackets[0].Measurements; !slices.Equal(measurements, []string{"Altitude"}) {
+		test.Errorf("Expected [Altitude] in the global config, got %v", measurements)
+	}
+}
@@ -0,0 +1,22 @@
+package proc
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/AarC10/GSW-V2/lib/serial"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"go.uber.org/zap"
+)
+
+// serialPacketReceiver receives framed telemetry packets from a serial device.
+// The device is reopened with backoff if it can't be opened or stops responding.
+func serialPacketReceiver(ctx context.Context, log *zap.Logger, cfg tlm.SerialConfig, sink packetHandler) error {
+	open := func(context.Context) (io.ReadCloser, error) {
+		return serial.Open(cfg.Device, cfg.Config)
+	}
+
+	log.Info(fmt.Sprintf("Reading %s for telemetry packet...", cfg.Device))
+	return reconnectingStream(ctx, log.With(zap.String("device", cfg.Device)), cfg.ReopenDelay, open, cfg.Framing, sink)
+}
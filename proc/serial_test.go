@@ -0,0 +1,57 @@
+package proc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/framing"
+	"github.com/AarC10/GSW-V2/lib/serial"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+func TestSerialCOBS(test *testing.T) {
+	test.Cleanup(resetState)
+	controller, device, err := serial.OpenPTY()
+	if err != nil {
+		test.Skipf("pseudo terminals unavailable: %v", err)
+	}
+	defer controller.Close()
+
+	config, err := ParseConfig(TestDataDir + "good.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	packet := config.TelemetryPackets[0]
+	packet.Serial = &tlm.SerialConfig{
+		Device:      device,
+		ReopenDelay: 10 * time.Millisecond,
+		Framing:     framing.Config{Type: framing.TypeCOBS},
+	}
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+
+	reader := waitShmReader(test, packet, shmDir)
+
+	// garbage before the first delimiter is dropped as an invalid frame
+	data := []byte{0, 1, 2, 0, 0, 5, 6, 7, 8, 0}
+	stream := append([]byte{0x07, 0x11, 0x00}, framing.EncodeCOBS(data)...)
+
+	// the device may not be open and in raw mode yet, so keep sending until the packet is read
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			if _, err := controller.Write(stream); err != nil {
+				return
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	expectShmPacket(test, reader, data)
+}
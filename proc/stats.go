@@ -0,0 +1,132 @@
+package proc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/db"
+)
+
+// PacketStats holds the ingest counters of a telemetry packet.
+type PacketStats struct {
+	Received    uint64 // Packets published to shared memory
+	WrongSize   uint64 // Packets dropped for having the wrong size
+	KernelDrops uint64 // Datagrams dropped by the kernel because the socket receive buffer was full
+	ShmErrors   uint64 // Packets that couldn't be written to shared memory
+
+	SequenceLost uint64 // CCSDS packets missing from gaps in the sequence count
+	Unroutable   uint64 // CCSDS packets received on the port with an unknown APID or segmented user data
+
+	ArchiveDrops uint64 // Datagrams not archived because the archive writer was behind
+	Duplicates   uint64 // Copies of packets already delivered by another station, dropped when merging
+	AuthFailed   uint64 // Packets dropped for a missing or invalid authentication tag
+}
+
+// packetCounters are the live counters behind PacketStats and the metrics of a packet.
+type packetCounters struct {
+	received    atomic.Uint64
+	wrongSize   atomic.Uint64
+	kernelDrops atomic.Uint64
+	shmErrors   atomic.Uint64
+
+	sequenceLost atomic.Uint64
+	unroutable   atomic.Uint64
+	archiveDrops atomic.Uint64
+	duplicates   atomic.Uint64
+	authFailed   atomic.Uint64
+
+	merger atomic.Pointer[packetMerger] // Merges the packet's copies delivered by several stations, if merging
+
+	lastReceived atomic.Int64 // Unix time in nanoseconds of the last received packet, 0 if none
+
+	dbQueue  atomic.Pointer[chan ReceivedPacket] // Channel read by the packet's database writer, if there is one
+	dbDrops  atomic.Uint64                       // Packets not written to the database because its queue was full
+	dbErrors atomic.Uint64                       // Failed database inserts
+	decode   histogram                           // Time taken to decode packets for the database
+}
+
+// decodeBuckets are the upper bounds of the decode latency histogram buckets.
+var decodeBuckets = [...]time.Duration{
+	time.Microsecond, 2500 * time.Nanosecond, 5 * time.Microsecond, 10 * time.Microsecond, 25 * time.Microsecond,
+	50 * time.Microsecond, 100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond, time.Millisecond,
+	10 * time.Millisecond,
+}
+
+// histogram counts durations into decodeBuckets.
+type histogram struct {
+	counts [len(decodeBuckets) + 1]atomic.Uint64 // Per bucket counts, the last bucket being +Inf
+	sum    atomic.Uint64                         // Sum of all durations in nanoseconds
+}
+
+// observe adds a duration to the histogram.
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(decodeBuckets) && d > decodeBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(uint64(d))
+}
+
+var countersMu sync.Mutex
+var countersByPacket = make(map[string]*packetCounters) // Packet name -> counters
+var databaseHandlers []db.Handler                       // Handlers used by database writers, for their asynchronous write errors
+
+// countersForPacket returns the counters of a packet, creating them if needed.
+func countersForPacket(packet string) *packetCounters {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+
+	counters, ok := countersByPacket[packet]
+	if !ok {
+		counters = &packetCounters{}
+		countersByPacket[packet] = counters
+	}
+	return counters
+}
+
+// resetIngestStats clears the counters of every packet.
+func resetIngestStats() {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+	countersByPacket = make(map[string]*packetCounters)
+	databaseHandlers = nil
+	archiveErrors.Store(0)
+}
+
+// registerDatabaseHandler records a handler used by a database writer.
+func registerDatabaseHandler(handler db.Handler) {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+
+	for _, h := range databaseHandlers {
+		if h == handler {
+			return
+		}
+	}
+	databaseHandlers = append(databaseHandlers, handler)
+}
+
+// IngestStats returns the ingest counters of each packet that has been received, keyed by packet name.
+func IngestStats() map[string]PacketStats {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+
+	stats := make(map[string]PacketStats, len(countersByPacket))
+	for packet, counters := range countersByPacket {
+		stats[packet] = PacketStats{
+			Received:    counters.received.Load(),
+			WrongSize:   counters.wrongSize.Load(),
+			KernelDrops: counters.kernelDrops.Load(),
+			ShmErrors:   counters.shmErrors.Load(),
+
+			SequenceLost: counters.sequenceLost.Load(),
+			Unroutable:   counters.unroutable.Load(),
+			ArchiveDrops: counters.archiveDrops.Load(),
+			Duplicates:   counters.duplicates.Load(),
+			AuthFailed:   counters.authFailed.Load(),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,337 @@
+package proc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/db"
+	"github.com/AarC10/GSW-V2/lib/logger"
+	"go.uber.org/zap"
+)
+
+// rateInterval is how often the status server samples packet counts to compute rates.
+const rateInterval = time.Second
+
+// StatusInfo describes the running service for the status API.
+type StatusInfo struct {
+	ConfigHash string     // SHA-256 of the telemetry config file, hex encoded
+	Database   string     // Database the service writes to, empty if none
+	Forwarder  *Forwarder // Forwards packets to other ground stations, configured through the API. nil if there is none
+	// ForwardingToken is the bearer token required to change forwarding destinations through the API.
+	// Destinations can't be changed through the API without one.
+	ForwardingToken string
+}
+
+// ServiceStatus is the response of the /status endpoint.
+type ServiceStatus struct {
+	Started    time.Time       `json:"started"`
+	Uptime     float64         `json:"uptime_seconds"`
+	Config     ConfigStatus    `json:"config"`
+	Packets    []PacketStatus  `json:"packets"`
+	Database   DatabaseStatus  `json:"database"`
+	Forwarding []ForwardStatus `json:"forwarding"` // Forwarding destinations, empty if there is no forwarder
+}
+
+// ConfigStatus identifies the loaded telemetry config.
+type ConfigStatus struct {
+	Name string `json:"name"`
+	Hash string `json:"sha256"`
+}
+
+// PacketStatus holds the state of a telemetry packet.
+type PacketStatus struct {
+	Name         string         `json:"name"`
+	Port         int            `json:"port"`
+	Size         int            `json:"size"`
+	LastReceived *time.Time     `json:"last_received"` // Nil if the packet was never received
+	Rate         float64        `json:"rate"`          // Packets per second over the last sample interval
+	Received     uint64         `json:"received"`
+	WrongSize    uint64         `json:"wrong_size"`
+	Rejected     uint64         `json:"rejected"`
+	KernelDrops  uint64         `json:"kernel_drops"`
+	SequenceLost uint64         `json:"sequence_lost"`
+	ShmErrors    uint64         `json:"shm_errors"`
+	DBDropped    uint64         `json:"db_dropped"`
+	DBErrors     uint64         `json:"db_errors"`
+	Duplicates   uint64         `json:"duplicates"`
+	AuthFailed   uint64         `json:"auth_failed"`
+	Stations     []StationStats `json:"stations,omitempty"` // Deliveries of each station, if merging stations
+}
+
+// DatabaseStatus holds the state of the database sink.
+type DatabaseStatus struct {
+	Type             string `json:"type"`   // Database type, or none
+	Status           string `json:"status"` // ok, degraded if writes are failing, or disabled
+	QueueDepth       int    `json:"queue_depth"`
+	Dropped          uint64 `json:"dropped"`
+	WriteErrors      uint64 `json:"write_errors"`
+	AsyncWriteErrors uint64 `json:"async_write_errors"`
+}
+
+// packetRate is the last sampled rate of a packet.
+type packetRate struct {
+	received uint64
+	rate     float64
+}
+
+// StatusServer serves the health and status API of the service.
+type StatusServer struct {
+	info    StatusInfo
+	started time.Time
+
+	mu         sync.Mutex
+	rates      map[string]packetRate // Packet name -> last sample
+	lastSample time.Time
+	lastErrors uint64 // Database errors at the last sample
+	dbFailing  bool   // Database errors increased during the last sample interval
+}
+
+// NewStatusServer creates a status server for the running service.
+func NewStatusServer(info StatusInfo) *StatusServer {
+	now := time.Now()
+	return &StatusServer{
+		info:       info,
+		started:    now,
+		rates:      make(map[string]packetRate),
+		lastSample: now,
+	}
+}
+
+// sample updates the packet rates and database state from the counters.
+func (s *StatusServer) sample(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := now.Sub(s.lastSample).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	s.lastSample = now
+
+	for name, stats := range IngestStats() {
+		last := s.rates[name]
+		s.rates[name] = packetRate{
+			received: stats.Received,
+			rate:     float64(stats.Received-last.received) / elapsed,
+		}
+	}
+
+	insertErrors, asyncErrors := databaseErrors()
+	s.dbFailing = insertErrors+asyncErrors > s.lastErrors
+	s.lastErrors = insertErrors + asyncErrors
+}
+
+// databaseErrors returns the failed database inserts of every packet, and the failed asynchronous writes.
+func databaseErrors() (uint64, uint64) {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+
+	var insertErrors, asyncErrors uint64
+	for _, counters := range countersByPacket {
+		insertErrors += counters.dbErrors.Load()
+	}
+	for _, handler := range databaseHandlers {
+		if counter, ok := handler.(db.WriteErrorCounter); ok {
+			asyncErrors += counter.WriteErrors()
+		}
+	}
+	return insertErrors, asyncErrors
+}
+
+// Status returns the current status of the service.
+func (s *StatusServer) Status() ServiceStatus {
+	now := time.Now()
+	status := ServiceStatus{
+		Started: s.started,
+		Uptime:  now.Sub(s.started).Seconds(),
+		Config:  ConfigStatus{Name: GswConfig.Name, Hash: s.info.ConfigHash},
+		Packets: make([]PacketStatus, 0, len(GswConfig.TelemetryPackets)),
+		Database: DatabaseStatus{
+			Type:   s.info.Database,
+			Status: "ok",
+		},
+	}
+	if status.Database.Type == "" {
+		status.Database.Type = "none"
+		status.Database.Status = "disabled"
+	}
+
+	rejected := RejectedDatagrams()
+	stations := MergedStationStats()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dbFailing {
+		status.Database.Status = "degraded"
+	}
+
+	for _, packet := range GswConfig.TelemetryPackets {
+		packetStatus := PacketStatus{
+			Name:     packet.Name,
+			Port:     packet.Port,
+			Size:     GetPacketSize(packet),
+			Rate:     s.rates[packet.Name].rate,
+			Stations: stations[packet.Name],
+		}
+		for _, count := range rejected[packet.Name] {
+			packetStatus.Rejected += count
+		}
+
+		countersMu.Lock()
+		counters, ok := countersByPacket[packet.Name]
+		countersMu.Unlock()
+		if ok {
+			if last := counters.lastReceived.Load(); last != 0 {
+				lastReceived := time.Unix(0, last)
+				packetStatus.LastReceived = &lastReceived
+			}
+			packetStatus.Received = counters.received.Load()
+			packetStatus.WrongSize = counters.wrongSize.Load()
+			packetStatus.KernelDrops = counters.kernelDrops.Load()
+			packetStatus.SequenceLost = counters.sequenceLost.Load()
+			packetStatus.ShmErrors = counters.shmErrors.Load()
+			packetStatus.DBDropped = counters.dbDrops.Load()
+			packetStatus.DBErrors = counters.dbErrors.Load()
+			packetStatus.Duplicates = counters.duplicates.Load()
+			packetStatus.AuthFailed = counters.authFailed.Load()
+			if queue := counters.dbQueue.Load(); queue != nil {
+				status.Database.QueueDepth += len(*queue)
+			}
+		}
+
+		status.Database.Dropped += packetStatus.DBDropped
+		status.Database.WriteErrors += packetStatus.DBErrors
+		status.Packets = append(status.Packets, packetStatus)
+	}
+	_, status.Database.AsyncWriteErrors = databaseErrors()
+
+	status.Forwarding = []ForwardStatus{}
+	if s.info.Forwarder != nil {
+		status.Forwarding = s.info.Forwarder.Destinations()
+	}
+
+	return status
+}
+
+// Handler returns the HTTP handler of the status API.
+// GET /health reports whether the service is up, and GET /status returns the ServiceStatus.
+// With a forwarder, GET /forwarding returns its destinations. With a forwarding token, requests bearing it can also
+// PUT /forwarding/{name} to add or replace a destination, DELETE /forwarding/{name} to remove it,
+// and POST /forwarding/{name}/enable and /disable to turn it on and off.
+func (s *StatusServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, s.Status())
+	})
+	if s.info.Forwarder != nil {
+		handleForwarding(mux, s.info.Forwarder, s.info.ForwardingToken)
+	}
+	return mux
+}
+
+// handleForwarding adds the endpoints listing a forwarder's destinations to mux,
+// and with a token, the endpoints changing them for requests bearing it.
+func handleForwarding(mux *http.ServeMux, forwarder *Forwarder, token string) {
+	mux.HandleFunc("GET /forwarding", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, forwarder.Destinations())
+	})
+	if token == "" {
+		return
+	}
+
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, requireToken(token, handler))
+	}
+	handle("PUT /forwarding/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var destination ForwardDestination
+		if err := json.NewDecoder(r.Body).Decode(&destination); err != nil {
+			http.Error(w, fmt.Sprintf("invalid destination: %v", err), http.StatusBadRequest)
+			return
+		}
+		destination.Name = r.PathValue("name")
+		if err := forwarder.Set(destination); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, forwarder.Destinations())
+	})
+	handle("DELETE /forwarding/{name}", func(w http.ResponseWriter, r *http.Request) {
+		writeForwardingResult(w, forwarder, forwarder.Remove(r.PathValue("name")))
+	})
+	handle("POST /forwarding/{name}/enable", func(w http.ResponseWriter, r *http.Request) {
+		writeForwardingResult(w, forwarder, forwarder.SetEnabled(r.PathValue("name"), true))
+	})
+	handle("POST /forwarding/{name}/disable", func(w http.ResponseWriter, r *http.Request) {
+		writeForwardingResult(w, forwarder, forwarder.SetEnabled(r.PathValue("name"), false))
+	})
+}
+
+// requireToken rejects requests that don't bear token in their Authorization header.
+func requireToken(token string, handler http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// writeForwardingResult responds with the forwarding destinations, or the error changing them.
+func writeForwardingResult(w http.ResponseWriter, forwarder *Forwarder, err error) {
+	if errors.Is(err, ErrUnknownDestination) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, forwarder.Destinations())
+}
+
+// writeJSON writes a value as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Log().Named("status").Warn("couldn't write response", zap.Error(err))
+	}
+}
+
+// Run serves the status API on addr until the context is canceled.
+func (s *StatusServer) Run(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: s.Handler()}
+
+	go func() {
+		ticker := time.NewTicker(rateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if err := server.Close(); err != nil {
+					logger.Log().Named("status").Warn("error closing status server", zap.Error(err))
+				}
+				return
+			case now := <-ticker.C:
+				s.sample(now)
+			}
+		}
+	}()
+
+	logger.Log().Named("status").Info("Serving status API", zap.String("addr", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving status API: %w", err)
+	}
+	return ctx.Err()
+}
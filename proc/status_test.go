@@ -0,0 +1,143 @@
+package proc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// getStatus performs a request against the status API and returns the response.
+func getStatus(test *testing.T, server *StatusServer, method string, path string) *httptest.ResponseRecorder {
+	test.Helper()
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder
+}
+
+func TestStatusHealth(test *testing.T) {
+	test.Cleanup(resetState)
+	server := NewStatusServer(StatusInfo{})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodGet, "/health", http.StatusOK},
+		{http.MethodGet, "/status", http.StatusOK},
+		{http.MethodPost, "/health", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/nothing", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		response := getStatus(test, server, tt.method, tt.path)
+		if response.Code != tt.code {
+			test.Errorf("%s %s: Expected %d, got %d", tt.method, tt.path, tt.code, response.Code)
+		}
+	}
+
+	var health map[string]string
+	if err := json.Unmarshal(getStatus(test, server, http.MethodGet, "/health").Body.Bytes(), &health); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	if health["status"] != "ok" {
+		test.Errorf("Expected ok, got %s", health["status"])
+	}
+}
+
+func TestStatus(test *testing.T) {
+	test.Cleanup(resetState)
+	if _, err := ParseConfig("../data/test/vehicles.yaml"); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+	byID := GswConfig.TelemetryPackets[0]
+	bySource := GswConfig.TelemetryPackets[1]
+
+	counters := countersForPacket(byID.Name)
+	counters.received.Add(10)
+	counters.wrongSize.Add(2)
+	counters.dbDrops.Add(1)
+	lastReceived := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	counters.lastReceived.Store(lastReceived.UnixNano())
+	queue := make(chan ReceivedPacket, 2)
+	queue <- ReceivedPacket{}
+	counters.dbQueue.Store(&queue)
+	countRejected(byID.Name, netip.MustParseAddr("10.0.0.1"))
+	countRejected(byID.Name, netip.MustParseAddr("10.0.0.2"))
+
+	server := NewStatusServer(StatusInfo{ConfigHash: "abc123", Database: "influxdb_v2"})
+	server.sample(server.lastSample.Add(2 * time.Second))
+
+	response := getStatus(test, server, http.MethodGet, "/status")
+	if response.Header().Get("Content-Type") != "application/json" {
+		test.Errorf("Expected application/json, got %s", response.Header().Get("Content-Type"))
+	}
+	var status ServiceStatus
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+
+	if status.Config != (ConfigStatus{Name: GswConfig.Name, Hash: "abc123"}) {
+		test.Errorf("Expected config %s abc123, got %+v", GswConfig.Name, status.Config)
+	}
+	if status.Uptime < 0 {
+		test.Errorf("Expected positive uptime, got %f", status.Uptime)
+	}
+	if len(status.Packets) != 2 {
+		test.Fatalf("Expected 2 packets, got %d", len(status.Packets))
+	}
+
+	packet := status.Packets[0]
+	if packet.Name != byID.Name || packet.Port != byID.Port || packet.Size != GetPacketSize(byID) {
+		test.Errorf("Expected packet %s on port %d, got %+v", byID.Name, byID.Port, packet)
+	}
+	if packet.LastReceived == nil || !packet.LastReceived.Equal(lastReceived) {
+		test.Errorf("Expected last received %s, got %v", lastReceived, packet.LastReceived)
+	}
+	if packet.Rate != 5 {
+		test.Errorf("Expected rate 5, got %f", packet.Rate)
+	}
+	if packet.Received != 10 || packet.WrongSize != 2 || packet.Rejected != 2 || packet.DBDropped != 1 {
+		test.Errorf("Expected 10 received, 2 wrong size, 2 rejected, 1 dropped, got %+v", packet)
+	}
+
+	if status.Packets[1].Name != bySource.Name || status.Packets[1].LastReceived != nil {
+		test.Errorf("Expected %s to never be received, got %+v", bySource.Name, status.Packets[1])
+	}
+
+	expectedDB := DatabaseStatus{Type: "influxdb_v2", Status: "ok", QueueDepth: 1, Dropped: 1}
+	if status.Database != expectedDB {
+		test.Errorf("Expected %+v, got %+v", expectedDB, status.Database)
+	}
+}
+
+func TestStatusDatabase(test *testing.T) {
+	test.Cleanup(resetState)
+	if _, err := ParseConfig("../data/test/vehicles.yaml"); err != nil {
+		test.Fatalf("Unexpected error: %v", err)
+	}
+
+	server := NewStatusServer(StatusInfo{})
+	if status := server.Status().Database; status.Type != "none" || status.Status != "disabled" {
+		test.Errorf("Expected disabled database, got %+v", status)
+	}
+
+	server = NewStatusServer(StatusInfo{Database: "influxdb_v2"})
+	registerDatabaseHandler(&errorCountingHandler{errors: 3})
+	countersForPacket(GswConfig.TelemetryPackets[0].Name).dbErrors.Add(2)
+	server.sample(server.lastSample.Add(time.Second))
+
+	expected := DatabaseStatus{Type: "influxdb_v2", Status: "degraded", WriteErrors: 2, AsyncWriteErrors: 3}
+	if status := server.Status().Database; status != expected {
+		test.Errorf("Expected %+v, got %+v", expected, status)
+	}
+
+	// without new errors during the next interval the database recovers
+	server.sample(server.lastSample.Add(time.Second))
+	if status := server.Status().Database; status.Status != "ok" {
+		test.Errorf("Expected ok, got %s", status.Status)
+	}
+}
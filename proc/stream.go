@@ -0,0 +1,96 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/framing"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultReconnectDelay = time.Second
+	maxReconnectDelay     = 30 * time.Second
+)
+
+// reconnectingStream reads frames from a stream opened by connect, reopening it with exponential backoff
+// whenever it fails or ends, until the context is canceled.
+func reconnectingStream(ctx context.Context, log *zap.Logger, delay time.Duration, connect func(context.Context) (io.ReadCloser, error), cfg framing.Config, sink packetHandler) error {
+	if delay <= 0 {
+		delay = defaultReconnectDelay
+	}
+
+	backoff := delay
+	for {
+		stream, err := connect(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("couldn't connect to telemetry source", zap.Error(err), zap.Duration("retry", backoff))
+		} else {
+			log.Info("connected to telemetry source")
+			backoff = delay
+
+			stopf := context.AfterFunc(ctx, func() { _ = stream.Close() })
+			err = readFrames(stream, streamSource(stream), cfg, sink, log)
+			stopf()
+			_ = stream.Close()
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("lost connection to telemetry source", zap.Error(err), zap.Duration("retry", backoff))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxReconnectDelay)
+	}
+}
+
+// streamSource returns the remote address of a network stream, or an invalid address for other streams.
+func streamSource(stream io.Reader) netip.Addr {
+	conn, ok := stream.(net.Conn)
+	if !ok {
+		return netip.Addr{}
+	}
+	addr, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Addr()
+}
+
+// readFrames reads frames sent by a source from a stream into the sink until the stream ends or becomes unusable.
+// A clean end of stream returns nil.
+func readFrames(stream io.Reader, source netip.Addr, cfg framing.Config, sink packetHandler, log *zap.Logger) error {
+	reader, err := framing.NewReader(cfg, stream, sink.frameSize())
+	if err != nil {
+		return fmt.Errorf("creating frame reader: %w", err)
+	}
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			if errors.Is(err, framing.ErrFrameTooLarge) || errors.Is(err, framing.ErrInvalidFrame) {
+				log.Error("dropped frame", zap.Error(err))
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		sink.handle(frame, source)
+	}
+}
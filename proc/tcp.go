@@ -0,0 +1,94 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"go.uber.org/zap"
+)
+
+// tcpPacketReceiver receives framed telemetry packets over TCP.
+// If a connect address is configured it dials out and redials when the connection is lost,
+// otherwise it listens on the packet port at the bind address, or all addresses if it is empty, and accepts any number of concurrent clients.
+func tcpPacketReceiver(ctx context.Context, log *zap.Logger, packet tlm.TelemetryPacket, cfg tlm.TCPConfig, bind string, sink packetHandler) error {
+	if cfg.Connect != "" {
+		return tcpDialer(ctx, log, cfg, sink)
+	}
+
+	var listenConfig net.ListenConfig
+	address := net.JoinHostPort(bind, strconv.Itoa(packet.Port))
+	listener, err := listenConfig.Listen(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	var connsMu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+
+	stopf := context.AfterFunc(ctx, func() {
+		if err := listener.Close(); err != nil {
+			log.Error("error closing TCP listener", zap.Error(err))
+		}
+		connsMu.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+		connsMu.Unlock()
+	})
+	defer stopf()
+
+	log.Info(fmt.Sprintf("Listening on TCP %s for telemetry packet...", address))
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				wg.Wait()
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				wg.Wait()
+				return err
+			}
+			log.Error("error accepting TCP connection", zap.Error(err))
+			continue
+		}
+
+		connsMu.Lock()
+		conns[conn] = struct{}{}
+		connsMu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			connLog := log.With(zap.String("client", conn.RemoteAddr().String()))
+			connLog.Info("TCP client connected")
+
+			err := readFrames(conn, streamSource(conn), cfg.Framing, sink, connLog)
+			if ctx.Err() == nil {
+				connLog.Info("TCP client disconnected", zap.Error(err))
+			}
+
+			connsMu.Lock()
+			delete(conns, conn)
+			connsMu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// tcpDialer connects to a TCP telemetry source, reconnecting with backoff until the context is canceled.
+func tcpDialer(ctx context.Context, log *zap.Logger, cfg tlm.TCPConfig, sink packetHandler) error {
+	var dialer net.Dialer
+	connect := func(ctx context.Context) (io.ReadCloser, error) {
+		return dialer.DialContext(ctx, "tcp", cfg.Connect)
+	}
+	return reconnectingStream(ctx, log.With(zap.String("server", cfg.Connect)), cfg.ReconnectDelay, connect, cfg.Framing, sink)
+}
@@ -0,0 +1,226 @@
+package proc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/framing"
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+// freePort returns a TCP port that was free at the time of the call.
+func freePort(test *testing.T) int {
+	test.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// startPacketWriter runs TelemetryPacketWriter until the test ends.
+func startPacketWriter(test *testing.T, packet tlm.TelemetryPacket, shmDir string) {
+	test.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- TelemetryPacketWriter(ctx, packet, make(chan ReceivedPacket), shmDir)
+	}()
+
+	test.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				test.Errorf("Expected context.Canceled, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			test.Errorf("Packet writer did not stop")
+		}
+	})
+}
+
+// dialRetry dials a TCP address until it succeeds or a timeout elapses.
+func dialRetry(test *testing.T, addr string) net.Conn {
+	test.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			test.Cleanup(func() { conn.Close() })
+			return conn
+		}
+		if time.Now().After(deadline) {
+			test.Fatalf("Couldn't connect to %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitShmReader opens a shared memory reader for the packet once its writer has created it.
+func waitShmReader(test *testing.T, packet tlm.TelemetryPacket, shmDir string) ipc.Reader {
+	test.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		reader, err := NewIpcShmReaderForPacket(packet, shmDir)
+		if err == nil {
+			test.Cleanup(reader.Cleanup)
+			return reader
+		}
+		if time.Now().After(deadline) {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectShmPacket waits for the next packet in shared memory and compares it.
+func expectShmPacket(test *testing.T, reader ipc.Reader, expected []byte) {
+	test.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	message, err := reader.Read(ctx)
+	if err != nil {
+		test.Fatalf("Expected packet, got %v", err)
+	}
+	if !bytes.Equal(message.Data(), expected) {
+		test.Errorf("Expected % X, got % X", expected, message.Data())
+	}
+}
+
+// readShmTimeout reads the next packet in shared memory, giving up after a timeout.
+func readShmTimeout(reader ipc.Reader, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	message, err := reader.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return message.Data(), nil
+}
+
+// lengthFrame prefixes data with a 2 byte big endian length.
+func lengthFrame(data []byte) []byte {
+	return append([]byte{byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+func tcpTestPacket(test *testing.T, cfg tlm.TCPConfig) tlm.TelemetryPacket {
+	test.Helper()
+	config, err := ParseConfig(TestDataDir + "good.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	packet := config.TelemetryPackets[0]
+	packet.Port = freePort(test)
+	packet.TCP = &cfg
+	return packet
+}
+
+func TestTCPListenMultipleClients(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := tcpTestPacket(test, tlm.TCPConfig{Framing: framing.Config{Type: framing.TypeLength}})
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(packet.Port))
+	first := dialRetry(test, addr)
+	second := dialRetry(test, addr)
+
+	reader, err := NewIpcShmReaderForPacket(packet, shmDir)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer reader.Cleanup()
+
+	firstPacket := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if _, err := first.Write(lengthFrame(firstPacket)); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	expectShmPacket(test, reader, firstPacket)
+
+	// wrong sized frames are dropped without closing the connection
+	secondPacket := []byte{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}
+	stream := append(lengthFrame([]byte{1, 2, 3}), lengthFrame(secondPacket)...)
+	if _, err := second.Write(stream); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	expectShmPacket(test, reader, secondPacket)
+
+	// a client reconnecting after disconnecting is accepted
+	first.Close()
+	third := dialRetry(test, addr)
+	thirdPacket := []byte{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}
+	if _, err := third.Write(lengthFrame(thirdPacket)); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	expectShmPacket(test, reader, thirdPacket)
+}
+
+func TestTCPListenBind(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := tcpTestPacket(test, tlm.TCPConfig{Framing: framing.Config{Type: framing.TypeLength}})
+	GswConfig.Ingest.Bind = "127.0.0.2"
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+
+	// the listener only accepts clients on the configured bind address
+	port := strconv.Itoa(packet.Port)
+	conn := dialRetry(test, net.JoinHostPort("127.0.0.2", port))
+	reader := waitShmReader(test, packet, shmDir)
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if _, err := conn.Write(lengthFrame(data)); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	expectShmPacket(test, reader, data)
+
+	if other, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port)); err == nil {
+		other.Close()
+		test.Errorf("Expected connection refused on 127.0.0.1, got nil")
+	}
+}
+
+func TestTCPConnectReconnects(test *testing.T) {
+	test.Cleanup(resetState)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer listener.Close()
+
+	packet := tcpTestPacket(test, tlm.TCPConfig{
+		Connect:        listener.Addr().String(),
+		ReconnectDelay: 10 * time.Millisecond,
+	})
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+
+	for i := byte(0); i < 2; i++ {
+		conn, err := listener.Accept()
+		if err != nil {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+
+		reader, err := NewIpcShmReaderForPacket(packet, shmDir)
+		if err != nil {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+
+		data := bytes.Repeat([]byte{i + 1}, 10)
+		if _, err := conn.Write(data); err != nil {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+		expectShmPacket(test, reader, data)
+
+		reader.Cleanup()
+		conn.Close()
+	}
+}
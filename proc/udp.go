@@ -0,0 +1,382 @@
+package proc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"go.uber.org/zap"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+// defaultBatchSize is the number of datagrams read per receive call when batch_size isn't set
+const defaultBatchSize = 32
+
+// maxRejectedSources limits how many distinct sources are counted per packet.
+// Further sources are counted together, so spoofed traffic can't grow the counters without bound.
+const maxRejectedSources = 256
+
+// rejectedOtherSource is the key that sources beyond maxRejectedSources are counted under
+const rejectedOtherSource = "other"
+
+var rejectedMu sync.Mutex
+var rejectedDatagrams = make(map[string]map[netip.Addr]uint64) // Packet name -> source -> rejected datagrams
+
+// countRejected records a datagram rejected from a source.
+// It returns true the first time a source is rejected for the packet.
+func countRejected(packet string, source netip.Addr) bool {
+	rejectedMu.Lock()
+	defer rejectedMu.Unlock()
+
+	counts, ok := rejectedDatagrams[packet]
+	if !ok {
+		counts = make(map[netip.Addr]uint64)
+		rejectedDatagrams[packet] = counts
+	}
+
+	if _, ok := counts[source]; !ok && len(counts) >= maxRejectedSources {
+		source = netip.Addr{}
+	}
+	counts[source]++
+	return counts[source] == 1
+}
+
+// resetRejectedDatagrams clears the rejected datagram counters.
+func resetRejectedDatagrams() {
+	rejectedMu.Lock()
+	defer rejectedMu.Unlock()
+	rejectedDatagrams = make(map[string]map[netip.Addr]uint64)
+}
+
+// RejectedDatagrams returns the number of datagrams rejected by source allowlists, keyed by packet name and source address.
+func RejectedDatagrams() map[string]map[string]uint64 {
+	rejectedMu.Lock()
+	defer rejectedMu.Unlock()
+
+	result := make(map[string]map[string]uint64, len(rejectedDatagrams))
+	for packet, counts := range rejectedDatagrams {
+		sources := make(map[string]uint64, len(counts))
+		for source, count := range counts {
+			key := rejectedOtherSource
+			if source.IsValid() {
+				key = source.String()
+			}
+			sources[key] = count
+		}
+		result[packet] = sources
+	}
+	return result
+}
+
+// sourceAllowed reports whether a datagram source matches the allowlist. An empty allowlist allows any source.
+func sourceAllowed(allowed []netip.Prefix, source netip.Addr) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	source = source.Unmap()
+	for _, prefix := range allowed {
+		if prefix.Contains(source) {
+			return true
+		}
+	}
+	return false
+}
+
+// udpPacketReceiver listens for telemetry packets on the packet's UDP port.
+func udpPacketReceiver(ctx context.Context, log *zap.Logger, packet tlm.TelemetryPacket, cfg tlm.UDPConfig, sink packetHandler) error {
+	allowed, err := cfg.AllowedPrefixes()
+	if err != nil {
+		return err
+	}
+
+	conn, err := listenUDP(ctx, packet.Port, cfg)
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	var closeConnOnce sync.Once
+	closeConn := func() {
+		closeConnOnce.Do(func() {
+			if err := conn.Close(); err != nil {
+				log.Error("error closing UDP connection", zap.Error(err))
+			}
+		})
+	}
+	defer closeConn()
+
+	stopf := context.AfterFunc(ctx, closeConn)
+	defer stopf()
+
+	log.Info(fmt.Sprintf("Listening on %s for telemetry packet...", conn.LocalAddr()),
+		zap.Strings("multicast", cfg.Multicast), zap.Strings("allowed_sources", cfg.AllowedSources))
+
+	if size, err := receiveBufferSize(conn); err != nil {
+		log.Warn("couldn't get socket receive buffer size", zap.Error(err))
+	} else if size < cfg.ReceiveBuffer {
+		log.Warn("socket receive buffer is smaller than receive_buffer, raise net.core.rmem_max or grant CAP_NET_ADMIN",
+			zap.Int("requested", cfg.ReceiveBuffer), zap.Int("actual", size))
+	} else {
+		log.Info("socket receive buffer", zap.Int("size", size))
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	}
+	receiver := newUDPBatchReceiver(conn, batchSize, sink.frameSize())
+
+	var lastDropLog time.Time
+	for {
+		messages, drops, err := receiver.receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// a closed connection would be unrecoverable, so return the error
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
+			log.Error("error reading from UDP", zap.Error(err))
+			continue
+		}
+
+		if drops > 0 {
+			sink.ingestCounters().kernelDrops.Add(drops)
+			if time.Since(lastDropLog) >= time.Second {
+				lastDropLog = time.Now()
+				log.Warn("kernel dropped datagrams, consider increasing receive_buffer",
+					zap.Uint64("dropped", drops), zap.Uint64("total", sink.ingestCounters().kernelDrops.Load()))
+			}
+		}
+
+		for i := range messages {
+			message := &messages[i]
+			source := messageSource(message)
+			if !sourceAllowed(allowed, source) {
+				if countRejected(packet.Name, source.Unmap()) {
+					log.Warn("rejected datagram from source not in allowed_sources", zap.Stringer("source", source.Unmap()))
+				}
+				continue
+			}
+
+			sink.handle(message.Buffers[0][:message.N], source)
+		}
+	}
+}
+
+// messageSource returns the source address of a received message.
+func messageSource(message *ipv4.Message) netip.Addr {
+	addr, ok := message.Addr.(*net.UDPAddr)
+	if !ok {
+		return netip.Addr{}
+	}
+	return addr.AddrPort().Addr()
+}
+
+// batchReader reads several datagrams per call, using recvmmsg where it's available.
+// It is implemented by both ipv4.PacketConn and ipv6.PacketConn.
+type batchReader interface {
+	ReadBatch(messages []ipv4.Message, flags int) (int, error)
+}
+
+// udpBatchReceiver reads datagrams in batches and tracks the socket's kernel drop counter.
+type udpBatchReceiver struct {
+	reader    batchReader
+	messages  []ipv4.Message
+	lastDrops uint32 // Last SO_RXQ_OVFL value seen
+}
+
+// newUDPBatchReceiver creates a receiver reading up to batchSize datagrams of packetSize bytes per call.
+func newUDPBatchReceiver(conn *net.UDPConn, batchSize int, packetSize int) *udpBatchReceiver {
+	var reader batchReader
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() != nil {
+		reader = ipv4.NewPacketConn(conn)
+	} else {
+		reader = ipv6.NewPacketConn(conn)
+	}
+
+	messages := make([]ipv4.Message, batchSize)
+	for i := range messages {
+		// One extra byte lets oversized packets be detected.
+		messages[i].Buffers = [][]byte{make([]byte, packetSize+1)}
+		messages[i].OOB = make([]byte, unix.CmsgSpace(4))
+	}
+
+	return &udpBatchReceiver{reader: reader, messages: messages}
+}
+
+// receive waits for at least one datagram and returns the datagrams read, along with how many
+// datagrams the kernel dropped since the previous call. The messages are reused by the next call.
+func (r *udpBatchReceiver) receive() ([]ipv4.Message, uint64, error) {
+	for i := range r.messages {
+		r.messages[i].OOB = r.messages[i].OOB[:cap(r.messages[i].OOB)]
+	}
+
+	n, err := r.reader.ReadBatch(r.messages, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var drops uint64
+	for i := range r.messages[:n] {
+		message := &r.messages[i]
+		if total, ok := rxqOverflow(message.OOB[:message.NN]); ok {
+			// the counter is cumulative and wraps around
+			drops += uint64(total - r.lastDrops)
+			r.lastDrops = total
+		}
+	}
+
+	return r.messages[:n], drops, nil
+}
+
+// rxqOverflow returns the SO_RXQ_OVFL counter in a message's control data.
+// The kernel only attaches it once the socket has dropped a datagram.
+func rxqOverflow(oob []byte) (uint32, bool) {
+	for len(oob) >= unix.SizeofCmsghdr {
+		header := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		length := int(header.Len)
+		if length < unix.CmsgLen(0) || length > len(oob) {
+			return 0, false
+		}
+		if header.Level == unix.SOL_SOCKET && header.Type == unix.SO_RXQ_OVFL && length >= unix.CmsgLen(4) {
+			return binary.NativeEndian.Uint32(oob[unix.CmsgLen(0):]), true
+		}
+
+		next := unix.CmsgSpace(length - unix.CmsgLen(0))
+		if next > len(oob) {
+			return 0, false
+		}
+		oob = oob[next:]
+	}
+	return 0, false
+}
+
+// setSocketOptions sizes the receive buffer of a UDP socket and enables its kernel drop counter.
+func setSocketOptions(fd int, cfg tlm.UDPConfig) error {
+	if cfg.ReceiveBuffer > 0 {
+		// SO_RCVBUFFORCE can exceed net.core.rmem_max, but needs CAP_NET_ADMIN
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, cfg.ReceiveBuffer); err != nil {
+			if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, cfg.ReceiveBuffer); err != nil {
+				return fmt.Errorf("setting receive buffer: %w", err)
+			}
+		}
+	}
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RXQ_OVFL, 1); err != nil {
+		return fmt.Errorf("enabling kernel drop counter: %w", err)
+	}
+	return nil
+}
+
+// receiveBufferSize returns the usable receive buffer size of a UDP socket.
+func receiveBufferSize(conn *net.UDPConn) (int, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var size int
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		size, sockErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if sockErr != nil {
+		return 0, sockErr
+	}
+
+	// Linux doubles the requested size to leave room for bookkeeping, and reports the doubled size
+	return size / 2, nil
+}
+
+// listenUDP opens the UDP socket for a packet, binding it to the configured address and interface
+// and joining any multicast groups.
+func listenUDP(ctx context.Context, port int, cfg tlm.UDPConfig) (*net.UDPConn, error) {
+	groups, err := cfg.MulticastGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	var ifi *net.Interface
+	if cfg.Interface != "" {
+		ifi, err = net.InterfaceByName(cfg.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("finding interface: %w", err)
+		}
+	}
+
+	// restrict the socket to IPv4 when only IPv4 addresses are configured, so multicast joins use the right protocol
+	network := "udp"
+	if bind, err := netip.ParseAddr(cfg.Bind); err == nil {
+		if bind.Is4() {
+			network = "udp4"
+		}
+	} else if len(groups) > 0 && allIPv4(groups) {
+		network = "udp4"
+	}
+
+	listenConfig := net.ListenConfig{
+		Control: func(_, _ string, conn syscall.RawConn) error {
+			var sockErr error
+			err := conn.Control(func(fd uintptr) {
+				if ifi != nil {
+					if err := unix.BindToDevice(int(fd), ifi.Name); err != nil {
+						sockErr = fmt.Errorf("binding to interface %s: %w", ifi.Name, err)
+						return
+					}
+				}
+				sockErr = setSocketOptions(int(fd), cfg)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+
+	packetConn, err := listenConfig.ListenPacket(ctx, network, net.JoinHostPort(cfg.Bind, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	conn := packetConn.(*net.UDPConn)
+
+	for _, group := range groups {
+		groupAddr := &net.UDPAddr{IP: group.AsSlice()}
+		if group.Is4() {
+			err = ipv4.NewPacketConn(conn).JoinGroup(ifi, groupAddr)
+		} else {
+			err = ipv6.NewPacketConn(conn).JoinGroup(ifi, groupAddr)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("joining multicast group %s: %w", group, err)
+		}
+	}
+
+	return conn, nil
+}
+
+// allIPv4 reports whether every address is an IPv4 address.
+func allIPv4(addrs []netip.Addr) bool {
+	for _, addr := range addrs {
+		if !addr.Is4() {
+			return false
+		}
+	}
+	return true
+}
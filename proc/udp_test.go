@@ -0,0 +1,369 @@
+package proc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/AarC10/GSW-V2/lib/auth"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"golang.org/x/sys/unix"
+)
+
+// udpTestPacket returns packet 0 of good.yaml on a free port with the given UDP settings.
+func udpTestPacket(test *testing.T, cfg *tlm.UDPConfig) tlm.TelemetryPacket {
+	test.Helper()
+	config, err := ParseConfig(TestDataDir + "good.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	packet := config.TelemetryPackets[0]
+	packet.Name = test.Name()
+	packet.Port = freePort(test)
+	packet.UDP = cfg
+	return packet
+}
+
+// sendUDPFrom sends datagrams from a local address until done is closed.
+// Datagrams are repeated since the receiver may not be listening yet.
+func sendUDPFrom(test *testing.T, from string, to string, data []byte, done chan struct{}) {
+	test.Helper()
+	conn, err := net.DialUDP("udp", net.UDPAddrFromAddrPort(netip.MustParseAddrPort(from)), net.UDPAddrFromAddrPort(netip.MustParseAddrPort(to)))
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	go func() {
+		defer conn.Close()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			_, _ = conn.Write(data)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func TestUDPAllowedSources(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := udpTestPacket(test, &tlm.UDPConfig{Bind: "127.0.0.1", AllowedSources: []string{"127.0.0.2/32"}})
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+	reader := waitShmReader(test, packet, shmDir)
+
+	done := make(chan struct{})
+	defer close(done)
+	to := net.JoinHostPort("127.0.0.1", strconv.Itoa(packet.Port))
+	rejected := []byte{9, 9, 9, 9, 9, 9, 9, 9, 9, 9}
+	allowed := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	sendUDPFrom(test, "127.0.0.3:0", to, rejected, done)
+	sendUDPFrom(test, "127.0.0.2:0", to, allowed, done)
+
+	// only packets from the allowed source reach shared memory
+	for i := 0; i < 5; i++ {
+		expectShmPacket(test, reader, allowed)
+	}
+
+	count := RejectedDatagrams()[packet.Name]["127.0.0.3"]
+	if count == 0 {
+		test.Errorf("Expected rejected datagrams from 127.0.0.3, got %v", RejectedDatagrams()[packet.Name])
+	}
+	if _, ok := RejectedDatagrams()[packet.Name]["127.0.0.2"]; ok {
+		test.Errorf("Expected no rejected datagrams from 127.0.0.2")
+	}
+}
+
+func TestUDPBindAddress(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := udpTestPacket(test, &tlm.UDPConfig{Bind: "127.0.0.2"})
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+	reader := waitShmReader(test, packet, shmDir)
+
+	done := make(chan struct{})
+	defer close(done)
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	sendUDPFrom(test, "127.0.0.1:0", net.JoinHostPort("127.0.0.2", strconv.Itoa(packet.Port)), data, done)
+	expectShmPacket(test, reader, data)
+
+	// the port is still free on other addresses
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: packet.Port})
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	conn.Close()
+}
+
+func TestUDPMulticast(test *testing.T) {
+	test.Cleanup(resetState)
+	group := "239.255.42.99"
+	packet := udpTestPacket(test, &tlm.UDPConfig{Multicast: []string{group}})
+
+	// multicast needs a route, which minimal sandboxes may not have
+	probe, err := listenUDP(test.Context(), packet.Port, tlm.UDPConfig{Multicast: []string{group}})
+	if err != nil {
+		test.Skipf("multicast unavailable: %v", err)
+	}
+	probe.Close()
+
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+	reader := waitShmReader(test, packet, shmDir)
+
+	conn, err := net.Dial("udp4", net.JoinHostPort(group, strconv.Itoa(packet.Port)))
+	if err != nil {
+		test.Skipf("multicast unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := conn.Write(data); err != nil {
+			test.Skipf("multicast unavailable: %v", err)
+		}
+		if time.Now().After(deadline) {
+			test.Skip("multicast datagrams weren't looped back")
+		}
+
+		// the datagram may be sent before the writer has joined the group
+		message, err := readShmTimeout(reader, 50*time.Millisecond)
+		if err == nil {
+			if string(message) != string(data) {
+				test.Errorf("Expected % X, got % X", data, message)
+			}
+			return
+		}
+	}
+}
+
+func TestSourceAllowed(test *testing.T) {
+	allowed, err := tlm.UDPConfig{AllowedSources: []string{"10.0.0.0/24", "fd00::1"}}.AllowedPrefixes()
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{"10.0.0.7", true},
+		{"::ffff:10.0.0.7", true},
+		{"10.0.1.7", false},
+		{"fd00::1", true},
+		{"fd00::2", false},
+	}
+	for _, tt := range tests {
+		if got := sourceAllowed(allowed, netip.MustParseAddr(tt.source)); got != tt.expected {
+			test.Errorf("%s: Expected %t, got %t", tt.source, tt.expected, got)
+		}
+	}
+
+	if !sourceAllowed(nil, netip.MustParseAddr("192.0.2.1")) {
+		test.Errorf("Expected an empty allowlist to allow any source")
+	}
+}
+
+func TestRejectedSourcesLimit(test *testing.T) {
+	test.Cleanup(resetState)
+	name := test.Name()
+	for i := 0; i < maxRejectedSources+10; i++ {
+		countRejected(name, netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)}))
+	}
+	countRejected(name, netip.AddrFrom4([4]byte{10, 0, 0, 0}))
+
+	counts := RejectedDatagrams()[name]
+	if len(counts) != maxRejectedSources+1 {
+		test.Errorf("Expected %d sources, got %d", maxRejectedSources+1, len(counts))
+	}
+	if counts[rejectedOtherSource] != 10 {
+		test.Errorf("Expected 10 datagrams from other sources, got %d", counts[rejectedOtherSource])
+	}
+	if counts["10.0.0.0"] != 2 {
+		test.Errorf("Expected 2 datagrams from 10.0.0.0, got %d", counts["10.0.0.0"])
+	}
+}
+
+// queueDatagrams sends count datagrams to a local port without waiting for them to be read.
+func queueDatagrams(test *testing.T, port int, count int, size int) {
+	test.Helper()
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer conn.Close()
+
+	data := make([]byte, size)
+	for i := 0; i < count; i++ {
+		data[0] = byte(i)
+		if _, err := conn.Write(data); err != nil {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+	}
+}
+
+func TestUDPBatchReceive(test *testing.T) {
+	port := freePort(test)
+	conn, err := listenUDP(test.Context(), port, tlm.UDPConfig{Bind: "127.0.0.1"})
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer conn.Close()
+
+	queueDatagrams(test, port, 20, 10)
+
+	receiver := newUDPBatchReceiver(conn, 8, 10)
+	received := 0
+	for received < 20 {
+		messages, drops, err := receiver.receive()
+		if err != nil {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+		if drops != 0 {
+			test.Errorf("Expected no drops, got %d", drops)
+		}
+		if received == 0 && len(messages) != 8 {
+			test.Errorf("Expected a full batch of 8 queued datagrams, got %d", len(messages))
+		}
+		for _, message := range messages {
+			if message.N != 10 || message.Buffers[0][0] != byte(received) {
+				test.Errorf("Expected datagram %d of 10 bytes, got %d of %d bytes", received, message.Buffers[0][0], message.N)
+			}
+			if source := messageSource(&message); source != netip.MustParseAddr("127.0.0.1") {
+				test.Errorf("Expected source 127.0.0.1, got %s", source)
+			}
+			received++
+		}
+	}
+}
+
+func TestUDPKernelDrops(test *testing.T) {
+	port := freePort(test)
+	// the kernel rounds a tiny receive buffer up to its minimum, which only holds a few datagrams
+	conn, err := listenUDP(test.Context(), port, tlm.UDPConfig{Bind: "127.0.0.1", ReceiveBuffer: 1})
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer conn.Close()
+
+	queueDatagrams(test, port, 500, 10)
+
+	receiver := newUDPBatchReceiver(conn, 64, 10)
+	var received int
+	var drops uint64
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+		messages, dropped, err := receiver.receive()
+		if err != nil {
+			break
+		}
+		received += len(messages)
+		drops += dropped
+	}
+
+	// the drop counter is attached to datagrams queued after the drops, so send one more
+	queueDatagrams(test, port, 1, 10)
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	messages, dropped, err := receiver.receive()
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	received += len(messages)
+	drops += dropped
+
+	if drops == 0 {
+		test.Fatalf("Expected kernel drops, got none after receiving %d datagrams", received)
+	}
+	if received+int(drops) != 501 {
+		test.Errorf("Expected received and dropped datagrams to add up to 501, got %d + %d", received, drops)
+	}
+}
+
+func TestRxqOverflow(test *testing.T) {
+	oob := make([]byte, unix.CmsgSpace(4)*2)
+
+	// an unrelated control message followed by the drop counter
+	first := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	first.Level = unix.SOL_SOCKET
+	first.Type = unix.SO_TIMESTAMP
+	first.SetLen(unix.CmsgLen(4))
+	second := (*unix.Cmsghdr)(unsafe.Pointer(&oob[unix.CmsgSpace(4)]))
+	second.Level = unix.SOL_SOCKET
+	second.Type = unix.SO_RXQ_OVFL
+	second.SetLen(unix.CmsgLen(4))
+	binary.NativeEndian.PutUint32(oob[unix.CmsgSpace(4)+unix.CmsgLen(0):], 42)
+
+	if drops, ok := rxqOverflow(oob); !ok || drops != 42 {
+		test.Errorf("Expected 42 drops, got %d (found %t)", drops, ok)
+	}
+	if _, ok := rxqOverflow(oob[:unix.CmsgSpace(4)]); ok {
+		test.Errorf("Expected no drop counter")
+	}
+	if _, ok := rxqOverflow(nil); ok {
+		test.Errorf("Expected no drop counter in empty control data")
+	}
+}
+
+func TestIngestStats(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := udpTestPacket(test, &tlm.UDPConfig{Bind: "127.0.0.1", BatchSize: 4})
+	startPacketWriter(test, packet, test.TempDir())
+	waitUDPListening(test, packet.Port)
+
+	queueDatagrams(test, packet.Port, 2, 3)
+	queueDatagrams(test, packet.Port, 6, 10)
+
+	expected := PacketStats{Received: 6, WrongSize: 2}
+	deadline := time.Now().Add(2 * time.Second)
+	for IngestStats()[packet.Name] != expected {
+		if time.Now().After(deadline) {
+			test.Fatalf("Expected %+v, got %+v", expected, IngestStats()[packet.Name])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUDPAuthentication(test *testing.T) {
+	test.Cleanup(resetState)
+	key := bytes.Repeat([]byte{0x5A}, auth.MinKeySize)
+	test.Setenv("GSW_TEST_KEY", hex.EncodeToString(key))
+	authenticator, err := auth.NewAuthenticator(key, 8)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	packet := udpTestPacket(test, &tlm.UDPConfig{Bind: "127.0.0.1"})
+	packet.Auth = &auth.Config{KeyEnv: "GSW_TEST_KEY", TagSize: 8}
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+	reader := waitShmReader(test, packet, shmDir)
+	waitUDPListening(test, packet.Port)
+
+	data := make([]byte, GetPacketSize(packet))
+	data[0] = 1
+	tagged := authenticator.Append(nil, data)
+	forged := bytes.Clone(tagged)
+	forged[0] = 2
+
+	// the tag is stripped before the packet reaches shared memory
+	sendUDPPacket(test, "127.0.0.1", packet.Port, forged)
+	sendUDPPacket(test, "127.0.0.1", packet.Port, data)
+	sendUDPPacket(test, "127.0.0.1", packet.Port, tagged)
+	expectShmPacket(test, reader, data)
+	waitIngestStats(test, packet.Name, func(stats PacketStats) bool {
+		return stats.Received == 1 && stats.AuthFailed == 1 && stats.WrongSize == 1
+	})
+}
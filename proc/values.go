@@ -0,0 +1,172 @@
+package proc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+	"go.uber.org/zap"
+)
+
+// valueIdentifier returns the identifier of the ring of a packet's engineering values for a vehicle.
+func valueIdentifier(packet tlm.TelemetryPacket, vehicle string) string {
+	return "values-" + shmIdentifier(packet, vehicle)
+}
+
+// newIpcValueReaderForPacket creates an IPC reader for the engineering values of a packet sent by a vehicle with IpcBackend.
+// Value records are sized by the number of measurements, so their definitions aren't needed.
+func newIpcValueReaderForPacket(packet tlm.TelemetryPacket, _ map[string]tlm.Measurement, vehicle string, shmDir string) (ipc.RingReader, error) {
+	reader, err := ipc.NewReader(IpcBackend, valueIdentifier(packet, vehicle), tlm.ValueRecordLen(len(packet.Measurements)), shmDir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s value reader: %w", IpcBackend, err)
+	}
+	return reader, nil
+}
+
+// valuePublisher decodes packets and publishes their engineering values as value records,
+// to the value rings of the packet and each configured vehicle. It is not safe for concurrent use.
+type valuePublisher struct {
+	decoder        *tlm.Decoder
+	values         []tlm.Value
+	record         []byte
+	writer         ipc.Writer   // Ring for values of packets that aren't attributed to a vehicle
+	vehicleWriters []ipc.Writer // Ring for each vehicle, in the order of the configured vehicles
+}
+
+// newValuePublisher creates the value rings of a packet and each configured vehicle.
+// A packet that can't be decoded has no engineering values, so nil is returned without an error.
+func newValuePublisher(log *zap.Logger, packet tlm.TelemetryPacket, shmDir string) (*valuePublisher, error) {
+	decoder, err := NewPacketDecoder(packet)
+	if err != nil {
+		log.Warn("packet can't be decoded, not publishing its engineering values", zap.Error(err))
+		return nil, nil
+	}
+	publisher := &valuePublisher{
+		decoder: decoder,
+		values:  decoder.NewValues(),
+		record:  make([]byte, tlm.ValueRecordLen(decoder.Len())),
+	}
+
+	name := packet.Name + " values"
+	publisher.writer, err = ipc.NewWriter(IpcBackend, valueIdentifier(packet, ""), name, len(publisher.record), shmDir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s value writer: %w", IpcBackend, err)
+	}
+	for _, vehicle := range GswConfig.Vehicles {
+		writer, err := ipc.NewWriter(IpcBackend, valueIdentifier(packet, vehicle.Name), name, len(publisher.record), shmDir)
+		if err != nil {
+			publisher.cleanup()
+			return nil, fmt.Errorf("error creating %s value writer: %w", IpcBackend, err)
+		}
+		publisher.vehicleWriters = append(publisher.vehicleWriters, writer)
+	}
+	return publisher, nil
+}
+
+// publish decodes a packet and writes its values to the ring of the vehicle at index vehicle,
+// or to the packet's ring if vehicle is negative. It does nothing on a nil publisher.
+func (p *valuePublisher) publish(vehicle int, data []byte) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.decoder.Decode(data, p.values); err != nil {
+		return err
+	}
+	if err := tlm.EncodeValueRecord(p.record, p.values); err != nil {
+		return err
+	}
+	writer := p.writer
+	if vehicle >= 0 {
+		writer = p.vehicleWriters[vehicle]
+	}
+	return writer.Write(p.record)
+}
+
+// cleanup removes the publisher's value rings. It does nothing on a nil publisher.
+func (p *valuePublisher) cleanup() {
+	if p == nil {
+		return
+	}
+	if p.writer != nil {
+		p.writer.Cleanup()
+	}
+	for _, writer := range p.vehicleWriters {
+		writer.Cleanup()
+	}
+}
+
+// ValueMessage holds the engineering values of a packet, in the order of the packet's measurements.
+type ValueMessage struct {
+	ReceiveTimestamp uint64        // Unix time gsw_service received the packet (nanoseconds since epoch)
+	Sequence         uint64        // Sequence number of the packet in its ring, counting from 1
+	Overwritten      uint32        // Packets overwritten before they could be read, in ReadAll mode
+	Values           []tlm.Value   // Calibrated value of each measurement
+	Quality          []tlm.Quality // Quality flags of each value
+}
+
+// ValueReader reads the engineering values gsw_service decoded from a packet sent by a vehicle,
+// so consumers don't need to decode packets themselves. Unlike those written to the database, values are scaled.
+// Like PacketReader, it reattaches when gsw_service restarts, and it is not thread safe.
+type ValueReader struct {
+	reader  *PacketReader
+	message ValueMessage
+}
+
+// NewValueReader creates a reader for the engineering values of a telemetry packet sent by a vehicle,
+// reading them in the given mode. An empty vehicle reads the values of packets that aren't attributed to a vehicle.
+// It doesn't use the global config, so the packet can come from a config loaded with LoadSharedConfig.
+func NewValueReader(packet tlm.TelemetryPacket, vehicle string, mode ipc.ReadMode, shmDir string) (*ValueReader, error) {
+	reader, err := newPacketReader(packet, nil, vehicle, mode, shmDir, newIpcValueReaderForPacket)
+	if err != nil {
+		return nil, err
+	}
+	return &ValueReader{reader: reader}, nil
+}
+
+// SetStateHandler sets a function called by Read when the writer goes down, and when the reader reattaches.
+// It is passed the packet's definition, whose measurements name the values read from then on.
+func (r *ValueReader) SetStateHandler(handler func(state ReaderState, packet tlm.TelemetryPacket)) {
+	r.reader.SetStateHandler(handler)
+}
+
+// State returns whether the reader is attached or waiting for the writer. It is safe to call concurrently with Read.
+func (r *ValueReader) State() ReaderState {
+	return r.reader.State()
+}
+
+// Packet returns the packet's definition from the telemetry config the reader last attached with.
+func (r *ValueReader) Packet() tlm.TelemetryPacket {
+	return r.reader.Packet()
+}
+
+// Read reads the values of a packet. The message returned is reused by the next call to Read.
+// While the writer is down, it waits for it to restart and reattaches, until the context is done.
+func (r *ValueReader) Read(ctx context.Context) (*ValueMessage, error) {
+	message, err := r.reader.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sequenced := message.(ipc.SequencedMessage)
+	data := sequenced.Data()
+
+	n := len(data) / tlm.ValueRecordSize
+	if cap(r.message.Values) < n {
+		r.message.Values = make([]tlm.Value, n)
+		r.message.Quality = make([]tlm.Quality, n)
+	}
+	r.message.Values = r.message.Values[:n]
+	r.message.Quality = r.message.Quality[:n]
+	if err := tlm.DecodeValueRecord(data, r.message.Values, r.message.Quality); err != nil {
+		return nil, fmt.Errorf("decoding value record: %w", err)
+	}
+	r.message.ReceiveTimestamp = sequenced.ReceiveTimestamp()
+	r.message.Sequence = sequenced.Sequence()
+	r.message.Overwritten = sequenced.Overwritten()
+	return &r.message, nil
+}
+
+// Cleanup cleans up the reader.
+func (r *ValueReader) Cleanup() {
+	r.reader.Cleanup()
+}
@@ -0,0 +1,79 @@
+package proc
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+// waitValueReader creates a value reader for a packet, waiting for its writer to start.
+func waitValueReader(test *testing.T, packet tlm.TelemetryPacket, shmDir string) *ValueReader {
+	test.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		reader, err := NewValueReader(packet, "", ipc.ReadAll, shmDir)
+		if err == nil {
+			test.Cleanup(reader.Cleanup)
+			return reader
+		}
+		if time.Now().After(deadline) {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestValueReader(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := udpTestPacket(test, &tlm.UDPConfig{Bind: "127.0.0.1"})
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+	reader := waitValueReader(test, packet, shmDir)
+
+	done := make(chan struct{})
+	defer close(done)
+	sendUDPFrom(test, "127.0.0.1:0", net.JoinHostPort("127.0.0.1", strconv.Itoa(packet.Port)), []byte{0xFF, 0xFF, 0xFF, 0xFE, 0, 0, 0, 5, 0, 7}, done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	message, err := reader.Read(ctx)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	expected := []tlm.Value{tlm.IntValue(-2), tlm.UintValue(5), tlm.IntValue(7)}
+	if !slices.Equal(message.Values, expected) {
+		test.Errorf("Expected %v, got %v", expected, message.Values)
+	}
+	if !slices.Equal(message.Quality, []tlm.Quality{0, 0, 0}) {
+		test.Errorf("Expected good values, got %v", message.Quality)
+	}
+	if message.Sequence != 1 {
+		test.Errorf("Expected sequence 1, got %d", message.Sequence)
+	}
+	if message.ReceiveTimestamp == 0 {
+		test.Errorf("Expected a receive timestamp, got 0")
+	}
+
+	// the packet's raw bytes are still published alongside its values
+	expectShmPacket(test, waitShmReader(test, packet, shmDir), []byte{0xFF, 0xFF, 0xFF, 0xFE, 0, 0, 0, 5, 0, 7})
+}
+
+func TestValueReaderUndecodablePacket(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := udpTestPacket(test, nil)
+	GswConfig.Measurements["Default"] = tlm.Measurement{Name: "Default", Size: 16, Type: "int"}
+	shmDir := test.TempDir()
+	startPacketWriter(test, packet, shmDir)
+
+	// packets that can't be decoded are still published, without a value ring
+	waitShmReader(test, packet, shmDir)
+	if _, err := NewValueReader(packet, "", ipc.ReadAll, shmDir); err == nil {
+		test.Errorf("Expected an error, got nil")
+	}
+}
@@ -12,9 +12,12 @@ import (
 
 // Configuration is a struct that holds the configuration for the GSW
 type Configuration struct {
-	Name             string                     `yaml:"name"`              // Name of the configuration
-	Measurements     map[string]tlm.Measurement `yaml:"measurements"`      // Map of measurements
-	TelemetryPackets []tlm.TelemetryPacket      `yaml:"telemetry_packets"` // List of telemetry packets
+	Name             string                     `yaml:"name"`               // Name of the configuration
+	Measurements     map[string]tlm.Measurement `yaml:"measurements"`       // Map of measurements
+	TelemetryPackets []tlm.TelemetryPacket      `yaml:"telemetry_packets"`  // List of telemetry packets
+	Ingest           tlm.UDPConfig              `yaml:"ingest,omitempty"`   // UDP ingest settings shared by all packets
+	Vehicles         []tlm.Vehicle              `yaml:"vehicles,omitempty"` // Vehicles sending the same packets (optional)
+	Merge            *tlm.MergeConfig           `yaml:"merge,omitempty"`    // Merges the packets delivered by several ground stations (optional)
 }
 
 var GswConfig Configuration // TODO: Make global safer
@@ -33,56 +36,119 @@ func ParseConfig(filename string) (*Configuration, error) {
 	return ParseConfigBytes(data)
 }
 
-// ParseConfigBytes parses a YAML formatted byte slice and returns a Configuration struct
+// ParseConfigBytes parses a YAML formatted byte slice into the global configuration and returns it
 func ParseConfigBytes(data []byte) (*Configuration, error) {
+	if err := parseConfig(data, &GswConfig); err != nil {
+		return nil, err
+	}
+	return &GswConfig, nil
+}
+
+// parseConfig parses a YAML formatted byte slice into config and checks it
+func parseConfig(data []byte, config *Configuration) error {
 	// Unmarshalling doesn't seem to lead to errors with bad data. Better to check result config
-	err := yaml.Unmarshal(data, &GswConfig)
+	err := yaml.Unmarshal(data, config)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshaling YAML: %v", err)
+		return fmt.Errorf("error unmarshaling YAML: %v", err)
 	}
-	if GswConfig.Name == "" {
-		return nil, fmt.Errorf("no configuration name provided")
+	if config.Name == "" {
+		return fmt.Errorf("no configuration name provided")
 	}
 
-	if len(GswConfig.Measurements) == 0 {
-		return nil, fmt.Errorf("no measurements found in configuration")
+	if len(config.Measurements) == 0 {
+		return fmt.Errorf("no measurements found in configuration")
 	}
 
-	if len(GswConfig.TelemetryPackets) == 0 {
-		return nil, fmt.Errorf("no telemetry packets found in configuration")
+	if len(config.TelemetryPackets) == 0 {
+		return fmt.Errorf("no telemetry packets found in configuration")
 	}
 
 	// Set default values for measurements if not specified
-	for k := range GswConfig.Measurements {
+	for k := range config.Measurements {
 		// TODO: More strict checks of configuration and input handling
-		if GswConfig.Measurements[k].Name == "" {
-			return nil, fmt.Errorf("measurement name missing in configuration")
+		if config.Measurements[k].Name == "" {
+			return fmt.Errorf("measurement name missing in configuration")
 		}
 
-		if GswConfig.Measurements[k].Endianness == "" {
-			entry := GswConfig.Measurements[k] // Workaround to avoid UnaddressableFieldAssign
-			entry.Endianness = "big"           // Default to big endian
-			GswConfig.Measurements[k] = entry
-		} else if GswConfig.Measurements[k].Endianness != "little" && GswConfig.Measurements[k].Endianness != "big" {
-			return nil, fmt.Errorf("endianness specified as %s, instead of big or little", GswConfig.Measurements[k].Endianness)
+		if config.Measurements[k].Endianness == "" {
+			entry := config.Measurements[k] // Workaround to avoid UnaddressableFieldAssign
+			entry.Endianness = "big"        // Default to big endian
+			config.Measurements[k] = entry
+		} else if config.Measurements[k].Endianness != "little" && config.Measurements[k].Endianness != "big" {
+			return fmt.Errorf("endianness specified as %s, instead of big or little", config.Measurements[k].Endianness)
 		}
 
 		// 0 is the default when parsed. If a user specifies 0, then it's probably a mistake.
-		if GswConfig.Measurements[k].ScalingFactor == 0 {
-			entry := GswConfig.Measurements[k] // Workaround to avoid UnaddressableFieldAssign
-			entry.ScalingFactor = 1.0          // Default scaling factor
-			GswConfig.Measurements[k] = entry
+		if config.Measurements[k].ScalingFactor == 0 {
+			entry := config.Measurements[k] // Workaround to avoid UnaddressableFieldAssign
+			entry.ScalingFactor = 1.0       // Default scaling factor
+			config.Measurements[k] = entry
 		}
 	}
 
-	return &GswConfig, nil
+	if err := config.Ingest.Validate(); err != nil {
+		return fmt.Errorf("invalid ingest settings: %w", err)
+	}
+
+	for _, packet := range config.TelemetryPackets {
+		if packet.TCP != nil && packet.Serial != nil {
+			return fmt.Errorf("packet %s can't be received over both tcp and serial", packet.Name)
+		}
+
+		if err := config.Ingest.Override(packet.UDP).Validate(); err != nil {
+			return fmt.Errorf("packet %s has invalid udp settings: %w", packet.Name, err)
+		}
+
+		if packet.TCP != nil {
+			if err := packet.TCP.Framing.Validate(); err != nil {
+				return fmt.Errorf("packet %s has invalid tcp framing: %w", packet.Name, err)
+			}
+		}
+
+		if packet.Serial != nil {
+			if packet.Serial.Device == "" {
+				return fmt.Errorf("packet %s has no serial device", packet.Name)
+			}
+			if err := packet.Serial.Config.Validate(); err != nil {
+				return fmt.Errorf("packet %s has invalid serial settings: %w", packet.Name, err)
+			}
+			if err := packet.Serial.Framing.Validate(); err != nil {
+				return fmt.Errorf("packet %s has invalid serial framing: %w", packet.Name, err)
+			}
+		}
+
+		if packet.Auth != nil {
+			if err := packet.Auth.Validate(); err != nil {
+				return fmt.Errorf("packet %s has invalid auth settings: %w", packet.Name, err)
+			}
+		}
+	}
+
+	if err := validateVehicles(config); err != nil {
+		return err
+	}
+
+	if err := validateCCSDS(config); err != nil {
+		return err
+	}
+
+	if err := validateMerge(config); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 // GetPacketSize returns the size of a telemetry packet in bytes
 func GetPacketSize(packet tlm.TelemetryPacket) int {
+	return packetSize(packet, GswConfig.Measurements)
+}
+
+// packetSize returns the size of a telemetry packet in bytes with the given measurement definitions
+func packetSize(packet tlm.TelemetryPacket, measurements map[string]tlm.Measurement) int {
 	size := 0
 	for _, measurementName := range packet.Measurements {
-		measurement, ok := GswConfig.Measurements[measurementName]
+		measurement, ok := measurements[measurementName]
 		if !ok {
 			logger.Error("measurement not found", zap.String("measurement", measurementName))
 			continue
@@ -91,3 +157,26 @@ func GetPacketSize(packet tlm.TelemetryPacket) int {
 	}
 	return size
 }
+
+// PacketUDPConfig returns the UDP ingest settings for a packet, combining the global ingest settings with the packet's own.
+func PacketUDPConfig(packet tlm.TelemetryPacket) tlm.UDPConfig {
+	return GswConfig.Ingest.Override(packet.UDP)
+}
+
+// NewPacketDecoder compiles a decoder for a telemetry packet using the measurements in the global configuration.
+func NewPacketDecoder(packet tlm.TelemetryPacket) (*tlm.Decoder, error) {
+	return tlm.NewDecoder(packet, GswConfig.Measurements)
+}
+
+// newUnscaledPacketDecoder compiles a decoder for a telemetry packet using the measurements in the global configuration,
+// ignoring their scaling factors, since the database stores measurements as they were sent.
+func newUnscaledPacketDecoder(packet tlm.TelemetryPacket) (*tlm.Decoder, error) {
+	measurements := make(map[string]tlm.Measurement, len(packet.Measurements))
+	for _, name := range packet.Measurements {
+		if measurement, ok := GswConfig.Measurements[name]; ok {
+			measurement.ScalingFactor = 1
+			measurements[name] = measurement
+		}
+	}
+	return tlm.NewDecoder(packet, measurements)
+}
@@ -1,6 +1,7 @@
 package proc
 
 import (
+	"os"
 	"testing"
 
 	"github.com/AarC10/GSW-V2/lib/tlm"
@@ -10,6 +11,10 @@ const TestDataDir = "../data/test/"
 
 func resetState() {
 	ResetConfig()
+	resetRejectedDatagrams()
+	resetIngestStats()
+	loadedData = nil
+	loadedConfig = nil
 }
 
 func compareMeasurements(expected tlm.Measurement, actual tlm.Measurement, test *testing.T) {
@@ -170,3 +175,182 @@ func TestGetPacketSize(test *testing.T) {
 		test.Errorf("Expected 0, got %d", size)
 	}
 }
+
+func TestLoadConfig(test *testing.T) {
+	test.Cleanup(resetState)
+	dir := test.TempDir()
+	if _, err := LoadConfig("", dir); err == nil {
+		test.Errorf("Expected error without a running gsw_service, got nil")
+	}
+
+	data, err := os.ReadFile(TestDataDir + "good.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	cleanup, err := WriteTelemetryConfigToShm(dir, data)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer cleanup()
+	for _, path := range []string{"", TestDataDir + "good.yaml"} {
+		ResetConfig()
+		config, err := LoadConfig(path, dir)
+		if err != nil {
+			test.Fatalf("%q: Expected nil, got %v", path, err)
+		}
+		if config != &GswConfig || len(config.TelemetryPackets) == 0 {
+			test.Errorf("%q: Expected the global config to be loaded", path)
+		}
+	}
+}
+
+func TestUpdateMeasurementGroup(test *testing.T) {
+	test.Cleanup(resetState)
+	config, _ := ParseConfig(TestDataDir + "good.yaml")
+	packet := config.TelemetryPackets[0]
+
+	decoder, err := NewPacketDecoder(packet)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	values := decoder.NewValues()
+	group := initMeasurementGroup(packet)
+
+	data := []byte{0xFF, 0xFF, 0xFF, 0x82, 0x00, 0x00, 0x00, 0x2A, 0x00, 0x07}
+	if err := UpdateMeasurementGroup(decoder, values, &group, data); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	if group.Timestamp == 0 {
+		test.Errorf("Expected timestamp to be set")
+	}
+
+	expected := []string{"-126", "42", "7"}
+	for i, value := range expected {
+		if group.Measurements[i].Value != value {
+			test.Errorf("Expected %s, got %s for measurement %s", value, group.Measurements[i].Value, group.Measurements[i].Name)
+		}
+	}
+
+	if err := UpdateMeasurementGroup(decoder, values, &group, data[:4]); err == nil {
+		test.Errorf("Expected error for short packet, got nil")
+	}
+}
+
+func TestUpdateMeasurementGroupUnscaled(test *testing.T) {
+	test.Cleanup(resetState)
+	config, err := ParseConfigBytes([]byte(`
+name: unscaled_test
+measurements:
+  Voltage:
+    name: Voltage
+    size: 2
+    type: int
+    scaling: 0.5
+telemetry_packets:
+  - name: Power
+    port: 10000
+    measurements: [Voltage]
+`))
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	packet := config.TelemetryPackets[0]
+
+	// the database stores measurements as they were sent
+	decoder, err := newUnscaledPacketDecoder(packet)
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	group := initMeasurementGroup(packet)
+	if err := UpdateMeasurementGroup(decoder, decoder.NewValues(), &group, []byte{0x00, 0x05}); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	if group.Measurements[0].Value != "5" {
+		test.Errorf("Expected 5, got %s", group.Measurements[0].Value)
+	}
+	if GswConfig.Measurements["Voltage"].ScalingFactor != 0.5 {
+		test.Errorf("Expected the global scaling factor to be kept, got %v", GswConfig.Measurements["Voltage"].ScalingFactor)
+	}
+}
+
+func BenchmarkUpdateMeasurementGroup(b *testing.B) {
+	b.Cleanup(resetState)
+	config, _ := ParseConfig(TestDataDir + "good.yaml")
+	packet := config.TelemetryPackets[0]
+
+	decoder, err := NewPacketDecoder(packet)
+	if err != nil {
+		b.Fatalf("Expected nil, got %v", err)
+	}
+	values := decoder.NewValues()
+	group := initMeasurementGroup(packet)
+	data := make([]byte, decoder.Size())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = UpdateMeasurementGroup(decoder, values, &group, data)
+	}
+}
+
+func TestParseIngestConfig(test *testing.T) {
+	test.Cleanup(resetState)
+	config, err := ParseConfig(TestDataDir + "ingest.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	shared := PacketUDPConfig(config.TelemetryPackets[0])
+	if shared.Bind != "0.0.0.0" || len(shared.AllowedSources) != 1 || shared.AllowedSources[0] != "10.0.0.0/24" {
+		test.Errorf("Expected global ingest settings, got %+v", shared)
+	}
+
+	multicast := PacketUDPConfig(config.TelemetryPackets[1])
+	if multicast.Bind != "0.0.0.0" || multicast.Interface != "eth0" || len(multicast.Multicast) != 1 {
+		test.Errorf("Expected packet settings merged with global settings, got %+v", multicast)
+	}
+	if len(multicast.AllowedSources) != 1 || multicast.AllowedSources[0] != "192.168.1.20" {
+		test.Errorf("Expected packet allowed sources to override global, got %v", multicast.AllowedSources)
+	}
+
+	resetState()
+	if _, err := ParseConfig(TestDataDir + "bad_ingest.yaml"); err == nil {
+		test.Errorf("Expected error for unicast multicast group, got nil")
+	}
+}
+
+func TestParseAuthConfig(test *testing.T) {
+	const config = `
+name: auth_test
+measurements:
+  Status:
+    name: Status
+    size: 1
+    type: int
+telemetry_packets:
+  - name: Status
+    port: 10000
+    measurements: [Status]
+`
+	tests := []struct {
+		name  string
+		auth  string
+		valid bool
+	}{
+		{"key file", "{key_file: /etc/gsw/downlink.key}", true},
+		{"key env", "{key_env: GSW_DOWNLINK_KEY, tag_size: 32}", true},
+		{"no key", "{tag_size: 16}", false},
+		{"short tag", "{key_env: GSW_DOWNLINK_KEY, tag_size: 4}", false},
+	}
+
+	for _, tt := range tests {
+		test.Run(tt.name, func(test *testing.T) {
+			test.Cleanup(resetState)
+			_, err := ParseConfigBytes([]byte(config + "    auth: " + tt.auth + "\n"))
+			if (err == nil) != tt.valid {
+				test.Errorf("Expected valid %v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package proc
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+// VehicleTag is the database tag that identifies the vehicle that sent a packet
+const VehicleTag = "vehicle"
+
+// ReceivedPacket is a telemetry packet published by TelemetryPacketWriter.
+type ReceivedPacket struct {
+	Vehicle string // Vehicle that sent the packet. Empty if the packet isn't attributed to a vehicle
+	Station string // Station that delivered the packet first. Empty unless merging stations
+	Data    []byte // Packet data
+}
+
+// ShmVehicles returns the vehicles each packet has a shared memory ring for.
+// The first entry is always "", the ring for packets that aren't attributed to a vehicle.
+func ShmVehicles() []string {
+	return GswConfig.ShmVehicles()
+}
+
+// ShmVehicles returns the vehicles each packet of the config has a shared memory ring for,
+// the first always being "" for packets that aren't attributed to a vehicle.
+func (config *Configuration) ShmVehicles() []string {
+	vehicles := []string{""}
+	for _, vehicle := range config.Vehicles {
+		vehicles = append(vehicles, vehicle.Name)
+	}
+	return vehicles
+}
+
+// validateVehicles checks the vehicle definitions and the vehicle_id measurement of each packet.
+func validateVehicles(config *Configuration) error {
+	names := make(map[string]bool)
+	ids := make(map[uint64]string)
+	for _, vehicle := range config.Vehicles {
+		if err := vehicle.Validate(); err != nil {
+			return err
+		}
+		if names[vehicle.Name] {
+			return fmt.Errorf("vehicle %s is defined more than once", vehicle.Name)
+		}
+		names[vehicle.Name] = true
+
+		if vehicle.ID != nil {
+			if other, ok := ids[*vehicle.ID]; ok {
+				return fmt.Errorf("vehicles %s and %s have the same id %d", other, vehicle.Name, *vehicle.ID)
+			}
+			ids[*vehicle.ID] = vehicle.Name
+		}
+	}
+
+	for _, packet := range config.TelemetryPackets {
+		if packet.VehicleID == "" {
+			continue
+		}
+		if len(config.Vehicles) == 0 {
+			return fmt.Errorf("packet %s has a vehicle_id but no vehicles are defined", packet.Name)
+		}
+		if !slices.Contains(packet.Measurements, packet.VehicleID) {
+			return fmt.Errorf("packet %s vehicle_id %s is not one of its measurements", packet.Name, packet.VehicleID)
+		}
+		measurement := config.Measurements[packet.VehicleID]
+		if measurement.Type != "int" || measurement.ScalingFactor != 1 {
+			return fmt.Errorf("packet %s vehicle_id %s must be an unscaled int", packet.Name, packet.VehicleID)
+		}
+	}
+
+	return nil
+}
+
+// vehicleRouter attributes packets to the vehicles that sent them.
+type vehicleRouter struct {
+	decoder *tlm.Decoder     // Decodes the vehicle ID. nil if the packet has no vehicle_id
+	idIndex int              // Index of the vehicle_id measurement in the packet
+	ids     map[uint64]int   // Vehicle ID -> vehicle index
+	sources [][]netip.Prefix // Vehicle index -> source addresses
+}
+
+// newVehicleRouter creates a router for a packet using the vehicles in the global configuration.
+func newVehicleRouter(packet tlm.TelemetryPacket) (*vehicleRouter, error) {
+	router := &vehicleRouter{ids: make(map[uint64]int)}
+
+	if packet.VehicleID != "" {
+		decoder, err := NewPacketDecoder(packet)
+		if err != nil {
+			return nil, err
+		}
+		router.decoder = decoder
+		router.idIndex = slices.Index(packet.Measurements, packet.VehicleID)
+	}
+
+	for i, vehicle := range GswConfig.Vehicles {
+		if vehicle.ID != nil {
+			router.ids[*vehicle.ID] = i
+		}
+		sources, err := vehicle.SourcePrefixes()
+		if err != nil {
+			return nil, err
+		}
+		router.sources = append(router.sources, sources)
+	}
+
+	return router, nil
+}
+
+// route returns the index of the vehicle that sent a packet, or -1 if the packet can't be attributed.
+// Packets with a vehicle_id are attributed by its value, other packets by their source address.
+func (r *vehicleRouter) route(data []byte, source netip.Addr) int {
+	if r.decoder != nil {
+		value, err := r.decoder.DecodeMeasurement(data, r.idIndex)
+		if err != nil {
+			return -1
+		}
+
+		var id uint64
+		switch value.Kind {
+		case tlm.ValueUint:
+			id = value.Uint
+		case tlm.ValueInt:
+			if value.Int < 0 {
+				return -1
+			}
+			id = uint64(value.Int)
+		default:
+			return -1
+		}
+
+		if vehicle, ok := r.ids[id]; ok {
+			return vehicle
+		}
+		return -1
+	}
+
+	if !source.IsValid() {
+		return -1
+	}
+	source = source.Unmap()
+	for vehicle, prefixes := range r.sources {
+		for _, prefix := range prefixes {
+			if prefix.Contains(source) {
+				return vehicle
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,266 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AarC10/GSW-V2/lib/db"
+	"github.com/AarC10/GSW-V2/lib/ipc"
+	"github.com/AarC10/GSW-V2/lib/tlm"
+)
+
+const vehicleTestConfig = `
+name: vehicles_test
+measurements:
+  VehicleID:
+    name: VehicleID
+    size: 1
+    type: int
+  Altitude:
+    name: Altitude
+    size: 4
+    type: float
+telemetry_packets:
+  - name: Packet
+    port: 10000
+    measurements:
+      - VehicleID
+      - Altitude
+`
+
+func TestParseVehicleConfig(test *testing.T) {
+	test.Cleanup(resetState)
+	config, err := ParseConfig(TestDataDir + "vehicles.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+
+	if len(config.Vehicles) != 2 {
+		test.Fatalf("Expected 2 vehicles, got %d", len(config.Vehicles))
+	}
+	if config.Vehicles[0].Name != "alpha" || config.Vehicles[0].ID == nil || *config.Vehicles[0].ID != 1 {
+		test.Errorf("Expected alpha with id 1, got %+v", config.Vehicles[0])
+	}
+	if config.TelemetryPackets[0].VehicleID != "VehicleID" {
+		test.Errorf("Expected vehicle_id VehicleID, got %s", config.TelemetryPackets[0].VehicleID)
+	}
+
+	vehicles := ShmVehicles()
+	if len(vehicles) != 3 || vehicles[0] != "" || vehicles[1] != "alpha" || vehicles[2] != "bravo" {
+		test.Errorf("Expected [\"\" alpha bravo], got %q", vehicles)
+	}
+}
+
+func TestBadVehicleConfig(test *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"bad name", "vehicles:\n  - name: alpha/1\n"},
+		{"duplicate name", "vehicles:\n  - name: alpha\n  - name: alpha\n"},
+		{"duplicate id", "vehicles:\n  - name: alpha\n    id: 1\n  - name: bravo\n    id: 1\n"},
+		{"bad source", "vehicles:\n  - name: alpha\n    sources: [10.0.0]\n"},
+		{"vehicle_id without vehicles", "telemetry_packets:\n  - name: Packet\n    port: 10000\n    vehicle_id: VehicleID\n    measurements: [VehicleID]\n"},
+		{"vehicle_id not in packet", "vehicles:\n  - name: alpha\ntelemetry_packets:\n  - name: Packet\n    port: 10000\n    vehicle_id: VehicleID\n    measurements: [Altitude]\n"},
+		{"float vehicle_id", "vehicles:\n  - name: alpha\ntelemetry_packets:\n  - name: Packet\n    port: 10000\n    vehicle_id: Altitude\n    measurements: [Altitude]\n"},
+	}
+
+	for _, tt := range tests {
+		test.Run(tt.name, func(test *testing.T) {
+			test.Cleanup(resetState)
+			if _, err := ParseConfigBytes([]byte(vehicleTestConfig + tt.config)); err == nil {
+				test.Errorf("Expected error, got nil")
+			}
+		})
+	}
+}
+
+// vehicleTestPacket loads a packet from vehicles.yaml onto a free port.
+func vehicleTestPacket(test *testing.T, index int) tlm.TelemetryPacket {
+	test.Helper()
+	config, err := ParseConfig(TestDataDir + "vehicles.yaml")
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	packet := config.TelemetryPackets[index]
+	packet.Port = freePort(test)
+	return packet
+}
+
+// startVehiclePacketWriter runs TelemetryPacketWriter and returns readers for each of its vehicle rings and its output.
+func startVehiclePacketWriter(test *testing.T, packet tlm.TelemetryPacket) (map[string]ipc.Reader, chan ReceivedPacket) {
+	test.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan ReceivedPacket, 16)
+	errs := make(chan error, 1)
+	shmDir := test.TempDir()
+	go func() {
+		errs <- TelemetryPacketWriter(ctx, packet, out, shmDir)
+	}()
+	test.Cleanup(func() {
+		cancel()
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			test.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	readers := make(map[string]ipc.Reader)
+	for _, vehicle := range ShmVehicles() {
+		readers[vehicle] = waitShmVehicleReader(test, packet, vehicle, shmDir)
+	}
+	waitUDPListening(test, packet.Port)
+	return readers, out
+}
+
+// waitUDPListening waits until a UDP port is in use, so datagrams sent to it aren't lost.
+func waitUDPListening(test *testing.T, port int) {
+	test.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		if err != nil {
+			return
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			test.Fatalf("Nothing listening on UDP port %d", port)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitShmVehicleReader opens a shared memory reader for a vehicle once its writer has created it.
+func waitShmVehicleReader(test *testing.T, packet tlm.TelemetryPacket, vehicle string, shmDir string) ipc.Reader {
+	test.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		reader, err := NewIpcShmReaderForVehicle(packet, vehicle, shmDir)
+		if err == nil {
+			test.Cleanup(reader.Cleanup)
+			return reader
+		}
+		if time.Now().After(deadline) {
+			test.Fatalf("Expected nil, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectReceived waits for the next packet on the writer output and checks its vehicle and data.
+func expectReceived(test *testing.T, out chan ReceivedPacket, vehicle string, data []byte) {
+	test.Helper()
+	select {
+	case received := <-out:
+		if received.Vehicle != vehicle {
+			test.Errorf("Expected vehicle %q, got %q", vehicle, received.Vehicle)
+		}
+		if string(received.Data) != string(data) {
+			test.Errorf("Expected % X, got % X", data, received.Data)
+		}
+	case <-time.After(2 * time.Second):
+		test.Fatalf("Expected packet from vehicle %q", vehicle)
+	}
+}
+
+// sendUDPPacket sends a single datagram from a local address.
+func sendUDPPacket(test *testing.T, from string, port int, data []byte) {
+	test.Helper()
+	conn, err := net.DialUDP("udp4", &net.UDPAddr{IP: net.ParseIP(from)}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(data); err != nil {
+		test.Fatalf("Expected nil, got %v", err)
+	}
+}
+
+func TestVehicleByID(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := vehicleTestPacket(test, 0)
+	readers, out := startVehiclePacketWriter(test, packet)
+
+	tests := []struct {
+		vehicle string
+		data    []byte
+	}{
+		{"alpha", []byte{1, 0, 0, 0, 10}},
+		{"bravo", []byte{2, 0, 0, 0, 20}},
+		{"", []byte{3, 0, 0, 0, 30}},
+	}
+	for _, tt := range tests {
+		// the source address doesn't matter when the packet has a vehicle_id
+		sendUDPPacket(test, "127.0.0.3", packet.Port, tt.data)
+		expectShmPacket(test, readers[tt.vehicle], tt.data)
+		expectReceived(test, out, tt.vehicle, tt.data)
+	}
+}
+
+func TestVehicleBySource(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := vehicleTestPacket(test, 1)
+	readers, out := startVehiclePacketWriter(test, packet)
+
+	tests := []struct {
+		source  string
+		vehicle string
+		data    []byte
+	}{
+		{"127.0.0.2", "alpha", []byte{0, 0, 0, 1}},
+		{"127.0.0.3", "bravo", []byte{0, 0, 0, 2}},
+		{"127.0.0.4", "", []byte{0, 0, 0, 3}},
+	}
+	for _, tt := range tests {
+		sendUDPPacket(test, tt.source, packet.Port, tt.data)
+		expectShmPacket(test, readers[tt.vehicle], tt.data)
+		expectReceived(test, out, tt.vehicle, tt.data)
+	}
+}
+
+// recordingHandler is a db.Handler that records inserted measurement groups.
+type recordingHandler struct {
+	groups chan db.MeasurementGroup
+}
+
+func (h *recordingHandler) Insert(measurements db.MeasurementGroup) error {
+	measurements.Tags = append([]db.Tag(nil), measurements.Tags...)
+	h.groups <- measurements
+	return nil
+}
+
+func (h *recordingHandler) CreateQuery(measurements db.MeasurementGroup) string {
+	return db.CreateQuery(measurements)
+}
+
+func (h *recordingHandler) Close() error {
+	return nil
+}
+
+func TestDatabaseWriterVehicleTag(test *testing.T) {
+	test.Cleanup(resetState)
+	packet := vehicleTestPacket(test, 1)
+	handler := &recordingHandler{groups: make(chan db.MeasurementGroup, 2)}
+	channel := make(chan ReceivedPacket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go DatabaseWriter(ctx, handler, packet, channel)
+
+	channel <- ReceivedPacket{Vehicle: "alpha", Data: []byte{0, 0, 0, 1}}
+	channel <- ReceivedPacket{Data: []byte{0, 0, 0, 2}}
+
+	tagged := <-handler.groups
+	if len(tagged.Tags) != 1 || tagged.Tags[0] != (db.Tag{Key: VehicleTag, Value: "alpha"}) {
+		test.Errorf("Expected vehicle tag alpha, got %v", tagged.Tags)
+	}
+	untagged := <-handler.groups
+	if len(untagged.Tags) != 0 {
+		test.Errorf("Expected no tags, got %v", untagged.Tags)
+	}
+	if untagged.Measurements[0].Value != "2" {
+		test.Errorf("Expected 2, got %s", untagged.Measurements[0].Value)
+	}
+}